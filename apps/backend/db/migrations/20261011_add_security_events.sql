@@ -0,0 +1,23 @@
+-- Migration: Add security event log
+-- Date: 2026-10-11
+--
+-- Persists security-relevant account events (logins, step-up, password and
+-- role changes, token revocation) with client IP, user agent and coarse
+-- geolocation. Rows are purged after SECURITY_EVENT_RETENTION_DAYS.
+
+CREATE TABLE IF NOT EXISTS security_events (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  actor_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  event_type TEXT NOT NULL,
+  outcome TEXT NOT NULL,
+  ip_address INET,
+  user_agent TEXT,
+  country TEXT,
+  city TEXT,
+  details JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_user_created ON security_events (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_security_events_created ON security_events (created_at);
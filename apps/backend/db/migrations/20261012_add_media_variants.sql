@@ -0,0 +1,15 @@
+-- Migration: Add media renditions
+-- Date: 2026-10-12
+--
+-- Each image is stored with smaller renditions (320, 640 and 1280px bounding
+-- boxes) next to the original so clients can fetch a size close to what they
+-- display. Existing media is filled in by scripts/backfill_media_variants.go.
+
+CREATE TABLE IF NOT EXISTS media_variants (
+  media_id UUID NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+  size INT NOT NULL,
+  width INT NOT NULL,
+  height INT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (media_id, size)
+);
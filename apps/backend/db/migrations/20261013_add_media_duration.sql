@@ -0,0 +1,7 @@
+-- Migration: Add video media duration
+-- Date: 2026-10-13
+--
+-- Animated images ('gifv') and videos ('video') are stored as MP4 with a
+-- poster frame. duration_ms is NULL for still images.
+
+ALTER TABLE media ADD COLUMN IF NOT EXISTS duration_ms INT;
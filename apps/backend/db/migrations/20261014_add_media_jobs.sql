@@ -0,0 +1,23 @@
+-- Migration: Add asynchronous media processing
+-- Date: 2026-10-14
+--
+-- Post media uploads are stored as a raw source object and converted by a
+-- worker pool. media.status tracks progress; media_jobs is the work queue,
+-- claimed with FOR UPDATE SKIP LOCKED so any instance can process it.
+-- width/height are 0 until processing finishes.
+
+ALTER TABLE media ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'ready';
+ALTER TABLE media DROP CONSTRAINT IF EXISTS media_status_check;
+ALTER TABLE media ADD CONSTRAINT media_status_check CHECK (status IN ('processing', 'ready', 'failed'));
+
+CREATE TABLE IF NOT EXISTS media_jobs (
+  media_id UUID PRIMARY KEY REFERENCES media(id) ON DELETE CASCADE,
+  source_ext TEXT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  run_after TIMESTAMPTZ NOT NULL DEFAULT now(),
+  locked_until TIMESTAMPTZ,
+  last_error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_jobs_run_after ON media_jobs (run_after, created_at);
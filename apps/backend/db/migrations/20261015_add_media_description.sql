@@ -0,0 +1,17 @@
+-- Migration: Add alt text, focal point and blurhash to media
+-- Date: 2026-10-15
+--
+-- alt_text is set by the owner at upload or later. focus_x/focus_y are the
+-- focal point as fractions of width and height from the top-left corner
+-- (NULL means centered). blurhash is computed when the media is converted.
+
+ALTER TABLE media ADD COLUMN IF NOT EXISTS alt_text TEXT;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS focus_x REAL;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS focus_y REAL;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS blurhash TEXT;
+
+ALTER TABLE media DROP CONSTRAINT IF EXISTS media_focus_check;
+ALTER TABLE media ADD CONSTRAINT media_focus_check CHECK (
+  (focus_x IS NULL AND focus_y IS NULL)
+  OR (focus_x BETWEEN 0 AND 1 AND focus_y BETWEEN 0 AND 1)
+);
@@ -0,0 +1,16 @@
+-- Migration: Add media storage accounting and per-role quotas
+-- Date: 2026-10-16
+--
+-- media.size_bytes is the total size of every stored object of a media item
+-- (original, renditions, poster, or the source while processing). Rows
+-- created before this migration start at 0; run
+-- scripts/backfill_media_sizes.go to fill them in.
+--
+-- roles.media_quota_bytes caps the stored bytes of users with the role. NULL
+-- means unlimited; a user with several roles gets the most generous quota.
+
+ALTER TABLE media ADD COLUMN IF NOT EXISTS size_bytes BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS media_quota_bytes BIGINT;
+
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS roles_media_quota_check;
+ALTER TABLE roles ADD CONSTRAINT roles_media_quota_check CHECK (media_quota_bytes IS NULL OR media_quota_bytes >= 0);
@@ -0,0 +1,23 @@
+-- Migration: Deduplicate processed media into shared blobs
+-- Date: 2026-10-17
+--
+-- Processed outputs are stored once per content hash under blobs/<hash>/ and
+-- shared by every media row with that blob_hash. The reference count of a
+-- blob is the number of media rows pointing at it; the foreign key keeps a
+-- blob row from being deleted while referenced. pinned_until protects a blob
+-- between being stored and its first media row being written. Media created
+-- before this migration keeps its objects under <media id>/ (blob_hash NULL).
+-- media.size_bytes is unchanged: a shared blob counts in full towards the
+-- quota of every user referencing it.
+
+CREATE TABLE IF NOT EXISTS media_blobs (
+  hash TEXT PRIMARY KEY,
+  ext TEXT NOT NULL,
+  pinned_until TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE media ADD COLUMN IF NOT EXISTS blob_hash TEXT REFERENCES media_blobs(hash);
+
+CREATE INDEX IF NOT EXISTS idx_media_blob_hash ON media (blob_hash) WHERE blob_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_media_created ON media (created_at);
@@ -0,0 +1,19 @@
+-- Migration: Add realtime event outbox
+-- Date: 2026-10-18
+--
+-- Realtime events are written in the same transaction as the post, reaction
+-- or moderation change they report, then published to Redis. Rows that were
+-- not published right after commit are retried by the outbox relay on any
+-- instance, claimed with FOR UPDATE SKIP LOCKED; Redis deduplicates retries
+-- by row ID.
+
+CREATE TABLE IF NOT EXISTS realtime_outbox (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  payload JSONB NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  locked_until TIMESTAMPTZ,
+  last_error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_realtime_outbox_created ON realtime_outbox (created_at, id);
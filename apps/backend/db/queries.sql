@@ -11,7 +11,7 @@ RETURNING id, name, created_at;
 -- name: CreateUser :one
 INSERT INTO users (username, terms_version, privacy_version, terms_accepted_at, privacy_accepted_at)
 VALUES ($1, $2, $3, $4, $5)
-RETURNING id, username, display_name, bio, avatar_media_id, created_at, terms_version, privacy_version, terms_accepted_at, privacy_accepted_at;
+RETURNING id, username, display_name, bio, avatar_media_id, created_at, terms_version, privacy_version, terms_accepted_at, privacy_accepted_at, email, email_verified_at;
 
 -- name: GetUserByUsername :one
 SELECT
@@ -152,6 +152,50 @@ SET salt = $2,
 	created_at = now()
 WHERE user_id = $1;
 
+-- name: GetUserEmail :one
+SELECT id, username, email, email_verified_at
+FROM users
+WHERE id = $1;
+
+-- name: SetUserEmail :exec
+UPDATE users
+SET email = sqlc.narg('email'),
+	email_verified_at = NULL
+WHERE id = $1;
+
+-- name: MarkUserEmailVerified :execrows
+UPDATE users
+SET email_verified_at = now()
+WHERE id = $1 AND lower(email) = lower(sqlc.arg('email')::text);
+
+-- name: GetUserByVerifiedEmail :one
+SELECT id, username, email
+FROM users
+WHERE lower(email) = lower(sqlc.arg('email')::text)
+	AND email_verified_at IS NOT NULL;
+
+-- name: CreateAuthToken :exec
+INSERT INTO auth_tokens (user_id, purpose, token_hash, email, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ConsumeAuthToken :one
+UPDATE auth_tokens
+SET used_at = now()
+WHERE token_hash = $1
+	AND purpose = $2
+	AND used_at IS NULL
+	AND expires_at > now()
+RETURNING user_id, email;
+
+-- name: InvalidateAuthTokens :exec
+UPDATE auth_tokens
+SET used_at = now()
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL;
+
+-- name: DeleteExpiredAuthTokens :execrows
+DELETE FROM auth_tokens
+WHERE expires_at < now() - interval '7 days';
+
 -- name: DeleteUserByID :exec
 DELETE FROM users
 WHERE id = $1;
@@ -193,19 +237,88 @@ WHERE id = $1
 RETURNING id, deleted_at;
 
 -- name: CreateMedia :one
-INSERT INTO media (id, user_id, type, ext, width, height)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, user_id, type, ext, width, height, created_at;
+INSERT INTO media (id, user_id, type, ext, width, height, duration_ms, blurhash, size_bytes, blob_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING id, user_id, type, ext, width, height, duration_ms, alt_text, focus_x, focus_y, blurhash, created_at;
+
+-- name: CreatePendingMedia :one
+INSERT INTO media (id, user_id, type, ext, width, height, status, alt_text, focus_x, focus_y, size_bytes)
+VALUES ($1, $2, $3, $4, 0, 0, 'processing', $5, $6, $7, $8)
+RETURNING id, user_id, type, ext, width, height, duration_ms, alt_text, focus_x, focus_y, blurhash, created_at;
+
+-- name: GetMediaStatusByID :one
+SELECT id, user_id, type, ext, width, height, duration_ms, alt_text, focus_x, focus_y, blurhash, status, created_at
+FROM media
+WHERE id = $1;
+
+-- name: UpdateMediaDescription :one
+UPDATE media
+SET alt_text = $3, focus_x = $4, focus_y = $5
+WHERE id = $1
+	AND user_id = $2
+	AND deleted_at IS NULL
+RETURNING id, user_id, type, ext, width, height, duration_ms, alt_text, focus_x, focus_y, blurhash, status, created_at;
+
+-- name: CountUnreadyMediaByIDs :one
+SELECT
+	COUNT(*) FILTER (WHERE status = 'processing')::int AS processing,
+	COUNT(*) FILTER (WHERE status = 'failed')::int AS failed
+FROM media
+WHERE id = ANY($1::uuid[]);
+
+-- name: CompleteMediaProcessing :one
+UPDATE media
+SET type = $2, ext = $3, width = $4, height = $5, duration_ms = $6, blurhash = $7, size_bytes = $8, blob_hash = $9, status = 'ready'
+WHERE id = $1
+	AND status = 'processing'
+RETURNING id, user_id, type, ext, width, height, duration_ms, alt_text, focus_x, focus_y, blurhash, created_at;
+
+-- name: FailMediaProcessing :exec
+UPDATE media
+SET status = 'failed', size_bytes = 0
+WHERE id = $1
+	AND status = 'processing';
+
+-- name: EnqueueMediaJob :exec
+INSERT INTO media_jobs (media_id, source_ext)
+VALUES ($1, $2);
+
+-- name: ClaimMediaJob :one
+UPDATE media_jobs j
+SET attempts = j.attempts + 1,
+	locked_until = now() + sqlc.arg('lease_seconds')::int * interval '1 second'
+FROM media m
+WHERE j.media_id = (
+		SELECT media_id FROM media_jobs
+		WHERE run_after <= now()
+			AND (locked_until IS NULL OR locked_until < now())
+		ORDER BY run_after ASC, created_at ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	AND m.id = j.media_id
+RETURNING j.media_id, j.source_ext, j.attempts, m.user_id;
+
+-- name: RetryMediaJob :exec
+UPDATE media_jobs
+SET run_after = now() + sqlc.arg('delay_seconds')::int * interval '1 second',
+	locked_until = NULL,
+	last_error = $2
+WHERE media_id = $1;
+
+-- name: DeleteMediaJob :exec
+DELETE FROM media_jobs
+WHERE media_id = $1;
 
 -- name: CountOwnedMediaByIDs :one
 SELECT COUNT(*)::int
 FROM media
 WHERE user_id = $1
 	AND id = ANY($2::uuid[])
-	AND type = 'image';
+	AND type IN ('image', 'video', 'gifv');
 
 -- name: GetMediaByID :one
-SELECT id, user_id, type, ext, width, height, created_at
+SELECT id, user_id, type, ext, width, height, created_at, blob_hash
 FROM media
 WHERE id = $1;
 
@@ -213,6 +326,130 @@ WHERE id = $1;
 DELETE FROM media
 WHERE id = $1;
 
+-- name: UpsertMediaVariant :exec
+INSERT INTO media_variants (media_id, size, width, height)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (media_id, size) DO UPDATE
+SET width = EXCLUDED.width, height = EXCLUDED.height;
+
+-- name: ListMediaVariants :many
+SELECT media_id, size, width, height
+FROM media_variants
+WHERE media_id = $1
+ORDER BY size ASC;
+
+-- name: ListMediaVariantsByMediaIDs :many
+SELECT media_id, size, width, height
+FROM media_variants
+WHERE media_id = ANY($1::uuid[])
+ORDER BY media_id ASC, size ASC;
+
+-- name: ListMediaForVariantBackfill :many
+SELECT id, ext, width, height, blob_hash
+FROM media
+WHERE id > $1
+	AND deleted_at IS NULL
+	AND type IN ('image', 'avatar')
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: AddMediaSizeBytes :exec
+UPDATE media
+SET size_bytes = size_bytes + $2
+WHERE id = $1;
+
+-- name: SetMediaSizeBytes :exec
+UPDATE media
+SET size_bytes = $2
+WHERE id = $1;
+
+-- name: ListMediaForSizeBackfill :many
+SELECT id, ext, width, height, blob_hash
+FROM media
+WHERE id > $1
+	AND size_bytes = 0
+	AND status = 'ready'
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: GetUserMediaUsage :one
+SELECT COUNT(*) AS media_count, COALESCE(SUM(size_bytes), 0)::bigint AS used_bytes
+FROM media
+WHERE user_id = $1
+	AND deleted_at IS NULL;
+
+-- name: ListUserRoleMediaQuotas :many
+-- One row per role of the user; NULL quota means unlimited.
+SELECT r.media_quota_bytes
+FROM user_roles ur
+JOIN roles r ON r.id = ur.role_id
+WHERE ur.user_id = $1;
+
+-- name: PinMediaBlob :exec
+-- Creates the blob row or extends its pin. It waits for a concurrent
+-- DeleteUnreferencedMediaBlob of the same hash to finish.
+INSERT INTO media_blobs (hash, ext, pinned_until)
+VALUES ($1, $2, now() + sqlc.arg('pin_seconds')::int * interval '1 second')
+ON CONFLICT (hash) DO UPDATE
+SET pinned_until = GREATEST(media_blobs.pinned_until, EXCLUDED.pinned_until);
+
+-- name: DeleteUnreferencedMediaBlob :one
+-- Deletes the blob row if no media references it and its pin has expired.
+-- The row stays locked until the transaction ends, so the caller removes the
+-- objects before committing.
+DELETE FROM media_blobs b
+WHERE b.hash = $1
+	AND b.pinned_until < now()
+	AND NOT EXISTS (SELECT 1 FROM media m WHERE m.blob_hash = b.hash)
+RETURNING b.hash, b.ext;
+
+-- name: ListUnreferencedMediaBlobs :many
+SELECT b.hash
+FROM media_blobs b
+WHERE b.hash > $1
+	AND b.pinned_until < now()
+	AND NOT EXISTS (SELECT 1 FROM media m WHERE m.blob_hash = b.hash)
+ORDER BY b.hash ASC
+LIMIT $2;
+
+-- name: ListExistingMediaBlobHashes :many
+SELECT hash
+FROM media_blobs
+WHERE hash = ANY($1::text[]);
+
+-- name: ListOrphanMedia :many
+-- Media that is not attached to a post, not an avatar and not the server
+-- icon, and was created before the cutoff. Processing media is left to the
+-- job queue.
+SELECT m.id
+FROM media m
+WHERE m.id > $1
+	AND m.created_at < sqlc.arg('created_before')
+	AND m.status <> 'processing'
+	AND NOT EXISTS (SELECT 1 FROM post_media pm WHERE pm.media_id = m.id)
+	AND NOT EXISTS (SELECT 1 FROM users u WHERE u.avatar_media_id = m.id)
+	AND m.id IS DISTINCT FROM sqlc.narg('server_icon_media_id')::uuid
+ORDER BY m.id ASC
+LIMIT $2;
+
+-- name: LockMediaByID :one
+SELECT id
+FROM media
+WHERE id = $1
+FOR UPDATE;
+
+-- name: DeleteOrphanMedia :one
+-- Re-checks the ListOrphanMedia conditions; run after LockMediaByID in the
+-- same transaction so a concurrent attach is either seen or fails.
+DELETE FROM media m
+WHERE m.id = $1
+	AND m.created_at < sqlc.arg('created_before')
+	AND m.status <> 'processing'
+	AND NOT EXISTS (SELECT 1 FROM post_media pm WHERE pm.media_id = m.id)
+	AND NOT EXISTS (SELECT 1 FROM users u WHERE u.avatar_media_id = m.id)
+	AND m.id IS DISTINCT FROM sqlc.narg('server_icon_media_id')::uuid
+RETURNING m.id, m.ext, m.blob_hash;
+
 -- name: IsMediaAttachedToPost :one
 SELECT EXISTS(
 	SELECT 1 FROM post_media WHERE media_id = $1
@@ -240,12 +477,16 @@ SELECT
 	m.ext,
 	m.width,
 	m.height,
+	m.duration_ms,
+	m.alt_text,
+	m.focus_x,
+	m.focus_y,
+	m.blurhash,
 	m.created_at,
 	pm.sort_order
 FROM post_media pm
 JOIN media m ON m.id = pm.media_id
 WHERE pm.post_id = $1
-	AND m.type = 'image'
 ORDER BY pm.sort_order ASC, m.created_at ASC, m.id ASC
 LIMIT 4;
 
@@ -258,12 +499,16 @@ SELECT
 	m.ext,
 	m.width,
 	m.height,
+	m.duration_ms,
+	m.alt_text,
+	m.focus_x,
+	m.focus_y,
+	m.blurhash,
 	m.created_at,
 	pm.sort_order
 FROM post_media pm
 JOIN media m ON m.id = pm.media_id
 WHERE pm.post_id = ANY($1::uuid[])
-	AND m.type = 'image'
 ORDER BY pm.post_id ASC, pm.sort_order ASC, m.created_at ASC, m.id ASC;
 
 -- name: ListTimelinePosts :many
@@ -939,7 +1184,8 @@ SELECT
 SELECT
   (SELECT COUNT(*) FROM users) AS total_users,
   (SELECT COUNT(*) FROM posts WHERE deleted_at IS NULL) AS total_posts,
-  (SELECT COUNT(*) FROM media WHERE deleted_at IS NULL) AS total_media;
+  (SELECT COUNT(*) FROM media WHERE deleted_at IS NULL) AS total_media,
+  (SELECT COALESCE(SUM(size_bytes), 0) FROM media WHERE deleted_at IS NULL)::bigint AS total_media_bytes;
 
 -- ==================== Admin Post Management ====================
 
@@ -999,10 +1245,15 @@ WHERE (sqlc.narg('user_id')::uuid IS NULL OR m.user_id = sqlc.narg('user_id'))
        OR (sqlc.narg('deleted') = true AND m.deleted_at IS NOT NULL)
        OR (sqlc.narg('deleted') = false AND m.deleted_at IS NULL));
 
--- name: AdminDeleteMedia :exec
-UPDATE media
+-- name: AdminDeleteMedia :one
+UPDATE media m
 SET deleted_at = NOW(), deleted_by = $2, deletion_reason = $3
-WHERE id = $1;
+WHERE m.id = $1
+RETURNING m.user_id, EXISTS(
+	SELECT 1 FROM post_media pm
+	JOIN posts p ON p.id = pm.post_id
+	WHERE pm.media_id = m.id AND p.deleted_at IS NULL AND p.visibility = 'public'
+) AS on_visible_post;
 
 -- ==================== Admin Profile Management ====================
 
@@ -1196,18 +1447,19 @@ WHERE document_type = $1
 -- -----------------------------------------------------
 
 -- name: GetRoleByID :one
-SELECT id, name, description
+SELECT id, name, description, media_quota_bytes
 FROM roles
 WHERE id = $1;
 
 -- name: CreateRole :exec
-INSERT INTO roles (id, name, description)
-VALUES ($1, $2, $3);
+INSERT INTO roles (id, name, description, media_quota_bytes)
+VALUES ($1, $2, $3, $4);
 
 -- name: UpdateRole :exec
 UPDATE roles
 SET name = COALESCE($2, name),
-    description = COALESCE($3, description)
+    description = COALESCE($3, description),
+    media_quota_bytes = $4
 WHERE id = $1;
 
 -- name: DeleteRole :exec
@@ -1294,3 +1546,180 @@ SET
     ELSE privacy_accepted_at 
   END
 WHERE id = ANY(sqlc.arg('user_ids')::uuid[]);
+
+-- name: CreateNotification :one
+INSERT INTO notifications (user_id, type, data)
+VALUES ($1, $2, $3)
+RETURNING id, user_id, type, data, created_at, read_at;
+
+-- name: ListNotificationsByUser :many
+SELECT id, user_id, type, data, created_at, read_at
+FROM notifications
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2;
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*)
+FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationRead :execrows
+UPDATE notifications
+SET read_at = COALESCE(read_at, now())
+WHERE id = $1 AND user_id = $2;
+
+-- -----------------------------------------------------
+-- OAuth2 / OpenID Connect provider
+-- -----------------------------------------------------
+
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, allowed_scopes, created_by)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, name, secret_hash, redirect_uris, allowed_scopes, created_by, created_at, disabled_at;
+
+-- name: GetOAuthClient :one
+SELECT id, name, secret_hash, redirect_uris, allowed_scopes, created_by, created_at, disabled_at
+FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT id, name, secret_hash, redirect_uris, allowed_scopes, created_by, created_at, disabled_at
+FROM oauth_clients
+ORDER BY created_at DESC, id;
+
+-- name: DisableOAuthClient :execrows
+UPDATE oauth_clients
+SET disabled_at = COALESCE(disabled_at, now())
+WHERE id = $1;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope, code_challenge, nonce, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+-- Marks a code as used and returns it. Expired and already-used codes yield no rows.
+UPDATE oauth_authorization_codes
+SET used_at = now()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > now()
+RETURNING client_id, user_id, redirect_uri, scope, code_challenge, nonce;
+
+-- name: DeleteExpiredOAuthAuthorizationCodes :execrows
+DELETE FROM oauth_authorization_codes
+WHERE expires_at <= now();
+
+-- name: GetOAuthConsent :one
+SELECT user_id, client_id, scope, granted_at
+FROM oauth_consents
+WHERE user_id = $1 AND client_id = $2;
+
+-- name: UpsertOAuthConsent :exec
+INSERT INTO oauth_consents (user_id, client_id, scope, granted_at)
+VALUES ($1, $2, $3, now())
+ON CONFLICT (user_id, client_id) DO UPDATE
+SET scope = EXCLUDED.scope, granted_at = EXCLUDED.granted_at;
+
+-- name: ListOAuthConsentsByUser :many
+SELECT c.client_id, c.scope, c.granted_at, oc.name AS client_name
+FROM oauth_consents c
+JOIN oauth_clients oc ON oc.id = c.client_id
+WHERE c.user_id = $1
+ORDER BY c.granted_at DESC;
+
+-- name: DeleteOAuthConsent :execrows
+DELETE FROM oauth_consents
+WHERE user_id = $1 AND client_id = $2;
+
+-- name: CreateOAuthAccessToken :exec
+INSERT INTO oauth_access_tokens (jti, client_id, user_id, scope, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetOAuthAccessToken :one
+SELECT jti, client_id, user_id, scope, expires_at, revoked_at, created_at
+FROM oauth_access_tokens
+WHERE jti = $1;
+
+-- name: RevokeOAuthAccessToken :execrows
+UPDATE oauth_access_tokens
+SET revoked_at = COALESCE(revoked_at, now())
+WHERE jti = $1 AND client_id = $2;
+
+-- name: RevokeOAuthAccessTokensForGrant :many
+-- Revokes all live tokens a user granted to a client and returns them so the
+-- caller can propagate revocation to the token cache.
+UPDATE oauth_access_tokens
+SET revoked_at = now()
+WHERE user_id = $1 AND client_id = $2 AND revoked_at IS NULL AND expires_at > now()
+RETURNING jti, expires_at;
+
+-- name: RevokeOAuthAccessTokensForClient :many
+UPDATE oauth_access_tokens
+SET revoked_at = now()
+WHERE client_id = $1 AND revoked_at IS NULL AND expires_at > now()
+RETURNING jti, expires_at;
+
+-- name: DeleteExpiredOAuthAccessTokens :execrows
+DELETE FROM oauth_access_tokens
+WHERE expires_at <= now();
+
+-- -----------------------------------------------------
+-- Security event log
+-- -----------------------------------------------------
+
+-- name: CreateSecurityEvent :exec
+INSERT INTO security_events (user_id, actor_user_id, event_type, outcome, ip_address, user_agent, country, city, details)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+
+-- name: ListSecurityEventsByUser :many
+SELECT id, user_id, actor_user_id, event_type, outcome, ip_address, user_agent, country, city, details, created_at
+FROM security_events
+WHERE user_id = sqlc.arg('user_id')
+	AND (
+		sqlc.narg('cursor_time')::timestamptz IS NULL
+		OR created_at < sqlc.narg('cursor_time')
+		OR (created_at = sqlc.narg('cursor_time') AND id < sqlc.narg('cursor_id'))
+	)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: DeleteSecurityEventsBefore :execrows
+DELETE FROM security_events
+WHERE created_at < $1;
+
+-- name: EnqueueRealtimeEvent :one
+INSERT INTO realtime_outbox (payload)
+VALUES ($1)
+RETURNING id;
+
+-- name: ClaimRealtimeOutbox :many
+UPDATE realtime_outbox o
+SET locked_until = now() + sqlc.arg('lease_seconds')::int * interval '1 second'
+WHERE o.id IN (
+		SELECT id FROM realtime_outbox
+		WHERE created_at <= now() - sqlc.arg('grace_seconds')::int * interval '1 second'
+			AND (locked_until IS NULL OR locked_until < now())
+		ORDER BY created_at ASC, id ASC
+		LIMIT sqlc.arg('batch_size')
+		FOR UPDATE SKIP LOCKED
+	)
+RETURNING o.id, o.payload, o.attempts, o.created_at;
+
+-- name: DeleteRealtimeOutboxEvent :exec
+DELETE FROM realtime_outbox
+WHERE id = $1;
+
+-- name: FailRealtimeOutboxEvent :exec
+UPDATE realtime_outbox
+SET attempts = attempts + 1,
+	last_error = $2
+WHERE id = $1;
+
+-- name: ReleaseRealtimeOutboxEvents :exec
+UPDATE realtime_outbox
+SET locked_until = NULL
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: GetRealtimeOutboxStats :one
+SELECT COUNT(*)::int AS pending,
+	COALESCE(EXTRACT(EPOCH FROM now() - MIN(created_at)), 0)::bigint AS oldest_age_seconds
+FROM realtime_outbox;
@@ -19,9 +19,14 @@ CREATE TABLE IF NOT EXISTS users (
   terms_version INT NOT NULL DEFAULT 0,
   privacy_version INT NOT NULL DEFAULT 0,
   terms_accepted_at TIMESTAMPTZ,
-  privacy_accepted_at TIMESTAMPTZ
+  privacy_accepted_at TIMESTAMPTZ,
+  email TEXT,
+  email_verified_at TIMESTAMPTZ
 );
 
+-- Email addresses are optional but unique (case-insensitive) when present.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email)) WHERE email IS NOT NULL;
+
 CREATE TABLE IF NOT EXISTS auth_credentials (
   user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
   salt BYTEA NOT NULL,
@@ -31,12 +36,32 @@ CREATE TABLE IF NOT EXISTS auth_credentials (
   created_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
+-- Single-use tokens for email verification and password reset.
+-- Only the SHA-256 hash of the token is stored.
+CREATE TABLE IF NOT EXISTS auth_tokens (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  purpose TEXT NOT NULL,
+  token_hash BYTEA NOT NULL UNIQUE,
+  email TEXT,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (purpose IN ('email_verify', 'password_reset'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_user_purpose ON auth_tokens (user_id, purpose);
+
 CREATE TYPE permission_effect AS ENUM ('allow', 'deny');
 
 CREATE TABLE IF NOT EXISTS roles (
   id TEXT PRIMARY KEY,
   name TEXT NOT NULL,
-  description TEXT NOT NULL DEFAULT ''
+  description TEXT NOT NULL DEFAULT '',
+  -- Stored media bytes allowed per user; NULL is unlimited. Users with
+  -- several roles get the most generous quota.
+  media_quota_bytes BIGINT,
+  CONSTRAINT roles_media_quota_check CHECK (media_quota_bytes IS NULL OR media_quota_bytes >= 0)
 );
 
 CREATE TABLE IF NOT EXISTS permissions (
@@ -91,7 +116,19 @@ CREATE TABLE IF NOT EXISTS posts (
   CHECK (visibility IN ('public', 'hidden', 'deleted'))
 );
 
--- Uploaded media (currently images only). Stored on disk as WebP.
+-- Content-addressed storage of processed media. Identical outputs are stored
+-- once under blobs/<hash>/ and shared by every media row with that blob_hash;
+-- a blob is referenced by as many media rows as point at it. pinned_until
+-- keeps a freshly stored blob alive until its first media row is written.
+CREATE TABLE IF NOT EXISTS media_blobs (
+  hash TEXT PRIMARY KEY,
+  ext TEXT NOT NULL,
+  pinned_until TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Uploaded media. Images and avatars are stored as WebP; videos and animated
+-- images ('video', 'gifv') as MP4 with a WebP poster frame.
 CREATE TABLE IF NOT EXISTS media (
   id UUID PRIMARY KEY,
   user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -103,7 +140,26 @@ CREATE TABLE IF NOT EXISTS media (
   deleted_at TIMESTAMPTZ,
   deleted_by UUID REFERENCES users(id) ON DELETE SET NULL,
   deletion_reason TEXT,
-  phash TEXT
+  phash TEXT,
+  duration_ms INT,
+  -- Post media is converted asynchronously; width/height are 0 until ready.
+  status TEXT NOT NULL DEFAULT 'ready',
+  alt_text TEXT,
+  -- Focal point as fractions from the top-left corner; NULL means centered.
+  focus_x REAL,
+  focus_y REAL,
+  blurhash TEXT,
+  -- Total bytes of every stored object (original, renditions, poster, or the
+  -- source while processing). A shared blob counts in full for each media row.
+  size_bytes BIGINT NOT NULL DEFAULT 0,
+  -- Shared blob holding the processed objects; NULL for media stored under
+  -- its own ID (uploads from before deduplication, or still processing).
+  blob_hash TEXT REFERENCES media_blobs(hash),
+  CHECK (status IN ('processing', 'ready', 'failed')),
+  CONSTRAINT media_focus_check CHECK (
+    (focus_x IS NULL AND focus_y IS NULL)
+    OR (focus_x BETWEEN 0 AND 1 AND focus_y BETWEEN 0 AND 1)
+  )
 );
 
 -- Avatar foreign key (must be added after media table exists).
@@ -112,6 +168,32 @@ CREATE TABLE IF NOT EXISTS media (
 -- In production, ensure migrations handle this properly.
 
 CREATE INDEX IF NOT EXISTS idx_media_user_created ON media (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_media_blob_hash ON media (blob_hash) WHERE blob_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_media_created ON media (created_at);
+
+-- Media processing queue. Rows are claimed with FOR UPDATE SKIP LOCKED and a
+-- lease (locked_until) so a crashed worker's job is retried by another.
+CREATE TABLE IF NOT EXISTS media_jobs (
+  media_id UUID PRIMARY KEY REFERENCES media(id) ON DELETE CASCADE,
+  source_ext TEXT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  run_after TIMESTAMPTZ NOT NULL DEFAULT now(),
+  locked_until TIMESTAMPTZ,
+  last_error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_jobs_run_after ON media_jobs (run_after, created_at);
+
+-- Downscaled renditions of an image, keyed by bounding-box edge.
+CREATE TABLE IF NOT EXISTS media_variants (
+  media_id UUID NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+  size INT NOT NULL,
+  width INT NOT NULL,
+  height INT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (media_id, size)
+);
 
 -- Post attachments (ordered).
 CREATE TABLE IF NOT EXISTS post_media (
@@ -270,6 +352,96 @@ CREATE TABLE IF NOT EXISTS agreement_documents (
   UNIQUE(document_type, version, language)
 );
 
+-- Per-user notification inbox
+CREATE TABLE IF NOT EXISTS notifications (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  type TEXT NOT NULL,
+  data JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  read_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications (user_id, created_at DESC);
+
+-- OAuth2 / OpenID Connect provider. Client secrets and authorization codes are
+-- stored as SHA-256 hashes; access tokens are JWTs tracked by jti.
+CREATE TABLE IF NOT EXISTS oauth_clients (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  secret_hash BYTEA,
+  redirect_uris TEXT[] NOT NULL,
+  allowed_scopes TEXT NOT NULL,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  disabled_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+  code_hash BYTEA PRIMARY KEY,
+  client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  redirect_uri TEXT NOT NULL,
+  scope TEXT NOT NULL,
+  code_challenge TEXT NOT NULL,
+  nonce TEXT,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+  scope TEXT NOT NULL,
+  granted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (user_id, client_id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_access_tokens (
+  jti TEXT PRIMARY KEY,
+  client_id TEXT NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  scope TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_access_tokens_user_client ON oauth_access_tokens (user_id, client_id);
+
+-- Security event log (logins, step-up, password/role changes, token revocation).
+-- actor_user_id is set when someone other than the owner caused the event.
+CREATE TABLE IF NOT EXISTS security_events (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  actor_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  event_type TEXT NOT NULL,
+  outcome TEXT NOT NULL,
+  ip_address INET,
+  user_agent TEXT,
+  country TEXT,
+  city TEXT,
+  details JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_user_created ON security_events (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_security_events_created ON security_events (created_at);
+
+-- Realtime events written in the transaction of the change they report.
+-- Rows are deleted once published; the outbox relay retries the rest.
+CREATE TABLE IF NOT EXISTS realtime_outbox (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  payload JSONB NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  locked_until TIMESTAMPTZ,
+  last_error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_realtime_outbox_created ON realtime_outbox (created_at, id);
+
 -- ============================================================================
 -- INITIAL DATA
 -- ============================================================================
@@ -339,7 +511,10 @@ INSERT INTO permissions (id, name, description) VALUES
   ('admin:moderation:view_reports', 'Admin moderation view reports', 'View reports and report details'),
   
   -- Moderation - Logs
-  ('admin:moderation:view_logs', 'Admin moderation view logs', 'View moderation logs')
+  ('admin:moderation:view_logs', 'Admin moderation view logs', 'View moderation logs'),
+  
+  -- OAuth client applications
+  ('admin:oauth:manage', 'Admin OAuth manage', 'Register and disable OAuth client applications')
 ON CONFLICT (id) DO NOTHING;
 
 -- Grant permissions to user role
@@ -14,7 +14,10 @@ type User struct {
 
 type contextKey int
 
-const userContextKey contextKey = 1
+const (
+	userContextKey contextKey = iota + 1
+	tokenScopesContextKey
+)
 
 var ErrUnauthorized = errors.New("unauthorized")
 
@@ -34,3 +37,26 @@ func RequireUser(ctx context.Context) (User, error) {
 	}
 	return user, nil
 }
+
+// WithTokenScopes marks the request as authenticated by a delegated (OAuth)
+// token that is limited to scopes.
+func WithTokenScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, tokenScopesContextKey, scopes)
+}
+
+// TokenScopesFromContext returns the scopes of a delegated token. ok is false
+// for first-party sessions, which are not scope-limited.
+func TokenScopesFromContext(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(tokenScopesContextKey).([]string)
+	return scopes, ok
+}
+
+// HasScope reports whether scope is in scopes.
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -12,7 +12,7 @@ import (
 )
 
 type TokenManager struct {
-	secret    []byte
+	keys      *Keyring
 	ttl       time.Duration
 	stepupTTL time.Duration
 	redis     *redis.Client
@@ -22,17 +22,111 @@ type Claims struct {
 	UserID    string `json:"uid"`
 	Username  string `json:"usr"`
 	TokenType string `json:"token_type,omitempty"`
+
+	// Scope and ClientID are set on delegated OAuth access tokens only.
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
 const (
 	tokenTypeAccess  = "access"
 	tokenTypeStepup  = "stepup"
+	tokenTypeOAuth   = "oauth"
 	defaultStepupTTL = 5 * time.Minute
 )
 
+// DefaultKeyID is the key ID used when a single JWT_SECRET is configured.
+const DefaultKeyID = "default"
+
 func NewTokenManager(secret []byte, ttl time.Duration) *TokenManager {
-	return &TokenManager{secret: secret, ttl: ttl, stepupTTL: defaultStepupTTL, redis: nil}
+	return NewTokenManagerWithKeyring(NewHMACKeyring(DefaultKeyID, secret), ttl)
+}
+
+// NewTokenManagerWithKeyring signs with the keyring's active key and verifies
+// against any of its non-retired keys. The keyring may be rotated at runtime.
+func NewTokenManagerWithKeyring(keys *Keyring, ttl time.Duration) *TokenManager {
+	return &TokenManager{keys: keys, ttl: ttl, stepupTTL: defaultStepupTTL, redis: nil}
+}
+
+// Keyring returns the keys used to sign and verify tokens.
+func (m *TokenManager) Keyring() *Keyring {
+	return m.keys
+}
+
+// JWKS returns the public verification keys for other services.
+func (m *TokenManager) JWKS() JWKSet {
+	return m.keys.JWKS(time.Now())
+}
+
+// SigningAlg returns the JWS algorithm of the active signing key.
+func (m *TokenManager) SigningAlg() string {
+	return m.keys.Active().Alg
+}
+
+// SignClaims signs arbitrary claims (e.g. an OpenID Connect ID token) with the
+// active key.
+func (m *TokenManager) SignClaims(claims jwt.Claims) (string, error) {
+	return m.sign(claims)
+}
+
+func (m *TokenManager) sign(claims jwt.Claims) (string, error) {
+	key := m.keys.Active()
+	var (
+		method jwt.SigningMethod
+		secret interface{}
+	)
+	switch key.Alg {
+	case AlgHS256:
+		method, secret = jwt.SigningMethodHS256, key.Secret
+	case AlgEdDSA:
+		method, secret = jwt.SigningMethodEdDSA, key.PrivateKey
+	default:
+		return "", errors.New("no usable signing key")
+	}
+	jwtToken := jwt.NewWithClaims(method, claims)
+	jwtToken.Header["kid"] = key.ID
+	return jwtToken.SignedString(secret)
+}
+
+// verificationKey selects the key named by the token's kid header and checks
+// that the token's alg matches it. Tokens without a kid predate key rotation
+// and are checked against the HS256 keys only.
+func (m *TokenManager) verificationKey(t *jwt.Token) (interface{}, error) {
+	now := time.Now()
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		set := jwt.VerificationKeySet{}
+		for _, k := range m.keys.LegacyHMAC(now) {
+			set.Keys = append(set.Keys, k.Secret)
+		}
+		if len(set.Keys) == 0 {
+			return nil, errors.New("unknown signing key")
+		}
+		return set, nil
+	}
+
+	key, ok := m.keys.Lookup(kid, now)
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	switch key.Alg {
+	case AlgHS256:
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.Secret, nil
+	case AlgEdDSA:
+		if t.Method != jwt.SigningMethodEdDSA {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.PublicKey, nil
+	default:
+		return nil, errors.New("unexpected signing method")
+	}
 }
 
 // SetRedis sets the Redis client for token revocation functionality
@@ -69,8 +163,7 @@ func (m *TokenManager) Issue(user User) (token string, expiresInSeconds int, err
 		},
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := jwtToken.SignedString(m.secret)
+	signed, err := m.sign(claims)
 	if err != nil {
 		return "", 0, err
 	}
@@ -101,8 +194,7 @@ func (m *TokenManager) IssueStepup(user User) (token string, expiresInSeconds in
 		},
 	}
 
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := jwtToken.SignedString(m.secret)
+	signed, err := m.sign(claims)
 	if err != nil {
 		return "", 0, err
 	}
@@ -114,12 +206,7 @@ func (m *TokenManager) Parse(token string) (User, error) {
 		return User{}, ErrUnauthorized
 	}
 
-	parsed, err := jwt.ParseWithClaims(token, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, errors.New("unexpected signing method")
-		}
-		return m.secret, nil
-	})
+	parsed, err := jwt.ParseWithClaims(token, &Claims{}, m.verificationKey)
 	if err != nil {
 		return User{}, ErrUnauthorized
 	}
@@ -142,24 +229,135 @@ func (m *TokenManager) Parse(token string) (User, error) {
 		return User{}, ErrUnauthorized
 	}
 
-	// Check if the token has been revoked (if Redis is available)
-	if m.redis != nil && claims.IssuedAt != nil {
-		ctx := context.Background()
-		key := "token:revoke:" + claims.UserID
-		revokedAfter, err := m.redis.Get(ctx, key).Result()
-		if err == nil && revokedAfter != "" {
-			// Parse the revocation time
-			revokedTime, err := time.Parse(time.RFC3339, revokedAfter)
-			if err == nil {
-				// If token was issued before the revocation time, reject it
-				if claims.IssuedAt.Time.Before(revokedTime) {
-					return User{}, ErrUnauthorized
-				}
+	if m.revoked(claims) {
+		return User{}, ErrUnauthorized
+	}
+
+	return User{ID: uid, Username: claims.Username}, nil
+}
+
+// revoked reports whether all of the user's tokens were invalidated after the
+// token was issued (if Redis is available).
+func (m *TokenManager) revoked(claims *Claims) bool {
+	if m.redis == nil || claims.IssuedAt == nil {
+		return false
+	}
+	ctx := context.Background()
+	key := "token:revoke:" + claims.UserID
+	revokedAfter, err := m.redis.Get(ctx, key).Result()
+	if err == nil && revokedAfter != "" {
+		// Parse the revocation time
+		revokedTime, err := time.Parse(time.RFC3339, revokedAfter)
+		if err == nil {
+			// If token was issued before the revocation time, reject it
+			if claims.IssuedAt.Time.Before(revokedTime) {
+				return true
 			}
 		}
 	}
+	return false
+}
 
-	return User{ID: uid, Username: claims.Username}, nil
+// OAuthToken describes a verified delegated access token.
+type OAuthToken struct {
+	ID        string
+	ClientID  string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// IssueOAuth issues a delegated access token for clientID limited to scopes.
+func (m *TokenManager) IssueOAuth(user User, clientID string, scopes []string, ttl time.Duration) (token string, info OAuthToken, err error) {
+	now := time.Now().UTC()
+	jti, err := RandomToken(18)
+	if err != nil {
+		return "", OAuthToken{}, err
+	}
+	exp := now.Add(ttl)
+	claims := Claims{
+		UserID:    user.ID.String(),
+		Username:  user.Username,
+		TokenType: tokenTypeOAuth,
+		Scope:     strings.Join(scopes, " "),
+		ClientID:  clientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+	signed, err := m.sign(claims)
+	if err != nil {
+		return "", OAuthToken{}, err
+	}
+	return signed, OAuthToken{ID: jti, ClientID: clientID, Scopes: scopes, IssuedAt: now, ExpiresAt: exp}, nil
+}
+
+// ParseOAuth verifies a delegated access token. Tokens revoked individually
+// (see RevokeOAuthToken) or via InvalidateUserTokens are rejected.
+func (m *TokenManager) ParseOAuth(token string) (User, OAuthToken, error) {
+	if token == "" {
+		return User{}, OAuthToken{}, ErrUnauthorized
+	}
+	parsed, err := jwt.ParseWithClaims(token, &Claims{}, m.verificationKey)
+	if err != nil {
+		return User{}, OAuthToken{}, ErrUnauthorized
+	}
+	claims, ok := parsed.Claims.(*Claims)
+	if !ok || !parsed.Valid || claims.TokenType != tokenTypeOAuth {
+		return User{}, OAuthToken{}, ErrUnauthorized
+	}
+	if claims.UserID == "" || claims.Username == "" || claims.ClientID == "" || claims.ID == "" {
+		return User{}, OAuthToken{}, ErrUnauthorized
+	}
+	if claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return User{}, OAuthToken{}, ErrUnauthorized
+	}
+	uid, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return User{}, OAuthToken{}, ErrUnauthorized
+	}
+	if m.revoked(claims) {
+		return User{}, OAuthToken{}, ErrUnauthorized
+	}
+	if m.redis != nil {
+		n, err := m.redis.Exists(context.Background(), "oauth:revoke:"+claims.ID).Result()
+		if err == nil && n > 0 {
+			return User{}, OAuthToken{}, ErrUnauthorized
+		}
+	}
+	return User{ID: uid, Username: claims.Username}, OAuthToken{
+		ID:        claims.ID,
+		ClientID:  claims.ClientID,
+		Scopes:    strings.Fields(claims.Scope),
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+// IsOAuthToken reports whether token (unverified) is a delegated access token.
+// It only routes the token to the right parser; ParseOAuth does the checks.
+func IsOAuthToken(token string) bool {
+	var claims Claims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &claims); err != nil {
+		return false
+	}
+	return claims.TokenType == tokenTypeOAuth
+}
+
+// RevokeOAuthToken blocks a single delegated token until it would have expired.
+func (m *TokenManager) RevokeOAuthToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if m.redis == nil {
+		return nil
+	}
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return m.redis.Set(ctx, "oauth:revoke:"+jti, "1", ttl).Err()
 }
 
 func (m *TokenManager) ParseStepup(token string) (User, string, time.Time, error) {
@@ -167,12 +365,7 @@ func (m *TokenManager) ParseStepup(token string) (User, string, time.Time, error
 		return User{}, "", time.Time{}, ErrUnauthorized
 	}
 
-	parsed, err := jwt.ParseWithClaims(token, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, errors.New("unexpected signing method")
-		}
-		return m.secret, nil
-	})
+	parsed, err := jwt.ParseWithClaims(token, &Claims{}, m.verificationKey)
 	if err != nil {
 		return User{}, "", time.Time{}, ErrUnauthorized
 	}
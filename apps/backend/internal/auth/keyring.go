@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported signing algorithms (JWS "alg" values).
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one entry of a Keyring.
+//
+// HS256 keys use Secret. EdDSA keys use PrivateKey for signing and PublicKey
+// for verification; a key with only PublicKey is verify-only.
+type SigningKey struct {
+	ID         string
+	Alg        string
+	Secret     []byte
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+
+	// RetireAt stops verification with this key after the given time.
+	// Zero means the key never retires.
+	RetireAt time.Time
+}
+
+func (k SigningKey) canSign() bool {
+	switch k.Alg {
+	case AlgHS256:
+		return len(k.Secret) > 0
+	case AlgEdDSA:
+		return len(k.PrivateKey) == ed25519.PrivateKeySize
+	default:
+		return false
+	}
+}
+
+func (k SigningKey) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// Keyring holds the active signing key and older verify-only keys.
+// It is safe for concurrent use and can be swapped at runtime.
+type Keyring struct {
+	mu     sync.RWMutex
+	active string
+	keys   map[string]SigningKey
+}
+
+// NewKeyring creates a keyring signing with active and accepting verifyOnly keys.
+func NewKeyring(active SigningKey, verifyOnly ...SigningKey) (*Keyring, error) {
+	kr := &Keyring{}
+	if err := kr.set(active.ID, append([]SigningKey{active}, verifyOnly...)); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// NewHMACKeyring creates a keyring with a single HS256 key.
+func NewHMACKeyring(kid string, secret []byte) *Keyring {
+	return &Keyring{
+		active: kid,
+		keys:   map[string]SigningKey{kid: {ID: kid, Alg: AlgHS256, Secret: secret}},
+	}
+}
+
+func (kr *Keyring) set(active string, keys []SigningKey) error {
+	m := make(map[string]SigningKey, len(keys))
+	for _, k := range keys {
+		switch k.Alg {
+		case AlgHS256:
+			if len(k.Secret) == 0 {
+				return fmt.Errorf("key %q: HS256 key requires a secret", k.ID)
+			}
+		case AlgEdDSA:
+			if len(k.PrivateKey) == ed25519.PrivateKeySize && len(k.PublicKey) == 0 {
+				k.PublicKey = k.PrivateKey.Public().(ed25519.PublicKey)
+			}
+			if len(k.PublicKey) != ed25519.PublicKeySize {
+				return fmt.Errorf("key %q: EdDSA key requires a public or private key", k.ID)
+			}
+		default:
+			return fmt.Errorf("key %q: unsupported alg %q", k.ID, k.Alg)
+		}
+		if _, dup := m[k.ID]; dup {
+			return fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		m[k.ID] = k
+	}
+	a, ok := m[active]
+	if !ok {
+		return fmt.Errorf("active key %q not found", active)
+	}
+	if !a.canSign() {
+		return fmt.Errorf("active key %q cannot sign", active)
+	}
+	if !a.RetireAt.IsZero() {
+		return fmt.Errorf("active key %q must not have a retirement time", active)
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.active = active
+	kr.keys = m
+	return nil
+}
+
+// Replace atomically swaps in the keys of other.
+func (kr *Keyring) Replace(other *Keyring) {
+	other.mu.RLock()
+	active, keys := other.active, other.keys
+	other.mu.RUnlock()
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.active = active
+	kr.keys = keys
+}
+
+// Active returns the current signing key.
+func (kr *Keyring) Active() SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.keys[kr.active]
+}
+
+// Lookup returns a non-retired key by ID.
+func (kr *Keyring) Lookup(kid string, now time.Time) (SigningKey, bool) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	k, ok := kr.keys[kid]
+	if !ok || k.retired(now) {
+		return SigningKey{}, false
+	}
+	return k, true
+}
+
+// LegacyHMAC returns the non-retired HS256 keys, active key first. Tokens
+// and messages signed before key IDs were introduced carry no kid and are
+// checked against these.
+func (kr *Keyring) LegacyHMAC(now time.Time) []SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	var out []SigningKey
+	if a, ok := kr.keys[kr.active]; ok && a.Alg == AlgHS256 {
+		out = append(out, a)
+	}
+	for id, k := range kr.keys {
+		if id != kr.active && k.Alg == AlgHS256 && !k.retired(now) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// JWK is a public JSON Web Key (RFC 8037 OKP for Ed25519).
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// JWKSet is the document served at the JWKS endpoint.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of all non-retired EdDSA keys.
+// HMAC secrets are never published.
+func (kr *Keyring) JWKS(now time.Time) JWKSet {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range kr.keys {
+		if k.Alg != AlgEdDSA || k.retired(now) {
+			continue
+		}
+		set.Keys = append(set.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k.PublicKey),
+			Kid: k.ID,
+			Alg: AlgEdDSA,
+			Use: "sig",
+		})
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// keyringFile is the on-disk format read by LoadKeyringFile:
+//
+//	{
+//	  "active": "2026-10",
+//	  "keys": [
+//	    {"kid": "2026-10", "alg": "EdDSA", "private_key": "<base64 32-byte seed>"},
+//	    {"kid": "2026-07", "alg": "EdDSA", "public_key": "<base64>", "retire_at": "2026-11-01T00:00:00Z"},
+//	    {"kid": "legacy",  "alg": "HS256", "secret": "<secret>", "retire_at": "2026-10-20T00:00:00Z"}
+//	  ]
+//	}
+type keyringFile struct {
+	Active string `json:"active"`
+	Keys   []struct {
+		Kid        string     `json:"kid"`
+		Alg        string     `json:"alg"`
+		Secret     string     `json:"secret,omitempty"`
+		PrivateKey string     `json:"private_key,omitempty"`
+		PublicKey  string     `json:"public_key,omitempty"`
+		RetireAt   *time.Time `json:"retire_at,omitempty"`
+	} `json:"keys"`
+}
+
+func decodeKeyMaterial(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// ParseKeyring parses the JSON keyring format.
+func ParseKeyring(data []byte) (*Keyring, error) {
+	var f keyringFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse keyring: %w", err)
+	}
+	if strings.TrimSpace(f.Active) == "" {
+		return nil, errors.New("keyring: active key id required")
+	}
+	keys := make([]SigningKey, 0, len(f.Keys))
+	for _, fk := range f.Keys {
+		if strings.TrimSpace(fk.Kid) == "" {
+			return nil, errors.New("keyring: key id required")
+		}
+		k := SigningKey{ID: fk.Kid, Alg: fk.Alg}
+		if fk.RetireAt != nil {
+			k.RetireAt = *fk.RetireAt
+		}
+		switch fk.Alg {
+		case AlgHS256:
+			if len(fk.Secret) < 32 {
+				return nil, fmt.Errorf("keyring: key %q: HS256 secret must be at least 32 characters", fk.Kid)
+			}
+			k.Secret = []byte(fk.Secret)
+		case AlgEdDSA:
+			if fk.PrivateKey != "" {
+				seed, err := decodeKeyMaterial(fk.PrivateKey)
+				if err != nil || len(seed) != ed25519.SeedSize {
+					return nil, fmt.Errorf("keyring: key %q: private_key must be a base64 32-byte Ed25519 seed", fk.Kid)
+				}
+				k.PrivateKey = ed25519.NewKeyFromSeed(seed)
+			} else {
+				pub, err := decodeKeyMaterial(fk.PublicKey)
+				if err != nil || len(pub) != ed25519.PublicKeySize {
+					return nil, fmt.Errorf("keyring: key %q: public_key must be a base64 32-byte Ed25519 key", fk.Kid)
+				}
+				k.PublicKey = pub
+			}
+		}
+		keys = append(keys, k)
+	}
+	kr := &Keyring{}
+	if err := kr.set(f.Active, keys); err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	return kr, nil
+}
+
+// LoadKeyringFile reads a keyring from path.
+func LoadKeyringFile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(data)
+}
+
+// WatchKeyringFile reloads path into kr whenever its modification time
+// changes, so keys can be rotated without a restart. Invalid files are logged
+// and ignored; the previous keys stay in effect.
+func WatchKeyringFile(ctx context.Context, path string, kr *Keyring, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	var lastMod time.Time
+	if st, err := os.Stat(path); err == nil {
+		lastMod = st.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		st, err := os.Stat(path)
+		if err != nil {
+			slog.Warn("keyring file unavailable", "path", path, "error", err)
+			continue
+		}
+		if st.ModTime().Equal(lastMod) {
+			continue
+		}
+		next, err := LoadKeyringFile(path)
+		if err != nil {
+			slog.Error("keyring reload failed; keeping previous keys", "path", path, "error", err)
+			continue
+		}
+		lastMod = st.ModTime()
+		kr.Replace(next)
+		slog.Info("keyring reloaded", "path", path, "active_kid", next.Active().ID)
+	}
+}
@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginAttempt tracks consecutive failed logins for one username.
+// Usernames are tracked whether or not the account exists so that
+// throttling behaves identically for unknown names.
+type LoginAttempt struct {
+	Username    string
+	Failures    int
+	LastFailure time.Time
+	LastIP      string
+	LockedUntil time.Time
+}
+
+// SubnetFailures summarises failed logins originating from one network prefix.
+type SubnetFailures struct {
+	Subnet    string
+	Usernames int
+	LastSeen  time.Time
+}
+
+// LoginAttemptStore persists login failure counters and subnet anomaly data.
+type LoginAttemptStore interface {
+	// Get returns the current record for username, if any.
+	Get(ctx context.Context, username string) (LoginAttempt, bool, error)
+	// RecordFailure atomically increments the failure counter for username.
+	// The record expires after ttl without further failures.
+	RecordFailure(ctx context.Context, username, ip string, now time.Time, ttl time.Duration) (LoginAttempt, error)
+	// Lock blocks logins for username until the given time.
+	Lock(ctx context.Context, username string, until time.Time) error
+	// Reset clears the failure counter and any lock.
+	Reset(ctx context.Context, username string) error
+	// List returns all tracked usernames.
+	List(ctx context.Context) ([]LoginAttempt, error)
+	// RecordSubnetFailure adds username to the set of usernames that failed from
+	// subnet within window and returns the set size.
+	RecordSubnetFailure(ctx context.Context, subnet, username string, now time.Time, window time.Duration) (int, error)
+	// ListSubnets returns subnets with failures inside their window.
+	ListSubnets(ctx context.Context) ([]SubnetFailures, error)
+}
+
+// NormalizeLoginKey returns the key used to track failures for a username.
+func NormalizeLoginKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// SubnetOf returns the /24 (IPv4) or /48 (IPv6) prefix for ip, or "" if ip is invalid.
+func SubnetOf(ip string) string {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// MemoryLoginAttemptStore is an in-memory implementation (single instance / testing).
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	attempts map[string]memoryAttempt
+	subnets  map[string]memorySubnet
+}
+
+type memoryAttempt struct {
+	LoginAttempt
+	expiresAt time.Time
+}
+
+type memorySubnet struct {
+	usernames map[string]time.Time
+	window    time.Duration
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return NewMemoryLoginAttemptStoreWithClock(time.Now)
+}
+
+// NewMemoryLoginAttemptStoreWithClock creates a store that expires records
+// according to now, which should be the clock of the service using it.
+func NewMemoryLoginAttemptStoreWithClock(now func() time.Time) *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{
+		now:      now,
+		attempts: map[string]memoryAttempt{},
+		subnets:  map[string]memorySubnet{},
+	}
+}
+
+func (s *MemoryLoginAttemptStore) Get(_ context.Context, username string) (LoginAttempt, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attempts[username]
+	if !ok {
+		return LoginAttempt{}, false, nil
+	}
+	if now := s.now(); now.After(a.expiresAt) && now.After(a.LockedUntil) {
+		delete(s.attempts, username)
+		return LoginAttempt{}, false, nil
+	}
+	return a.LoginAttempt, true, nil
+}
+
+func (s *MemoryLoginAttemptStore) RecordFailure(_ context.Context, username, ip string, now time.Time, ttl time.Duration) (LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attempts[username]
+	if !ok || (now.After(a.expiresAt) && now.After(a.LockedUntil)) {
+		a = memoryAttempt{LoginAttempt: LoginAttempt{Username: username}}
+	}
+	a.Failures++
+	a.LastFailure = now
+	a.LastIP = ip
+	a.expiresAt = now.Add(ttl)
+	s.attempts[username] = a
+	return a.LoginAttempt, nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(_ context.Context, username string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attempts[username]
+	if !ok {
+		a = memoryAttempt{LoginAttempt: LoginAttempt{Username: username}, expiresAt: until}
+	}
+	a.LockedUntil = until
+	s.attempts[username] = a
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(_ context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, username)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) List(_ context.Context) ([]LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	out := make([]LoginAttempt, 0, len(s.attempts))
+	for k, a := range s.attempts {
+		if now.After(a.expiresAt) && now.After(a.LockedUntil) {
+			delete(s.attempts, k)
+			continue
+		}
+		out = append(out, a.LoginAttempt)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastFailure.After(out[j].LastFailure) })
+	return out, nil
+}
+
+func (s *MemoryLoginAttemptStore) RecordSubnetFailure(_ context.Context, subnet, username string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sn, ok := s.subnets[subnet]
+	if !ok {
+		sn = memorySubnet{usernames: map[string]time.Time{}}
+	}
+	sn.window = window
+	for u, seen := range sn.usernames {
+		if now.Sub(seen) > window {
+			delete(sn.usernames, u)
+		}
+	}
+	sn.usernames[username] = now
+	s.subnets[subnet] = sn
+	return len(sn.usernames), nil
+}
+
+func (s *MemoryLoginAttemptStore) ListSubnets(_ context.Context) ([]SubnetFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	out := make([]SubnetFailures, 0, len(s.subnets))
+	for subnet, sn := range s.subnets {
+		var last time.Time
+		for u, seen := range sn.usernames {
+			if now.Sub(seen) > sn.window {
+				delete(sn.usernames, u)
+				continue
+			}
+			if seen.After(last) {
+				last = seen
+			}
+		}
+		if len(sn.usernames) == 0 {
+			delete(s.subnets, subnet)
+			continue
+		}
+		out = append(out, SubnetFailures{Subnet: subnet, Usernames: len(sn.usernames), LastSeen: last})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Usernames > out[j].Usernames })
+	return out, nil
+}
+
+// RedisLoginAttemptStore is a Redis-backed implementation shared across instances.
+//
+// Keys:
+//
+//	login:attempts:<username>  hash {failures, last_failure, last_ip, locked_until}
+//	login:attempts:index       zset username -> expiry (unix)
+//	login:subnet:<subnet>      zset username -> last failure (unix)
+//	login:subnets:index        zset subnet -> expiry (unix)
+type RedisLoginAttemptStore struct {
+	redis *redis.Client
+}
+
+func NewRedisLoginAttemptStore(rdb *redis.Client) *RedisLoginAttemptStore {
+	return &RedisLoginAttemptStore{redis: rdb}
+}
+
+const (
+	loginAttemptKeyPrefix = "login:attempts:"
+	loginAttemptIndexKey  = "login:attempts:index"
+	loginSubnetKeyPrefix  = "login:subnet:"
+	loginSubnetIndexKey   = "login:subnets:index"
+)
+
+func (s *RedisLoginAttemptStore) Get(ctx context.Context, username string) (LoginAttempt, bool, error) {
+	vals, err := s.redis.HGetAll(ctx, loginAttemptKeyPrefix+username).Result()
+	if err != nil {
+		return LoginAttempt{}, false, err
+	}
+	if len(vals) == 0 {
+		return LoginAttempt{}, false, nil
+	}
+	return parseLoginAttempt(username, vals), true, nil
+}
+
+func parseLoginAttempt(username string, vals map[string]string) LoginAttempt {
+	a := LoginAttempt{Username: username, LastIP: vals["last_ip"]}
+	a.Failures, _ = strconv.Atoi(vals["failures"])
+	if v, err := strconv.ParseInt(vals["last_failure"], 10, 64); err == nil {
+		a.LastFailure = time.Unix(v, 0).UTC()
+	}
+	if v, err := strconv.ParseInt(vals["locked_until"], 10, 64); err == nil && v > 0 {
+		a.LockedUntil = time.Unix(v, 0).UTC()
+	}
+	return a
+}
+
+func (s *RedisLoginAttemptStore) RecordFailure(ctx context.Context, username, ip string, now time.Time, ttl time.Duration) (LoginAttempt, error) {
+	key := loginAttemptKeyPrefix + username
+	pipe := s.redis.TxPipeline()
+	pipe.HIncrBy(ctx, key, "failures", 1)
+	pipe.HSet(ctx, key, "last_failure", now.Unix(), "last_ip", ip)
+	pipe.Expire(ctx, key, ttl)
+	pipe.ZAdd(ctx, loginAttemptIndexKey, redis.Z{Score: float64(now.Add(ttl).Unix()), Member: username})
+	all := pipe.HGetAll(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return LoginAttempt{}, err
+	}
+	return parseLoginAttempt(username, all.Val()), nil
+}
+
+func (s *RedisLoginAttemptStore) Lock(ctx context.Context, username string, until time.Time) error {
+	key := loginAttemptKeyPrefix + username
+	// Keep the record at least as long as the lock.
+	expiry := time.Until(until)
+	if ttl, err := s.redis.TTL(ctx, key).Result(); err == nil && ttl > expiry {
+		expiry = ttl
+	}
+	pipe := s.redis.TxPipeline()
+	pipe.HSet(ctx, key, "locked_until", until.Unix())
+	pipe.Expire(ctx, key, expiry)
+	pipe.ZAdd(ctx, loginAttemptIndexKey, redis.Z{Score: float64(time.Now().Add(expiry).Unix()), Member: username})
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisLoginAttemptStore) Reset(ctx context.Context, username string) error {
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, loginAttemptKeyPrefix+username)
+	pipe.ZRem(ctx, loginAttemptIndexKey, username)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisLoginAttemptStore) List(ctx context.Context) ([]LoginAttempt, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := s.redis.ZRemRangeByScore(ctx, loginAttemptIndexKey, "-inf", now).Err(); err != nil {
+		return nil, err
+	}
+	names, err := s.redis.ZRange(ctx, loginAttemptIndexKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]LoginAttempt, 0, len(names))
+	for _, name := range names {
+		a, ok, err := s.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastFailure.After(out[j].LastFailure) })
+	return out, nil
+}
+
+func (s *RedisLoginAttemptStore) RecordSubnetFailure(ctx context.Context, subnet, username string, now time.Time, window time.Duration) (int, error) {
+	key := loginSubnetKeyPrefix + subnet
+	cutoff := strconv.FormatInt(now.Add(-window).Unix(), 10)
+	pipe := s.redis.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Unix()), Member: username})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff)
+	pipe.Expire(ctx, key, window)
+	pipe.ZAdd(ctx, loginSubnetIndexKey, redis.Z{Score: float64(now.Add(window).Unix()), Member: subnet})
+	count := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(count.Val()), nil
+}
+
+func (s *RedisLoginAttemptStore) ListSubnets(ctx context.Context) ([]SubnetFailures, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := s.redis.ZRemRangeByScore(ctx, loginSubnetIndexKey, "-inf", now).Err(); err != nil {
+		return nil, err
+	}
+	subnets, err := s.redis.ZRange(ctx, loginSubnetIndexKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SubnetFailures, 0, len(subnets))
+	for _, subnet := range subnets {
+		members, err := s.redis.ZRevRangeWithScores(ctx, loginSubnetKeyPrefix+subnet, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(members) == 0 {
+			continue
+		}
+		out = append(out, SubnetFailures{
+			Subnet:    subnet,
+			Usernames: len(members),
+			LastSeen:  time.Unix(int64(members[0].Score), 0).UTC(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Usernames > out[j].Usernames })
+	return out, nil
+}
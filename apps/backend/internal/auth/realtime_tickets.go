@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// RealtimeTicketTTL is how long a realtime ticket can be redeemed.
+const RealtimeTicketTTL = 30 * time.Second
+
+// RealtimeTicket authenticates one realtime connection for clients that
+// cannot send the auth cookie, such as native apps and frontends on other
+// origins. It is bound to the IP that requested it.
+type RealtimeTicket struct {
+	Ticket       string
+	UserID       uuid.UUID
+	Username     string
+	IP           string
+	ExpiresAtUTC time.Time
+}
+
+// RealtimeTicketStore defines the interface for realtime ticket storage.
+// Take removes the ticket, so each one is redeemed at most once.
+type RealtimeTicketStore interface {
+	Put(ctx context.Context, ticket RealtimeTicket) error
+	Take(ctx context.Context, ticket string) (RealtimeTicket, bool)
+}
+
+// MemoryRealtimeTicketStore is an in-memory implementation
+type MemoryRealtimeTicketStore struct {
+	mu      sync.Mutex
+	tickets map[string]RealtimeTicket
+}
+
+func NewMemoryRealtimeTicketStore() *MemoryRealtimeTicketStore {
+	return &MemoryRealtimeTicketStore{tickets: map[string]RealtimeTicket{}}
+}
+
+func (s *MemoryRealtimeTicketStore) Put(_ context.Context, ticket RealtimeTicket) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(time.Now().UTC())
+	s.tickets[ticket.Ticket] = ticket
+	return nil
+}
+
+func (s *MemoryRealtimeTicketStore) Take(_ context.Context, ticket string) (RealtimeTicket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(time.Now().UTC())
+	t, ok := s.tickets[ticket]
+	if !ok {
+		return RealtimeTicket{}, false
+	}
+	delete(s.tickets, ticket)
+	return t, true
+}
+
+func (s *MemoryRealtimeTicketStore) pruneLocked(now time.Time) {
+	for k, v := range s.tickets {
+		if now.After(v.ExpiresAtUTC) {
+			delete(s.tickets, k)
+		}
+	}
+}
+
+// RedisRealtimeTicketStore is a Redis-backed implementation, so that a
+// ticket issued by one instance can be redeemed on another.
+type RedisRealtimeTicketStore struct {
+	redis *redis.Client
+}
+
+func NewRedisRealtimeTicketStore(rdb *redis.Client) *RedisRealtimeTicketStore {
+	return &RedisRealtimeTicketStore{redis: rdb}
+}
+
+func (s *RedisRealtimeTicketStore) Put(ctx context.Context, ticket RealtimeTicket) error {
+	key := "realtime:ticket:" + ticket.Ticket
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(ticket.ExpiresAtUTC)
+	if ttl <= 0 {
+		ttl = RealtimeTicketTTL
+	}
+	return s.redis.Set(ctx, key, data, ttl).Err()
+}
+
+func (s *RedisRealtimeTicketStore) Take(ctx context.Context, ticket string) (RealtimeTicket, bool) {
+	key := "realtime:ticket:" + ticket
+	// GETDEL lets only one of concurrent redemptions see the ticket.
+	data, err := s.redis.GetDel(ctx, key).Result()
+	if err != nil {
+		return RealtimeTicket{}, false
+	}
+
+	var t RealtimeTicket
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return RealtimeTicket{}, false
+	}
+	if time.Now().UTC().After(t.ExpiresAtUTC) {
+		return RealtimeTicket{}, false
+	}
+	return t, true
+}
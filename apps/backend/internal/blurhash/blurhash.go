@@ -0,0 +1,131 @@
+// Package blurhash encodes images as BlurHash strings: a few DCT components
+// packed into a short base83 string that clients render as a blurred
+// placeholder while the real image loads. See https://blurha.sh.
+package blurhash
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+var (
+	// ErrInvalidComponents is returned for component counts outside 1..9.
+	ErrInvalidComponents = errors.New("blurhash: components must be between 1 and 9")
+
+	// ErrInvalidPixels is returned when the pixel buffer does not match the
+	// given dimensions.
+	ErrInvalidPixels = errors.New("blurhash: pixel buffer does not match dimensions")
+)
+
+// Encode computes the BlurHash of an image given as packed 8-bit RGB rows
+// (3 bytes per pixel, no padding). xComponents and yComponents set the detail
+// along each axis; 4x3 suits landscape images.
+func Encode(xComponents, yComponents, width, height int, rgb []byte) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", ErrInvalidComponents
+	}
+	if width < 1 || height < 1 || len(rgb) != width*height*3 {
+		return "", ErrInvalidPixels
+	}
+
+	// Linearize once; the basis loops below visit every pixel per component.
+	linear := make([]float64, len(rgb))
+	for i, v := range rgb {
+		linear[i] = srgbToLinear(v)
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				basisY := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := basisY * math.Cos(math.Pi*float64(i)*float64(x)/float64(width))
+					p := (y*width + x) * 3
+					r += basis * linear[p]
+					g += basis * linear[p+1]
+					b += basis * linear[p+2]
+				}
+			}
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+
+	var sb strings.Builder
+	encode83(&sb, (xComponents-1)+(yComponents-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMaximum := 0.0
+		for _, f := range ac {
+			actualMaximum = math.Max(actualMaximum, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantised+1) / 166
+		encode83(&sb, quantised, 1)
+	} else {
+		encode83(&sb, 0, 1)
+	}
+
+	encode83(&sb, encodeDC(dc), 4)
+	for _, f := range ac {
+		encode83(&sb, encodeAC(f, maximumValue), 2)
+	}
+	return sb.String(), nil
+}
+
+func encodeDC(c [3]float64) int {
+	return int(linearToSRGB(c[0]))<<16 | int(linearToSRGB(c[1]))<<8 | int(linearToSRGB(c[2]))
+}
+
+func encodeAC(c [3]float64, maximumValue float64) int {
+	quant := func(v float64) int {
+		return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+	}
+	return quant(c[0])*19*19 + quant(c[1])*19 + quant(c[2])
+}
+
+func encode83(sb *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := (value / intPow(83, length-i)) % 83
+		sb.WriteByte(base83Chars[digit])
+	}
+}
+
+func srgbToLinear(v byte) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	c := math.Max(0, math.Min(1, v))
+	if c <= 0.0031308 {
+		return math.Trunc(c*12.92*255 + 0.5)
+	}
+	return math.Trunc((1.055*math.Pow(c, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+func intPow(base, exp int) int {
+	out := 1
+	for range exp {
+		out *= base
+	}
+	return out
+}
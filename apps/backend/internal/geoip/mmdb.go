@@ -0,0 +1,390 @@
+// Package geoip resolves IP addresses to a coarse location (country and city)
+// using a local MaxMind DB file such as GeoLite2-City.mmdb.
+//
+// Only the subset of the MaxMind DB format needed for lookups is implemented;
+// the database is read fully into memory and never written.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree
+// and the data section.
+const dataSectionSeparator = 16
+
+// Location is the coarse geolocation of an IP address.
+type Location struct {
+	Country string // ISO 3166-1 alpha-2 code, e.g. "JP"
+	City    string // English city name, if known
+}
+
+// Locator looks up the location of an IP address.
+type Locator interface {
+	Lookup(ip net.IP) (Location, bool)
+}
+
+// Reader is an in-memory MaxMind DB reader. A nil *Reader finds nothing.
+type Reader struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// Open reads the MaxMind DB at path.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(buf)
+}
+
+// New parses a MaxMind DB from buf. The slice must not be modified afterwards.
+func New(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("geoip: metadata marker not found")
+	}
+	metaStart := i + len(metadataMarker)
+	d := decoder{buf: buf[metaStart:]}
+	raw, _, err := d.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: metadata: %w", err)
+	}
+	meta, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errors.New("geoip: metadata is not a map")
+	}
+	r := &Reader{
+		nodeCount:  toUint(meta["node_count"]),
+		recordSize: toUint(meta["record_size"]),
+		ipVersion:  toUint(meta["ip_version"]),
+	}
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("geoip: unsupported ip version %d", r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(i) {
+		return nil, errors.New("geoip: search tree exceeds file size")
+	}
+	r.buf = buf[:treeSize]
+	r.data = buf[treeSize+dataSectionSeparator : i]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases; walk there once.
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < r.nodeCount; j++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Lookup returns the location of ip. The second result is false when the
+// address is not in the database or the record has no country.
+func (r *Reader) Lookup(ip net.IP) (Location, bool) {
+	if r == nil || ip == nil {
+		return Location{}, false
+	}
+	offset, ok := r.find(ip)
+	if !ok {
+		return Location{}, false
+	}
+	d := decoder{buf: r.data}
+	raw, _, err := d.decode(offset, 0)
+	if err != nil {
+		return Location{}, false
+	}
+	rec, _ := raw.(map[string]any)
+	var loc Location
+	loc.Country = lookupString(rec, "country", "iso_code")
+	if loc.Country == "" {
+		loc.Country = lookupString(rec, "registered_country", "iso_code")
+	}
+	loc.City = lookupString(rec, "city", "names", "en")
+	return loc, loc.Country != ""
+}
+
+// find walks the search tree and returns the data section offset for ip.
+func (r *Reader) find(ip net.IP) (uint, bool) {
+	addr := ip.To4()
+	node := uint(0)
+	switch {
+	case addr != nil && r.ipVersion == 6:
+		node = r.ipv4Start
+	case addr == nil && r.ipVersion == 4:
+		return 0, false
+	case addr == nil:
+		addr = ip.To16()
+	}
+	bits := len(addr) * 8
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := (addr[i/8] >> (7 - uint(i%8))) & 1
+		node = r.record(node, uint(bit))
+	}
+	if node <= r.nodeCount {
+		return 0, false
+	}
+	offset := node - r.nodeCount - dataSectionSeparator
+	if offset >= uint(len(r.data)) {
+		return 0, false
+	}
+	return offset, true
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) record(node, bit uint) uint {
+	nodeBytes := r.recordSize / 4
+	b := r.buf[node*nodeBytes : (node+1)*nodeBytes]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+func lookupString(m map[string]any, path ...string) string {
+	var cur any = m
+	for _, key := range path {
+		mm, ok := cur.(map[string]any)
+		if !ok {
+			return ""
+		}
+		cur = mm[key]
+	}
+	s, _ := cur.(string)
+	return s
+}
+
+func toUint(v any) uint {
+	switch n := v.(type) {
+	case uint64:
+		return uint(n)
+	case int64:
+		if n > 0 {
+			return uint(n)
+		}
+	}
+	return 0
+}
+
+// MaxMind DB data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeFloat64
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeSlice
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat32
+)
+
+// maxDepth bounds nesting so corrupt files cannot recurse without limit.
+const maxDepth = 32
+
+var errCorrupt = errors.New("corrupt data section")
+
+type decoder struct {
+	buf []byte
+}
+
+func (d decoder) byteAt(offset uint) (byte, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, errCorrupt
+	}
+	return d.buf[offset], nil
+}
+
+func (d decoder) slice(offset, size uint) ([]byte, error) {
+	if offset+size > uint(len(d.buf)) || offset+size < offset {
+		return nil, errCorrupt
+	}
+	return d.buf[offset : offset+size], nil
+}
+
+func uintFrom(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// decode decodes the value at offset and returns it with the offset of the
+// following value. Maps become map[string]any, arrays []any, unsigned
+// integers uint64 and signed integers int64.
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errCorrupt
+	}
+	ctrl, err := d.byteAt(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		ss := uint(ctrl>>3) & 0x3
+		b, err := d.slice(offset, ss+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		vvv := uint64(ctrl & 0x7)
+		var ptr uint64
+		switch ss {
+		case 0:
+			ptr = vvv<<8 | uintFrom(b)
+		case 1:
+			ptr = (vvv<<16 | uintFrom(b)) + 2048
+		case 2:
+			ptr = (vvv<<24 | uintFrom(b)) + 526336
+		default:
+			ptr = uintFrom(b)
+		}
+		v, _, err := d.decode(uint(ptr), depth+1)
+		return v, offset + ss + 1, err
+	}
+
+	if typ == typeExtended {
+		ext, err := d.byteAt(offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset++
+		typ = 7 + uint(ext)
+	}
+
+	size := uint(ctrl & 0x1f)
+	switch {
+	case size == 29:
+		b, err := d.slice(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		size = 29 + uint(uintFrom(b))
+		offset++
+	case size == 30:
+		b, err := d.slice(offset, 2)
+		if err != nil {
+			return nil, 0, err
+		}
+		size = 285 + uint(uintFrom(b))
+		offset += 2
+	case size == 31:
+		b, err := d.slice(offset, 3)
+		if err != nil {
+			return nil, 0, err
+		}
+		size = 65821 + uint(uintFrom(b))
+		offset += 3
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeSlice:
+		s := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			s = append(s, v)
+			offset = next
+		}
+		return s, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	b, err := d.slice(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	next := offset + size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeFloat64:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat32:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errCorrupt
+		}
+		return uintFrom(b), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errCorrupt
+		}
+		return int64(int32(uint32(uintFrom(b)))), next, nil
+	case typeUint128:
+		// Only used for fields we never read; keep the raw bytes.
+		return append([]byte(nil), b...), next, nil
+	default:
+		return nil, 0, errCorrupt
+	}
+}
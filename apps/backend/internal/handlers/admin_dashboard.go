@@ -29,3 +29,38 @@ func (h *API) GetAdminDashboardStats(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, stats)
 }
+
+// GetAdminRealtimeStats reports realtime delivery counters for monitoring
+func (h *API) GetAdminRealtimeStats(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "authentication required"})
+		return
+	}
+
+	// Check admin permission
+	if err := h.Authz.RequirePermission(r.Context(), user.ID, "admin:access"); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	var stats api.RealtimeStats
+	if h.Realtime != nil {
+		hub := h.Realtime.Stats()
+		stats.Connections = hub.Connections
+		stats.DroppedEvents = int64(hub.DroppedEvents)
+		stats.DroppedClients = int64(hub.DroppedClients)
+		stats.CoalescedEvents = int64(hub.CoalescedEvents)
+		stats.PublishErrors = int64(hub.PublishErrors)
+	}
+	outbox, err := h.RealtimeOutbox.Stats(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	stats.OutboxPending = outbox.Pending
+	stats.OutboxOldestAgeSeconds = outbox.OldestAgeSeconds
+	stats.OutboxDropped = int64(outbox.Dropped)
+
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/service/moderation"
+)
+
+// ===== Admin Login Security =====
+
+// GetAdminSecurityLoginLockouts lists failed-login tracking and flagged subnets
+func (h API) GetAdminSecurityLoginLockouts(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "authentication required"})
+		return
+	}
+
+	if err := h.Authz.RequirePermission(r.Context(), user.ID, "admin:users:read"); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	overview, err := h.Auth.LoginSecurityOverview(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, overview)
+}
+
+// DeleteAdminSecurityLoginLockoutsUsername clears backoff/lockout for a username
+func (h API) DeleteAdminSecurityLoginLockoutsUsername(w http.ResponseWriter, r *http.Request, username string) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "authentication required"})
+		return
+	}
+
+	if err := h.Authz.RequirePermission(r.Context(), user.ID, "admin:users:write"); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if err := h.Auth.UnlockLogin(r.Context(), user, username); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if h.ModLogs != nil {
+		if _, err := h.ModLogs.CreateLog(r.Context(), moderation.CreateLogParams{
+			AdminUserID: user.ID,
+			Action:      "unlock_login",
+			TargetType:  "username",
+			TargetID:    auth.NormalizeLoginKey(username),
+		}); err != nil {
+			// Log error but don't fail the operation
+			slog.Warn("failed to log login unlock", "error", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
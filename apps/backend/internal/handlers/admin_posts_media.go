@@ -7,6 +7,7 @@ import (
 
 	"backend/internal/api"
 	"backend/internal/auth"
+	"backend/internal/service"
 	"backend/internal/service/moderation"
 
 	"github.com/google/uuid"
@@ -244,7 +245,7 @@ func (h *API) GetAdminMedia(w http.ResponseWriter, r *http.Request, params api.G
 			scheme = "https"
 		}
 		host := r.Host
-		mediaURL := scheme + "://" + host + "/media/" + m.ID.String() + "/image." + m.Ext
+		mediaURL := scheme + "://" + host + "/media/" + m.ID.String() + "/" + service.MediaFileName(m.Ext)
 
 		items[i] = api.AdminMedia{
 			Id:               openapi_types.UUID(m.ID),
@@ -13,6 +13,7 @@ import (
 	"backend/internal/api"
 	"backend/internal/auth"
 	"backend/internal/logging"
+	"backend/internal/realtime"
 	"backend/internal/service"
 	"backend/internal/service/admin"
 	"backend/internal/service/moderation"
@@ -25,18 +26,26 @@ import (
 
 // API implements the generated OpenAPI server interface.
 type API struct {
-	Auth       *service.AuthService
-	Admin      *service.AdminService
-	Authz      *service.AuthzService
-	Users      *service.UsersService
-	Posts      *service.PostsService
-	Timeline   *service.TimelineService
-	Reactions  *service.ReactionsService
-	Media      *service.MediaService
-	Setup      *service.SetupService
-	Agreements *service.AgreementsService
-	Tokens     *auth.TokenManager
-	Redis      *redis.Client
+	Auth           *service.AuthService
+	Admin          *service.AdminService
+	Authz          *service.AuthzService
+	Users          *service.UsersService
+	Posts          *service.PostsService
+	Timeline       *service.TimelineService
+	Reactions      *service.ReactionsService
+	Media          *service.MediaService
+	Setup          *service.SetupService
+	Agreements     *service.AgreementsService
+	Email          *service.EmailService
+	Notifications  *service.NotificationsService
+	OAuth          *service.OAuthService
+	SecurityEvents *service.SecurityEventsService
+	Tokens         *auth.TokenManager
+	Redis          *redis.Client
+	Realtime       *realtime.Hub
+	RealtimeOutbox *service.RealtimeOutbox
+	// RealtimeTickets must be shared with the realtime WebSocketOptions.
+	RealtimeTickets auth.RealtimeTicketStore
 
 	// Admin services
 	AdminInvites    *admin.InvitesService
@@ -470,6 +479,47 @@ func (h API) PostMedia(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, media)
 }
 
+func (h API) GetMediaMediaId(w http.ResponseWriter, r *http.Request, mediaId api.MediaId) {
+	if h.Media == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "media not configured"})
+		return
+	}
+	caller, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	media, err := h.Media.GetMedia(r.Context(), caller.ID, mediaId)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, media)
+}
+
+func (h API) PatchMediaMediaId(w http.ResponseWriter, r *http.Request, mediaId api.MediaId) {
+	if h.Media == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "media not configured"})
+		return
+	}
+	caller, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	var req api.UpdateMediaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, api.Error{Code: "invalid_request", Message: "invalid json"})
+		return
+	}
+	media, err := h.Media.UpdateMedia(r.Context(), caller.ID, mediaId, req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, media)
+}
+
 func (h API) GetPostsPostIdReactions(w http.ResponseWriter, r *http.Request, postId api.PostId) {
 	if h.Reactions == nil {
 		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "reactions not configured"})
@@ -726,6 +776,15 @@ func (h API) PutAdminUsersUserIdRoles(w http.ResponseWriter, r *http.Request, us
 		writeServiceError(w, err)
 		return
 	}
+	if actor, ok := auth.UserFromContext(r.Context()); ok {
+		h.SecurityEvents.Record(r.Context(), service.SecurityEvent{
+			UserID:  userId,
+			ActorID: actor.ID,
+			Type:    service.SecurityEventRoleChange,
+			Outcome: service.SecurityOutcomeSuccess,
+			Details: map[string]any{"roles": roles},
+		})
+	}
 	writeJSON(w, http.StatusOK, api.RoleList(roles))
 }
 
@@ -757,6 +816,15 @@ func (h API) PutAdminUsersUserIdPermissions(w http.ResponseWriter, r *http.Reque
 		writeServiceError(w, err)
 		return
 	}
+	if actor, ok := auth.UserFromContext(r.Context()); ok {
+		h.SecurityEvents.Record(r.Context(), service.SecurityEvent{
+			UserID:  userId,
+			ActorID: actor.ID,
+			Type:    service.SecurityEventPermissionChange,
+			Outcome: service.SecurityOutcomeSuccess,
+			Details: map[string]any{"overrides": overrides},
+		})
+	}
 	writeJSON(w, http.StatusOK, api.UserPermissionOverrides{Overrides: overrides})
 }
 
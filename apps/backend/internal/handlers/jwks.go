@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"backend/internal/auth"
+	"backend/internal/realtime"
+)
+
+// NewJWKSHandler serves the public keys other services use to verify access
+// tokens. Only asymmetric (EdDSA) keys are published; HS256 secrets never are.
+// This is a public endpoint that does not require authentication.
+func NewJWKSHandler(tokens *auth.TokenManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		writeJSON(w, http.StatusOK, tokens.JWKS())
+	}
+}
+
+// NewRealtimeJWKSHandler serves the public keys that verify signed realtime
+// events, for consumers that receive them through relays. Like the JWKS
+// endpoint it publishes EdDSA keys only and requires no authentication.
+func NewRealtimeJWKSHandler(hub *realtime.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		writeJSON(w, http.StatusOK, hub.SigningKeys())
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+
+	openapi_types "github.com/oapi-codegen/runtime/types"
+)
+
+func (h API) GetMeStorage(w http.ResponseWriter, r *http.Request) {
+	if h.Media == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "media not configured"})
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	usage, err := h.Media.GetStorageUsage(r.Context(), user.ID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+func (h API) GetAdminUsersUserIdStorage(w http.ResponseWriter, r *http.Request, userId openapi_types.UUID) {
+	if h.Media == nil || h.Users == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "media not configured"})
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "authentication required"})
+		return
+	}
+	if err := h.Authz.RequirePermission(r.Context(), user.ID, "admin:users:read"); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	// Usage of an unknown user would read as empty; report it as missing.
+	if _, err := h.Users.GetByID(r.Context(), userId); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	usage, err := h.Media.GetStorageUsage(r.Context(), userId)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+
+	"github.com/google/uuid"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+)
+
+func (h API) GetMeNotifications(w http.ResponseWriter, r *http.Request, params api.GetMeNotificationsParams) {
+	if h.Notifications == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "notifications not configured"})
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	limit := 50
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	list, err := h.Notifications.List(r.Context(), user.ID, limit)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h API) PostMeNotificationsNotificationIdRead(w http.ResponseWriter, r *http.Request, notificationId openapi_types.UUID) {
+	if h.Notifications == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "notifications not configured"})
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	if err := h.Notifications.MarkRead(r.Context(), user.ID, uuid.UUID(notificationId)); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/service"
+	"backend/internal/service/moderation"
+)
+
+// ===== OAuth2 / OpenID Connect =====
+
+func (h API) oauthUnavailable(w http.ResponseWriter) bool {
+	if h.OAuth == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "oauth not configured"})
+		return true
+	}
+	return false
+}
+
+// GetOauthAuthorize returns consent screen data for an authorization request
+func (h API) GetOauthAuthorize(w http.ResponseWriter, r *http.Request, params api.GetOauthAuthorizeParams) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	req := service.AuthorizeRequest{
+		ClientID:            params.ClientId,
+		RedirectURI:         params.RedirectUri,
+		ResponseType:        params.ResponseType,
+		Scope:               params.Scope,
+		CodeChallenge:       params.CodeChallenge,
+		CodeChallengeMethod: params.CodeChallengeMethod,
+	}
+	if params.State != nil {
+		req.State = *params.State
+	}
+	if params.Nonce != nil {
+		req.Nonce = *params.Nonce
+	}
+	info, err := h.OAuth.AuthorizeInfo(r.Context(), user, req)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// PostOauthAuthorize records the user's consent decision
+func (h API) PostOauthAuthorize(w http.ResponseWriter, r *http.Request) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	var body api.OAuthAuthorizeDecision
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, api.Error{Code: "invalid_request", Message: "invalid json"})
+		return
+	}
+	req := service.AuthorizeRequest{
+		ClientID:            body.ClientId,
+		RedirectURI:         body.RedirectUri,
+		ResponseType:        body.ResponseType,
+		Scope:               body.Scope,
+		CodeChallenge:       body.CodeChallenge,
+		CodeChallengeMethod: body.CodeChallengeMethod,
+	}
+	if body.State != nil {
+		req.State = *body.State
+	}
+	if body.Nonce != nil {
+		req.Nonce = *body.Nonce
+	}
+	redirectURL, err := h.OAuth.Authorize(r.Context(), user, req, body.Approve)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.OAuthAuthorizeResult{RedirectUrl: redirectURL})
+}
+
+// oauthClientCredentials reads client credentials from HTTP Basic auth
+// (RFC 6749 §2.3.1, form-encoded) or from the request body.
+func oauthClientCredentials(r *http.Request) (clientID, secret string) {
+	if id, pw, ok := r.BasicAuth(); ok {
+		if dec, err := url.QueryUnescape(id); err == nil {
+			id = dec
+		}
+		if dec, err := url.QueryUnescape(pw); err == nil {
+			pw = dec
+		}
+		return id, pw
+	}
+	return r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+}
+
+// writeOAuthError writes errors in the RFC 6749 §5.2 format used by the token,
+// introspection and revocation endpoints.
+func writeOAuthError(w http.ResponseWriter, err error) {
+	se, ok := err.(*service.Error)
+	if !ok {
+		slog.Error("oauth endpoint failed", "error", err)
+		writeJSON(w, http.StatusInternalServerError, api.OAuthError{Error: "server_error"})
+		return
+	}
+	if se.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	desc := se.Message
+	writeJSON(w, se.Status, api.OAuthError{Error: se.Code, ErrorDescription: &desc})
+}
+
+func setNoStore(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+}
+
+// PostOauthToken is the OAuth2 token endpoint
+func (h API) PostOauthToken(w http.ResponseWriter, r *http.Request) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	setNoStore(w)
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, service.NewError(http.StatusBadRequest, "invalid_request", "invalid form body"))
+		return
+	}
+	clientID, secret := oauthClientCredentials(r)
+	resp, err := h.OAuth.Exchange(r.Context(), service.OAuthTokenRequest{
+		GrantType:    r.PostFormValue("grant_type"),
+		Code:         r.PostFormValue("code"),
+		RedirectURI:  r.PostFormValue("redirect_uri"),
+		ClientID:     clientID,
+		ClientSecret: secret,
+		CodeVerifier: r.PostFormValue("code_verifier"),
+	})
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// PostOauthIntrospect is the OAuth2 token introspection endpoint
+func (h API) PostOauthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	setNoStore(w)
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, service.NewError(http.StatusBadRequest, "invalid_request", "invalid form body"))
+		return
+	}
+	clientID, secret := oauthClientCredentials(r)
+	result, err := h.OAuth.Introspect(r.Context(), clientID, secret, r.PostFormValue("token"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// PostOauthRevoke is the OAuth2 token revocation endpoint
+func (h API) PostOauthRevoke(w http.ResponseWriter, r *http.Request) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, service.NewError(http.StatusBadRequest, "invalid_request", "invalid form body"))
+		return
+	}
+	clientID, secret := oauthClientCredentials(r)
+	if err := h.OAuth.Revoke(r.Context(), clientID, secret, r.PostFormValue("token")); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetOauthUserinfo is the OpenID Connect UserInfo endpoint
+func (h API) GetOauthUserinfo(w http.ResponseWriter, r *http.Request) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	scopes, delegated := auth.TokenScopesFromContext(r.Context())
+	if !ok || !delegated || !auth.HasScope(scopes, service.OAuthScopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "oauth access token with openid scope required"})
+		return
+	}
+	info, err := h.OAuth.UserInfo(r.Context(), user, scopes)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// GetMeOauthAuthorizations lists apps the current user has authorized
+func (h API) GetMeOauthAuthorizations(w http.ResponseWriter, r *http.Request) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	items, err := h.OAuth.ListAuthorizations(r.Context(), user.ID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// DeleteMeOauthAuthorizationsClientId revokes an app's access to the current user
+func (h API) DeleteMeOauthAuthorizationsClientId(w http.ResponseWriter, r *http.Request, clientId string) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	if err := h.OAuth.RevokeAuthorization(r.Context(), user.ID, clientId); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ===== Admin OAuth Clients =====
+
+// GetAdminOauthClients lists registered OAuth clients
+func (h API) GetAdminOauthClients(w http.ResponseWriter, r *http.Request) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "authentication required"})
+		return
+	}
+	if err := h.Authz.RequirePermission(r.Context(), user.ID, "admin:oauth:manage"); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	clients, err := h.OAuth.ListOAuthClients(r.Context())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, clients)
+}
+
+// PostAdminOauthClients registers an OAuth client
+func (h API) PostAdminOauthClients(w http.ResponseWriter, r *http.Request) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "authentication required"})
+		return
+	}
+	if err := h.Authz.RequirePermission(r.Context(), user.ID, "admin:oauth:manage"); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	var req api.CreateOAuthClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, api.Error{Code: "invalid_request", Message: "invalid json"})
+		return
+	}
+	client, secret, err := h.OAuth.CreateOAuthClient(r.Context(), user, service.CreateOAuthClientParams{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectUris,
+		Scopes:       req.Scopes,
+		Public:       req.Public != nil && *req.Public,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if h.ModLogs != nil {
+		if _, err := h.ModLogs.CreateLog(r.Context(), moderation.CreateLogParams{
+			AdminUserID: user.ID,
+			Action:      "create_oauth_client",
+			TargetType:  "oauth_client",
+			TargetID:    client.ClientId,
+			Details:     client.Name,
+		}); err != nil {
+			// Log error but don't fail the operation
+			slog.Warn("failed to log oauth client creation", "error", err)
+		}
+	}
+
+	resp := api.CreatedOAuthClient{Client: client}
+	if secret != "" {
+		resp.ClientSecret = &secret
+	}
+	setNoStore(w)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// DeleteAdminOauthClientsClientId disables an OAuth client and revokes its tokens
+func (h API) DeleteAdminOauthClientsClientId(w http.ResponseWriter, r *http.Request, clientId string) {
+	if h.oauthUnavailable(w) {
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "authentication required"})
+		return
+	}
+	if err := h.Authz.RequirePermission(r.Context(), user.ID, "admin:oauth:manage"); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	if err := h.OAuth.DisableOAuthClient(r.Context(), user, clientId); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if h.ModLogs != nil {
+		if _, err := h.ModLogs.CreateLog(r.Context(), moderation.CreateLogParams{
+			AdminUserID: user.ID,
+			Action:      "disable_oauth_client",
+			TargetType:  "oauth_client",
+			TargetID:    clientId,
+		}); err != nil {
+			// Log error but don't fail the operation
+			slog.Warn("failed to log oauth client disable", "error", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NewOpenIDConfigurationHandler serves the OpenID Connect discovery document.
+// This is a public endpoint that does not require authentication.
+func NewOpenIDConfigurationHandler(oauth *service.OAuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		writeJSON(w, http.StatusOK, oauth.Discovery())
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+)
+
+func (h API) GetUsersUsernamePresence(w http.ResponseWriter, r *http.Request, username api.Username) {
+	if h.Users == nil || h.Realtime == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "realtime not configured"})
+		return
+	}
+	u, err := h.Users.GetByUsername(r.Context(), username)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	status, err := h.Realtime.Presence(r.Context(), u.Id)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.Presence{UserId: u.Id, Status: status})
+}
+
+func (h API) GetMePresence(w http.ResponseWriter, r *http.Request) {
+	if h.Realtime == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "realtime not configured"})
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	hidden, err := h.Realtime.PresenceHidden(r.Context(), user.ID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.PresenceSettings{Hidden: hidden})
+}
+
+func (h API) PutMePresence(w http.ResponseWriter, r *http.Request) {
+	if h.Realtime == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "realtime not configured"})
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	// A missing flag must not reveal a hidden user.
+	var req struct {
+		Hidden *bool `json:"hidden"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Hidden == nil {
+		writeJSON(w, http.StatusBadRequest, api.Error{Code: "invalid_request", Message: "hidden is required"})
+		return
+	}
+	if err := h.Realtime.SetPresenceHidden(r.Context(), user.ID, *req.Hidden); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.PresenceSettings{Hidden: *req.Hidden})
+}
@@ -23,53 +23,118 @@ const (
 	defaultMaxConnectionsPerIP = 50
 )
 
-// WebSocketOptions configures realtime WebSocket behavior.
+// WebSocketOptions configures realtime WebSocket and SSE behavior.
 type WebSocketOptions struct {
 	TrustProxy          bool
 	MaxConnections      int
 	MaxConnectionsPerIP int
+
+	// Compression negotiates permessage-deflate with clients that offer
+	// it. It trades CPU for bandwidth on JSON-heavy streams.
+	Compression bool
+
+	// Limiter is shared by the realtime endpoints so that the connection
+	// limits apply across transports. When nil, each handler builds its own
+	// from the limits above.
+	Limiter *RealtimeLimiter
+
+	// Tickets redeems tickets issued by POST /realtime/ticket. When nil,
+	// websockets authenticate with the auth cookie only.
+	Tickets auth.RealtimeTicketStore
+}
+
+func (o WebSocketOptions) limiter() *RealtimeLimiter {
+	if o.Limiter != nil {
+		return o.Limiter
+	}
+	return NewRealtimeLimiter(o)
+}
+
+// realtimeUser resolves the user of a realtime request from the auth cookie.
+// Invalid tokens are treated as anonymous.
+func realtimeUser(r *http.Request, tokenManager *auth.TokenManager) (auth.User, bool) {
+	// Authentication via httpOnly cookie only (no query parameter support for security)
+	// Query parameter authentication removed to prevent token leakage in logs, browser history, and referer headers
+	cookie, err := r.Cookie("ciel_auth")
+	if err != nil || cookie.Value == "" || tokenManager == nil {
+		return auth.User{}, false
+	}
+	user, err := tokenManager.Parse(cookie.Value)
+	if err != nil {
+		slog.Debug("realtime auth token invalid, continuing as anonymous", "error", err, "remote", r.RemoteAddr)
+		return auth.User{}, false
+	}
+	return user, true
+}
+
+// signedEvents reports whether a realtime request asks for signed events
+// with ?signed=1 and, when the hub cannot sign them, rejects it.
+func signedEvents(w http.ResponseWriter, r *http.Request, hub *realtime.Hub) (signed, ok bool) {
+	switch r.URL.Query().Get("signed") {
+	case "1", "true":
+	default:
+		return false, true
+	}
+	if !hub.CanSignEvents() {
+		writeJSON(w, http.StatusBadRequest, api.Error{Code: "signed_events_unavailable", Message: "signed events require an EdDSA realtime signing key"})
+		return false, false
+	}
+	return true, true
 }
 
 // NewTimelineWebSocketHandler serves realtime timeline events.
 // Authentication is optional - unauthenticated users can receive public timeline events.
+// Clients that cannot send the auth cookie authenticate with ?ticket=.
+// With ?signed=1 events are delivered as realtime.SignedEvent.
 func NewTimelineWebSocketHandler(hub *realtime.Hub, tokenManager *auth.TokenManager, opts WebSocketOptions) http.HandlerFunc {
 	upgrader := websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin:     allowOrigin,
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		CheckOrigin:       allowOrigin,
+		EnableCompression: opts.Compression,
 	}
-	maxTotal := resolveLimit(opts.MaxConnections, "REALTIME_WS_MAX_CONNECTIONS", defaultMaxConnections)
-	maxPerIP := resolveLimit(opts.MaxConnectionsPerIP, "REALTIME_WS_MAX_CONNECTIONS_PER_IP", defaultMaxConnectionsPerIP)
-	limiter := newWSLimiter(maxTotal, maxPerIP)
+	// Ticket connections carry no ambient credentials a foreign page could
+	// ride on, so they may come from any origin.
+	ticketUpgrader := upgrader
+	ticketUpgrader.CheckOrigin = func(*http.Request) bool { return true }
+	limiter := opts.limiter()
 	return func(w http.ResponseWriter, r *http.Request) {
 		if hub == nil {
 			writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "realtime not configured"})
 			return
 		}
 
-		// Authentication via httpOnly cookie only (no query parameter support for security)
-		// Query parameter authentication removed to prevent token leakage in logs, browser history, and referer headers
-		var authenticated bool
-		var userID string
-		var username string
-
-		if cookie, err := r.Cookie("ciel_auth"); err == nil && cookie.Value != "" {
-			user, err := tokenManager.Parse(cookie.Value)
-			if err == nil {
-				authenticated = true
-				userID = user.ID.String()
-				username = user.Username
-			} else {
-				slog.Debug("websocket auth token invalid, continuing as anonymous", "error", err, "remote", r.RemoteAddr)
-			}
+		signed, ok := signedEvents(w, r, hub)
+		if !ok {
+			return
 		}
-
 		ip := middleware.ClientIP(r, opts.TrustProxy)
 		if !limiter.acquire(ip) {
 			writeJSON(w, http.StatusTooManyRequests, api.Error{Code: "rate_limited", Message: "too many realtime connections"})
 			return
 		}
-		conn, err := upgrader.Upgrade(w, r, nil)
+		upgrade := upgrader.Upgrade
+		var user auth.User
+		var authenticated bool
+		if r.URL.Query().Has("ticket") {
+			// Tickets are single-use, so only redeem one for a request that
+			// passed the limiter and can still be upgraded.
+			if !websocket.IsWebSocketUpgrade(r) {
+				limiter.release(ip)
+				writeJSON(w, http.StatusBadRequest, api.Error{Code: "invalid_request", Message: "websocket upgrade required"})
+				return
+			}
+			user, authenticated = redeemRealtimeTicket(r, opts.Tickets, opts.TrustProxy)
+			if !authenticated {
+				limiter.release(ip)
+				writeJSON(w, http.StatusUnauthorized, api.Error{Code: "invalid_ticket", Message: "invalid or expired realtime ticket"})
+				return
+			}
+			upgrade = ticketUpgrader.Upgrade
+		} else {
+			user, authenticated = realtimeUser(r, tokenManager)
+		}
+		conn, err := upgrade(w, r, nil)
 		if err != nil {
 			limiter.release(ip)
 			slog.Warn("websocket upgrade failed", "error", err, "origin", r.Header.Get("Origin"), "remote", r.RemoteAddr)
@@ -79,14 +144,18 @@ func NewTimelineWebSocketHandler(hub *realtime.Hub, tokenManager *auth.TokenMana
 
 		// Log successful WebSocket connection
 		if authenticated {
-			slog.Info("websocket connected (authenticated)", "user_id", userID, "username", username, "remote", r.RemoteAddr)
+			slog.Info("websocket connected (authenticated)", "user_id", user.ID, "username", user.Username, "remote", r.RemoteAddr)
 		} else {
 			slog.Info("websocket connected (anonymous)", "remote", r.RemoteAddr)
 		}
 
-		realtime.NewClient(hub, conn, func() {
+		client := realtime.NewUserClient(hub, conn, user.ID, func() {
 			limiter.release(ip)
-		}).Run()
+		})
+		if signed {
+			client.SignEvents()
+		}
+		client.Run()
 	}
 }
 
@@ -174,7 +243,9 @@ func parseBaseURL(raw string) (*url.URL, error) {
 	return parsed, nil
 }
 
-type wsLimiter struct {
+// RealtimeLimiter caps concurrent realtime connections in total and per
+// client IP.
+type RealtimeLimiter struct {
 	mu       sync.Mutex
 	byIP     map[string]int
 	total    int
@@ -182,15 +253,17 @@ type wsLimiter struct {
 	maxPerIP int
 }
 
-func newWSLimiter(maxTotal, maxPerIP int) *wsLimiter {
-	return &wsLimiter{
+// NewRealtimeLimiter builds a limiter from the limits in opts, falling back
+// to REALTIME_WS_MAX_CONNECTIONS and REALTIME_WS_MAX_CONNECTIONS_PER_IP.
+func NewRealtimeLimiter(opts WebSocketOptions) *RealtimeLimiter {
+	return &RealtimeLimiter{
 		byIP:     make(map[string]int),
-		maxTotal: maxTotal,
-		maxPerIP: maxPerIP,
+		maxTotal: resolveLimit(opts.MaxConnections, "REALTIME_WS_MAX_CONNECTIONS", defaultMaxConnections),
+		maxPerIP: resolveLimit(opts.MaxConnectionsPerIP, "REALTIME_WS_MAX_CONNECTIONS_PER_IP", defaultMaxConnectionsPerIP),
 	}
 }
 
-func (l *wsLimiter) acquire(ip string) bool {
+func (l *RealtimeLimiter) acquire(ip string) bool {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if l.maxTotal > 0 && l.total >= l.maxTotal {
@@ -204,7 +277,7 @@ func (l *wsLimiter) acquire(ip string) bool {
 	return true
 }
 
-func (l *wsLimiter) release(ip string) {
+func (l *RealtimeLimiter) release(ip string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if l.total > 0 {
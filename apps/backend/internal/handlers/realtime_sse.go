@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/middleware"
+	"backend/internal/realtime"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// sseHeartbeatInterval keeps idle streams from being closed by proxies.
+	sseHeartbeatInterval = 15 * time.Second
+	sseWriteWait         = 10 * time.Second
+	sseRetryMillis       = 3000
+)
+
+// NewTimelineSSEHandler serves the same events as the timeline websocket as
+// Server-Sent Events, for clients whose proxies break websocket upgrades.
+// Authentication is optional; authenticated users also receive events
+// addressed to them.
+func NewTimelineSSEHandler(hub *realtime.Hub, tokenManager *auth.TokenManager, opts WebSocketOptions) http.HandlerFunc {
+	return newSSEHandler(hub, tokenManager, opts, false)
+}
+
+// NewUserSSEHandler serves only the events addressed to the authenticated
+// user as Server-Sent Events.
+func NewUserSSEHandler(hub *realtime.Hub, tokenManager *auth.TokenManager, opts WebSocketOptions) http.HandlerFunc {
+	return newSSEHandler(hub, tokenManager, opts, true)
+}
+
+func newSSEHandler(hub *realtime.Hub, tokenManager *auth.TokenManager, opts WebSocketOptions, private bool) http.HandlerFunc {
+	limiter := opts.limiter()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hub == nil {
+			writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "realtime not configured"})
+			return
+		}
+		user, authenticated := realtimeUser(r, tokenManager)
+		if private && !authenticated {
+			writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "authentication required"})
+			return
+		}
+		signed, ok := signedEvents(w, r, hub)
+		if !ok {
+			return
+		}
+
+		ip := middleware.ClientIP(r, opts.TrustProxy)
+		if !limiter.acquire(ip) {
+			writeJSON(w, http.StatusTooManyRequests, api.Error{Code: "rate_limited", Message: "too many realtime connections"})
+			return
+		}
+		defer limiter.release(ip)
+
+		topics := []string{realtime.TopicTimeline}
+		userID := uuid.Nil
+		if private {
+			topics = nil
+		}
+		if authenticated {
+			userID = user.ID
+		}
+		client := realtime.NewStreamClient(hub, userID, topics)
+		if signed {
+			client.SignEvents()
+		}
+		hub.Register(client)
+		defer hub.Unregister(client)
+
+		// EventSource sends Last-Event-ID when it reconnects; the query
+		// parameter covers the first connection of a reloaded page.
+		lastEventID := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+		if lastEventID == "" {
+			lastEventID = strings.TrimSpace(r.URL.Query().Get("lastEventId"))
+		}
+
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Accel-Buffering", "no") // disable nginx response buffering
+		w.WriteHeader(http.StatusOK)
+
+		rc := http.NewResponseController(w)
+		write := func(frame func(io.Writer) error) bool {
+			// The server's WriteTimeout would end the stream; each write gets
+			// its own deadline instead.
+			_ = rc.SetWriteDeadline(time.Now().Add(sseWriteWait))
+			if err := frame(w); err != nil {
+				return false
+			}
+			return rc.Flush() == nil
+		}
+		if !write(func(out io.Writer) error {
+			_, err := fmt.Fprintf(out, "retry: %d\n\n", sseRetryMillis)
+			return err
+		}) {
+			return
+		}
+		if lastEventID != "" {
+			if err := client.Resume(lastEventID); err != nil {
+				resync, _ := json.Marshal(realtime.Reply{Type: realtime.ReplyResync})
+				if !write(func(out io.Writer) error { return writeSSEFrame(out, resync) }) {
+					return
+				}
+			}
+		}
+
+		if authenticated {
+			slog.Info("sse connected (authenticated)", "user_id", user.ID, "remote", r.RemoteAddr)
+		} else {
+			slog.Info("sse connected (anonymous)", "remote", r.RemoteAddr)
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case payload, ok := <-client.SendChan():
+				if !ok {
+					if client.CloseCode() == realtime.CloseSlowConsumer {
+						dropped, _ := json.Marshal(realtime.Reply{Type: realtime.ReplyError, Code: "slow_consumer", Message: "connection fell behind; reconnect to resume"})
+						write(func(out io.Writer) error { return writeSSEFrame(out, dropped) })
+					}
+					return
+				}
+				if !write(func(out io.Writer) error { return writeSSEFrame(out, payload) }) {
+					return
+				}
+			case <-heartbeat.C:
+				if !write(func(out io.Writer) error {
+					_, err := io.WriteString(out, ": heartbeat\n\n")
+					return err
+				}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeSSEFrame writes a hub payload as one SSE message. Events carry their
+// ID so EventSource can resume, signed ones included; replies such as
+// resync_required are sent as named events.
+func writeSSEFrame(w io.Writer, payload []byte) error {
+	var head struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Payload string `json:"payload"`
+	}
+	_ = json.Unmarshal(payload, &head)
+	if head.Payload != "" {
+		_ = json.Unmarshal([]byte(head.Payload), &head)
+	}
+	var err error
+	switch head.Type {
+	case realtime.ReplyAck, realtime.ReplyPong, realtime.ReplyError, realtime.ReplyResync:
+		_, err = fmt.Fprintf(w, "event: %s\n", head.Type)
+	default:
+		if head.ID != "" && !strings.ContainsAny(head.ID, "\r\n") {
+			_, err = fmt.Fprintf(w, "id: %s\n", head.ID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// Marshalled JSON never contains raw newlines.
+	_, err = fmt.Fprintf(w, "data: %s\n\n", payload)
+	return err
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/logging"
+	"backend/internal/middleware"
+)
+
+func (h API) PostRealtimeTicket(w http.ResponseWriter, r *http.Request) {
+	if h.Realtime == nil || h.RealtimeTickets == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "realtime not configured"})
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	ticket, err := auth.RandomToken(32)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	// The access log resolves the client IP with the proxy settings that the
+	// websocket handler uses when the ticket is redeemed.
+	ip := logging.ClientIP(r.Context())
+	if ip == "" {
+		ip = middleware.ClientIP(r, false)
+	}
+	expiresAt := time.Now().UTC().Add(auth.RealtimeTicketTTL)
+	if err := h.RealtimeTickets.Put(r.Context(), auth.RealtimeTicket{
+		Ticket:       ticket,
+		UserID:       user.ID,
+		Username:     user.Username,
+		IP:           ip,
+		ExpiresAtUTC: expiresAt,
+	}); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, api.RealtimeTicket{Ticket: ticket, ExpiresAt: expiresAt})
+}
+
+// redeemRealtimeTicket resolves the user of a ?ticket= realtime request.
+// Tickets are single-use and only valid from the IP that requested them.
+func redeemRealtimeTicket(r *http.Request, tickets auth.RealtimeTicketStore, trustProxy bool) (auth.User, bool) {
+	value := r.URL.Query().Get("ticket")
+	if tickets == nil || value == "" {
+		return auth.User{}, false
+	}
+	ticket, ok := tickets.Take(r.Context(), value)
+	if !ok {
+		return auth.User{}, false
+	}
+	if ip := middleware.ClientIP(r, trustProxy); ip != ticket.IP {
+		slog.Warn("realtime ticket redeemed from another IP", "user_id", ticket.UserID, "remote", ip)
+		return auth.User{}, false
+	}
+	return auth.User{ID: ticket.UserID, Username: ticket.Username}, true
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+)
+
+func (h API) GetMeSecurityEvents(w http.ResponseWriter, r *http.Request, params api.GetMeSecurityEventsParams) {
+	if h.SecurityEvents == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "security events not configured"})
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "unauthorized"})
+		return
+	}
+	limit := 50
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	page, err := h.SecurityEvents.List(r.Context(), user.ID, limit, params.Cursor)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h API) GetAdminUsersUserIdSecurityEvents(w http.ResponseWriter, r *http.Request, userId api.UserId, params api.GetAdminUsersUserIdSecurityEventsParams) {
+	if h.SecurityEvents == nil {
+		writeJSON(w, http.StatusServiceUnavailable, api.Error{Code: "service_unavailable", Message: "security events not configured"})
+		return
+	}
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, api.Error{Code: "unauthorized", Message: "authentication required"})
+		return
+	}
+	if err := h.Authz.RequirePermission(r.Context(), user.ID, "admin:users:read"); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	limit := 50
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+	page, err := h.SecurityEvents.List(r.Context(), userId, limit, params.Cursor)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
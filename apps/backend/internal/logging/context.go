@@ -48,3 +48,34 @@ func RequestAttrs(ctx context.Context) []slog.Attr {
 	}
 	return attrs
 }
+
+// ClientIP returns the client IP stored by WithRequestContext, if any.
+func ClientIP(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	info, ok := ctx.Value(requestInfoKey{}).(requestInfo)
+	if !ok {
+		return ""
+	}
+	return info.clientIP
+}
+
+type userAgentKey struct{}
+
+// WithUserAgent stores the request's User-Agent header in context.
+func WithUserAgent(ctx context.Context, userAgent string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, userAgentKey{}, strings.TrimSpace(userAgent))
+}
+
+// UserAgent returns the User-Agent stored by WithUserAgent, if any.
+func UserAgent(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	ua, _ := ctx.Value(userAgentKey{}).(string)
+	return ua
+}
@@ -0,0 +1,199 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ErrInvalidMessage is returned for messages that cannot be delivered safely.
+var ErrInvalidMessage = errors.New("invalid mail message")
+
+// ErrDisabled is returned by DisabledMailer.
+var ErrDisabled = errors.New("mail delivery is not configured")
+
+// DisabledMailer refuses every message. It is used when no mail driver is
+// configured, so that features which mail secrets turn themselves off.
+type DisabledMailer struct{}
+
+func (DisabledMailer) Send(context.Context, Message) error {
+	return ErrDisabled
+}
+
+// Enabled reports whether m can deliver mail.
+func Enabled(m Mailer) bool {
+	if m == nil {
+		return false
+	}
+	_, disabled := m.(DisabledMailer)
+	return !disabled
+}
+
+func validateMessage(msg Message) error {
+	if strings.TrimSpace(msg.To) == "" {
+		return fmt.Errorf("%w: missing recipient", ErrInvalidMessage)
+	}
+	// Reject header injection via CR/LF in header fields.
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("%w: header contains line break", ErrInvalidMessage)
+	}
+	return nil
+}
+
+func formatMessage(from string, msg Message, now time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + now.UTC().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// SMTPOptions configures SMTPMailer.
+type SMTPOptions struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends mail through an SMTP relay. STARTTLS is used when the
+// server advertises it; PLAIN auth is only attempted when a username is set.
+type SMTPMailer struct {
+	opts SMTPOptions
+}
+
+func NewSMTPMailer(opts SMTPOptions) *SMTPMailer {
+	if opts.Port == "" {
+		opts.Port = "587"
+	}
+	return &SMTPMailer{opts: opts}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := validateMessage(msg); err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(m.opts.Host, m.opts.Port)
+	var a smtp.Auth
+	if m.opts.Username != "" {
+		a = smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)
+	}
+
+	// smtp.SendMail has no context support; run it in the background so
+	// callers are not blocked beyond their deadline.
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, a, m.opts.From, []string{msg.To}, formatMessage(m.opts.From, msg, time.Now()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileMailer appends messages to a local file instead of delivering them.
+// If Path is empty, only the recipient and subject are written to the
+// structured log: bodies carry verification and reset links, which must not
+// end up in server logs. Intended for development and tests.
+type FileMailer struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func NewFileMailer(path, from string) *FileMailer {
+	return &FileMailer{path: path, from: from}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := validateMessage(msg); err != nil {
+		return err
+	}
+	if m.path == "" {
+		slog.Info("mail (log driver)", "to", msg.To, "subject", msg.Subject)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(formatMessage(m.from, msg, time.Now())); err != nil {
+		return err
+	}
+	_, err = f.Write([]byte("\r\n"))
+	return err
+}
+
+// NewFromEnv builds a Mailer from environment variables:
+//
+//	MAIL_DRIVER = smtp | file | log
+//	MAIL_FROM   = sender address
+//	SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD (smtp driver)
+//	MAIL_FILE_PATH (file driver)
+//
+// Without MAIL_DRIVER it returns a DisabledMailer; no driver is picked
+// implicitly.
+func NewFromEnv() (Mailer, error) {
+	from := strings.TrimSpace(os.Getenv("MAIL_FROM"))
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	switch driver := strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_DRIVER"))); driver {
+	case "":
+		return DisabledMailer{}, nil
+	case "log":
+		return NewFileMailer("", from), nil
+	case "file":
+		path := strings.TrimSpace(os.Getenv("MAIL_FILE_PATH"))
+		if path == "" {
+			return nil, errors.New("MAIL_FILE_PATH is required for the file mail driver")
+		}
+		return NewFileMailer(path, from), nil
+	case "smtp":
+		host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
+		if host == "" {
+			return nil, errors.New("SMTP_HOST is required for the smtp mail driver")
+		}
+		return NewSMTPMailer(SMTPOptions{
+			Host:     host,
+			Port:     strings.TrimSpace(os.Getenv("SMTP_PORT")),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
@@ -62,6 +62,7 @@ func AccessLog(opt AccessLogOptions) func(http.Handler) http.Handler {
 			route := r.Method + " " + r.URL.Path
 
 			ctx := logging.WithRequestContext(r.Context(), requestID, clientIP, route)
+			ctx = logging.WithUserAgent(ctx, r.UserAgent())
 			r = r.WithContext(ctx)
 
 			next.ServeHTTP(rec, r)
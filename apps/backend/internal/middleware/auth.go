@@ -13,8 +13,12 @@ import (
 func OptionalAuth(tokenManager *auth.TokenManager) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Skip auth for public media endpoints
+			// Media delivery is public; the user is only resolved so owners
+			// can view their unattached uploads.
 			if strings.HasPrefix(r.URL.Path, "/media/") {
+				if user, ok := mediaUser(r, tokenManager); ok {
+					r = r.WithContext(auth.WithUser(r.Context(), user))
+				}
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -45,6 +49,25 @@ func OptionalAuth(tokenManager *auth.TokenManager) func(http.Handler) http.Handl
 				return
 			}
 
+			// Delegated OAuth tokens are only accepted as bearer tokens and
+			// only on routes their scopes cover.
+			if !isCookieAuth && auth.IsOAuthToken(token) {
+				user, grant, err := tokenManager.ParseOAuth(token)
+				if err != nil {
+					logUnauthorized(r, "token_parse_failed", "oauth", err)
+					writeUnauthorized(w)
+					return
+				}
+				scope, ok := oauthRouteScope(r.Method, r.URL.Path)
+				if !ok || !auth.HasScope(grant.Scopes, scope) {
+					writeInsufficientScope(w, scope)
+					return
+				}
+				ctx := auth.WithTokenScopes(auth.WithUser(r.Context(), user), grant.Scopes)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			user, err := tokenManager.Parse(token)
 			if err != nil {
 				authSource := "bearer"
@@ -67,6 +90,30 @@ func OptionalAuth(tokenManager *auth.TokenManager) func(http.Handler) http.Handl
 	}
 }
 
+// mediaUser resolves the user of a media request from the auth cookie or a
+// first-party bearer token. Media responses are cacheable and often loaded by
+// <img> tags, so invalid credentials are ignored rather than rejected and the
+// cookie is never refreshed.
+func mediaUser(r *http.Request, tokenManager *auth.TokenManager) (auth.User, bool) {
+	if tokenManager == nil {
+		return auth.User{}, false
+	}
+	var token string
+	if cookie, err := r.Cookie("ciel_auth"); err == nil && cookie.Value != "" {
+		token = cookie.Value
+	} else if authz := r.Header.Get("Authorization"); strings.HasPrefix(authz, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(authz, "Bearer "))
+	}
+	if token == "" || auth.IsOAuthToken(token) {
+		return auth.User{}, false
+	}
+	user, err := tokenManager.Parse(token)
+	if err != nil {
+		return auth.User{}, false
+	}
+	return user, true
+}
+
 func RequireAuth(tokenManager *auth.TokenManager) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
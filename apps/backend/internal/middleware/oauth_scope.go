@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"backend/internal/api"
+	"backend/internal/service"
+)
+
+// oauthRouteScope returns the scope a delegated (OAuth) access token needs for
+// a route. Routes not listed are closed to delegated tokens: account, auth,
+// admin and setup endpoints always require a first-party session.
+func oauthRouteScope(method, path string) (string, bool) {
+	switch {
+	case path == "/api/v1/oauth/userinfo" && (method == http.MethodGet || method == http.MethodPost):
+		return service.OAuthScopeOpenID, true
+	case path == "/api/v1/me" && method == http.MethodGet:
+		return service.OAuthScopeProfile, true
+	case path == "/api/v1/posts" && method == http.MethodPost:
+		return "posts_create", true
+	case path == "/api/v1/media" && method == http.MethodPost:
+		return "media_upload", true
+	}
+
+	if method == http.MethodGet {
+		switch {
+		case path == "/api/v1/timeline",
+			strings.HasPrefix(path, "/api/v1/posts/"),
+			strings.HasPrefix(path, "/api/v1/users/"):
+			return service.OAuthScopeRead, true
+		}
+		return "", false
+	}
+
+	// /api/v1/posts/{postId}[/reactions]
+	rest, ok := strings.CutPrefix(path, "/api/v1/posts/")
+	if !ok || rest == "" {
+		return "", false
+	}
+	postID, sub, _ := strings.Cut(rest, "/")
+	if postID == "" {
+		return "", false
+	}
+	switch {
+	case sub == "" && method == http.MethodDelete:
+		return "posts_delete", true
+	case sub == "reactions" && method == http.MethodPost:
+		return "reactions_add", true
+	case sub == "reactions" && method == http.MethodDelete:
+		return "reactions_remove", true
+	}
+	return "", false
+}
+
+func writeInsufficientScope(w http.ResponseWriter, scope string) {
+	challenge := `Bearer error="insufficient_scope"`
+	if scope != "" {
+		challenge += `, scope="` + scope + `"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_ = json.NewEncoder(w).Encode(api.Error{Code: "insufficient_scope", Message: "token scope does not allow this request"})
+}
@@ -57,6 +57,12 @@ func RateLimit(rdb *redis.Client, opt RateLimitOptions) func(http.Handler) http.
 		{routeKey: "auth_login_finish", limit: 10, window: 1 * time.Minute, subject: subjectIP},
 		{routeKey: "auth_stepup_start", limit: 10, window: 1 * time.Minute, subject: subjectIP},
 		{routeKey: "auth_stepup_finish", limit: 10, window: 1 * time.Minute, subject: subjectIP},
+		// Password reset / email verification: per-IP, reset mail is tighter to limit mail abuse.
+		{routeKey: "auth_password_reset_request", limit: 5, window: 15 * time.Minute, subject: subjectIP},
+		{routeKey: "auth_password_reset", limit: 10, window: 1 * time.Minute, subject: subjectIP},
+		{routeKey: "auth_email_verify", limit: 10, window: 1 * time.Minute, subject: subjectIP},
+		// OAuth client endpoints (token, introspect, revoke): per-IP; they check client secrets.
+		{routeKey: "oauth_client", limit: 60, window: 1 * time.Minute, subject: subjectIP},
 		// Media upload: per-user, low frequency + daily cap.
 		{routeKey: "media_upload", limit: 10, window: 10 * time.Minute, subject: subjectUser},
 		{routeKey: "media_upload", limit: 50, window: 24 * time.Hour, subject: subjectUser},
@@ -217,6 +223,14 @@ func classifyAuthRoute(method, path string) string {
 		return "auth_stepup_start"
 	case "/api/v1/auth/stepup/finish":
 		return "auth_stepup_finish"
+	case "/api/v1/auth/password/reset/request":
+		return "auth_password_reset_request"
+	case "/api/v1/auth/password/reset":
+		return "auth_password_reset"
+	case "/api/v1/auth/email/verify":
+		return "auth_email_verify"
+	case "/api/v1/oauth/token", "/api/v1/oauth/introspect", "/api/v1/oauth/revoke":
+		return "oauth_client"
 	default:
 		return ""
 	}
@@ -229,11 +243,12 @@ func classifyMediaRoute(method, path string) string {
 		return "media_upload"
 	}
 
-	// Public media delivery (GET /media/*)
-	if method == http.MethodGet && strings.HasPrefix(path, "/media/") {
-		// ServeImage supports /media/{id}/image.png and /media/{id}/image.webp
-		if strings.HasSuffix(path, "/image.png") || strings.HasSuffix(path, "/image.webp") {
-			return "media_get"
+	// Public media delivery (GET/HEAD /media/*)
+	if (method == http.MethodGet || method == http.MethodHead) && strings.HasPrefix(path, "/media/") {
+		for _, suffix := range []string{"/image.png", "/image.webp", "/video.mp4", "/poster.webp"} {
+			if strings.HasSuffix(path, suffix) {
+				return "media_get"
+			}
 		}
 	}
 
@@ -4,6 +4,8 @@ import (
 	"errors"
 
 	"backend/internal/api"
+
+	"github.com/google/uuid"
 )
 
 // EventType identifies the kind of realtime update.
@@ -13,14 +15,47 @@ const (
 	EventPostCreated     EventType = "post_created"
 	EventPostDeleted     EventType = "post_deleted"
 	EventReactionUpdated EventType = "reaction_updated"
+	EventMediaReady      EventType = "media_ready"
+	EventMediaFailed     EventType = "media_failed"
+	EventPostHidden      EventType = "post_hidden"
+	EventPostUnhidden    EventType = "post_unhidden"
+	EventMediaDeleted    EventType = "media_deleted"
+	EventUserUpdated     EventType = "user_updated"
+
+	// Presence and typing events are ephemeral: they carry no ID, are not
+	// retained for resume and are never stored in the database.
+	EventPresenceUpdated EventType = "presence_updated"
+	EventTyping          EventType = "typing"
 )
 
 // Event is the payload delivered over realtime channels.
 type Event struct {
+	// Id orders events and lets clients resume after it. It is assigned
+	// when the event is published.
+	Id             string              `json:"id,omitempty"`
 	Type           EventType           `json:"type"`
 	Post           *api.Post           `json:"post,omitempty"`
 	PostId         *api.PostId         `json:"postId,omitempty"`
 	ReactionCounts *api.ReactionCounts `json:"reactionCounts,omitempty"`
+	Media          *api.Media          `json:"media,omitempty"`
+	MediaId        *api.MediaId        `json:"mediaId,omitempty"`
+	Reason         *string             `json:"reason,omitempty"`
+	// User is the public profile of an updated user. Clients patch it into
+	// the authors they have cached.
+	User     *api.User     `json:"user,omitempty"`
+	Presence *api.Presence `json:"presence,omitempty"`
+	Typing   *Typing       `json:"typing,omitempty"`
+
+	// UserId restricts delivery to that user's connections. Events without
+	// it are broadcast to everyone.
+	UserId *uuid.UUID `json:"userId,omitempty"`
+}
+
+// Typing reports that a user is composing in a topic: a reply under a post
+// topic or a direct message to the user of a user topic.
+type Typing struct {
+	UserId uuid.UUID `json:"userId"`
+	Topic  string    `json:"topic"`
 }
 
 // Validate ensures required fields for each event type.
@@ -38,6 +73,57 @@ func (e Event) Validate() error {
 		if e.ReactionCounts == nil {
 			return errors.New("reactionCounts required")
 		}
+	case EventMediaReady:
+		if e.Media == nil {
+			return errors.New("media required")
+		}
+		if e.UserId == nil {
+			return errors.New("userId required")
+		}
+	case EventMediaFailed:
+		if e.MediaId == nil {
+			return errors.New("mediaId required")
+		}
+		if e.UserId == nil {
+			return errors.New("userId required")
+		}
+	case EventPostHidden:
+		if e.PostId == nil {
+			return errors.New("postId required")
+		}
+	case EventPostUnhidden:
+		if e.Post == nil {
+			return errors.New("post required")
+		}
+	case EventMediaDeleted:
+		if e.MediaId == nil {
+			return errors.New("mediaId required")
+		}
+	case EventUserUpdated:
+		if e.User == nil {
+			return errors.New("user required")
+		}
+		// Agreement state is private to the user.
+		if e.User.TermsVersion != nil || e.User.PrivacyVersion != nil ||
+			e.User.TermsAcceptedAt != nil || e.User.PrivacyAcceptedAt != nil || e.User.IsAdmin != nil {
+			return errors.New("user must be a public profile")
+		}
+	case EventPresenceUpdated:
+		if e.Presence == nil {
+			return errors.New("presence required")
+		}
+	case EventTyping:
+		if e.Typing == nil {
+			return errors.New("typing required")
+		}
+		recipient, ok := typingRecipient(e.Typing.Topic)
+		if !ok {
+			return errors.New("invalid typing topic")
+		}
+		// Direct message indicators are addressed to their recipient only.
+		if recipient != uuid.Nil && (e.UserId == nil || *e.UserId != recipient) {
+			return errors.New("userId must be the recipient")
+		}
 	default:
 		return errors.New("invalid event type")
 	}
@@ -0,0 +1,258 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// eventStream retains every published event, addressed or not, so
+	// reconnecting clients can catch up. Entry IDs are the event IDs.
+	eventStream = "realtime:events"
+
+	// historySize is the number of events retained for replay. Redis trims
+	// approximately, so slightly more may be kept.
+	historySize = 10000
+
+	// maxReplayEvents is the largest gap a client can resume across; past
+	// it the client is told to resync instead.
+	maxReplayEvents = 200
+
+	// dedupKeyPrefix is followed by the key passed to PublishOnce.
+	dedupKeyPrefix = "realtime:dedup:"
+
+	// dedupTTL is how long PublishOnce remembers a key. It must outlast
+	// every retry of the same event.
+	dedupTTL = time.Hour
+)
+
+// publishScript appends a wire message to the event stream and publishes it
+// with its entry ID on a channel. Running both in one script keeps channel
+// order identical to ID order across instances. When a dedup key is given
+// and already set, nothing is published and the script returns nil.
+//
+// KEYS[1] stream, ARGV[1] max length, ARGV[2] wire message, ARGV[3] channel,
+// ARGV[4] dedup key or empty, ARGV[5] dedup TTL in seconds.
+var publishScript = redis.NewScript(`
+if ARGV[4] ~= '' and not redis.call('SET', ARGV[4], '1', 'NX', 'EX', ARGV[5]) then
+  return false
+end
+local id = redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'msg', ARGV[2])
+redis.call('PUBLISH', ARGV[3], '{"id":"' .. id .. '","msg":' .. ARGV[2] .. '}')
+return id
+`)
+
+// streamMessage is what publishScript sends on channels.
+type streamMessage struct {
+	ID  string          `json:"id"`
+	Msg json.RawMessage `json:"msg"`
+}
+
+// eventID is a parsed "<milliseconds>-<sequence>" ID, the format of Redis
+// stream entry IDs.
+type eventID struct {
+	ms, seq uint64
+}
+
+func parseEventID(s string) (eventID, bool) {
+	msPart, seqPart, ok := strings.Cut(s, "-")
+	if !ok {
+		return eventID{}, false
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return eventID{}, false
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return eventID{}, false
+	}
+	return eventID{ms: ms, seq: seq}, true
+}
+
+func (id eventID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id eventID) after(other eventID) bool {
+	return id.ms > other.ms || id.ms == other.ms && id.seq > other.seq
+}
+
+// memoryHistory retains events for hubs without Redis.
+type memoryHistory struct {
+	mu      sync.Mutex
+	last    eventID
+	entries []outbound          // ring buffer of historySize entries
+	start   int                 // index of the oldest entry once full
+	keys    map[string]struct{} // dedup keys of retained entries
+}
+
+// nextID returns an ID after every previous one. The caller holds mu.
+func (m *memoryHistory) nextID() eventID {
+	ms := uint64(time.Now().UnixMilli())
+	if ms > m.last.ms {
+		m.last = eventID{ms: ms}
+	} else {
+		m.last.seq++
+	}
+	return m.last
+}
+
+// add retains msg. The caller holds mu.
+func (m *memoryHistory) add(msg outbound) {
+	if msg.key != "" {
+		if m.keys == nil {
+			m.keys = make(map[string]struct{})
+		}
+		m.keys[msg.key] = struct{}{}
+	}
+	if len(m.entries) < historySize {
+		m.entries = append(m.entries, msg)
+		return
+	}
+	if evicted := m.entries[m.start].key; evicted != "" {
+		delete(m.keys, evicted)
+	}
+	m.entries[m.start] = msg
+	m.start = (m.start + 1) % historySize
+}
+
+// seen reports whether an event with the dedup key is retained. The caller
+// holds mu.
+func (m *memoryHistory) seen(key string) bool {
+	_, ok := m.keys[key]
+	return ok
+}
+
+// since returns the retained events after id, or false when id is no longer
+// retained or more than limit events followed it.
+func (m *memoryHistory) since(id eventID, limit int) ([]outbound, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.entries)
+	for i := range n {
+		entry := m.entries[(m.start+i)%n]
+		if entry.id == id {
+			if n-i-1 > limit {
+				return nil, false
+			}
+			out := make([]outbound, 0, n-i-1)
+			for j := i + 1; j < n; j++ {
+				out = append(out, m.entries[(m.start+j)%n])
+			}
+			return out, true
+		}
+		if entry.id.after(id) {
+			break
+		}
+	}
+	return nil, false
+}
+
+// since returns up to maxReplayEvents events published after id, or false
+// when the client must resync because id is no longer retained or too many
+// events followed it.
+func (h *Hub) since(ctx context.Context, id eventID) ([]outbound, bool, error) {
+	if h.rdb == nil {
+		out, ok := h.memory.since(id, maxReplayEvents)
+		return out, ok, nil
+	}
+	// The range includes id itself, which proves it is still retained, and
+	// one more entry than can be replayed to detect overlong gaps.
+	entries, err := h.rdb.XRangeN(ctx, eventStream, id.String(), "+", maxReplayEvents+2).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(entries) == 0 || entries[0].ID != id.String() || len(entries) > maxReplayEvents+1 {
+		return nil, false, nil
+	}
+	out := make([]outbound, 0, len(entries)-1)
+	for _, entry := range entries[1:] {
+		wire, _ := entry.Values["msg"].(string)
+		entryID, ok := parseEventID(entry.ID)
+		if !ok {
+			continue
+		}
+		if msg, ok := h.decodeWire(entryID, []byte(wire)); ok {
+			out = append(out, msg)
+		}
+	}
+	return out, true, nil
+}
+
+// decodeWire verifies and decodes a message published by any instance and
+// returns it ready for delivery with its ID set.
+func (h *Hub) decodeWire(id eventID, wire []byte) (outbound, bool) {
+	payload := wire
+	if h.signer != nil {
+		var signed signedMessage
+		if err := json.Unmarshal(wire, &signed); err != nil {
+			return outbound{}, false
+		}
+		if len(signed.Payload) == 0 || strings.TrimSpace(signed.Sig) == "" {
+			return outbound{}, false
+		}
+		if !h.signer.Verify(signed.Payload, signed.Kid, signed.Sig) {
+			return outbound{}, false
+		}
+		payload = signed.Payload
+	}
+	if len(payload) > maxPayloadBytes {
+		return outbound{}, false
+	}
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return outbound{}, false
+	}
+	if err := event.Validate(); err != nil {
+		return outbound{}, false
+	}
+	if id != (eventID{}) {
+		event.Id = id.String()
+		var err error
+		if payload, err = json.Marshal(event); err != nil {
+			return outbound{}, false
+		}
+	}
+	return newOutbound(id, payload, event), true
+}
+
+func newOutbound(id eventID, payload []byte, event Event) outbound {
+	msg := outbound{id: id, payload: payload, topics: event.Topics(), signed: &clientSignature{}}
+	if event.UserId != nil {
+		msg.userID = *event.UserId
+	}
+	// Reaction counts, profiles, presence and typing are state, not a
+	// change: only the latest matters.
+	switch {
+	case event.Type == EventReactionUpdated && event.ReactionCounts != nil:
+		msg.coalesce = string(event.Type) + ":" + event.ReactionCounts.PostId.String()
+	case event.Type == EventUserUpdated && event.User != nil:
+		msg.coalesce = string(event.Type) + ":" + event.User.Id.String()
+	case event.Type == EventPresenceUpdated && event.Presence != nil:
+		msg.coalesce = string(event.Type) + ":" + event.Presence.UserId.String()
+	case event.Type == EventTyping && event.Typing != nil:
+		msg.coalesce = string(event.Type) + ":" + event.Typing.UserId.String() + ":" + event.Typing.Topic
+	}
+	return msg
+}
+
+// wants reports whether msg is for client.
+func (c *Client) wants(msg outbound) bool {
+	if msg.userID != uuid.Nil {
+		return c.userID == msg.userID
+	}
+	for _, topic := range msg.topics {
+		if _, ok := c.topics[topic]; ok {
+			return true
+		}
+	}
+	return false
+}
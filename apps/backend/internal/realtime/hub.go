@@ -3,85 +3,227 @@ package realtime
 import (
 	"context"
 	"encoding/json"
-	"strings"
+	"errors"
+	"log/slog"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"backend/internal/api"
+	"backend/internal/auth"
+
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/redis/go-redis/v9"
 )
 
-const timelineChannel = "realtime:timeline"
+const (
+	timelineChannel = "realtime:timeline"
+	// userChannelPrefix is followed by a user ID. Each instance subscribes
+	// to the channels of the users connected to it.
+	userChannelPrefix = "realtime:user:"
+
+	// broadcastBuffer is the fan-out queue of the hub loop. Publishers wait
+	// up to enqueueWait for room before the event is dropped.
+	broadcastBuffer = 128
+	enqueueWait     = 2 * time.Second
+)
+
+func userChannel(userID uuid.UUID) string {
+	return userChannelPrefix + userID.String()
+}
 
 // Publisher broadcasts realtime events.
 type Publisher interface {
 	Publish(ctx context.Context, event Event) error
 }
 
-// Hub manages realtime clients and fan-out.
+// OncePublisher is implemented by publishers that can deduplicate retried
+// events by key.
+type OncePublisher interface {
+	PublishOnce(ctx context.Context, key string, event Event) error
+}
+
+// Hub manages realtime clients and fan-out. Clients are spread over
+// shards, each with its own loop.
 type Hub struct {
-	rdb        *redis.Client
-	signer     *Signer
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan []byte
-	clients    map[*Client]struct{}
-	subReady   chan struct{}
-	subOnce    sync.Once
+	rdb       *redis.Client
+	signer    *Signer
+	broadcast chan outbound
+	shards    []*shard
+	next      atomic.Uint64  // Round-robin shard assignment
+	memory    *memoryHistory // History when there is no Redis
+	subReady  chan struct{}
+	subOnce   sync.Once
+
+	// wantUsers counts the shards with connections of each user for the
+	// Redis subscriber, which is woken through resync when the set changes.
+	wantMu    sync.Mutex
+	wantUsers map[uuid.UUID]int
+	resync    chan struct{}
+
+	presence *presenceTracker
+
+	stats hubStats
+}
+
+// HubOptions tunes a Hub.
+type HubOptions struct {
+	// Shards is the number of fan-out loops. It defaults to GOMAXPROCS.
+	Shards int
+	// Signer signs messages between instances and events for clients that
+	// ask for signed events. It defaults to NewSignerFromEnv.
+	Signer *Signer
+}
+
+// outbound is a payload queued for delivery. A non-nil userID limits it to
+// that user's clients; otherwise it goes to the subscribers of topics. The
+// id is zero for events that could not be retained.
+type outbound struct {
+	id       eventID
+	payload  []byte
+	userID   uuid.UUID
+	topics   []string
+	key      string // PublishOnce key, retained in memory history
+	coalesce string // Queued payloads with the same key are superseded
+	signed   *clientSignature
+}
+
+// clientSignature is the signed form of an outbound payload. Shards with
+// clients that asked for signed events compute it on first use and share
+// it.
+type clientSignature struct {
+	once    sync.Once
+	payload []byte
+}
+
+// clientPayload returns the payload for client: wrapped in a SignedEvent
+// when the client asked for signed events.
+func (msg outbound) clientPayload(client *Client, signer *Signer) []byte {
+	if !client.signed || signer == nil || msg.signed == nil {
+		return msg.payload
+	}
+	msg.signed.once.Do(func() {
+		kid, sig := signer.Sign(msg.payload)
+		msg.signed.payload, _ = json.Marshal(SignedEvent{Payload: string(msg.payload), Kid: kid, Sig: sig})
+	})
+	if msg.signed.payload == nil {
+		return msg.payload
+	}
+	return msg.signed.payload
 }
 
-// NewHub initializes a realtime hub.
+// NewHub initializes a realtime hub with default options.
 func NewHub(rdb *redis.Client) *Hub {
+	return NewHubWithOptions(rdb, HubOptions{})
+}
+
+// NewHubWithOptions initializes a realtime hub.
+func NewHubWithOptions(rdb *redis.Client, opts HubOptions) *Hub {
+	shards := opts.Shards
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	signer := opts.Signer
+	if signer == nil {
+		signer = NewSignerFromEnv()
+	}
 	h := &Hub{
-		rdb:        rdb,
-		signer:     NewSignerFromEnv(),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan []byte, 128),
-		clients:    make(map[*Client]struct{}),
-		subReady:   make(chan struct{}),
+		rdb:       rdb,
+		signer:    signer,
+		broadcast: make(chan outbound, broadcastBuffer),
+		subReady:  make(chan struct{}),
+		wantUsers: make(map[uuid.UUID]int),
+		resync:    make(chan struct{}, 1),
+	}
+	h.presence = newPresenceTracker(h)
+	h.shards = make([]*shard, shards)
+	for i := range h.shards {
+		h.shards[i] = newShard(h)
 	}
 	if rdb == nil {
+		h.memory = &memoryHistory{}
 		h.markSubReady()
 	}
 	return h
 }
 
-// Run starts the hub event loop.
+// nextShard picks the shard of a new client.
+func (h *Hub) nextShard() *shard {
+	return h.shards[(h.next.Add(1)-1)%uint64(len(h.shards))]
+}
+
+// Run starts the hub's shards and feeds them published events.
 func (h *Hub) Run(ctx context.Context) {
 	if h.rdb != nil {
 		go h.subscribeRedis(ctx)
 	}
+	go h.presence.run(ctx)
+	for _, s := range h.shards {
+		go s.run(ctx)
+	}
 	for {
 		select {
 		case <-ctx.Done():
-			for client := range h.clients {
-				delete(h.clients, client)
-				close(client.send)
-			}
 			return
-		case client := <-h.register:
-			h.clients[client] = struct{}{}
-		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
 		case msg := <-h.broadcast:
-			for client := range h.clients {
+			for _, s := range h.shards {
 				select {
-				case client.send <- msg:
-				default:
-					delete(h.clients, client)
-					close(client.send)
+				case s.broadcast <- msg:
+				case <-ctx.Done():
+					return
 				}
 			}
 		}
 	}
 }
 
-// Publish sends an event to all subscribers.
+// setWantUser records whether a shard needs the user's Redis channel and
+// wakes the subscriber when the first shard starts or the last one stops
+// needing it.
+func (h *Hub) setWantUser(userID uuid.UUID, want bool) {
+	if h.rdb == nil {
+		return
+	}
+	h.wantMu.Lock()
+	if want {
+		h.wantUsers[userID]++
+		if h.wantUsers[userID] > 1 {
+			h.wantMu.Unlock()
+			return
+		}
+	} else {
+		if h.wantUsers[userID]--; h.wantUsers[userID] > 0 {
+			h.wantMu.Unlock()
+			return
+		}
+		delete(h.wantUsers, userID)
+	}
+	h.wantMu.Unlock()
+	select {
+	case h.resync <- struct{}{}:
+	default:
+	}
+}
+
+// Publish sends an event to the subscribers of its topics, or only to the
+// connections of event.UserId when it is set.
 func (h *Hub) Publish(ctx context.Context, event Event) error {
+	return h.publish(ctx, "", event)
+}
+
+// PublishOnce publishes event unless an event with the same key was
+// published recently, so that callers can retry until it succeeds. Unlike
+// Publish, it does not fall back to local delivery when Redis fails.
+func (h *Hub) PublishOnce(ctx context.Context, key string, event Event) error {
+	if key == "" {
+		return errors.New("dedup key required")
+	}
+	return h.publish(ctx, key, event)
+}
+
+func (h *Hub) publish(ctx context.Context, key string, event Event) error {
 	if err := event.Validate(); err != nil {
 		return err
 	}
@@ -89,32 +231,136 @@ func (h *Hub) Publish(ctx context.Context, event Event) error {
 	if err != nil {
 		return err
 	}
-	wirePayload := payload
-	if h.signer != nil {
-		wirePayload, err = json.Marshal(signedMessage{
-			Payload: payload,
-			Sig:     h.signer.Sign(payload),
-		})
-		if err != nil {
-			return err
-		}
+	wirePayload, err := h.wire(payload)
+	if err != nil {
+		return err
 	}
 	if h.rdb != nil {
-		if err := h.rdb.Publish(ctx, timelineChannel, wirePayload).Err(); err != nil {
-			h.enqueue(payload)
+		channel := eventChannel(event)
+		dedupKey := ""
+		if key != "" {
+			dedupKey = dedupKeyPrefix + key
+		}
+		err := publishScript.Run(ctx, h.rdb, []string{eventStream},
+			historySize, wirePayload, channel, dedupKey, int(dedupTTL/time.Second)).Err()
+		if errors.Is(err, redis.Nil) {
+			return nil // already published
+		}
+		if err != nil {
+			h.stats.publishErrors.Add(1)
+			if key == "" {
+				h.enqueue(ctx, newOutbound(eventID{}, payload, event))
+			}
 			return err
 		}
 		return nil
 	}
-	h.enqueue(payload)
+
+	// Assigning the ID and queueing under one lock keeps delivery in ID
+	// order.
+	h.memory.mu.Lock()
+	defer h.memory.mu.Unlock()
+	if key != "" && h.memory.seen(key) {
+		return nil
+	}
+	id := h.memory.nextID()
+	event.Id = id.String()
+	if payload, err = json.Marshal(event); err != nil {
+		return err
+	}
+	msg := newOutbound(id, payload, event)
+	msg.key = key
+	h.memory.add(msg)
+	h.enqueue(ctx, msg)
 	return nil
 }
 
-func (h *Hub) enqueue(payload []byte) {
+// publishEphemeral delivers event on every instance without retaining it:
+// it gets no ID, is not replayed on resume and cannot be deduplicated.
+func (h *Hub) publishEphemeral(ctx context.Context, event Event) error {
+	if err := event.Validate(); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if h.rdb == nil {
+		h.enqueue(ctx, newOutbound(eventID{}, payload, event))
+		return nil
+	}
+	wirePayload, err := h.wire(payload)
+	if err != nil {
+		return err
+	}
+	if err := h.rdb.Publish(ctx, eventChannel(event), wirePayload).Err(); err != nil {
+		h.stats.publishErrors.Add(1)
+		return err
+	}
+	return nil
+}
+
+// wire wraps payload for other instances, signing it when a signer is set.
+func (h *Hub) wire(payload []byte) ([]byte, error) {
+	if h.signer == nil {
+		return payload, nil
+	}
+	kid, sig := h.signer.Sign(payload)
+	return json.Marshal(signedMessage{
+		Payload: payload,
+		Kid:     kid,
+		Sig:     sig,
+	})
+}
+
+// CanSignEvents reports whether clients can ask for signed events.
+func (h *Hub) CanSignEvents() bool {
+	return h.signer.CanSignEvents()
+}
+
+// SigningKeys returns the public keys that verify signed events.
+func (h *Hub) SigningKeys() auth.JWKSet {
+	return h.signer.JWKS()
+}
+
+// eventChannel is the Redis channel event travels on.
+func eventChannel(event Event) string {
+	if event.UserId != nil {
+		return userChannel(*event.UserId)
+	}
+	return timelineChannel
+}
+
+// PublishToUser sends an event to the connections of userID on every
+// instance.
+func (h *Hub) PublishToUser(ctx context.Context, userID uuid.UUID, event Event) error {
+	event.UserId = &userID
+	return h.Publish(ctx, event)
+}
+
+// enqueue hands msg to the hub loop, waiting up to enqueueWait while the
+// queue is full. Events that still do not fit are counted as dropped.
+func (h *Hub) enqueue(ctx context.Context, msg outbound) {
 	select {
-	case h.broadcast <- payload:
+	case h.broadcast <- msg:
+		return
 	default:
 	}
+	timer := time.NewTimer(enqueueWait)
+	defer timer.Stop()
+	select {
+	case h.broadcast <- msg:
+	case <-ctx.Done():
+		h.dropEvent()
+	case <-timer.C:
+		h.dropEvent()
+	}
+}
+
+func (h *Hub) dropEvent() {
+	if h.stats.droppedEvents.Add(1)%100 == 1 {
+		slog.Warn("realtime broadcast queue full; dropping events", "dropped_total", h.stats.droppedEvents.Load())
+	}
 }
 
 func (h *Hub) subscribeRedis(ctx context.Context) {
@@ -128,15 +374,60 @@ func (h *Hub) subscribeRedis(ctx context.Context) {
 		return
 	}
 	ch := pubsub.Channel()
+	subscribed := make(map[uuid.UUID]struct{})
+	h.syncUserChannels(ctx, pubsub, subscribed)
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-h.resync:
+			h.syncUserChannels(ctx, pubsub, subscribed)
 		case msg, ok := <-ch:
 			if !ok {
 				return
 			}
-			h.handleRedisPayload([]byte(msg.Payload))
+			h.handleRedisPayload(ctx, msg.Channel, []byte(msg.Payload))
+		}
+	}
+}
+
+// syncUserChannels subscribes to the channels of newly connected users and
+// unsubscribes from those of users that left. subscribed is updated to the
+// channels actually held.
+func (h *Hub) syncUserChannels(ctx context.Context, pubsub *redis.PubSub, subscribed map[uuid.UUID]struct{}) {
+	var add, drop []string
+	var added, dropped []uuid.UUID
+	h.wantMu.Lock()
+	for userID := range h.wantUsers {
+		if _, ok := subscribed[userID]; !ok {
+			add = append(add, userChannel(userID))
+			added = append(added, userID)
+		}
+	}
+	for userID := range subscribed {
+		if _, ok := h.wantUsers[userID]; !ok {
+			drop = append(drop, userChannel(userID))
+			dropped = append(dropped, userID)
+		}
+	}
+	h.wantMu.Unlock()
+
+	if len(add) > 0 {
+		if err := pubsub.Subscribe(ctx, add...); err != nil {
+			slog.Warn("failed to subscribe to realtime user channels", "error", err)
+		} else {
+			for _, userID := range added {
+				subscribed[userID] = struct{}{}
+			}
+		}
+	}
+	if len(drop) > 0 {
+		if err := pubsub.Unsubscribe(ctx, drop...); err != nil {
+			slog.Warn("failed to unsubscribe from realtime user channels", "error", err)
+		} else {
+			for _, userID := range dropped {
+				delete(subscribed, userID)
+			}
 		}
 	}
 }
@@ -159,73 +450,131 @@ func (h *Hub) WaitReady(ctx context.Context) bool {
 
 // Register adds a client to the hub.
 func (h *Hub) Register(client *Client) {
-	h.register <- client
+	client.shard.register <- client
 }
 
+// Unregister removes a client from the hub and closes its send queue.
+func (h *Hub) Unregister(client *Client) {
+	client.shard.unregister <- client
+}
+
+// signedMessage is the wire format between instances when a signer is
+// set. Kid is empty on instances that predate key IDs.
 type signedMessage struct {
 	Payload json.RawMessage `json:"payload"`
+	Kid     string          `json:"kid,omitempty"`
 	Sig     string          `json:"sig"`
 }
 
-func (h *Hub) handleRedisPayload(payload []byte) {
+func (h *Hub) handleRedisPayload(ctx context.Context, channel string, payload []byte) {
 	if len(payload) == 0 {
 		return
 	}
-	if h.signer == nil {
-		h.handlePayload(payload)
-		return
-	}
-	var signed signedMessage
-	if err := json.Unmarshal(payload, &signed); err != nil {
-		return
-	}
-	if len(signed.Payload) == 0 || strings.TrimSpace(signed.Sig) == "" {
-		return
-	}
-	if !h.signer.Verify(signed.Payload, signed.Sig) {
-		return
-	}
-	h.handlePayload(signed.Payload)
-}
-
-func (h *Hub) handlePayload(payload []byte) {
-	if len(payload) > maxPayloadBytes {
-		return
+	// Messages without an ID are ephemeral, or come from instances that
+	// predate the event stream.
+	var id eventID
+	var sm streamMessage
+	if err := json.Unmarshal(payload, &sm); err == nil && len(sm.Msg) > 0 {
+		var ok bool
+		if id, ok = parseEventID(sm.ID); !ok {
+			return
+		}
+		payload = sm.Msg
 	}
-	var event Event
-	if err := json.Unmarshal(payload, &event); err != nil {
+	msg, ok := h.decodeWire(id, payload)
+	if !ok {
 		return
 	}
-	if err := event.Validate(); err != nil {
+	// Addressed events travel only on their user's channel.
+	if channel != timelineChannel && (msg.userID == uuid.Nil || channel != userChannel(msg.userID)) {
 		return
 	}
-	h.enqueue(payload)
+	h.enqueue(ctx, msg)
 }
 
 // Client represents a websocket connection.
 type Client struct {
-	hub   *Hub
-	conn  *websocket.Conn
-	send  chan []byte
-	close func()
+	hub     *Hub
+	shard   *shard
+	conn    *websocket.Conn
+	queue   *sendQueue
+	close   func()
+	userID  uuid.UUID // uuid.Nil for anonymous connections
+	initial []string  // Topics subscribed to on registration
+
+	sendOnce sync.Once
+	send     chan []byte // Feeds SendChan
+
+	// Owned by the shard goroutine.
+	topics    map[string]struct{}
+	replaying bool       // A resume is being served
+	pending   []outbound // Live events held back during a resume
+	presence  api.PresenceStatus
+	ephemeral tokenBucket // Limits presence and typing commands
+
+	signed bool // Events are delivered as SignedEvent
 }
 
 const (
 	writeWait       = 10 * time.Second
 	pongWait        = 60 * time.Second
 	pingPeriod      = (pongWait * 9) / 10
-	maxMessageSize  = 512
+	maxMessageSize  = 4096
 	maxPayloadBytes = 1 << 20
+
+	// sendBuffer holds a full replay besides live events.
+	sendBuffer       = maxReplayEvents + 2*maxPendingEvents
+	maxPendingEvents = 64
 )
 
+func newClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID, topics []string) *Client {
+	return &Client{
+		hub:     hub,
+		shard:   hub.nextShard(),
+		conn:    conn,
+		queue:   newSendQueue(sendBuffer),
+		userID:  userID,
+		initial: topics,
+	}
+}
+
 // NewClient builds a new realtime client.
 func NewClient(hub *Hub, conn *websocket.Conn, onClose func()) *Client {
-	return &Client{
-		hub:   hub,
-		conn:  conn,
-		send:  make(chan []byte, 16),
-		close: onClose,
+	c := newClient(hub, conn, uuid.Nil, []string{TopicTimeline})
+	c.close = onClose
+	return c
+}
+
+// NewStreamClient builds a client for a transport that reads SendChan
+// itself, such as Server-Sent Events. It starts subscribed to topics and,
+// when userID is not uuid.Nil, receives events addressed to that user.
+func NewStreamClient(hub *Hub, userID uuid.UUID, topics []string) *Client {
+	return newClient(hub, nil, userID, topics)
+}
+
+// SignEvents delivers the client's events as SignedEvent messages. It must
+// be called before the client is registered, on a hub whose CanSignEvents
+// is true.
+func (c *Client) SignEvents() {
+	c.signed = true
+}
+
+// Resume asks the hub to replay the events after lastEventID, as the resume
+// command does. The client must be registered.
+func (c *Client) Resume(lastEventID string) error {
+	if _, ok := parseEventID(lastEventID); !ok {
+		return errors.New("invalid event id")
 	}
+	c.shard.commands <- clientCommand{client: c, cmd: Command{Op: OpResume, LastEventID: lastEventID}}
+	return nil
+}
+
+// NewUserClient builds a client for an authenticated user, which also
+// receives events addressed to that user.
+func NewUserClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID, onClose func()) *Client {
+	c := NewClient(hub, conn, onClose)
+	c.userID = userID
+	return c
 }
 
 // Run registers the client and pumps messages.
@@ -235,14 +584,38 @@ func (c *Client) Run() {
 	c.readPump()
 }
 
-// SendChan exposes the outbound messages channel.
+// SendChan exposes the outbound messages. It is closed when the hub drops
+// the client; CloseCode then tells why.
 func (c *Client) SendChan() <-chan []byte {
+	c.sendOnce.Do(func() {
+		c.send = make(chan []byte)
+		go func() {
+			defer close(c.send)
+			for {
+				payload, ok := c.queue.next()
+				if !ok {
+					return
+				}
+				select {
+				case c.send <- payload:
+				case <-c.queue.done:
+					return
+				}
+			}
+		}()
+	})
 	return c.send
 }
 
+// CloseCode returns the websocket close code the hub ended the client
+// with, such as CloseSlowConsumer, or 0 while it is connected.
+func (c *Client) CloseCode() int {
+	return c.queue.closeReason().code
+}
+
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.Unregister(c)
 		_ = c.conn.Close()
 		if c.close != nil {
 			c.close()
@@ -255,9 +628,18 @@ func (c *Client) readPump() {
 		return nil
 	})
 	for {
-		if _, _, err := c.conn.ReadMessage(); err != nil {
+		typ, msg, err := c.conn.ReadMessage()
+		if err != nil {
 			return
 		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		cc := clientCommand{client: c}
+		if typ != websocket.TextMessage {
+			cc.reject = &Reply{Type: ReplyError, Code: "invalid_command", Message: "commands must be text messages"}
+		} else {
+			cc.cmd, cc.reject = parseCommand(msg)
+		}
+		c.shard.commands <- cc
 	}
 }
 
@@ -268,16 +650,20 @@ func (c *Client) writePump() {
 		_ = c.conn.Close()
 	}()
 	for {
-		select {
-		case msg, ok := <-c.send:
+		if payload, ok := c.queue.pop(); ok {
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
 				return
 			}
+			continue
+		}
+		select {
+		case <-c.queue.ready:
+		case <-c.queue.done:
+			reason := c.queue.closeReason()
+			_ = c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(reason.code, reason.text), time.Now().Add(writeWait))
+			return
 		case <-ticker.C:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
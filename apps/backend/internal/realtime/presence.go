@@ -0,0 +1,407 @@
+package realtime
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"backend/internal/api"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// presenceKeyPrefix is followed by a user ID. The sorted set holds one
+	// "<instance>:<status>" member per instance with connections of the
+	// user, scored by when it expires.
+	presenceKeyPrefix = "realtime:presence:"
+	// presenceHiddenKey is the set of users who hide their presence.
+	presenceHiddenKey = "realtime:presence-hidden"
+
+	// presenceHeartbeat is how often an instance refreshes the presence of
+	// its users. Entries of an instance that stops refreshing them expire
+	// after presenceTTL.
+	presenceHeartbeat = 30 * time.Second
+	presenceTTL       = 3 * presenceHeartbeat
+	// presenceFlushTimeout bounds marking local users offline when the hub
+	// stops.
+	presenceFlushTimeout = 5 * time.Second
+)
+
+func presenceKey(userID uuid.UUID) string {
+	return presenceKeyPrefix + userID.String()
+}
+
+// presenceStatusLua computes a user's presence from KEYS[1], the user's
+// sorted set, and KEYS[2], the hidden set. ARGV[1] is the user ID and
+// ARGV[2] the current time in milliseconds.
+const presenceStatusLua = `
+local function status()
+  if redis.call('SISMEMBER', KEYS[2], ARGV[1]) == 1 then
+    return 'offline'
+  end
+  local result = 'offline'
+  for _, member in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], '(' .. ARGV[2], '+inf')) do
+    if string.sub(member, -7) == ':online' then
+      return 'online'
+    end
+    result = 'away'
+  end
+  return result
+end
+`
+
+// presenceSetScript replaces the entry of an instance and returns the
+// user's presence before and after.
+//
+// ARGV[3] instance ID, ARGV[4] status or empty to remove the entry,
+// ARGV[5] expiry in milliseconds, ARGV[6] TTL in milliseconds.
+var presenceSetScript = redis.NewScript(presenceStatusLua + `
+local before = status()
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+redis.call('ZREM', KEYS[1], ARGV[3] .. ':online', ARGV[3] .. ':away')
+if ARGV[4] ~= '' then
+  redis.call('ZADD', KEYS[1], ARGV[5], ARGV[3] .. ':' .. ARGV[4])
+  redis.call('PEXPIRE', KEYS[1], ARGV[6])
+end
+return {before, status()}
+`)
+
+// presenceHideScript hides (ARGV[3] = "1") or shows a user's presence and
+// returns it before and after.
+var presenceHideScript = redis.NewScript(presenceStatusLua + `
+local before = status()
+if ARGV[3] == '1' then
+  redis.call('SADD', KEYS[2], ARGV[1])
+else
+  redis.call('SREM', KEYS[2], ARGV[1])
+end
+return {before, status()}
+`)
+
+var presenceGetScript = redis.NewScript(presenceStatusLua + `
+return status()
+`)
+
+// presenceStore holds the presence of users across instances. Offline
+// stands for "no connections" when setting the status of this instance.
+type presenceStore interface {
+	set(ctx context.Context, userID uuid.UUID, status api.PresenceStatus) (before, after api.PresenceStatus, err error)
+	setHidden(ctx context.Context, userID uuid.UUID, hidden bool) (before, after api.PresenceStatus, err error)
+	hidden(ctx context.Context, userID uuid.UUID) (bool, error)
+	get(ctx context.Context, userID uuid.UUID) (api.PresenceStatus, error)
+}
+
+type redisPresence struct {
+	rdb      *redis.Client
+	instance string
+}
+
+func (p redisPresence) run(ctx context.Context, script *redis.Script, userID uuid.UUID, args ...any) (any, error) {
+	args = append([]any{userID.String(), time.Now().UnixMilli()}, args...)
+	return script.Run(ctx, p.rdb, []string{presenceKey(userID), presenceHiddenKey}, args...).Result()
+}
+
+func (p redisPresence) set(ctx context.Context, userID uuid.UUID, status api.PresenceStatus) (api.PresenceStatus, api.PresenceStatus, error) {
+	member := string(status)
+	if status == api.Offline {
+		member = ""
+	}
+	expiry := time.Now().Add(presenceTTL).UnixMilli()
+	res, err := p.run(ctx, presenceSetScript, userID, p.instance, member, expiry, presenceTTL.Milliseconds())
+	return presenceTransition(res, err)
+}
+
+func (p redisPresence) setHidden(ctx context.Context, userID uuid.UUID, hidden bool) (api.PresenceStatus, api.PresenceStatus, error) {
+	flag := "0"
+	if hidden {
+		flag = "1"
+	}
+	res, err := p.run(ctx, presenceHideScript, userID, flag)
+	return presenceTransition(res, err)
+}
+
+func (p redisPresence) hidden(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return p.rdb.SIsMember(ctx, presenceHiddenKey, userID.String()).Result()
+}
+
+func (p redisPresence) get(ctx context.Context, userID uuid.UUID) (api.PresenceStatus, error) {
+	res, err := p.run(ctx, presenceGetScript, userID)
+	if err != nil {
+		return api.Offline, err
+	}
+	status, _ := res.(string)
+	return api.PresenceStatus(status), nil
+}
+
+// presenceTransition decodes the {before, after} reply of a script.
+func presenceTransition(res any, err error) (api.PresenceStatus, api.PresenceStatus, error) {
+	if err != nil {
+		return api.Offline, api.Offline, err
+	}
+	pair, _ := res.([]any)
+	if len(pair) != 2 {
+		return api.Offline, api.Offline, nil
+	}
+	before, _ := pair[0].(string)
+	after, _ := pair[1].(string)
+	return api.PresenceStatus(before), api.PresenceStatus(after), nil
+}
+
+// memoryPresence holds presence for hubs without Redis, where this
+// instance is the only one.
+type memoryPresence struct {
+	mu       sync.Mutex
+	statuses map[uuid.UUID]api.PresenceStatus
+	hide     map[uuid.UUID]struct{}
+}
+
+func (m *memoryPresence) statusLocked(userID uuid.UUID) api.PresenceStatus {
+	if _, ok := m.hide[userID]; ok {
+		return api.Offline
+	}
+	if status, ok := m.statuses[userID]; ok {
+		return status
+	}
+	return api.Offline
+}
+
+func (m *memoryPresence) set(_ context.Context, userID uuid.UUID, status api.PresenceStatus) (api.PresenceStatus, api.PresenceStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := m.statusLocked(userID)
+	if status == api.Offline {
+		delete(m.statuses, userID)
+	} else {
+		m.statuses[userID] = status
+	}
+	return before, m.statusLocked(userID), nil
+}
+
+func (m *memoryPresence) setHidden(_ context.Context, userID uuid.UUID, hidden bool) (api.PresenceStatus, api.PresenceStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := m.statusLocked(userID)
+	if hidden {
+		m.hide[userID] = struct{}{}
+	} else {
+		delete(m.hide, userID)
+	}
+	return before, m.statusLocked(userID), nil
+}
+
+func (m *memoryPresence) hidden(_ context.Context, userID uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.hide[userID]
+	return ok, nil
+}
+
+func (m *memoryPresence) get(_ context.Context, userID uuid.UUID) (api.PresenceStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.statusLocked(userID), nil
+}
+
+// presenceTracker counts the connections of each user on this instance by
+// status and writes the resulting status of the instance to the store.
+// Shards report changes; a single loop writes them so that the store sees
+// them in order.
+type presenceTracker struct {
+	hub   *Hub
+	store presenceStore
+
+	mu    sync.Mutex
+	users map[uuid.UUID]*localPresence
+	dirty map[uuid.UUID]struct{}
+	wake  chan struct{}
+}
+
+// localPresence counts a user's connections on this instance.
+type localPresence struct {
+	online, away int
+}
+
+func (l *localPresence) status() api.PresenceStatus {
+	switch {
+	case l.online > 0:
+		return api.Online
+	case l.away > 0:
+		return api.Away
+	}
+	return api.Offline
+}
+
+func (l *localPresence) count(status api.PresenceStatus) *int {
+	switch status {
+	case api.Online:
+		return &l.online
+	case api.Away:
+		return &l.away
+	}
+	return nil
+}
+
+func newPresenceTracker(hub *Hub) *presenceTracker {
+	t := &presenceTracker{
+		hub:   hub,
+		users: make(map[uuid.UUID]*localPresence),
+		dirty: make(map[uuid.UUID]struct{}),
+		wake:  make(chan struct{}, 1),
+	}
+	if hub.rdb != nil {
+		t.store = redisPresence{rdb: hub.rdb, instance: uuid.NewString()}
+	} else {
+		t.store = &memoryPresence{
+			statuses: make(map[uuid.UUID]api.PresenceStatus),
+			hide:     make(map[uuid.UUID]struct{}),
+		}
+	}
+	return t
+}
+
+// move records that a connection of userID went from one status to
+// another, with Offline standing for connecting or disconnecting.
+func (t *presenceTracker) move(userID uuid.UUID, from, to api.PresenceStatus) {
+	if from == to {
+		return
+	}
+	t.mu.Lock()
+	local, ok := t.users[userID]
+	if !ok {
+		local = &localPresence{}
+		t.users[userID] = local
+	}
+	if n := local.count(from); n != nil && *n > 0 {
+		*n--
+	}
+	if n := local.count(to); n != nil {
+		*n++
+	}
+	t.dirty[userID] = struct{}{}
+	t.mu.Unlock()
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run writes changed statuses as they are reported and refreshes every
+// local user's entry each heartbeat. When ctx ends, the users of this
+// instance are marked offline.
+func (t *presenceTracker) run(ctx context.Context) {
+	ticker := time.NewTicker(presenceHeartbeat)
+	defer ticker.Stop()
+	for {
+		var users []uuid.UUID
+		select {
+		case <-ctx.Done():
+			t.flush(ctx)
+			return
+		case <-t.wake:
+			t.mu.Lock()
+			for userID := range t.dirty {
+				users = append(users, userID)
+			}
+			clear(t.dirty)
+			t.mu.Unlock()
+		case <-ticker.C:
+			t.mu.Lock()
+			for userID := range t.users {
+				users = append(users, userID)
+			}
+			t.mu.Unlock()
+		}
+		for _, userID := range users {
+			t.sync(ctx, userID)
+		}
+	}
+}
+
+// flush marks every user with connections or pending changes on this
+// instance offline, so that other instances need not wait for the entries
+// to expire.
+func (t *presenceTracker) flush(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), presenceFlushTimeout)
+	defer cancel()
+	t.mu.Lock()
+	users := make([]uuid.UUID, 0, len(t.users)+len(t.dirty))
+	for userID := range t.users {
+		users = append(users, userID)
+	}
+	for userID := range t.dirty {
+		if _, ok := t.users[userID]; !ok {
+			users = append(users, userID)
+		}
+	}
+	clear(t.users)
+	clear(t.dirty)
+	t.mu.Unlock()
+	for i, userID := range users {
+		if ctx.Err() != nil {
+			slog.Warn("realtime presence flush timed out", "remaining", len(users)-i)
+			return
+		}
+		before, after, err := t.store.set(ctx, userID, api.Offline)
+		if err != nil {
+			slog.Warn("failed to update realtime presence", "user_id", userID, "error", err)
+			continue
+		}
+		// Without Redis there are no other instances to tell.
+		if t.hub.rdb != nil {
+			t.announce(ctx, userID, before, after)
+		}
+	}
+}
+
+// sync writes the local status of userID and announces a change of their
+// overall presence.
+func (t *presenceTracker) sync(ctx context.Context, userID uuid.UUID) {
+	t.mu.Lock()
+	status := api.Offline
+	if local, ok := t.users[userID]; ok {
+		if status = local.status(); status == api.Offline {
+			delete(t.users, userID)
+		}
+	}
+	t.mu.Unlock()
+	before, after, err := t.store.set(ctx, userID, status)
+	if err != nil {
+		slog.Warn("failed to update realtime presence", "user_id", userID, "error", err)
+		return
+	}
+	t.announce(ctx, userID, before, after)
+}
+
+func (t *presenceTracker) announce(ctx context.Context, userID uuid.UUID, before, after api.PresenceStatus) {
+	if before == after {
+		return
+	}
+	event := Event{Type: EventPresenceUpdated, Presence: &api.Presence{UserId: userID, Status: after}}
+	if err := t.hub.publishEphemeral(ctx, event); err != nil {
+		slog.Warn("failed to publish realtime presence", "user_id", userID, "error", err)
+	}
+}
+
+// Presence returns the presence of userID across instances.
+func (h *Hub) Presence(ctx context.Context, userID uuid.UUID) (api.PresenceStatus, error) {
+	return h.presence.store.get(ctx, userID)
+}
+
+// PresenceHidden reports whether userID hides their presence.
+func (h *Hub) PresenceHidden(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return h.presence.store.hidden(ctx, userID)
+}
+
+// SetPresenceHidden hides or shows the presence of userID. Hidden users
+// appear offline on every instance while they stay connected.
+func (h *Hub) SetPresenceHidden(ctx context.Context, userID uuid.UUID, hidden bool) error {
+	before, after, err := h.presence.store.setHidden(ctx, userID, hidden)
+	if err != nil {
+		return err
+	}
+	h.presence.announce(ctx, userID, before, after)
+	return nil
+}
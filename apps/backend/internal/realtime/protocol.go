@@ -0,0 +1,172 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"backend/internal/api"
+)
+
+// Clients send JSON commands as text messages:
+//
+//	{"op": "subscribe", "topic": "post:<uuid>", "id": "1"}
+//	{"op": "unsubscribe", "topic": "timeline", "id": "2"}
+//	{"op": "ping", "id": "3"}
+//	{"op": "resume", "lastEventId": "1700000000000-0", "id": "4"}
+//	{"op": "presence", "status": "away", "id": "5"}
+//	{"op": "typing", "topic": "post:<uuid>", "id": "6"}
+//
+// The optional id is echoed in the reply: {"type": "ack", ...} for
+// subscribe and unsubscribe, {"type": "pong", ...} for ping and
+// {"type": "error", "code": ..., "message": ...} when a command is rejected.
+// Events never use these types.
+//
+// Every event carries an "id" that increases with each event. After
+// reconnecting, a client sends resume with the last ID it saw and receives
+// the events it missed on its current subscriptions, then an ack. When the
+// gap is no longer retained it gets {"type": "resync_required"} instead and
+// should refetch.
+//
+// Authenticated clients report their connection's presence as "online" or
+// "away" (for example while the tab is hidden); connections start online.
+// A user is online while any of their connections on any instance is
+// online, and subscribers of their user topic receive presence_updated
+// events when that changes. Typing announces that the user is composing a
+// reply under a post topic or a direct message to the user of a user topic;
+// clients repeat it every few seconds while typing and drop indicators not
+// refreshed since. Both are rate-limited per connection and rejected with
+// code "rate_limited" past the limit.
+//
+// Connections opened with ?signed=1 receive every event as a SignedEvent
+// whose signature verifies with the keys at /.well-known/realtime-keys.json.
+// Replies are not signed.
+//
+// A client that reads too slowly for its queue is disconnected with close
+// code 4008 (CloseSlowConsumer); it should reconnect and resume. SSE
+// streams receive an error reply with code "slow_consumer" instead. While
+// a client lags, a newer reaction_updated event for a post replaces the
+// queued one.
+const (
+	OpSubscribe   = "subscribe"
+	OpUnsubscribe = "unsubscribe"
+	OpPing        = "ping"
+	OpResume      = "resume"
+	OpPresence    = "presence"
+	OpTyping      = "typing"
+
+	ReplyAck    = "ack"
+	ReplyPong   = "pong"
+	ReplyError  = "error"
+	ReplyResync = "resync_required"
+
+	// MaxSubscriptions is the number of topics a connection may subscribe
+	// to at once.
+	MaxSubscriptions = 50
+
+	maxCommandIDLen = 64
+
+	// A connection may send ephemeralBurst presence and typing commands at
+	// once and one more every ephemeralInterval after that.
+	ephemeralBurst    = 5
+	ephemeralInterval = time.Second
+
+	// CloseSlowConsumer is the websocket close code of a client dropped
+	// for falling behind.
+	CloseSlowConsumer = 4008
+)
+
+// Command is a message sent by a client.
+type Command struct {
+	Op          string `json:"op"`
+	Topic       string `json:"topic,omitempty"`
+	LastEventID string `json:"lastEventId,omitempty"`
+	Status      string `json:"status,omitempty"`
+	ID          string `json:"id,omitempty"`
+}
+
+// Reply answers a Command.
+type Reply struct {
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Op      string `json:"op,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// clientCommand is a parsed command on its way to the hub. A non-nil reject
+// is sent back instead of applying it.
+type clientCommand struct {
+	client *Client
+	cmd    Command
+	reject *Reply
+}
+
+// parseCommand decodes and validates a client message.
+func parseCommand(msg []byte) (Command, *Reply) {
+	var cmd Command
+	if err := json.Unmarshal(msg, &cmd); err != nil {
+		return cmd, &Reply{Type: ReplyError, Code: "invalid_command", Message: "malformed command"}
+	}
+	if len(cmd.ID) > maxCommandIDLen {
+		return cmd, &Reply{Type: ReplyError, Op: cmd.Op, Code: "invalid_command", Message: "id too long"}
+	}
+	switch cmd.Op {
+	case OpSubscribe, OpUnsubscribe:
+		topic, err := ParseTopic(cmd.Topic)
+		if err != nil {
+			return cmd, &Reply{Type: ReplyError, ID: cmd.ID, Op: cmd.Op, Topic: cmd.Topic, Code: "invalid_topic", Message: err.Error()}
+		}
+		cmd.Topic = topic
+	case OpPing:
+		cmd.Topic = ""
+	case OpResume:
+		if _, ok := parseEventID(cmd.LastEventID); !ok {
+			return cmd, &Reply{Type: ReplyError, ID: cmd.ID, Op: cmd.Op, Code: "invalid_command", Message: "invalid lastEventId"}
+		}
+		cmd.Topic = ""
+	case OpPresence:
+		if cmd.Status != string(api.Online) && cmd.Status != string(api.Away) {
+			return cmd, &Reply{Type: ReplyError, ID: cmd.ID, Op: cmd.Op, Code: "invalid_command", Message: "status must be online or away"}
+		}
+		cmd.Topic = ""
+	case OpTyping:
+		topic, err := ParseTopic(cmd.Topic)
+		if err == nil {
+			if _, ok := typingRecipient(topic); !ok {
+				err = errors.New("only post and user topics can be typed in")
+			}
+		}
+		if err != nil {
+			return cmd, &Reply{Type: ReplyError, ID: cmd.ID, Op: cmd.Op, Topic: cmd.Topic, Code: "invalid_topic", Message: err.Error()}
+		}
+		cmd.Topic = topic
+	default:
+		return cmd, &Reply{Type: ReplyError, ID: cmd.ID, Op: cmd.Op, Code: "invalid_command", Message: "unknown op"}
+	}
+	return cmd, nil
+}
+
+// tokenBucket rate-limits the commands of one connection. The zero value
+// is full.
+type tokenBucket struct {
+	used float64 // Tokens taken and not yet refilled
+	last time.Time
+}
+
+// allow takes a token at now if one is left.
+func (b *tokenBucket) allow(now time.Time) bool {
+	if !b.last.IsZero() {
+		b.used -= float64(now.Sub(b.last)) / float64(ephemeralInterval)
+		if b.used < 0 {
+			b.used = 0
+		}
+	}
+	b.last = now
+	if b.used+1 > ephemeralBurst {
+		return false
+	}
+	b.used++
+	return true
+}
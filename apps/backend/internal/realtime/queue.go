@@ -0,0 +1,174 @@
+package realtime
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeReason tells a client why the hub ended its connection.
+type closeReason struct {
+	code int
+	text string
+}
+
+var (
+	closeNormal       = closeReason{code: websocket.CloseNormalClosure}
+	closeShutdown     = closeReason{code: websocket.CloseGoingAway, text: "server shutting down"}
+	closeSlowConsumer = closeReason{code: CloseSlowConsumer, text: "slow consumer"}
+)
+
+// queued is a payload waiting in a sendQueue. A nil payload marks an entry
+// superseded by a later one with the same key.
+type queued struct {
+	payload []byte
+	key     string
+}
+
+// sendQueue is the bounded outbound queue of a client. The hub pushes
+// without blocking; the client's writer takes payloads in order. Payloads
+// pushed with a key replace the queued payload with the same key, so a
+// client that falls behind receives only the latest state of, for example,
+// a post's reaction counts.
+type sendQueue struct {
+	mu     sync.Mutex
+	items  []*queued
+	head   int
+	live   int
+	limit  int
+	keys   map[string]*queued
+	ready  chan struct{} // Signalled when a payload is pushed
+	done   chan struct{} // Closed by close
+	closed bool
+	reason closeReason
+}
+
+func newSendQueue(limit int) *sendQueue {
+	return &sendQueue{
+		limit: limit,
+		keys:  make(map[string]*queued),
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// push queues payload and reports whether it fit. A payload with a key
+// moves to the back of the queue, replacing its queued predecessor, which
+// keeps event IDs increasing. Pushing to a closed queue is a no-op.
+func (q *sendQueue) push(payload []byte, key string) (ok, coalesced bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return true, false
+	}
+	if key != "" {
+		if prev, found := q.keys[key]; found {
+			prev.payload = nil
+			q.live--
+			coalesced = true
+		}
+	}
+	if q.live >= q.limit {
+		return false, coalesced
+	}
+	if len(q.items)-q.head >= 2*q.limit {
+		q.compact()
+	}
+	item := &queued{payload: payload, key: key}
+	q.items = append(q.items, item)
+	q.live++
+	if key != "" {
+		q.keys[key] = item
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true, coalesced
+}
+
+// compact drops superseded entries and the consumed prefix.
+func (q *sendQueue) compact() {
+	items := make([]*queued, 0, q.live)
+	for _, item := range q.items[q.head:] {
+		if item.payload != nil {
+			items = append(items, item)
+		}
+	}
+	q.items = items
+	q.head = 0
+}
+
+// free returns how many more payloads fit.
+func (q *sendQueue) free() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.limit - q.live
+}
+
+// pop returns the next payload, if any.
+func (q *sendQueue) pop() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, false
+	}
+	for q.head < len(q.items) {
+		item := q.items[q.head]
+		q.items[q.head] = nil
+		q.head++
+		if item.payload == nil {
+			continue
+		}
+		q.live--
+		if item.key != "" && q.keys[item.key] == item {
+			delete(q.keys, item.key)
+		}
+		if q.head == len(q.items) {
+			q.items = q.items[:0]
+			q.head = 0
+		}
+		return item.payload, true
+	}
+	q.items = q.items[:0]
+	q.head = 0
+	return nil, false
+}
+
+// next waits for the next payload. It returns false once the queue is
+// closed; payloads still queued then are discarded.
+func (q *sendQueue) next() ([]byte, bool) {
+	for {
+		if payload, ok := q.pop(); ok {
+			return payload, true
+		}
+		select {
+		case <-q.ready:
+		case <-q.done:
+			return nil, false
+		}
+	}
+}
+
+// close ends the queue with reason. Only the first call has an effect.
+func (q *sendQueue) close(reason closeReason) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.reason = reason
+	q.items = nil
+	q.head = 0
+	q.live = 0
+	q.keys = nil
+	close(q.done)
+}
+
+// closeReason returns why the queue was closed.
+func (q *sendQueue) closeReason() closeReason {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.reason
+}
@@ -0,0 +1,347 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"backend/internal/api"
+
+	"github.com/google/uuid"
+)
+
+// shard owns a subset of the hub's clients. Each shard runs its own loop, so
+// fan-out to many connections is spread across goroutines while the events
+// of one client stay in order.
+type shard struct {
+	hub        *Hub
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan outbound
+	commands   chan clientCommand
+	replays    chan replayResult
+	clients    map[*Client]struct{}
+	users      map[uuid.UUID]map[*Client]struct{}
+	topics     map[string]map[*Client]struct{}
+}
+
+func newShard(hub *Hub) *shard {
+	return &shard{
+		hub:        hub,
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		broadcast:  make(chan outbound, broadcastBuffer),
+		commands:   make(chan clientCommand),
+		replays:    make(chan replayResult),
+		clients:    make(map[*Client]struct{}),
+		users:      make(map[uuid.UUID]map[*Client]struct{}),
+		topics:     make(map[string]map[*Client]struct{}),
+	}
+}
+
+func (s *shard) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for client := range s.clients {
+				s.remove(client, closeShutdown)
+			}
+			return
+		case client := <-s.register:
+			s.add(client)
+		case client := <-s.unregister:
+			if _, ok := s.clients[client]; ok {
+				s.remove(client, closeNormal)
+			}
+		case cc := <-s.commands:
+			s.handleCommand(ctx, cc)
+		case res := <-s.replays:
+			s.finishReplay(res)
+		case msg := <-s.broadcast:
+			s.fanOut(msg)
+		}
+	}
+}
+
+// fanOut delivers msg to the shard's clients it is for.
+func (s *shard) fanOut(msg outbound) {
+	if msg.userID != uuid.Nil {
+		for client := range s.users[msg.userID] {
+			s.deliver(client, msg)
+		}
+		return
+	}
+	// A client subscribed to several of the topics gets one copy.
+	var sent map[*Client]struct{}
+	if len(msg.topics) > 1 {
+		sent = make(map[*Client]struct{})
+	}
+	for _, topic := range msg.topics {
+		for client := range s.topics[topic] {
+			if sent != nil {
+				if _, ok := sent[client]; ok {
+					continue
+				}
+				sent[client] = struct{}{}
+			}
+			s.deliver(client, msg)
+		}
+	}
+}
+
+// deliver queues msg for client. While the client resumes, live events are
+// held back until the replay is sent.
+func (s *shard) deliver(client *Client, msg outbound) {
+	if client.replaying {
+		if len(client.pending) >= maxPendingEvents {
+			s.dropSlow(client)
+			return
+		}
+		client.pending = append(client.pending, msg)
+		return
+	}
+	s.sendEvent(client, msg)
+}
+
+// sendEvent queues an event for client in the form it asked for.
+func (s *shard) sendEvent(client *Client, msg outbound) {
+	s.send(client, msg.clientPayload(client, s.hub.signer), msg.coalesce)
+}
+
+// send queues payload for client, disconnecting clients that fall behind.
+// Payloads with a coalesce key replace the client's queued payload with the
+// same key.
+func (s *shard) send(client *Client, payload []byte, coalesce string) {
+	ok, coalesced := client.queue.push(payload, coalesce)
+	if coalesced {
+		s.hub.stats.coalescedEvents.Add(1)
+	}
+	if !ok {
+		s.dropSlow(client)
+	}
+}
+
+// dropSlow disconnects a client whose queue stayed full.
+func (s *shard) dropSlow(client *Client) {
+	s.hub.stats.droppedClients.Add(1)
+	slog.Debug("dropping slow realtime client", "user_id", client.userID)
+	s.remove(client, closeSlowConsumer)
+}
+
+func (s *shard) reply(client *Client, reply Reply) {
+	payload, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+	s.send(client, payload, "")
+}
+
+// handleCommand applies a client command and replies to it.
+func (s *shard) handleCommand(ctx context.Context, cc clientCommand) {
+	client := cc.client
+	if _, ok := s.clients[client]; !ok {
+		return
+	}
+	cmd := cc.cmd
+	reply := Reply{Type: ReplyAck, ID: cmd.ID, Op: cmd.Op, Topic: cmd.Topic}
+	switch {
+	case cc.reject != nil:
+		reply = *cc.reject
+	case cmd.Op == OpPing:
+		reply = Reply{Type: ReplyPong, ID: cmd.ID}
+	case cmd.Op == OpSubscribe:
+		if _, ok := client.topics[cmd.Topic]; !ok {
+			if len(client.topics) >= MaxSubscriptions {
+				reply = Reply{Type: ReplyError, ID: cmd.ID, Op: cmd.Op, Topic: cmd.Topic, Code: "too_many_subscriptions", Message: "subscription limit reached"}
+			} else {
+				s.subscribe(client, cmd.Topic)
+			}
+		}
+	case cmd.Op == OpUnsubscribe:
+		s.unsubscribe(client, cmd.Topic)
+	case cmd.Op == OpPresence || cmd.Op == OpTyping:
+		if client.userID == uuid.Nil {
+			reply = Reply{Type: ReplyError, ID: cmd.ID, Op: cmd.Op, Topic: cmd.Topic, Code: "unauthorized", Message: "authentication required"}
+			break
+		}
+		if !client.ephemeral.allow(time.Now()) {
+			reply = Reply{Type: ReplyError, ID: cmd.ID, Op: cmd.Op, Topic: cmd.Topic, Code: "rate_limited", Message: "too many presence and typing commands"}
+			break
+		}
+		if cmd.Op == OpPresence {
+			s.setPresence(client, api.PresenceStatus(cmd.Status))
+		} else {
+			s.typing(ctx, client, cmd.Topic)
+		}
+	case cmd.Op == OpResume:
+		if client.replaying {
+			reply = Reply{Type: ReplyError, ID: cmd.ID, Op: cmd.Op, Code: "resume_in_progress", Message: "already resuming"}
+			break
+		}
+		// The ack follows the replay.
+		client.replaying = true
+		go s.replay(ctx, client, cmd)
+		return
+	}
+	s.reply(client, reply)
+}
+
+// replayResult carries the events missed by a resuming client.
+type replayResult struct {
+	client *Client
+	cmd    Command
+	events []outbound
+	ok     bool
+	err    error
+}
+
+func (s *shard) replay(ctx context.Context, client *Client, cmd Command) {
+	res := replayResult{client: client, cmd: cmd}
+	// parseCommand validated the ID.
+	since, _ := parseEventID(cmd.LastEventID)
+	res.events, res.ok, res.err = s.hub.since(ctx, since)
+	select {
+	case s.replays <- res:
+	case <-ctx.Done():
+	}
+}
+
+// finishReplay sends a resuming client the events it missed, or tells it to
+// resync, followed by the live events held back meanwhile.
+func (s *shard) finishReplay(res replayResult) {
+	client := res.client
+	if _, ok := s.clients[client]; !ok {
+		return
+	}
+	client.replaying = false
+	pending := client.pending
+	client.pending = nil
+
+	var last eventID
+	switch {
+	case res.err != nil:
+		slog.Warn("failed to read realtime history", "error", res.err)
+		s.reply(client, Reply{Type: ReplyError, ID: res.cmd.ID, Op: res.cmd.Op, Code: "resume_failed", Message: "history unavailable"})
+	case !res.ok:
+		s.reply(client, Reply{Type: ReplyResync, ID: res.cmd.ID})
+	default:
+		var missed []outbound
+		for _, msg := range res.events {
+			if client.wants(msg) {
+				missed = append(missed, msg)
+			}
+			last = msg.id
+		}
+		// Send queues are bounded; a replay that does not fit is a gap
+		// too large to resume across.
+		if len(missed)+1+len(pending) > client.queue.free() {
+			last = eventID{}
+			s.reply(client, Reply{Type: ReplyResync, ID: res.cmd.ID})
+			break
+		}
+		for _, msg := range missed {
+			s.sendEvent(client, msg)
+		}
+		s.reply(client, Reply{Type: ReplyAck, ID: res.cmd.ID, Op: res.cmd.Op})
+	}
+	for _, msg := range pending {
+		// Live events already covered by the replay are skipped.
+		if msg.id != (eventID{}) && !msg.id.after(last) {
+			continue
+		}
+		s.sendEvent(client, msg)
+	}
+}
+
+// setPresence changes the status of an authenticated client.
+func (s *shard) setPresence(client *Client, status api.PresenceStatus) {
+	s.hub.presence.move(client.userID, client.presence, status)
+	client.presence = status
+}
+
+// typing announces that client's user is composing in topic, which
+// parseCommand limited to post and user topics.
+func (s *shard) typing(ctx context.Context, client *Client, topic string) {
+	event := Event{Type: EventTyping, Typing: &Typing{UserId: client.userID, Topic: topic}}
+	if recipient, _ := typingRecipient(topic); recipient != uuid.Nil {
+		event.UserId = &recipient
+	}
+	// Publishing may wait on Redis or on this shard's own queue.
+	go func() {
+		// Typing would reveal users who hide their presence; their
+		// commands are acked but not published.
+		if hidden, err := s.hub.presence.store.hidden(ctx, client.userID); err != nil || hidden {
+			if err != nil {
+				slog.Debug("failed to check hidden presence for typing", "user_id", client.userID, "error", err)
+			}
+			return
+		}
+		if err := s.hub.publishEphemeral(ctx, event); err != nil {
+			slog.Debug("failed to publish typing indicator", "user_id", client.userID, "error", err)
+		}
+	}()
+}
+
+func (s *shard) subscribe(client *Client, topic string) {
+	client.topics[topic] = struct{}{}
+	subs, ok := s.topics[topic]
+	if !ok {
+		subs = make(map[*Client]struct{})
+		s.topics[topic] = subs
+	}
+	subs[client] = struct{}{}
+}
+
+func (s *shard) unsubscribe(client *Client, topic string) {
+	delete(client.topics, topic)
+	if subs, ok := s.topics[topic]; ok {
+		delete(subs, client)
+		if len(subs) == 0 {
+			delete(s.topics, topic)
+		}
+	}
+}
+
+// add registers client, subscribes it to its initial topics and indexes it
+// by user.
+func (s *shard) add(client *Client) {
+	s.clients[client] = struct{}{}
+	s.hub.stats.connections.Add(1)
+	client.topics = make(map[string]struct{})
+	for _, topic := range client.initial {
+		s.subscribe(client, topic)
+	}
+	if client.userID == uuid.Nil {
+		return
+	}
+	s.setPresence(client, api.Online)
+	byUser, ok := s.users[client.userID]
+	if !ok {
+		byUser = make(map[*Client]struct{})
+		s.users[client.userID] = byUser
+		s.hub.setWantUser(client.userID, true)
+	}
+	byUser[client] = struct{}{}
+}
+
+// remove unregisters client and closes its queue with reason.
+func (s *shard) remove(client *Client, reason closeReason) {
+	delete(s.clients, client)
+	s.hub.stats.connections.Add(-1)
+	client.queue.close(reason)
+	for topic := range client.topics {
+		s.unsubscribe(client, topic)
+	}
+	if client.userID == uuid.Nil {
+		return
+	}
+	s.setPresence(client, api.Offline)
+	if byUser, ok := s.users[client.userID]; ok {
+		delete(byUser, client)
+		if len(byUser) == 0 {
+			delete(s.users, client.userID)
+			s.hub.setWantUser(client.userID, false)
+		}
+	}
+}
@@ -1,36 +1,61 @@
 package realtime
 
 import (
+	"crypto/ed25519"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"os"
 	"strings"
+	"time"
+
+	"backend/internal/auth"
 )
 
-// Signer provides HMAC signing for realtime payloads.
+// Signer signs realtime payloads with the active key of a keyring and
+// verifies them against any of its non-retired keys, so that keys can be
+// rotated while instances keep exchanging messages. HS256 keys sign with
+// HMAC-SHA256 and EdDSA keys with Ed25519; both signatures are base64url.
+//
+// Rotating without dropping messages takes three steps, each rolled out to
+// every instance (keyring files are reloaded without a restart): add the
+// new key as verify-only, make it active, then retire the old key.
 type Signer struct {
-	secret []byte
+	keys *auth.Keyring
+}
+
+// NewSigner returns a signer backed by keys, which may be replaced at
+// runtime.
+func NewSigner(keys *auth.Keyring) *Signer {
+	return &Signer{keys: keys}
 }
 
-// NewSignerFromEnv returns a signer if REALTIME_SIGNING_SECRET is set.
+// NewSignerFromEnv returns a signer with a single HS256 key if
+// REALTIME_SIGNING_SECRET is set. Its key ID is auth.DefaultKeyID.
 func NewSignerFromEnv() *Signer {
 	secret := strings.TrimSpace(os.Getenv("REALTIME_SIGNING_SECRET"))
 	if secret == "" {
 		return nil
 	}
-	return &Signer{secret: []byte(secret)}
+	return NewSigner(auth.NewHMACKeyring(auth.DefaultKeyID, []byte(secret)))
 }
 
-// Sign returns a base64url HMAC of the payload.
-func (s *Signer) Sign(payload []byte) string {
-	mac := hmac.New(sha256.New, s.secret)
-	_, _ = mac.Write(payload)
-	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+// Sign returns the active key ID and its signature of payload.
+func (s *Signer) Sign(payload []byte) (kid, sig string) {
+	key := s.keys.Active()
+	var raw []byte
+	switch key.Alg {
+	case auth.AlgEdDSA:
+		raw = ed25519.Sign(key.PrivateKey, payload)
+	default:
+		raw = hmacSum(key.Secret, payload)
+	}
+	return key.ID, base64.RawURLEncoding.EncodeToString(raw)
 }
 
-// Verify checks whether sig matches the payload HMAC.
-func (s *Signer) Verify(payload []byte, sig string) bool {
+// Verify checks sig against the key kid. Messages without a kid come from
+// instances that predate key IDs and are checked against the HS256 keys.
+func (s *Signer) Verify(payload []byte, kid, sig string) bool {
 	if s == nil {
 		return false
 	}
@@ -38,7 +63,54 @@ func (s *Signer) Verify(payload []byte, sig string) bool {
 	if err != nil {
 		return false
 	}
-	mac := hmac.New(sha256.New, s.secret)
+	now := time.Now()
+	if kid == "" {
+		for _, key := range s.keys.LegacyHMAC(now) {
+			if hmac.Equal(raw, hmacSum(key.Secret, payload)) {
+				return true
+			}
+		}
+		return false
+	}
+	key, ok := s.keys.Lookup(kid, now)
+	if !ok {
+		return false
+	}
+	switch key.Alg {
+	case auth.AlgHS256:
+		return hmac.Equal(raw, hmacSum(key.Secret, payload))
+	case auth.AlgEdDSA:
+		return ed25519.Verify(key.PublicKey, payload, raw)
+	}
+	return false
+}
+
+// CanSignEvents reports whether clients can verify events signed by s
+// with published keys, which requires an EdDSA active key.
+func (s *Signer) CanSignEvents() bool {
+	return s != nil && s.keys.Active().Alg == auth.AlgEdDSA
+}
+
+// JWKS returns the public keys that verify events signed for clients.
+func (s *Signer) JWKS() auth.JWKSet {
+	if s == nil {
+		return auth.JWKSet{Keys: []auth.JWK{}}
+	}
+	return s.keys.JWKS(time.Now())
+}
+
+func hmacSum(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
 	_, _ = mac.Write(payload)
-	return hmac.Equal(raw, mac.Sum(nil))
+	return mac.Sum(nil)
+}
+
+// SignedEvent is how events reach clients that asked for signed events.
+// Payload is the event JSON as a string, so that its exact bytes survive
+// relays that re-encode messages; Sig is the base64url Ed25519 signature of
+// those bytes by the key Kid, published at /.well-known/realtime-keys.json.
+type SignedEvent struct {
+	Payload string `json:"payload"`
+	Kid     string `json:"kid"`
+	Sig     string `json:"sig"`
 }
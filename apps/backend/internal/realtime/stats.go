@@ -0,0 +1,39 @@
+package realtime
+
+import "sync/atomic"
+
+// Stats are counters of one hub since it started. Each instance keeps its
+// own.
+type Stats struct {
+	// Connections is the number of registered clients.
+	Connections int64
+	// DroppedEvents counts events that were not fanned out because the
+	// broadcast queue stayed full.
+	DroppedEvents uint64
+	// DroppedClients counts clients disconnected for falling behind.
+	DroppedClients uint64
+	// CoalescedEvents counts queued events superseded by a later one, such
+	// as reaction counts of the same post, before a client read them.
+	CoalescedEvents uint64
+	// PublishErrors counts events that could not be published to Redis.
+	PublishErrors uint64
+}
+
+type hubStats struct {
+	connections     atomic.Int64
+	droppedEvents   atomic.Uint64
+	droppedClients  atomic.Uint64
+	coalescedEvents atomic.Uint64
+	publishErrors   atomic.Uint64
+}
+
+// Stats returns the hub's counters.
+func (h *Hub) Stats() Stats {
+	return Stats{
+		Connections:     h.stats.connections.Load(),
+		DroppedEvents:   h.stats.droppedEvents.Load(),
+		DroppedClients:  h.stats.droppedClients.Load(),
+		CoalescedEvents: h.stats.coalescedEvents.Load(),
+		PublishErrors:   h.stats.publishErrors.Load(),
+	}
+}
@@ -0,0 +1,185 @@
+package realtime
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Topics clients can subscribe to. Events addressed to a user (Event.UserId)
+// reach that user's connections regardless of their subscriptions.
+const (
+	// TopicTimeline carries every broadcast event: post creation, deletion
+	// and moderation, reaction updates, media deletions and profile
+	// updates. Connections start subscribed to it.
+	TopicTimeline = "timeline"
+
+	topicUserPrefix    = "user:"    // posts created by a user, their profile and presence
+	topicPostPrefix    = "post:"    // deletion, moderation of, reactions to and replies typed under one post
+	topicHashtagPrefix = "hashtag:" // posts created with a hashtag
+
+	maxHashtagRunes = 64
+)
+
+var errInvalidTopic = errors.New("invalid topic")
+
+// UserTopic returns the topic of posts created by userID and of updates to
+// their profile and presence.
+func UserTopic(userID uuid.UUID) string {
+	return topicUserPrefix + userID.String()
+}
+
+// PostTopic returns the topic of updates to postID.
+func PostTopic(postID uuid.UUID) string {
+	return topicPostPrefix + postID.String()
+}
+
+// HashtagTopic returns the topic of posts tagged with tag, with or without
+// its leading '#'.
+func HashtagTopic(tag string) string {
+	return topicHashtagPrefix + strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+// ParseTopic validates a topic sent by a client and returns its canonical
+// form.
+func ParseTopic(raw string) (string, error) {
+	if raw == TopicTimeline {
+		return raw, nil
+	}
+	if rest, ok := strings.CutPrefix(raw, topicUserPrefix); ok {
+		id, err := uuid.Parse(rest)
+		if err != nil {
+			return "", errInvalidTopic
+		}
+		return UserTopic(id), nil
+	}
+	if rest, ok := strings.CutPrefix(raw, topicPostPrefix); ok {
+		id, err := uuid.Parse(rest)
+		if err != nil {
+			return "", errInvalidTopic
+		}
+		return PostTopic(id), nil
+	}
+	if rest, ok := strings.CutPrefix(raw, topicHashtagPrefix); ok {
+		tag := strings.TrimPrefix(rest, "#")
+		if !validHashtag(tag) {
+			return "", errInvalidTopic
+		}
+		return HashtagTopic(tag), nil
+	}
+	return "", errInvalidTopic
+}
+
+// typingRecipient reports whether topic can be typed in: a post topic, for
+// replies, or a user topic, for direct messages to that user, whom it
+// returns. Post topics return uuid.Nil.
+func typingRecipient(topic string) (uuid.UUID, bool) {
+	if rest, ok := strings.CutPrefix(topic, topicUserPrefix); ok {
+		id, err := uuid.Parse(rest)
+		return id, err == nil && id != uuid.Nil
+	}
+	if rest, ok := strings.CutPrefix(topic, topicPostPrefix); ok {
+		_, err := uuid.Parse(rest)
+		return uuid.Nil, err == nil
+	}
+	return uuid.Nil, false
+}
+
+// Hashtags returns the distinct lowercased hashtags in content, without
+// their '#'. A tag starts after whitespace or at the beginning of content.
+func Hashtags(content string) []string {
+	var tags []string
+	seen := make(map[string]struct{})
+	for _, field := range strings.FieldsFunc(content, unicode.IsSpace) {
+		rest, ok := strings.CutPrefix(field, "#")
+		if !ok {
+			continue
+		}
+		end := strings.IndexFunc(rest, func(r rune) bool { return !isHashtagRune(r) })
+		if end >= 0 {
+			rest = rest[:end]
+		}
+		if !validHashtag(rest) {
+			continue
+		}
+		tag := strings.ToLower(rest)
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func isHashtagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r)
+}
+
+func validHashtag(tag string) bool {
+	if tag == "" || utf8.RuneCountInString(tag) > maxHashtagRunes {
+		return false
+	}
+	for _, r := range tag {
+		if !isHashtagRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Topics returns the topics an event is delivered to. Events addressed to a
+// user have none.
+func (e Event) Topics() []string {
+	if e.UserId != nil {
+		return nil
+	}
+	switch e.Type {
+	case EventPostCreated, EventPostUnhidden:
+		if e.Post == nil {
+			return nil
+		}
+		topics := []string{TopicTimeline, UserTopic(e.Post.Author.Id)}
+		for _, tag := range Hashtags(e.Post.Content) {
+			topics = append(topics, HashtagTopic(tag))
+		}
+		if e.Type == EventPostUnhidden {
+			topics = append(topics, PostTopic(e.Post.Id))
+		}
+		return topics
+	case EventPostDeleted, EventPostHidden:
+		if e.PostId == nil {
+			return nil
+		}
+		return []string{TopicTimeline, PostTopic(*e.PostId)}
+	case EventMediaDeleted:
+		if e.MediaId == nil {
+			return nil
+		}
+		return []string{TopicTimeline}
+	case EventUserUpdated:
+		if e.User == nil {
+			return nil
+		}
+		return []string{TopicTimeline, UserTopic(e.User.Id)}
+	case EventReactionUpdated:
+		if e.ReactionCounts == nil {
+			return nil
+		}
+		return []string{TopicTimeline, PostTopic(e.ReactionCounts.PostId)}
+	case EventPresenceUpdated:
+		if e.Presence == nil {
+			return nil
+		}
+		return []string{UserTopic(e.Presence.UserId)}
+	case EventTyping:
+		if e.Typing == nil {
+			return nil
+		}
+		return []string{e.Typing.Topic}
+	}
+	return nil
+}
@@ -168,9 +168,10 @@ func (s *AdminService) GetDashboardStats(ctx context.Context) (api.DashboardStat
 		return api.DashboardStats{}, err
 	}
 	return api.DashboardStats{
-		TotalUsers: int(stats.TotalUsers),
-		TotalPosts: int(stats.TotalPosts),
-		TotalMedia: int(stats.TotalMedia),
+		TotalUsers:      int(stats.TotalUsers),
+		TotalPosts:      int(stats.TotalPosts),
+		TotalMedia:      int(stats.TotalMedia),
+		TotalMediaBytes: stats.TotalMediaBytes,
 	}, nil
 }
 
@@ -400,9 +401,10 @@ func (s *AdminService) GetRole(ctx context.Context, roleID string) (api.Role, er
 		return api.Role{}, err
 	}
 	return api.Role{
-		Id:          api.RoleId(row.ID),
-		Name:        row.Name,
-		Description: row.Description,
+		Id:              api.RoleId(row.ID),
+		Name:            row.Name,
+		Description:     row.Description,
+		MediaQuotaBytes: nullInt64Ptr(row.MediaQuotaBytes),
 	}, nil
 }
 
@@ -418,6 +420,10 @@ func (s *AdminService) CreateRole(ctx context.Context, req api.CreateRoleRequest
 	if !isValidRoleID(roleID) {
 		return api.Role{}, NewError(http.StatusBadRequest, "invalid_request", "role id must contain only lowercase letters, numbers, and underscores")
 	}
+	quota, err := roleMediaQuota(req.MediaQuotaBytes)
+	if err != nil {
+		return api.Role{}, err
+	}
 	// Check if role already exists
 	exists, err := s.store.Q.RoleExists(ctx, roleID)
 	if err != nil {
@@ -428,17 +434,19 @@ func (s *AdminService) CreateRole(ctx context.Context, req api.CreateRoleRequest
 	}
 	// Create role
 	err = s.store.Q.CreateRole(ctx, sqlc.CreateRoleParams{
-		ID:          roleID,
-		Name:        strings.TrimSpace(req.Name),
-		Description: strings.TrimSpace(req.Description),
+		ID:              roleID,
+		Name:            strings.TrimSpace(req.Name),
+		Description:     strings.TrimSpace(req.Description),
+		MediaQuotaBytes: quota,
 	})
 	if err != nil {
 		return api.Role{}, err
 	}
 	return api.Role{
-		Id:          api.RoleId(roleID),
-		Name:        req.Name,
-		Description: req.Description,
+		Id:              api.RoleId(roleID),
+		Name:            req.Name,
+		Description:     req.Description,
+		MediaQuotaBytes: nullInt64Ptr(quota),
 	}, nil
 }
 
@@ -463,23 +471,54 @@ func (s *AdminService) UpdateRole(ctx context.Context, roleID string, req api.Up
 	if req.Description != nil {
 		newDesc = strings.TrimSpace(*req.Description)
 	}
+	newQuota := existing.MediaQuotaBytes
+	if req.ClearMediaQuota != nil && *req.ClearMediaQuota {
+		if req.MediaQuotaBytes != nil {
+			return api.Role{}, NewError(http.StatusBadRequest, "invalid_request", "mediaQuotaBytes cannot be combined with clearMediaQuota")
+		}
+		newQuota = sql.NullInt64{}
+	} else if req.MediaQuotaBytes != nil {
+		if newQuota, err = roleMediaQuota(req.MediaQuotaBytes); err != nil {
+			return api.Role{}, err
+		}
+	}
 	// Update role
 	err = s.store.Q.UpdateRole(ctx, sqlc.UpdateRoleParams{
-		ID:          roleID,
-		Name:        newName,
-		Description: newDesc,
+		ID:              roleID,
+		Name:            newName,
+		Description:     newDesc,
+		MediaQuotaBytes: newQuota,
 	})
 	if err != nil {
 		return api.Role{}, err
 	}
 	// Return updated role
 	return api.Role{
-		Id:          api.RoleId(roleID),
-		Name:        newName,
-		Description: newDesc,
+		Id:              api.RoleId(roleID),
+		Name:            newName,
+		Description:     newDesc,
+		MediaQuotaBytes: nullInt64Ptr(newQuota),
 	}, nil
 }
 
+// roleMediaQuota validates a requested role quota; nil means unlimited.
+func roleMediaQuota(v *int64) (sql.NullInt64, error) {
+	if v == nil {
+		return sql.NullInt64{}, nil
+	}
+	if *v < 0 {
+		return sql.NullInt64{}, NewError(http.StatusBadRequest, "invalid_request", "mediaQuotaBytes must not be negative")
+	}
+	return sql.NullInt64{Int64: *v, Valid: true}, nil
+}
+
+func nullInt64Ptr(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
+
 func (s *AdminService) DeleteRole(ctx context.Context, roleID string) error {
 	if s.store == nil {
 		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
@@ -2,9 +2,15 @@ package admin
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"net/http"
 
+	"backend/internal/db/sqlc"
+	"backend/internal/realtime"
 	"backend/internal/repository"
+	"backend/internal/service"
 	"backend/internal/service/moderation"
 
 	"github.com/google/uuid"
@@ -14,6 +20,7 @@ import (
 type ProfileService struct {
 	store       *repository.Store
 	logsService *moderation.LogsService
+	outbox      *service.RealtimeOutbox
 }
 
 // NewProfileService creates a new ProfileService
@@ -24,10 +31,45 @@ func NewProfileService(store *repository.Store, logsService *moderation.LogsServ
 	}
 }
 
+// NewProfileServiceWithPublisher creates a new ProfileService that announces
+// profile changes as user_updated events.
+func NewProfileServiceWithPublisher(store *repository.Store, logsService *moderation.LogsService, publisher realtime.Publisher) *ProfileService {
+	return &ProfileService{
+		store:       store,
+		logsService: logsService,
+		outbox:      service.NewRealtimeOutbox(store, publisher),
+	}
+}
+
+// update applies change and records a user_updated event in one
+// transaction, then publishes the event. It returns sql.ErrNoRows when the
+// user does not exist.
+func (s *ProfileService) update(ctx context.Context, userID uuid.UUID, change func(q *sqlc.Queries) error) error {
+	var event service.OutboxEvent
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		if err := change(q); err != nil {
+			return err
+		}
+		var err error
+		event, err = service.RecordUserUpdated(ctx, s.outbox, q, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.outbox.Publish(ctx, event)
+	return nil
+}
+
 // DeleteUserAvatar removes a user's avatar
 func (s *ProfileService) DeleteUserAvatar(ctx context.Context, userID, adminUserID uuid.UUID, reason string) error {
-	err := s.store.Q.AdminDeleteUserAvatar(ctx, userID)
+	err := s.update(ctx, userID, func(q *sqlc.Queries) error {
+		return q.AdminDeleteUserAvatar(ctx, userID)
+	})
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return service.NewError(http.StatusNotFound, "not_found", "user not found")
+		}
 		return fmt.Errorf("failed to delete user avatar: %w", err)
 	}
 
@@ -49,8 +91,13 @@ func (s *ProfileService) DeleteUserAvatar(ctx context.Context, userID, adminUser
 
 // DeleteUserDisplayName removes a user's display name
 func (s *ProfileService) DeleteUserDisplayName(ctx context.Context, userID, adminUserID uuid.UUID, reason string) error {
-	err := s.store.Q.AdminDeleteUserDisplayName(ctx, userID)
+	err := s.update(ctx, userID, func(q *sqlc.Queries) error {
+		return q.AdminDeleteUserDisplayName(ctx, userID)
+	})
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return service.NewError(http.StatusNotFound, "not_found", "user not found")
+		}
 		return fmt.Errorf("failed to delete user display name: %w", err)
 	}
 
@@ -72,8 +119,13 @@ func (s *ProfileService) DeleteUserDisplayName(ctx context.Context, userID, admi
 
 // DeleteUserBio removes a user's bio
 func (s *ProfileService) DeleteUserBio(ctx context.Context, userID, adminUserID uuid.UUID, reason string) error {
-	err := s.store.Q.AdminDeleteUserBio(ctx, userID)
+	err := s.update(ctx, userID, func(q *sqlc.Queries) error {
+		return q.AdminDeleteUserBio(ctx, userID)
+	})
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return service.NewError(http.StatusNotFound, "not_found", "user not found")
+		}
 		return fmt.Errorf("failed to delete user bio: %w", err)
 	}
 
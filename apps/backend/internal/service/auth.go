@@ -35,6 +35,10 @@ type AuthService struct {
 	now            func() time.Time
 	configMgr      *config.Manager
 	inviteSvc      InviteServiceInterface
+	loginAttempts  auth.LoginAttemptStore
+	loginPolicy    LoginProtectionPolicy
+	notifications  *NotificationsService
+	securityEvents *SecurityEventsService
 }
 
 func NewAuthService(store *repository.Store, tokens *auth.TokenManager) *AuthService {
@@ -57,6 +61,14 @@ type AuthServiceOptions struct {
 	// StepupSessionStore is the stepup session store implementation.
 	// If nil, defaults to in-memory store.
 	StepupSessionStore auth.StepupSessionStore
+
+	// LoginAttemptStore tracks failed logins per username and subnet.
+	// If nil, defaults to in-memory store.
+	LoginAttemptStore auth.LoginAttemptStore
+
+	// LoginProtection configures backoff and lockout. Zero fields use
+	// DefaultLoginProtectionPolicy values.
+	LoginProtection LoginProtectionPolicy
 }
 
 func NewAuthServiceWithOptions(store *repository.Store, tokens *auth.TokenManager, opts AuthServiceOptions) *AuthService {
@@ -76,6 +88,10 @@ func NewAuthServiceWithOptions(store *repository.Store, tokens *auth.TokenManage
 	if stepupSessions == nil {
 		stepupSessions = auth.NewMemoryStepupSessionStore()
 	}
+	loginAttempts := opts.LoginAttemptStore
+	if loginAttempts == nil {
+		loginAttempts = auth.NewMemoryLoginAttemptStoreWithClock(now)
+	}
 	return &AuthService{
 		store:          store,
 		sessions:       loginSessions,
@@ -84,6 +100,8 @@ func NewAuthServiceWithOptions(store *repository.Store, tokens *auth.TokenManage
 		loginTTL:       ttl,
 		now:            now,
 		configMgr:      nil, // Will be set later via SetConfigManager
+		loginAttempts:  loginAttempts,
+		loginPolicy:    opts.LoginProtection.withDefaults(),
 	}
 }
 
@@ -97,6 +115,16 @@ func (s *AuthService) SetInviteService(inviteSvc InviteServiceInterface) {
 	s.inviteSvc = inviteSvc
 }
 
+// SetNotificationsService sets the inbox used to warn owners about login lockouts
+func (s *AuthService) SetNotificationsService(notifications *NotificationsService) {
+	s.notifications = notifications
+}
+
+// SetSecurityEventsService sets the log that records logins, step-up and password changes
+func (s *AuthService) SetSecurityEventsService(events *SecurityEventsService) {
+	s.securityEvents = events
+}
+
 // validateRegistrationInput validates username and password from registration request
 func validateRegistrationInput(req api.RegisterRequest) (string, error) {
 	username := strings.TrimSpace(string(req.Username))
@@ -335,9 +363,18 @@ func (s *AuthService) LoginStart(ctx context.Context, req api.LoginStartRequest)
 		return api.LoginStartResponse{}, NewError(http.StatusBadRequest, "invalid_request", "username and clientNonce required")
 	}
 
+	// Checked before the user lookup so throttling looks the same for unknown usernames.
+	if err := s.checkLoginAllowed(ctx, username); err != nil {
+		return api.LoginStartResponse{}, err
+	}
+
 	row, err := s.store.Q.GetAuthByUsername(ctx, username)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			// Unknown usernames never reach LoginFinish, so their failures
+			// are counted here; otherwise only existing accounts could be
+			// locked out, and a lockout would reveal that they exist.
+			s.recordLoginFailure(ctx, username, "unknown_user")
 			return api.LoginStartResponse{}, NewError(http.StatusNotFound, "not_found", "user not found")
 		}
 		return api.LoginStartResponse{}, err
@@ -389,14 +426,21 @@ func (s *AuthService) LoginFinish(ctx context.Context, req api.LoginFinishReques
 		return api.LoginFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid or expired login session")
 	}
 
+	// Sessions started before a lockout must not be usable to keep guessing.
+	if err := s.checkLoginAllowed(ctx, sess.Username); err != nil {
+		return api.LoginFinishResponse{}, err
+	}
+
 	expectedFinalNonce := sess.ClientNonce + sess.ServerNonce
 	if req.ClientFinalNonce != expectedFinalNonce {
+		s.recordLoginFailure(ctx, sess.Username, "invalid_nonce")
 		return api.LoginFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid nonce")
 	}
 
 	row, err := s.store.Q.GetAuthByUsername(ctx, sess.Username)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			s.recordLoginFailure(ctx, sess.Username, "unknown_user")
 			return api.LoginFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid credentials")
 		}
 		return api.LoginFinishResponse{}, err
@@ -405,13 +449,24 @@ func (s *AuthService) LoginFinish(ctx context.Context, req api.LoginFinishReques
 	authMessage := auth.BuildAuthMessage(sess.Username, sess.ClientNonce, sess.ServerNonce, sess.SaltB64, sess.Iterations, req.ClientFinalNonce)
 	okProof, err := auth.VerifyClientProof(row.StoredKey, authMessage, req.ClientProof)
 	if err != nil || !okProof {
+		s.recordLoginFailure(ctx, sess.Username, "invalid_proof")
+		s.securityEvents.Record(ctx, SecurityEvent{
+			UserID:  row.UserID,
+			Type:    SecurityEventLogin,
+			Outcome: SecurityOutcomeFailure,
+			Details: map[string]any{"reason": "invalid_proof"},
+		})
 		return api.LoginFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid proof")
 	}
+	s.resetLoginFailures(ctx, sess.Username)
+	auditLogin(ctx, "success", sess.Username, "")
+	s.securityEvents.Record(ctx, SecurityEvent{UserID: row.UserID, Type: SecurityEventLogin, Outcome: SecurityOutcomeSuccess})
 
 	token, expiresIn, err := s.tokens.Issue(auth.User{ID: row.UserID, Username: row.Username})
 	if err != nil {
 		return api.LoginFinishResponse{}, err
 	}
+	s.securityEvents.Record(ctx, SecurityEvent{UserID: row.UserID, Type: SecurityEventSessionCreate, Outcome: SecurityOutcomeSuccess})
 
 	return api.LoginFinishResponse{
 		AccessToken:      token,
@@ -423,25 +478,25 @@ func (s *AuthService) LoginFinish(ctx context.Context, req api.LoginFinishReques
 
 func (s *AuthService) StepUpStart(ctx context.Context, user auth.User, req api.StepupStartRequest) (api.StepupStartResponse, error) {
 	if s.store == nil {
-		auditStepup(ctx, "auth.stepup.start", "failure", user, "service_unavailable")
+		s.auditStepup(ctx, "auth.stepup.start", "failure", user, "service_unavailable")
 		return api.StepupStartResponse{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
 	}
 	if user.ID == uuid.Nil {
-		auditStepup(ctx, "auth.stepup.start", "failure", user, "unauthorized")
+		s.auditStepup(ctx, "auth.stepup.start", "failure", user, "unauthorized")
 		return api.StepupStartResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "unauthorized")
 	}
 	if strings.TrimSpace(req.ClientNonce) == "" {
-		auditStepup(ctx, "auth.stepup.start", "failure", user, "invalid_request")
+		s.auditStepup(ctx, "auth.stepup.start", "failure", user, "invalid_request")
 		return api.StepupStartResponse{}, NewError(http.StatusBadRequest, "invalid_request", "clientNonce required")
 	}
 
 	row, err := s.store.Q.GetAuthByUserID(ctx, user.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			auditStepup(ctx, "auth.stepup.start", "failure", user, "unauthorized")
+			s.auditStepup(ctx, "auth.stepup.start", "failure", user, "unauthorized")
 			return api.StepupStartResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid credentials")
 		}
-		auditStepup(ctx, "auth.stepup.start", "failure", user, "internal")
+		s.auditStepup(ctx, "auth.stepup.start", "failure", user, "internal")
 		return api.StepupStartResponse{}, err
 	}
 
@@ -475,21 +530,21 @@ func (s *AuthService) StepUpStart(ctx context.Context, user auth.User, req api.S
 		ServerNonce:      serverNonce,
 		ExpiresInSeconds: int(s.loginTTL.Seconds()),
 	}
-	auditStepup(ctx, "auth.stepup.start", "success", user, "")
+	s.auditStepup(ctx, "auth.stepup.start", "success", user, "")
 	return resp, nil
 }
 
 func (s *AuthService) StepUpFinish(ctx context.Context, user auth.User, req api.StepupFinishRequest) (api.StepupFinishResponse, error) {
 	if s.store == nil {
-		auditStepup(ctx, "auth.stepup.finish", "failure", user, "service_unavailable")
+		s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "service_unavailable")
 		return api.StepupFinishResponse{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
 	}
 	if user.ID == uuid.Nil {
-		auditStepup(ctx, "auth.stepup.finish", "failure", user, "unauthorized")
+		s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "unauthorized")
 		return api.StepupFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "unauthorized")
 	}
 	if strings.TrimSpace(req.StepupSessionId) == "" || strings.TrimSpace(req.ClientFinalNonce) == "" || strings.TrimSpace(req.ClientProof) == "" {
-		auditStepup(ctx, "auth.stepup.finish", "failure", user, "invalid_request")
+		s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "invalid_request")
 		return api.StepupFinishResponse{}, NewError(http.StatusBadRequest, "invalid_request", "missing fields")
 	}
 
@@ -497,40 +552,40 @@ func (s *AuthService) StepUpFinish(ctx context.Context, user auth.User, req api.
 	// One-time use: delete regardless of outcome.
 	s.stepupSessions.Delete(req.StepupSessionId)
 	if !ok {
-		auditStepup(ctx, "auth.stepup.finish", "failure", user, "invalid_session")
+		s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "invalid_session")
 		return api.StepupFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid or expired stepup session")
 	}
 	if sess.UserID != user.ID.String() {
-		auditStepup(ctx, "auth.stepup.finish", "failure", user, "session_mismatch")
+		s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "session_mismatch")
 		return api.StepupFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid stepup session")
 	}
 
 	expectedFinalNonce := sess.ClientNonce + sess.ServerNonce
 	if req.ClientFinalNonce != expectedFinalNonce {
-		auditStepup(ctx, "auth.stepup.finish", "failure", user, "invalid_nonce")
+		s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "invalid_nonce")
 		return api.StepupFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid nonce")
 	}
 
 	row, err := s.store.Q.GetAuthByUserID(ctx, user.ID)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			auditStepup(ctx, "auth.stepup.finish", "failure", user, "unauthorized")
+			s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "unauthorized")
 			return api.StepupFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid credentials")
 		}
-		auditStepup(ctx, "auth.stepup.finish", "failure", user, "internal")
+		s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "internal")
 		return api.StepupFinishResponse{}, err
 	}
 
 	authMessage := auth.BuildAuthMessage(sess.Username, sess.ClientNonce, sess.ServerNonce, sess.SaltB64, sess.Iterations, req.ClientFinalNonce)
 	okProof, err := auth.VerifyClientProof(row.StoredKey, authMessage, req.ClientProof)
 	if err != nil || !okProof {
-		auditStepup(ctx, "auth.stepup.finish", "failure", user, "invalid_proof")
+		s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "invalid_proof")
 		return api.StepupFinishResponse{}, NewError(http.StatusUnauthorized, "unauthorized", "invalid proof")
 	}
 
 	token, expiresIn, err := s.tokens.IssueStepup(auth.User{ID: row.UserID, Username: row.Username})
 	if err != nil {
-		auditStepup(ctx, "auth.stepup.finish", "failure", user, "internal")
+		s.auditStepup(ctx, "auth.stepup.finish", "failure", user, "internal")
 		return api.StepupFinishResponse{}, err
 	}
 
@@ -539,7 +594,7 @@ func (s *AuthService) StepUpFinish(ctx context.Context, user auth.User, req api.
 		TokenType:        api.StepupFinishResponseTokenType("Stepup"),
 		ExpiresInSeconds: expiresIn,
 	}
-	auditStepup(ctx, "auth.stepup.finish", "success", user, "")
+	s.auditStepup(ctx, "auth.stepup.finish", "success", user, "")
 	return resp, nil
 }
 
@@ -573,11 +628,19 @@ func (s *AuthService) ChangePassword(ctx context.Context, user auth.User, req ap
 	}
 
 	// Invalidate all existing tokens for this user
+	tokensRevoked := true
 	if err := s.tokens.InvalidateUserTokens(ctx, user.ID.String()); err != nil {
 		slog.Warn("failed to invalidate user tokens after password change", "error", err, "user_id", user.ID.String())
 		// Don't fail the password change if token invalidation fails
+		tokensRevoked = false
 	}
 
+	s.securityEvents.Record(ctx, SecurityEvent{
+		UserID:  user.ID,
+		Type:    SecurityEventPasswordChange,
+		Outcome: SecurityOutcomeSuccess,
+		Details: map[string]any{"tokens_revoked": tokensRevoked},
+	})
 	return nil
 }
 
@@ -590,15 +653,26 @@ func (s *AuthService) DeleteAccount(ctx context.Context, user auth.User) error {
 	}
 
 	// Invalidate all existing tokens before deleting the account
+	outcome := SecurityOutcomeSuccess
 	if err := s.tokens.InvalidateUserTokens(ctx, user.ID.String()); err != nil {
 		slog.Warn("failed to invalidate user tokens before account deletion", "error", err, "user_id", user.ID.String())
 		// Continue with account deletion even if token invalidation fails
+		outcome = SecurityOutcomeFailure
 	}
+	s.securityEvents.Record(ctx, SecurityEvent{
+		UserID:  user.ID,
+		Type:    SecurityEventTokenRevocation,
+		Outcome: outcome,
+		Details: map[string]any{"reason": "account_deletion"},
+	})
 
 	return s.store.Q.DeleteUserByID(ctx, user.ID)
 }
 
-func auditStepup(ctx context.Context, event, outcome string, user auth.User, reason string) {
+// auditStepup logs every step-up attempt and persists finish attempts to the
+// user's security history. Start events only hand out a challenge, so they
+// are not persisted.
+func (s *AuthService) auditStepup(ctx context.Context, event, outcome string, user auth.User, reason string) {
 	attrs := make([]slog.Attr, 0, 4)
 	if user.ID != uuid.Nil {
 		attrs = append(attrs, slog.String("actor_user_id", user.ID.String()))
@@ -608,6 +682,15 @@ func auditStepup(ctx context.Context, event, outcome string, user auth.User, rea
 	}
 	attrs = append(attrs, logging.RequestAttrs(ctx)...)
 	logging.Audit(ctx, event, outcome, attrs...)
+
+	if event != "auth.stepup.finish" {
+		return
+	}
+	var details map[string]any
+	if reason != "" {
+		details = map[string]any{"reason": reason}
+	}
+	s.securityEvents.Record(ctx, SecurityEvent{UserID: user.ID, Type: SecurityEventStepup, Outcome: outcome, Details: details})
 }
 
 // errorsAs is a tiny wrapper to avoid importing errors in every file; keeps style consistent.
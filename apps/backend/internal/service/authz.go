@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 
+	"backend/internal/auth"
 	"backend/internal/db/sqlc"
 	"backend/internal/repository"
 
@@ -36,6 +37,11 @@ func (s *AuthzService) HasPermission(ctx context.Context, userID uuid.UUID, perm
 	if normalizedScope == "" {
 		normalizedScope = DefaultPermissionScope
 	}
+	// Delegated (OAuth) tokens only carry the permissions they were granted.
+	if tokenScopes, ok := auth.TokenScopesFromContext(ctx); ok && !auth.HasScope(tokenScopes, perm) {
+		slog.Warn("permission denied", slog.String("reason", "token_scope"), slog.String("permission_id", perm), slog.String("scope", normalizedScope), slog.String("user_id", userID.String()))
+		return false, nil
+	}
 
 	userSummary, err := s.store.Q.GetUserPermissionSummary(ctx, sqlc.GetUserPermissionSummaryParams{
 		UserID:       userID,
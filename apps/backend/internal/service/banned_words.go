@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"backend/internal/db/sqlc"
+)
+
+// Banned word scopes (banned_words.applies_to). Words scoped to "all" match
+// every scope.
+const (
+	bannedWordScopePosts = "posts"
+)
+
+// checkBannedWords rejects text matching any banned word for scope. Text that
+// is stored as-is (such as alt text) cannot be queued for review, so flagged
+// words are rejected like auto-deleted ones.
+func checkBannedWords(ctx context.Context, q *sqlc.Queries, scope, text string) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	words, err := q.ListBannedWords(ctx, sql.NullString{String: scope, Valid: true})
+	if err != nil {
+		return err
+	}
+	for _, w := range words {
+		if bannedWordMatches(w.Pattern, text) {
+			return NewError(http.StatusBadRequest, "invalid_request", "text contains banned content")
+		}
+	}
+	return nil
+}
+
+// bannedWordMatches matches pattern case-insensitively as a regular
+// expression, or as a literal substring when it is not a valid expression.
+func bannedWordMatches(pattern, text string) bool {
+	if re, err := regexp.Compile("(?i)" + pattern); err == nil {
+		return re.MatchString(text)
+	}
+	return strings.Contains(strings.ToLower(text), strings.ToLower(pattern))
+}
@@ -0,0 +1,439 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/db/sqlc"
+	"backend/internal/logging"
+	"backend/internal/mail"
+	"backend/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	authTokenPurposeEmailVerify   = "email_verify"
+	authTokenPurposePasswordReset = "password_reset"
+
+	maxEmailLength = 254
+)
+
+// errMailDisabled is returned by operations that must mail a link when no
+// mail driver is configured.
+var errMailDisabled = NewError(http.StatusServiceUnavailable, "mail_unavailable", "email delivery is not configured")
+
+// EmailService manages optional user email addresses, email verification and
+// password reset. Tokens are single-use and only their SHA-256 hash is stored.
+type EmailService struct {
+	store     *repository.Store
+	tokens    *auth.TokenManager
+	mailer    mail.Mailer
+	verifyTTL time.Duration
+	resetTTL  time.Duration
+	now       func() time.Time
+	async     bool
+
+	securityEvents *SecurityEventsService
+}
+
+type EmailServiceOptions struct {
+	// VerifyTTL controls how long email verification links stay valid.
+	// If zero, defaults to 24 hours.
+	VerifyTTL time.Duration
+
+	// ResetTTL controls how long password reset links stay valid.
+	// If zero, defaults to 30 minutes.
+	ResetTTL time.Duration
+
+	// Now is used to compute token expiry. If nil, defaults to time.Now.
+	Now func() time.Time
+
+	// SyncDelivery sends reset mail inline instead of in the background.
+	// Background delivery keeps response timing independent of whether the
+	// address is registered; tests may prefer synchronous delivery.
+	SyncDelivery bool
+}
+
+func NewEmailService(store *repository.Store, tokens *auth.TokenManager, mailer mail.Mailer, opts EmailServiceOptions) *EmailService {
+	if opts.VerifyTTL == 0 {
+		opts.VerifyTTL = 24 * time.Hour
+	}
+	if opts.ResetTTL == 0 {
+		opts.ResetTTL = 30 * time.Minute
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if mailer == nil {
+		mailer = mail.DisabledMailer{}
+	}
+	return &EmailService{
+		store:     store,
+		tokens:    tokens,
+		mailer:    mailer,
+		verifyTTL: opts.VerifyTTL,
+		resetTTL:  opts.ResetTTL,
+		now:       opts.Now,
+		async:     !opts.SyncDelivery,
+	}
+}
+
+// SetSecurityEventsService sets the log that records password resets.
+func (s *EmailService) SetSecurityEventsService(events *SecurityEventsService) {
+	s.securityEvents = events
+}
+
+// RunCleanup periodically deletes email verification and password reset
+// tokens that expired over a week ago until ctx is cancelled.
+func (s *EmailService) RunCleanup(ctx context.Context, interval time.Duration) {
+	if s.store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.store.Q.DeleteExpiredAuthTokens(ctx); err != nil {
+			slog.Warn("failed to delete expired auth tokens", "error", err)
+		}
+	}
+}
+
+func hashAuthToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// normalizeEmail validates a bare address (no display name) and returns it trimmed.
+func normalizeEmail(raw string) (string, error) {
+	email := strings.TrimSpace(raw)
+	if email == "" || len(email) > maxEmailLength {
+		return "", NewError(http.StatusBadRequest, "invalid_request", "invalid email address")
+	}
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", NewError(http.StatusBadRequest, "invalid_request", "invalid email address")
+	}
+	return email, nil
+}
+
+func (s *EmailService) GetEmail(ctx context.Context, userID uuid.UUID) (api.EmailStatus, error) {
+	if s.store == nil {
+		return api.EmailStatus{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	row, err := s.store.Q.GetUserEmail(ctx, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return api.EmailStatus{}, NewError(http.StatusNotFound, "not_found", "user not found")
+		}
+		return api.EmailStatus{}, err
+	}
+	return mapEmailStatus(row.Email, row.EmailVerifiedAt), nil
+}
+
+func mapEmailStatus(email sql.NullString, verifiedAt sql.NullTime) api.EmailStatus {
+	out := api.EmailStatus{Verified: email.Valid && verifiedAt.Valid}
+	if email.Valid {
+		e := email.String
+		out.Email = &e
+	}
+	if verifiedAt.Valid && email.Valid {
+		t := verifiedAt.Time
+		out.VerifiedAt = &t
+	}
+	return out
+}
+
+// SetEmail stores a new (unverified) email address and sends a verification link.
+func (s *EmailService) SetEmail(ctx context.Context, user auth.User, rawEmail string) (api.EmailStatus, error) {
+	if s.store == nil {
+		return api.EmailStatus{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	if user.ID == uuid.Nil {
+		return api.EmailStatus{}, NewError(http.StatusUnauthorized, "unauthorized", "unauthorized")
+	}
+	email, err := normalizeEmail(rawEmail)
+	if err != nil {
+		return api.EmailStatus{}, err
+	}
+	if !mail.Enabled(s.mailer) {
+		return api.EmailStatus{}, errMailDisabled
+	}
+
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return api.EmailStatus{}, err
+	}
+
+	err = s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		if err := q.SetUserEmail(ctx, sqlc.SetUserEmailParams{
+			ID:    user.ID,
+			Email: sql.NullString{String: email, Valid: true},
+		}); err != nil {
+			return err
+		}
+		// Older verification links refer to a previous address.
+		if err := q.InvalidateAuthTokens(ctx, sqlc.InvalidateAuthTokensParams{UserID: user.ID, Purpose: authTokenPurposeEmailVerify}); err != nil {
+			return err
+		}
+		return q.CreateAuthToken(ctx, sqlc.CreateAuthTokenParams{
+			UserID:    user.ID,
+			Purpose:   authTokenPurposeEmailVerify,
+			TokenHash: hashAuthToken(token),
+			Email:     sql.NullString{String: email, Valid: true},
+			ExpiresAt: s.now().UTC().Add(s.verifyTTL),
+		})
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errorsAs(err, &pgErr) && pgErr.Code == "23505" {
+			return api.EmailStatus{}, NewError(http.StatusConflict, "email_taken", "email address already in use")
+		}
+		return api.EmailStatus{}, err
+	}
+
+	msg := mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nConfirm this email address by opening the link below:\n\n%s\n\nThe link expires in %s. If you did not request this, you can ignore this message.\n",
+			user.Username, publicBaseURL()+"/verify-email?token="+url.QueryEscape(token), s.verifyTTL),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		slog.Warn("failed to send verification email", "error", err, "user_id", user.ID.String())
+		return api.EmailStatus{}, NewError(http.StatusServiceUnavailable, "mail_unavailable", "failed to send verification email")
+	}
+
+	auditAccount(ctx, "account.email.set", "success", user.ID, "")
+	return api.EmailStatus{Email: &email, Verified: false}, nil
+}
+
+// RemoveEmail clears the user's email address and any outstanding tokens.
+func (s *EmailService) RemoveEmail(ctx context.Context, user auth.User) error {
+	if s.store == nil {
+		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	if user.ID == uuid.Nil {
+		return NewError(http.StatusUnauthorized, "unauthorized", "unauthorized")
+	}
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		if err := q.SetUserEmail(ctx, sqlc.SetUserEmailParams{ID: user.ID}); err != nil {
+			return err
+		}
+		for _, purpose := range []string{authTokenPurposeEmailVerify, authTokenPurposePasswordReset} {
+			if err := q.InvalidateAuthTokens(ctx, sqlc.InvalidateAuthTokensParams{UserID: user.ID, Purpose: purpose}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	auditAccount(ctx, "account.email.remove", "success", user.ID, "")
+	return nil
+}
+
+// VerifyEmail consumes a verification token. The token only verifies the
+// address it was issued for; changing the email invalidates it.
+func (s *EmailService) VerifyEmail(ctx context.Context, token string) error {
+	if s.store == nil {
+		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return NewError(http.StatusBadRequest, "invalid_request", "token required")
+	}
+
+	invalid := NewError(http.StatusBadRequest, "invalid_token", "invalid or expired token")
+	var userID uuid.UUID
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		row, err := q.ConsumeAuthToken(ctx, sqlc.ConsumeAuthTokenParams{
+			TokenHash: hashAuthToken(token),
+			Purpose:   authTokenPurposeEmailVerify,
+		})
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return invalid
+			}
+			return err
+		}
+		userID = row.UserID
+		if !row.Email.Valid {
+			return invalid
+		}
+		n, err := q.MarkUserEmailVerified(ctx, sqlc.MarkUserEmailVerifiedParams{ID: row.UserID, Email: row.Email.String})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return invalid
+		}
+		return nil
+	})
+	if err != nil {
+		auditAccount(ctx, "account.email.verify", "failure", userID, "invalid_token")
+		return err
+	}
+	auditAccount(ctx, "account.email.verify", "success", userID, "")
+	return nil
+}
+
+// RequestPasswordReset sends a reset link if the address belongs to a verified
+// account. It never reveals whether the address is registered.
+func (s *EmailService) RequestPasswordReset(ctx context.Context, rawEmail string) error {
+	if s.store == nil {
+		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	email, err := normalizeEmail(rawEmail)
+	if err != nil {
+		return err
+	}
+	if !mail.Enabled(s.mailer) {
+		return errMailDisabled
+	}
+
+	row, err := s.store.Q.GetUserByVerifiedEmail(ctx, email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			auditAccount(ctx, "account.password_reset.request", "failure", uuid.Nil, "unknown_email")
+			return nil
+		}
+		return err
+	}
+
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Q.CreateAuthToken(ctx, sqlc.CreateAuthTokenParams{
+		UserID:    row.ID,
+		Purpose:   authTokenPurposePasswordReset,
+		TokenHash: hashAuthToken(token),
+		Email:     row.Email,
+		ExpiresAt: s.now().UTC().Add(s.resetTTL),
+	}); err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      row.Email.String,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nA password reset was requested for your account. Open the link below to choose a new password:\n\n%s\n\nThe link expires in %s and can be used once. If you did not request this, you can ignore this message.\n",
+			row.Username, publicBaseURL()+"/reset-password?token="+url.QueryEscape(token), s.resetTTL),
+	}
+	send := func(ctx context.Context) {
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			slog.Warn("failed to send password reset email", "error", err, "user_id", row.ID.String())
+		}
+	}
+	if s.async {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+			defer cancel()
+			send(ctx)
+		}()
+	} else {
+		send(ctx)
+	}
+
+	auditAccount(ctx, "account.password_reset.request", "success", row.ID, "")
+	return nil
+}
+
+// ResetPassword consumes a reset token, rotates the SCRAM credentials and
+// revokes every session issued before the reset.
+func (s *EmailService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if s.store == nil {
+		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return NewError(http.StatusBadRequest, "invalid_request", "token required")
+	}
+	if err := auth.ValidatePassword(newPassword); err != nil {
+		return NewError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+
+	creds, err := generateSCRAMCredentials(newPassword)
+	if err != nil {
+		return err
+	}
+
+	var userID uuid.UUID
+	err = s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		row, err := q.ConsumeAuthToken(ctx, sqlc.ConsumeAuthTokenParams{
+			TokenHash: hashAuthToken(token),
+			Purpose:   authTokenPurposePasswordReset,
+		})
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return NewError(http.StatusBadRequest, "invalid_token", "invalid or expired token")
+			}
+			return err
+		}
+		userID = row.UserID
+
+		if err := q.UpdateAuthCredential(ctx, sqlc.UpdateAuthCredentialParams{
+			UserID:     row.UserID,
+			Salt:       creds.salt,
+			Iterations: int32(creds.iterations),
+			StoredKey:  creds.storedKey,
+			ServerKey:  creds.serverKey,
+		}); err != nil {
+			return err
+		}
+
+		// Any other outstanding reset links are now stale.
+		return q.InvalidateAuthTokens(ctx, sqlc.InvalidateAuthTokensParams{UserID: row.UserID, Purpose: authTokenPurposePasswordReset})
+	})
+	if err != nil {
+		auditAccount(ctx, "account.password_reset", "failure", userID, "invalid_token")
+		return err
+	}
+
+	tokensRevoked := false
+	if s.tokens != nil {
+		if err := s.tokens.InvalidateUserTokens(ctx, userID.String()); err != nil {
+			slog.Warn("failed to invalidate user tokens after password reset", "error", err, "user_id", userID.String())
+		} else {
+			tokensRevoked = true
+		}
+	}
+
+	auditAccount(ctx, "account.password_reset", "success", userID, "")
+	s.securityEvents.Record(ctx, SecurityEvent{
+		UserID:  userID,
+		Type:    SecurityEventPasswordReset,
+		Outcome: SecurityOutcomeSuccess,
+		Details: map[string]any{"tokens_revoked": tokensRevoked},
+	})
+	return nil
+}
+
+func auditAccount(ctx context.Context, event, outcome string, userID uuid.UUID, reason string) {
+	attrs := make([]slog.Attr, 0, 4)
+	if userID != uuid.Nil {
+		attrs = append(attrs, slog.String("target_user_id", userID.String()))
+	}
+	if reason != "" {
+		attrs = append(attrs, slog.String("reason", reason))
+	}
+	attrs = append(attrs, logging.RequestAttrs(ctx)...)
+	logging.Audit(ctx, event, outcome, attrs...)
+}
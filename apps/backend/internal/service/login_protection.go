@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/logging"
+)
+
+// LoginProtectionPolicy controls per-username failure throttling.
+//
+// After BackoffAfter consecutive failures, each further failure blocks the
+// username for BaseBackoff doubled per failure (capped at MaxBackoff). Once
+// LockoutAfter failures accumulate the username is locked for LockoutDuration
+// and the account owner is notified.
+type LoginProtectionPolicy struct {
+	BackoffAfter    int
+	BaseBackoff     time.Duration
+	MaxBackoff      time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+
+	// FailureTTL is how long a failure counter survives without new failures.
+	FailureTTL time.Duration
+
+	// SubnetWindow and SubnetThreshold flag a network prefix once failures for
+	// SubnetThreshold distinct usernames originate from it within SubnetWindow.
+	SubnetWindow    time.Duration
+	SubnetThreshold int
+}
+
+// DefaultLoginProtectionPolicy returns conservative defaults.
+func DefaultLoginProtectionPolicy() LoginProtectionPolicy {
+	return LoginProtectionPolicy{
+		BackoffAfter:    3,
+		BaseBackoff:     time.Second,
+		MaxBackoff:      5 * time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		FailureTTL:      24 * time.Hour,
+		SubnetWindow:    10 * time.Minute,
+		SubnetThreshold: 20,
+	}
+}
+
+func (p LoginProtectionPolicy) withDefaults() LoginProtectionPolicy {
+	d := DefaultLoginProtectionPolicy()
+	if p.BackoffAfter <= 0 {
+		p.BackoffAfter = d.BackoffAfter
+	}
+	if p.BaseBackoff <= 0 {
+		p.BaseBackoff = d.BaseBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = d.MaxBackoff
+	}
+	if p.LockoutAfter <= 0 {
+		p.LockoutAfter = d.LockoutAfter
+	}
+	if p.LockoutDuration <= 0 {
+		p.LockoutDuration = d.LockoutDuration
+	}
+	if p.FailureTTL <= 0 {
+		p.FailureTTL = d.FailureTTL
+	}
+	if p.SubnetWindow <= 0 {
+		p.SubnetWindow = d.SubnetWindow
+	}
+	if p.SubnetThreshold <= 0 {
+		p.SubnetThreshold = d.SubnetThreshold
+	}
+	return p
+}
+
+// blockDuration returns how long the username is blocked after the given
+// number of consecutive failures.
+func (p LoginProtectionPolicy) blockDuration(failures int) time.Duration {
+	if failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures < p.BackoffAfter {
+		return 0
+	}
+	d := p.BaseBackoff
+	for i := p.BackoffAfter; i < failures && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// errLoginThrottled is deliberately identical for existing and unknown usernames.
+func errLoginThrottled() *Error {
+	return NewError(http.StatusTooManyRequests, "too_many_attempts", "too many failed login attempts; try again later")
+}
+
+// checkLoginAllowed rejects attempts for usernames under backoff or lockout.
+// Store errors fail open so a Redis outage does not lock everyone out.
+func (s *AuthService) checkLoginAllowed(ctx context.Context, username string) error {
+	a, ok, err := s.loginAttempts.Get(ctx, auth.NormalizeLoginKey(username))
+	if err != nil {
+		slog.Warn("login attempt store unavailable", "error", err)
+		return nil
+	}
+	if ok && s.now().Before(a.LockedUntil) {
+		auditLogin(ctx, "failure", username, "throttled")
+		return errLoginThrottled()
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt for username and applies backoff,
+// lockout and subnet anomaly detection.
+func (s *AuthService) recordLoginFailure(ctx context.Context, username, reason string) {
+	auditLogin(ctx, "failure", username, reason)
+
+	key := auth.NormalizeLoginKey(username)
+	if key == "" {
+		return
+	}
+	now := s.now().UTC()
+	ip := logging.ClientIP(ctx)
+	policy := s.loginPolicy
+
+	a, err := s.loginAttempts.RecordFailure(ctx, key, ip, now, policy.FailureTTL)
+	if err != nil {
+		slog.Warn("failed to record login failure", "error", err)
+		return
+	}
+	if block := policy.blockDuration(a.Failures); block > 0 {
+		until := now.Add(block)
+		if err := s.loginAttempts.Lock(ctx, key, until); err != nil {
+			slog.Warn("failed to apply login backoff", "error", err)
+		}
+		if a.Failures == policy.LockoutAfter {
+			logging.Audit(ctx, "auth.login.lockout", "success", append([]slog.Attr{
+				slog.String("username", key),
+				slog.Int("failures", a.Failures),
+				slog.Time("locked_until", until),
+			}, logging.RequestAttrs(ctx)...)...)
+			s.notifyLockout(ctx, username, until, ip)
+		}
+	}
+
+	if subnet := auth.SubnetOf(ip); subnet != "" {
+		count, err := s.loginAttempts.RecordSubnetFailure(ctx, subnet, key, now, policy.SubnetWindow)
+		if err != nil {
+			slog.Warn("failed to record subnet login failure", "error", err)
+			return
+		}
+		if count == policy.SubnetThreshold {
+			logging.Audit(ctx, "auth.login.anomaly", "failure", append([]slog.Attr{
+				slog.String("subnet", subnet),
+				slog.Int("distinct_usernames", count),
+				slog.Duration("window", policy.SubnetWindow),
+			}, logging.RequestAttrs(ctx)...)...)
+		}
+	}
+}
+
+func (s *AuthService) resetLoginFailures(ctx context.Context, username string) {
+	if err := s.loginAttempts.Reset(ctx, auth.NormalizeLoginKey(username)); err != nil {
+		slog.Warn("failed to reset login failures", "error", err)
+	}
+}
+
+// notifyLockout tells the account owner (if the account exists) that their
+// username was locked. Nothing about this is visible to the caller.
+func (s *AuthService) notifyLockout(ctx context.Context, username string, until time.Time, ip string) {
+	if s.notifications == nil || s.store == nil {
+		return
+	}
+	user, err := s.store.Q.GetUserByUsername(ctx, username)
+	if err != nil {
+		return
+	}
+	data := map[string]any{
+		"lockedUntil": until.UTC().Format(time.RFC3339),
+	}
+	if subnet := auth.SubnetOf(ip); subnet != "" {
+		data["subnet"] = subnet
+	}
+	if err := s.notifications.Notify(ctx, user.ID, NotificationLoginLockout, data); err != nil {
+		slog.Warn("failed to notify user of login lockout", "error", err, "user_id", user.ID.String())
+	}
+}
+
+// LoginSecurityOverview lists tracked usernames and flagged network prefixes.
+func (s *AuthService) LoginSecurityOverview(ctx context.Context) (api.LoginSecurityOverview, error) {
+	attempts, err := s.loginAttempts.List(ctx)
+	if err != nil {
+		return api.LoginSecurityOverview{}, err
+	}
+	subnets, err := s.loginAttempts.ListSubnets(ctx)
+	if err != nil {
+		return api.LoginSecurityOverview{}, err
+	}
+
+	now := s.now()
+	out := api.LoginSecurityOverview{
+		Accounts: make([]api.LoginLockout, 0, len(attempts)),
+		Subnets:  make([]api.LoginAnomalySubnet, 0, len(subnets)),
+	}
+	for _, a := range attempts {
+		item := api.LoginLockout{
+			Username:      a.Username,
+			Failures:      a.Failures,
+			LastFailureAt: a.LastFailure,
+			Locked:        a.Failures >= s.loginPolicy.LockoutAfter && now.Before(a.LockedUntil),
+		}
+		if a.LastIP != "" {
+			ip := a.LastIP
+			item.LastIp = &ip
+		}
+		if now.Before(a.LockedUntil) {
+			until := a.LockedUntil
+			item.LockedUntil = &until
+		}
+		out.Accounts = append(out.Accounts, item)
+	}
+	for _, sn := range subnets {
+		out.Subnets = append(out.Subnets, api.LoginAnomalySubnet{
+			Subnet:     sn.Subnet,
+			Usernames:  sn.Usernames,
+			LastSeenAt: sn.LastSeen,
+			Flagged:    sn.Usernames >= s.loginPolicy.SubnetThreshold,
+		})
+	}
+	return out, nil
+}
+
+// UnlockLogin clears failure tracking for a username.
+func (s *AuthService) UnlockLogin(ctx context.Context, admin auth.User, username string) error {
+	key := auth.NormalizeLoginKey(username)
+	if key == "" {
+		return NewError(http.StatusBadRequest, "invalid_request", "username required")
+	}
+	if err := s.loginAttempts.Reset(ctx, key); err != nil {
+		return err
+	}
+	logging.Audit(ctx, "auth.login.unlock", "success", append([]slog.Attr{
+		slog.String("actor_user_id", admin.ID.String()),
+		slog.String("username", key),
+	}, logging.RequestAttrs(ctx)...)...)
+	return nil
+}
+
+func auditLogin(ctx context.Context, outcome, username, reason string) {
+	attrs := make([]slog.Attr, 0, 4)
+	if key := auth.NormalizeLoginKey(username); key != "" {
+		attrs = append(attrs, slog.String("username", key))
+	}
+	if reason != "" {
+		attrs = append(attrs, slog.String("reason", reason))
+	}
+	attrs = append(attrs, logging.RequestAttrs(ctx)...)
+	logging.Audit(ctx, "auth.login", outcome, attrs...)
+}
@@ -1,28 +1,34 @@
 package service
 
 import (
-	"bytes"
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"backend/internal/api"
 	"backend/internal/auth"
 	"backend/internal/config"
 	"backend/internal/db/sqlc"
+	"backend/internal/realtime"
 	"backend/internal/repository"
+	"backend/internal/storage"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
@@ -46,6 +52,9 @@ var allowedExt = map[string]struct{}{
 	".jpg":  {},
 	".jpeg": {},
 	".webp": {},
+	".gif":  {},
+	".mp4":  {},
+	".webm": {},
 }
 
 var expectedMimeByExt = map[string]string{
@@ -53,63 +62,257 @@ var expectedMimeByExt = map[string]string{
 	".jpg":  "image/jpeg",
 	".jpeg": "image/jpeg",
 	".webp": "image/webp",
+	".gif":  "image/gif",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
 }
 
 var allowedMIMESniff = map[string]struct{}{
 	"image/png":  {},
 	"image/jpeg": {},
 	"image/webp": {},
+	"image/gif":  {},
+	"video/mp4":  {},
+	"video/webm": {},
 }
 
 type MediaService struct {
 	store       *repository.Store
-	mediaDir    string
-	ffmpegPath  string
+	objects     storage.MediaStore
+	ffmpegPath  string // Empty disables video uploads
 	ffprobePath string
-	initErr     error // Initialization error (directory creation/permission issue)
+	images      ImageProcessor // Nil disables uploads
+	initErr     error          // Initialization error (directory creation/permission issue)
+	serveMode   string
+	presignTTL  time.Duration
+	publisher   realtime.Publisher
+	wake        chan struct{} // Signals idle workers that a job was queued
+
+	pngCache       *storage.FileStore // PNG transcodes for clients without WebP
+	pngGroup       singleflight.Group
+	pngCacheBytes  int64         // Size above which the oldest transcodes are evicted
+	pngCacheMaxAge time.Duration // Age after which unused transcodes are evicted
+
+	signingKey    []byte // Signs URLs of non-public media; nil disables
+	signedURLTTL  time.Duration
+	previewURLTTL time.Duration
+
+	orphanMaxAge time.Duration // Age after which unattached media is collected
+
+	reconcileEvery time.Duration // Minimum time between object reconciliations; 0 disables
+	reconcileMu    sync.Mutex
+	lastReconcile  time.Time
 }
 
 const storedImageExt = "webp"
 
+// errVideoUnsupported rejects video uploads when ffmpeg is not installed.
+var errVideoUnsupported = NewError(http.StatusUnsupportedMediaType, "unsupported_media_type", "video uploads are not supported")
+
+// videoSupported reports whether videos and animated images can be
+// transcoded, which always requires ffmpeg.
+func (s *MediaService) videoSupported() bool {
+	return s.ffmpegPath != "" && s.ffprobePath != ""
+}
+
+// Media serving modes.
+const (
+	// MediaServeProxy streams objects through the backend.
+	MediaServeProxy = "proxy"
+	// MediaServeRedirect redirects to a short-lived presigned URL when the
+	// store supports it, and proxies otherwise.
+	MediaServeRedirect = "redirect"
+)
+
+type MediaServiceOptions struct {
+	// Objects stores media files. If nil, uploads return 503.
+	Objects storage.MediaStore
+
+	// InitErr reports a storage initialization failure; uploads return 503.
+	InitErr error
+
+	// ServeMode is MediaServeProxy (default) or MediaServeRedirect.
+	ServeMode string
+
+	// PresignTTL is how long redirect URLs stay valid.
+	// If zero, defaults to 5 minutes.
+	PresignTTL time.Duration
+
+	// Publisher receives media_ready/media_failed events for queued uploads.
+	// Optional.
+	Publisher realtime.Publisher
+
+	// PNGCacheDir holds PNG transcodes served from image.png URLs. Files
+	// can be deleted at any time. If empty, a directory below the system
+	// temp directory is used.
+	PNGCacheDir string
+
+	// PNGCacheMaxBytes bounds the PNG cache: RunPNGCacheEviction deletes the
+	// least recently served transcodes above it. If zero, defaults to 1 GiB.
+	PNGCacheMaxBytes int64
+
+	// PNGCacheMaxAge is how long a transcode may go unserved before it is
+	// evicted, which also removes transcodes of deleted media. If zero,
+	// defaults to 7 days.
+	PNGCacheMaxAge time.Duration
+
+	// URLSigningKey enables signed URLs: owner-facing responses carry URLs
+	// with an expiry and HMAC signature that grant access to non-public
+	// media without credentials. If empty, signed URLs are disabled.
+	URLSigningKey []byte
+
+	// SignedURLTTL is how long signed URLs stay valid.
+	// If zero, defaults to 1 hour.
+	SignedURLTTL time.Duration
+
+	// PreviewURLTTL is how long the signed URLs in upload responses stay
+	// valid. If zero, defaults to 15 minutes.
+	PreviewURLTTL time.Duration
+
+	// ImageProcessor selects how still images are converted:
+	// MediaImageProcessorAuto (default), MediaImageProcessorFFmpeg or
+	// MediaImageProcessorGo. Videos always need ffmpeg.
+	ImageProcessor string
+
+	// OrphanMaxAge is how long media may stay unattached (not on a post, not
+	// an avatar, not the server icon) before the garbage collector deletes
+	// it. It also protects stored objects without a database row, which
+	// may belong to an upload in progress. If zero, defaults to 24 hours.
+	OrphanMaxAge time.Duration
+
+	// ReconcileObjectsInterval is the minimum time between garbage
+	// collections that list stored blobs to delete those without a database
+	// row. Listing a large S3 bucket is slow and billed per request. If
+	// zero, stored objects are not reconciled.
+	ReconcileObjectsInterval time.Duration
+}
+
 type imageConvertFunc func(ctx context.Context, inPath, outPath string) error
-type imageUploadFunc func(ctx context.Context, user auth.User, src multipart.File, header *multipart.FileHeader) (api.Media, error)
+type imageUploadFunc func(ctx context.Context, user auth.User, src multipart.File, header *multipart.FileHeader, form url.Values) (api.Media, error)
 
+// NewMediaService creates a media service storing files below mediaDir.
 func NewMediaService(store *repository.Store, mediaDir string, initErr error) *MediaService {
+	var objects storage.MediaStore
+	if strings.TrimSpace(mediaDir) != "" {
+		objects = storage.NewFileStore(mediaDir)
+	}
+	return NewMediaServiceWithOptions(store, MediaServiceOptions{Objects: objects, InitErr: initErr})
+}
+
+func NewMediaServiceWithOptions(store *repository.Store, opts MediaServiceOptions) *MediaService {
 	ffmpegPath, _ := exec.LookPath("ffmpeg")
 	ffprobePath, _ := exec.LookPath("ffprobe")
+	if opts.ServeMode == "" {
+		opts.ServeMode = MediaServeProxy
+	}
+	if opts.PresignTTL <= 0 {
+		opts.PresignTTL = 5 * time.Minute
+	}
+	if opts.PNGCacheDir == "" {
+		opts.PNGCacheDir = filepath.Join(os.TempDir(), "ciel-media-png")
+	}
+	if opts.PNGCacheMaxBytes <= 0 {
+		opts.PNGCacheMaxBytes = 1 << 30
+	}
+	if opts.PNGCacheMaxAge <= 0 {
+		opts.PNGCacheMaxAge = 7 * 24 * time.Hour
+	}
+	if opts.SignedURLTTL <= 0 {
+		opts.SignedURLTTL = time.Hour
+	}
+	if opts.PreviewURLTTL <= 0 {
+		opts.PreviewURLTTL = 15 * time.Minute
+	}
+	if opts.OrphanMaxAge <= 0 {
+		opts.OrphanMaxAge = 24 * time.Hour
+	}
 	return &MediaService{
 		store:       store,
-		mediaDir:    mediaDir,
+		objects:     opts.Objects,
 		ffmpegPath:  ffmpegPath,
 		ffprobePath: ffprobePath,
-		initErr:     initErr,
+		images:      newImageProcessor(opts.ImageProcessor, ffmpegPath, ffprobePath),
+		initErr:     opts.InitErr,
+		serveMode:   opts.ServeMode,
+		presignTTL:  opts.PresignTTL,
+		publisher:   opts.Publisher,
+		wake:        make(chan struct{}, 1),
+
+		pngCache:       storage.NewFileStore(opts.PNGCacheDir),
+		pngCacheBytes:  opts.PNGCacheMaxBytes,
+		pngCacheMaxAge: opts.PNGCacheMaxAge,
+		signingKey:     opts.URLSigningKey,
+		signedURLTTL:   opts.SignedURLTTL,
+		previewURLTTL:  opts.PreviewURLTTL,
+
+		orphanMaxAge:   opts.OrphanMaxAge,
+		reconcileEvery: opts.ReconcileObjectsInterval,
 	}
 }
 
+// MediaKeyPrefix is the storage prefix of a media item's processed objects:
+// its shared blob when it has one, otherwise its own ID.
+func MediaKeyPrefix(id uuid.UUID, blobHash string) string {
+	if blobHash != "" {
+		return mediaBlobPrefix(blobHash)
+	}
+	return id.String()
+}
+
+// mediaObjectKey is the storage key of a media file under prefix.
+func mediaObjectKey(prefix, ext string) string {
+	return prefix + "/" + mediaFileName(ext)
+}
+
+func normalizeStoredExt(ext string) string {
+	ext = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+	if ext == "" {
+		ext = storedImageExt
+	}
+	return ext
+}
+
+// MediaObjectKeys lists every object stored under prefix (see
+// MediaKeyPrefix), original first. Renditions are only generated below the
+// original size, so later keys may not exist. Tools that copy or verify
+// storage use it to stay in sync with the upload pipeline.
+func MediaObjectKeys(prefix, ext string) []string {
+	if isVideoExt(ext) {
+		return []string{mediaObjectKey(prefix, ext), mediaPosterKey(prefix)}
+	}
+	keys := []string{mediaObjectKey(prefix, ext)}
+	for _, size := range mediaRenditionSizes {
+		keys = append(keys, mediaVariantKey(prefix, size))
+	}
+	return keys
+}
+
+// UploadImageFromRequest handles post media uploads: still images, animated
+// images and short videos.
 func (s *MediaService) UploadImageFromRequest(w http.ResponseWriter, r *http.Request, user auth.User) (api.Media, error) {
-	return s.uploadFromRequest(w, r, user, s.uploadImage)
+	return s.uploadFromRequest(w, r, user, maxVideoUploadBytes, s.uploadImage)
 }
 
 func (s *MediaService) UploadAvatarFromRequest(w http.ResponseWriter, r *http.Request, user auth.User) (api.Media, error) {
-	return s.uploadFromRequest(w, r, user, s.uploadAvatar)
+	return s.uploadFromRequest(w, r, user, maxUploadBytes, s.uploadAvatar)
 }
 
-func (s *MediaService) uploadFromRequest(w http.ResponseWriter, r *http.Request, user auth.User, upload imageUploadFunc) (api.Media, error) {
+func (s *MediaService) uploadFromRequest(w http.ResponseWriter, r *http.Request, user auth.User, maxBytes int64, upload imageUploadFunc) (api.Media, error) {
 	if s.initErr != nil {
 		return api.Media{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "media storage not available")
 	}
 	if s.store == nil {
 		return api.Media{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
 	}
-	if s.ffmpegPath == "" || s.ffprobePath == "" {
-		return api.Media{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "ffmpeg/ffprobe not available")
+	if s.images == nil {
+		return api.Media{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "image processing not available")
 	}
-	if strings.TrimSpace(s.mediaDir) == "" {
+	if s.objects == nil {
 		return api.Media{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "media storage not configured")
 	}
 
 	// Hard cap request size.
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		var mbe *http.MaxBytesError
@@ -124,17 +327,63 @@ func (s *MediaService) uploadFromRequest(w http.ResponseWriter, r *http.Request,
 		return api.Media{}, NewError(http.StatusBadRequest, "invalid_request", "file is required")
 	}
 	defer file.Close()
+	if err := s.checkMediaQuota(r.Context(), user.ID, header.Size); err != nil {
+		return api.Media{}, err
+	}
 
-	return upload(r.Context(), user, file, header)
+	m, err := upload(r.Context(), user, file, header, url.Values(r.MultipartForm.Value))
+	if err != nil {
+		return api.Media{}, err
+	}
+	// Uploads are unattached, so the uploader needs signed URLs to preview
+	// them where cookies are not sent.
+	s.signAPIMedia(&m, s.previewURLTTL)
+	return m, nil
 }
 
+// mediaDelivery selects which representation of a media item is served.
+type mediaDelivery int
+
+const (
+	deliverOriginal mediaDelivery = iota // WebP image or MP4 video
+	deliverPoster                        // WebP poster of video and gifv media
+	deliverPNG                           // PNG transcode of the image or poster
+)
+
+// ServeImage serves a media item's file: the WebP image, or the MP4 for
+// video and gifv media. For images, the optional size query parameter selects
+// the smallest stored rendition whose longer edge is at least size pixels,
+// falling back to the original.
 func (s *MediaService) ServeImage(w http.ResponseWriter, r *http.Request) {
+	s.serveMedia(w, r, deliverOriginal)
+}
+
+// ServePoster serves the poster frame of video and gifv media.
+func (s *MediaService) ServePoster(w http.ResponseWriter, r *http.Request) {
+	s.serveMedia(w, r, deliverPoster)
+}
+
+// ServePNG serves the image (or a video's poster frame) transcoded to PNG
+// for clients that cannot decode WebP. Transcodes are cached on disk.
+func (s *MediaService) ServePNG(w http.ResponseWriter, r *http.Request) {
+	s.serveMedia(w, r, deliverPNG)
+}
+
+func (s *MediaService) serveMedia(w http.ResponseWriter, r *http.Request, delivery mediaDelivery) {
 	idStr := chi.URLParam(r, "mediaId")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
+	size := 0
+	if v := r.URL.Query().Get("size"); v != "" {
+		size, err = strconv.Atoi(v)
+		if err != nil || size < 1 {
+			http.Error(w, "invalid size", http.StatusBadRequest)
+			return
+		}
+	}
 
 	// Check if media exists and get its metadata
 	if s.store == nil {
@@ -149,27 +398,20 @@ func (s *MediaService) ServeImage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Access control: Media attached to posts or used as avatars is public.
-	// Unattached media (drafts) requires authentication and ownership.
+	// Unattached media (drafts) requires a valid signed URL, or
+	// authentication and ownership.
 	// Server icon from config is also considered public.
-	cfg := config.GetGlobalConfig()
-	var serverIconMediaID uuid.NullUUID
-	if cfg != nil && cfg.Server.IconMediaID != nil {
-		serverIconMediaID = uuid.NullUUID{
-			UUID:  *cfg.Server.IconMediaID,
-			Valid: true,
-		}
-	}
-
 	isPublic, err := s.store.Q.IsMediaPublic(r.Context(), sqlc.IsMediaPublicParams{
 		MediaID:           id,
-		ServerIconMediaID: serverIconMediaID,
+		ServerIconMediaID: serverIconMediaID(),
 	})
 	if err != nil {
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if !isPublic.Valid || !isPublic.Bool {
+	public := isPublic.Valid && isPublic.Bool
+	if !public && !s.verifyMediaSignature(r, id) {
 		// Media not public - require authentication and ownership
 		user, ok := auth.UserFromContext(r.Context())
 		if !ok {
@@ -182,27 +424,124 @@ func (s *MediaService) ServeImage(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Determine stored extension
-	ext := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(row.Ext)), ".")
-	if ext == "" {
-		ext = storedImageExt
+	if s.objects == nil {
+		http.NotFound(w, r)
+		return
+	}
+	video := isVideoExt(row.Ext)
+	if delivery == deliverPoster && !video {
+		http.NotFound(w, r)
+		return
+	}
+	prefix := MediaKeyPrefix(id, row.BlobHash.String)
+	key := mediaObjectKey(prefix, row.Ext)
+	contentType := mediaContentType(row.Ext)
+	switch {
+	case video && delivery != deliverOriginal:
+		key, contentType = mediaPosterKey(prefix), "image/webp"
+	case !video && size > 0 && size < max(int(row.Width), int(row.Height)):
+		key = s.variantKeyForSize(r.Context(), id, prefix, size, key)
+	}
+
+	// Objects never change once stored, so public media is cached forever.
+	// Private media must be revalidated: it may be deleted, and signed URLs
+	// must not outlive their expiry in shared caches.
+	cacheControl := "public, max-age=31536000, immutable"
+	if !public {
+		cacheControl = "private, no-cache"
+	}
+
+	if delivery == deliverPNG {
+		s.servePNG(w, r, key, cacheControl)
+		return
 	}
+	if s.serveMode == MediaServeRedirect && s.redirectToObject(w, r, key, public) {
+		return
+	}
+	s.serveObject(w, r, s.objects, key, contentType, cacheControl)
+}
+
+// serverIconMediaID returns the configured server icon, which is public and
+// never garbage-collected.
+func serverIconMediaID() uuid.NullUUID {
+	cfg := config.GetGlobalConfig()
+	if cfg == nil || cfg.Server.IconMediaID == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: *cfg.Server.IconMediaID, Valid: true}
+}
 
-	// Serve the file
-	p := filepath.Join(s.mediaDir, id.String(), "image."+ext)
-	f, err := os.Open(p)
+// serveObject writes an object with ETag and Last-Modified validators.
+// Seekable objects go through http.ServeContent, which answers HEAD,
+// conditional (If-None-Match, If-Modified-Since) and Range requests.
+func (s *MediaService) serveObject(w http.ResponseWriter, r *http.Request, objects storage.MediaStore, key, contentType, cacheControl string) {
+	f, info, err := objects.Get(r.Context(), key)
 	if err != nil {
+		if !errors.Is(err, storage.ErrNotExist) {
+			slog.Warn("failed to read media object", "error", err, "key", key)
+		}
 		http.NotFound(w, r)
 		return
 	}
 	defer f.Close()
 
-	// Currently we store WebP only.
-	w.Header().Set("Content-Type", "image/webp")
-	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	if rs, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", info.ModTime, rs)
+		return
+	}
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
 	_, _ = io.Copy(w, f)
 }
 
+// variantKeyForSize returns the key of the rendition to serve for size, or
+// fallback (the original) when none is suitable.
+func (s *MediaService) variantKeyForSize(ctx context.Context, id uuid.UUID, prefix string, size int, fallback string) string {
+	rows, err := s.store.Q.ListMediaVariants(ctx, id)
+	if err != nil {
+		slog.Warn("failed to list media variants", "error", err, "media_id", id)
+		return fallback
+	}
+	variants := make([]mediaVariant, 0, len(rows))
+	for _, row := range rows {
+		variants = append(variants, mediaVariant{Size: int(row.Size), Width: int(row.Width), Height: int(row.Height)})
+	}
+	if v, ok := pickVariant(variants, size); ok {
+		return mediaVariantKey(prefix, v.Size)
+	}
+	return fallback
+}
+
+// redirectToObject redirects to a presigned URL for key. It returns false
+// when the store cannot presign, in which case the caller proxies instead.
+func (s *MediaService) redirectToObject(w http.ResponseWriter, r *http.Request, key string, public bool) bool {
+	u, err := s.objects.PresignGet(r.Context(), key, s.presignTTL)
+	if err != nil {
+		if !errors.Is(err, storage.ErrPresignUnsupported) {
+			slog.Warn("failed to presign media URL", "error", err, "key", key)
+		}
+		return false
+	}
+	// The redirect may be cached for at most half the URL lifetime so clients
+	// never follow an expired signature. Owner-only media must not be shared.
+	scope := "public"
+	if !public {
+		scope = "private"
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, int(s.presignTTL/2/time.Second)))
+	http.Redirect(w, r, u, http.StatusFound)
+	return true
+}
+
 func (s *MediaService) DeleteMedia(ctx context.Context, userID uuid.UUID, mediaID uuid.UUID) error {
 	if s.store == nil {
 		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
@@ -221,27 +560,37 @@ func (s *MediaService) DeleteMedia(ctx context.Context, userID uuid.UUID, mediaI
 	if err := s.store.Q.DeleteMediaByID(ctx, mediaID); err != nil {
 		return err
 	}
-	if strings.TrimSpace(s.mediaDir) == "" {
+	if s.objects == nil {
 		return nil
 	}
-	_ = os.RemoveAll(filepath.Join(s.mediaDir, mediaID.String()))
+	s.deleteMediaObjects(ctx, mediaID, media.Ext, media.BlobHash.String)
 	return nil
 }
 
-func (s *MediaService) uploadImage(ctx context.Context, user auth.User, src multipart.File, header *multipart.FileHeader) (api.Media, error) {
-	return s.uploadImageWithOptions(ctx, user, src, header, "image", s.convertToWebP, 0)
+// uploadImage stores the upload as a source object and queues it for
+// conversion; the returned media is in the processing state.
+func (s *MediaService) uploadImage(ctx context.Context, user auth.User, src multipart.File, header *multipart.FileHeader, form url.Values) (api.Media, error) {
+	return s.enqueueUpload(ctx, user, src, header, form)
 }
 
-func (s *MediaService) uploadAvatar(ctx context.Context, user auth.User, src multipart.File, header *multipart.FileHeader) (api.Media, error) {
+// uploadAvatar converts synchronously: avatars are small and are set on the
+// profile as soon as the upload returns. Avatars take no description.
+func (s *MediaService) uploadAvatar(ctx context.Context, user auth.User, src multipart.File, header *multipart.FileHeader, _ url.Values) (api.Media, error) {
 	return s.uploadImageWithOptions(ctx, user, src, header, "avatar", s.convertToWebPAvatar, avatarOutputPx)
 }
 
+// uploadImageWithOptions converts a still image upload inline and stores it
+// as mediaType. Videos are rejected and animated images keep only their
+// first frame.
 func (s *MediaService) uploadImageWithOptions(ctx context.Context, user auth.User, src multipart.File, header *multipart.FileHeader, mediaType string, convert imageConvertFunc, expectedSize int) (api.Media, error) {
 	// Validate file metadata
 	_, declaredCT, ext, err := s.validateUploadMetadata(header)
 	if err != nil {
 		return api.Media{}, err
 	}
+	if _, ok := motionExt[ext]; ok {
+		return api.Media{}, NewError(http.StatusUnsupportedMediaType, "unsupported_media_type", "unsupported file extension")
+	}
 
 	// Write upload to temporary file with content validation
 	inPath, totalSize, err := s.writeUploadToTemp(src, ext, declaredCT)
@@ -250,18 +599,118 @@ func (s *MediaService) uploadImageWithOptions(ctx context.Context, user auth.Use
 	}
 	defer os.Remove(inPath)
 
-	// Verify file size
-	if totalSize > maxUploadBytes {
-		return api.Media{}, NewError(http.StatusRequestEntityTooLarge, "payload_too_large", "file too large")
+	// Convert and save, then create the database record
+	id := uuid.New()
+	res, err := s.processUpload(ctx, id, inPath, ext, totalSize, mediaType, convert, expectedSize, false)
+	if err != nil {
+		return api.Media{}, err
 	}
-
-	// Validate image dimensions
-	if err := s.validateImageDimensions(ctx, inPath); err != nil {
+	row, err := s.store.Q.CreateMedia(ctx, sqlc.CreateMediaParams{
+		ID:         id,
+		UserID:     user.ID,
+		Type:       res.Type,
+		Ext:        res.Ext,
+		Width:      int32(res.Width),
+		Height:     int32(res.Height),
+		DurationMs: res.Duration,
+		Blurhash:   nullString(res.Blurhash),
+		SizeBytes:  res.Bytes,
+		BlobHash:   nullString(res.Blob),
+	})
+	if err != nil {
+		s.deleteMediaObjects(ctx, id, res.Ext, res.Blob)
 		return api.Media{}, err
 	}
+	variants := s.saveVariants(ctx, id, res.Blob, res.Variants)
+
+	return newAPIMedia(mediaRecord{
+		ID:         row.ID,
+		Type:       row.Type,
+		Ext:        row.Ext,
+		Width:      row.Width,
+		Height:     row.Height,
+		DurationMs: row.DurationMs,
+		Blurhash:   row.Blurhash,
+		CreatedAt:  row.CreatedAt,
+	}, variants), nil
+}
 
-	// Convert, save, and create database record
-	return s.convertAndSaveImage(ctx, user, inPath, mediaType, convert, expectedSize)
+// processedMedia describes converted media whose objects are already stored.
+type processedMedia struct {
+	Type     string
+	Ext      string
+	Width    int
+	Height   int
+	Duration sql.NullInt32
+	Blurhash string
+	Bytes    int64  // Stored size of the original and poster
+	Blob     string // Hash of the blob holding the objects
+	Variants []mediaVariant
+}
+
+// processUpload validates and converts the upload at inPath and stores
+// the results in a blob (see storeBlob); id is only used for logging.
+// When allowMotion is set and ffmpeg is available, videos and animated
+// images are transcoded to MP4; otherwise animated images are converted
+// like still images. Validation failures are returned as *Error.
+func (s *MediaService) processUpload(ctx context.Context, id uuid.UUID, inPath, ext string, size int64, mediaType string, convert imageConvertFunc, expectedSize int, allowMotion bool) (processedMedia, error) {
+	_, isMotionExt := motionExt[ext]
+	if isMotionExt && !s.videoSupported() {
+		return processedMedia{}, errVideoUnsupported
+	}
+
+	// Validate image dimensions before decoding any frames
+	if err := s.validateImageDimensions(ctx, inPath, ext); err != nil {
+		return processedMedia{}, err
+	}
+
+	motion := isMotionExt
+	if allowMotion && !motion && s.videoSupported() {
+		animated, err := s.isAnimated(ctx, inPath, ext)
+		if err != nil {
+			return processedMedia{}, NewError(http.StatusBadRequest, "invalid_request", "invalid image")
+		}
+		motion = animated
+	}
+
+	// Verify file size; still images keep the stricter limit
+	limit := maxUploadBytes
+	if motion {
+		limit = maxVideoUploadBytes
+	}
+	if size > limit {
+		return processedMedia{}, NewError(http.StatusRequestEntityTooLarge, "payload_too_large", "file too large")
+	}
+
+	if motion {
+		if isMotionExt {
+			return s.convertVideo(ctx, id, inPath, mediaTypeVideo)
+		}
+		return s.convertVideo(ctx, id, inPath, mediaTypeGIFV)
+	}
+	return s.convertImage(ctx, id, inPath, mediaType, convert, expectedSize)
+}
+
+// deleteMediaObjects removes the stored objects of a media item whose row is
+// gone or was never written. A shared blob is only released, which deletes it
+// once nothing else references it. It is used to clean up after failures, so
+// it ignores cancellation of ctx.
+func (s *MediaService) deleteMediaObjects(ctx context.Context, id uuid.UUID, ext, blobHash string) {
+	ctx = context.WithoutCancel(ctx)
+	keys := []string{mediaSourceKey(id)}
+	if blobHash == "" {
+		keys = append(MediaObjectKeys(id.String(), ext), keys...)
+	}
+	for _, key := range keys {
+		if err := s.objects.Delete(ctx, key); err != nil {
+			slog.Warn("failed to delete media object", "error", err, "key", key)
+		}
+	}
+	if blobHash != "" {
+		if _, err := s.releaseBlob(ctx, blobHash); err != nil {
+			slog.Warn("failed to release media blob", "error", err, "hash", blobHash)
+		}
+	}
 }
 
 // validateUploadMetadata validates file metadata (filename, extension, MIME type)
@@ -364,7 +813,8 @@ func validateMIMEType(buf []byte, ext, declaredCT string) error {
 	return nil
 }
 
-// validateImageDimensions validates image dimensions using ffprobe
+// validateImageDimensions validates the dimensions of an upload with the
+// given extension, reading only its header.
 //
 // SECURITY: These limits prevent:
 // - Memory exhaustion attacks (extremely large pixel counts)
@@ -373,8 +823,12 @@ func validateMIMEType(buf []byte, ext, declaredCT string) error {
 //
 // Valid images exceeding old limits (4096x4096, 12MP) will be automatically resized
 // to maxOutputEdgePx (1920px) by convertToWebP, preserving aspect ratio.
-func (s *MediaService) validateImageDimensions(ctx context.Context, imagePath string) error {
-	w, h, err := s.probeDimensions(ctx, imagePath)
+func (s *MediaService) validateImageDimensions(ctx context.Context, imagePath, ext string) error {
+	probe := s.images.Dimensions
+	if _, ok := motionExt[ext]; ok {
+		probe = s.probeDimensions
+	}
+	w, h, err := probe(ctx, imagePath)
 	if err != nil {
 		return NewError(http.StatusBadRequest, "invalid_request", "invalid image")
 	}
@@ -388,172 +842,105 @@ func (s *MediaService) validateImageDimensions(ctx context.Context, imagePath st
 	return nil
 }
 
-// convertAndSaveImage converts the image, saves it, and creates a database record
-func (s *MediaService) convertAndSaveImage(ctx context.Context, user auth.User, inPath, mediaType string, convert imageConvertFunc, expectedSize int) (api.Media, error) {
-	id := uuid.New()
-	outDir := filepath.Join(s.mediaDir, id.String())
-	if err := os.MkdirAll(outDir, 0o755); err != nil {
-		return api.Media{}, err
+// convertImage converts the image and stores it with its renditions in a
+// blob.
+func (s *MediaService) convertImage(ctx context.Context, id uuid.UUID, inPath, mediaType string, convert imageConvertFunc, expectedSize int) (processedMedia, error) {
+	workDir, err := os.MkdirTemp("", "ciel-media-*")
+	if err != nil {
+		return processedMedia{}, err
 	}
-
-	outTmp := filepath.Join(outDir, "image.tmp."+storedImageExt)
-	outPath := filepath.Join(outDir, "image."+storedImageExt)
-	cleanupOut := func() { _ = os.RemoveAll(outDir) }
+	defer os.RemoveAll(workDir)
+	outPath := filepath.Join(workDir, "image."+storedImageExt)
 
 	// Convert image
-	if err := convert(ctx, inPath, outTmp); err != nil {
-		cleanupOut()
+	if err := convert(ctx, inPath, outPath); err != nil {
 		reason := strings.TrimSpace(err.Error())
 		if reason != "" {
 			if len(reason) > 240 {
 				reason = reason[:240] + "..."
 			}
-			return api.Media{}, NewError(http.StatusBadRequest, "invalid_request", "failed to convert image: "+reason)
+			return processedMedia{}, NewError(http.StatusBadRequest, "invalid_request", "failed to convert image: "+reason)
 		}
-		return api.Media{}, NewError(http.StatusBadRequest, "invalid_request", "failed to convert image")
-	}
-
-	if err := os.Rename(outTmp, outPath); err != nil {
-		cleanupOut()
-		return api.Media{}, err
+		return processedMedia{}, NewError(http.StatusBadRequest, "invalid_request", "failed to convert image")
 	}
 
 	// Verify converted dimensions
-	wOut, hOut, err := s.probeDimensions(ctx, outPath)
+	wOut, hOut, err := s.images.Dimensions(ctx, outPath)
 	if err != nil {
-		cleanupOut()
-		return api.Media{}, NewError(http.StatusBadRequest, "invalid_request", "failed to read converted image")
+		return processedMedia{}, NewError(http.StatusBadRequest, "invalid_request", "failed to read converted image")
 	}
 	if expectedSize > 0 && (wOut != expectedSize || hOut != expectedSize) {
-		cleanupOut()
-		return api.Media{}, NewError(http.StatusBadRequest, "invalid_request", "failed to convert image")
+		return processedMedia{}, NewError(http.StatusBadRequest, "invalid_request", "failed to convert image")
 	}
 
-	// Create database record
-	row, err := s.store.Q.CreateMedia(ctx, sqlc.CreateMediaParams{
-		ID:     id,
-		UserID: user.ID,
-		Type:   mediaType,
-		Ext:    storedImageExt,
-		Width:  int32(wOut),
-		Height: int32(hOut),
-	})
+	st, err := os.Stat(outPath)
 	if err != nil {
-		cleanupOut()
-		return api.Media{}, err
+		return processedMedia{}, err
 	}
-
-	return api.Media{
-		Id:        row.ID,
-		Type:      api.MediaType("image"),
-		Url:       mediaImageURL(row.ID, row.Ext),
-		Width:     int(row.Width),
-		Height:    int(row.Height),
-		CreatedAt: row.CreatedAt,
+	variants := s.renderRenditions(ctx, id, outPath, workDir, renditionSizesFor(wOut, hOut))
+	files := []blobFile{{Name: mediaFileName(storedImageExt), Path: outPath, ContentType: "image/webp"}}
+	for _, v := range variants {
+		files = append(files, blobFile{Name: mediaVariantFileName(v.Size), Path: v.Path, ContentType: "image/webp"})
+	}
+	hash, err := s.storeBlob(ctx, storedImageExt, files)
+	if err != nil {
+		return processedMedia{}, err
+	}
+
+	return processedMedia{
+		Type:     mediaType,
+		Ext:      storedImageExt,
+		Width:    wOut,
+		Height:   hOut,
+		Blurhash: s.computeBlurhash(ctx, outPath, wOut, hOut),
+		Bytes:    st.Size(),
+		Blob:     hash,
+		Variants: variants,
 	}, nil
 }
 
-func (s *MediaService) probeDimensions(ctx context.Context, path string) (int, int, error) {
-	cmd := exec.CommandContext(ctx, s.ffprobePath,
-		"-v", "error",
-		"-select_streams", "v:0",
-		"-show_entries", "stream=width,height",
-		"-of", "csv=s=x:p=0",
-		path,
-	)
-	out, err := cmd.Output()
+// putFile uploads a local file to the media store and returns its size.
+func (s *MediaService) putFile(ctx context.Context, key, path, contentType string) (int64, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
-	line := strings.TrimSpace(string(out))
-	parts := strings.Split(line, "x")
-	if len(parts) != 2 {
-		return 0, 0, fmt.Errorf("unexpected ffprobe output: %q", line)
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
 	}
-	w, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	return st.Size(), s.objects.Put(ctx, key, f, st.Size(), contentType)
+}
+
+// downloadObject copies the object at key to a new local file at path and
+// returns its size.
+func (s *MediaService) downloadObject(ctx context.Context, key, path string) (int64, error) {
+	src, _, err := s.objects.Get(ctx, key)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
-	h, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	defer src.Close()
+	f, err := os.Create(path)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
+	}
+	n, err := io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-	return w, h, nil
+	return n, err
+}
+
+// probeDimensions returns the size of a video (or image) using ffprobe.
+func (s *MediaService) probeDimensions(ctx context.Context, path string) (int, int, error) {
+	return ffprobeDimensions(ctx, s.ffprobePath, path)
 }
 
 func (s *MediaService) convertToWebPAvatar(ctx context.Context, inPath, outPath string) error {
-	// Scale to cover and center-crop to a square avatar.
-	vf := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", avatarOutputPx, avatarOutputPx, avatarOutputPx, avatarOutputPx)
-	args := []string{
-		"-hide_banner",
-		"-loglevel", "error",
-		"-y",
-		"-i", inPath,
-		"-frames:v", "1",
-		"-map_metadata", "-1",
-		"-map_chapters", "-1",
-		"-vf", vf,
-		"-f", "webp",
-		"-c:v", "libwebp",
-		"-q:v", strconv.Itoa(defaultWebPQuality),
-		"-an",
-		outPath,
-	}
-
-	cmd := exec.CommandContext(ctx, s.ffmpegPath, args...)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		msg := strings.TrimSpace(stderr.String())
-		msg = strings.ReplaceAll(msg, inPath, "<input>")
-		msg = strings.ReplaceAll(msg, outPath, "<output>")
-
-		// SECURITY: Log detailed error server-side, return generic error to client
-		slog.Error("ffmpeg conversion failed", "error", err, "stderr", msg)
-		return fmt.Errorf("media conversion failed")
-	}
-	return nil
+	return s.images.ConvertWebPSquare(ctx, inPath, outPath, avatarOutputPx)
 }
 
 func (s *MediaService) convertToWebP(ctx context.Context, inPath, outPath string) error {
-	// SECURITY: Automatically resize images to maxOutputEdgePx (1920px) to:
-	// - Limit output resolution and prevent storage exhaustion
-	// - Strip metadata (EXIF/XMP/GPS) that may contain sensitive location/device info
-	// - Preserve aspect ratio while fitting within maximum edge constraint
-	// - Convert all formats to WebP for consistent, optimized output
-	//
-	// NOTE: Avoid quoting expressions here; Go exec passes quotes literally and ffmpeg filter parsing becomes brittle.
-	// Also escape commas inside min() for ffmpeg expression parser.
-	vf := fmt.Sprintf("scale=w=min(%d\\,iw):h=min(%d\\,ih):force_original_aspect_ratio=decrease", maxOutputEdgePx, maxOutputEdgePx)
-	args := []string{
-		"-hide_banner",
-		"-loglevel", "error",
-		"-y",
-		"-i", inPath,
-		"-frames:v", "1",
-		"-map_metadata", "-1",
-		"-map_chapters", "-1",
-		"-vf", vf,
-		"-f", "webp",
-		"-c:v", "libwebp",
-		"-q:v", strconv.Itoa(defaultWebPQuality),
-		"-an",
-		outPath,
-	}
-
-	cmd := exec.CommandContext(ctx, s.ffmpegPath, args...)
-	// Capture stderr for diagnostics.
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
-		msg := strings.TrimSpace(stderr.String())
-		// Best-effort sanitize: avoid leaking local temp paths.
-		msg = strings.ReplaceAll(msg, inPath, "<input>")
-		msg = strings.ReplaceAll(msg, outPath, "<output>")
-
-		// SECURITY: Log detailed error server-side, return generic error to client
-		slog.Error("ffmpeg conversion failed", "error", err, "stderr", msg)
-		return fmt.Errorf("media conversion failed")
-	}
-	return nil
+	return s.images.ConvertWebP(ctx, inPath, outPath, maxOutputEdgePx)
 }
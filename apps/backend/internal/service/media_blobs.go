@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"backend/internal/db/sqlc"
+	"backend/internal/storage"
+)
+
+// mediaBlobDir is the storage directory of deduplicated media. Each blob
+// lives under mediaBlobDir/<hash>/ with the same object names as media
+// stored under its ID.
+const mediaBlobDir = "blobs"
+
+// mediaBlobPin is how long a stored blob is kept without references. It
+// covers the gap between storing a blob and writing the media row that
+// references it.
+const mediaBlobPin = mediaJobLease
+
+// mediaBlobPrefix is the storage prefix of the blob with the given hash.
+func mediaBlobPrefix(hash string) string {
+	return mediaBlobDir + "/" + hash
+}
+
+// blobFile is a local file to store in a blob.
+type blobFile struct {
+	Name        string // Object name under the blob prefix
+	Path        string
+	ContentType string
+}
+
+// storeBlob stores files in the blob named by the SHA-256 of the first file
+// and returns the hash. The other files must be derived from the first, so
+// identical outputs share every object. Objects already present are not
+// uploaded again.
+//
+// The blob is pinned for mediaBlobPin, within which the caller must
+// reference it from a media row. Objects of a failed call are removed by the
+// garbage collector once the pin expires.
+func (s *MediaService) storeBlob(ctx context.Context, ext string, files []blobFile) (string, error) {
+	hash, err := fileSHA256(files[0].Path)
+	if err != nil {
+		return "", err
+	}
+	// Pinning waits for a concurrent release of the same blob, so the objects
+	// checked below are not deleted underneath us.
+	if err := s.store.Q.PinMediaBlob(ctx, sqlc.PinMediaBlobParams{
+		Hash:       hash,
+		Ext:        ext,
+		PinSeconds: int32(mediaBlobPin / time.Second),
+	}); err != nil {
+		return "", err
+	}
+	prefix := mediaBlobPrefix(hash)
+	for _, f := range files {
+		key := prefix + "/" + f.Name
+		if _, err := s.objects.Stat(ctx, key); err == nil {
+			continue
+		} else if !errors.Is(err, storage.ErrNotExist) {
+			return "", err
+		}
+		if _, err := s.putFile(ctx, key, f.Path, f.ContentType); err != nil {
+			return "", err
+		}
+	}
+	return hash, nil
+}
+
+// releaseBlob deletes the blob with the given hash once no media references
+// it and its pin has expired, and reports whether it did. The objects are
+// removed while the blob row is locked, so a concurrent upload of the same
+// content waits in storeBlob and then stores them again, and a media row
+// referencing the blob cannot be written until the deletion commits (and then
+// fails its foreign key).
+func (s *MediaService) releaseBlob(ctx context.Context, hash string) (bool, error) {
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		blob, err := q.DeleteUnreferencedMediaBlob(ctx, hash)
+		if err != nil {
+			return err
+		}
+		for _, key := range MediaObjectKeys(mediaBlobPrefix(blob.Hash), blob.Ext) {
+			if err := s.objects.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"backend/internal/api"
+	"backend/internal/blurhash"
+	"backend/internal/db/sqlc"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// maxAltTextRunes limits alt text length (Unicode characters).
+	maxAltTextRunes = 1500
+
+	// blurhashSamplePx is the edge of the thumbnail the BlurHash is computed
+	// from; the hash only keeps a few components, so more pixels add nothing.
+	blurhashSamplePx = 32
+)
+
+// mediaDescription holds the owner-provided alt text and focal point.
+type mediaDescription struct {
+	AltText sql.NullString
+	FocusX  sql.NullFloat64
+	FocusY  sql.NullFloat64
+}
+
+// parseUploadDescription reads the optional altText and focus ("x,y") fields
+// of an upload form.
+func parseUploadDescription(form url.Values) (mediaDescription, error) {
+	var desc mediaDescription
+	alt, err := normalizeAltText(form.Get("altText"))
+	if err != nil {
+		return desc, err
+	}
+	desc.AltText = alt
+
+	if v := strings.TrimSpace(form.Get("focus")); v != "" {
+		xs, ys, ok := strings.Cut(v, ",")
+		if !ok {
+			return desc, NewError(http.StatusBadRequest, "invalid_request", "focus must be x,y")
+		}
+		x, errX := strconv.ParseFloat(strings.TrimSpace(xs), 32)
+		y, errY := strconv.ParseFloat(strings.TrimSpace(ys), 32)
+		if errX != nil || errY != nil {
+			return desc, NewError(http.StatusBadRequest, "invalid_request", "focus must be x,y")
+		}
+		if err := desc.setFocus(x, y); err != nil {
+			return desc, err
+		}
+	}
+	return desc, nil
+}
+
+func (d *mediaDescription) setFocus(x, y float64) error {
+	if x < 0 || x > 1 || y < 0 || y > 1 {
+		return NewError(http.StatusBadRequest, "invalid_request", "focus must be between 0 and 1")
+	}
+	d.FocusX = sql.NullFloat64{Float64: x, Valid: true}
+	d.FocusY = sql.NullFloat64{Float64: y, Valid: true}
+	return nil
+}
+
+// normalizeAltText trims alt text and enforces the length limit. Empty text
+// is stored as NULL.
+func normalizeAltText(text string) (sql.NullString, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return sql.NullString{}, nil
+	}
+	if utf8.RuneCountInString(text) > maxAltTextRunes {
+		return sql.NullString{}, NewError(http.StatusBadRequest, "invalid_request", "alt text exceeds maximum length of "+strconv.Itoa(maxAltTextRunes)+" characters")
+	}
+	return sql.NullString{String: text, Valid: true}, nil
+}
+
+// UpdateMedia changes the alt text and focal point of media owned by userID.
+func (s *MediaService) UpdateMedia(ctx context.Context, userID, mediaID uuid.UUID, req api.UpdateMediaRequest) (api.Media, error) {
+	if s.store == nil {
+		return api.Media{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	current, err := s.store.Q.GetMediaStatusByID(ctx, mediaID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.Media{}, NewError(http.StatusNotFound, "not_found", "media not found")
+		}
+		return api.Media{}, err
+	}
+	if current.UserID != userID {
+		return api.Media{}, NewError(http.StatusNotFound, "not_found", "media not found")
+	}
+
+	desc := mediaDescription{AltText: current.AltText, FocusX: current.FocusX, FocusY: current.FocusY}
+	if req.AltText != nil {
+		if desc.AltText, err = normalizeAltText(*req.AltText); err != nil {
+			return api.Media{}, err
+		}
+		if err := checkBannedWords(ctx, s.store.Q, bannedWordScopePosts, desc.AltText.String); err != nil {
+			return api.Media{}, err
+		}
+	}
+	if req.Focus != nil {
+		if err := desc.setFocus(float64(req.Focus.X), float64(req.Focus.Y)); err != nil {
+			return api.Media{}, err
+		}
+	}
+
+	row, err := s.store.Q.UpdateMediaDescription(ctx, sqlc.UpdateMediaDescriptionParams{
+		ID:      mediaID,
+		UserID:  userID,
+		AltText: desc.AltText,
+		FocusX:  desc.FocusX,
+		FocusY:  desc.FocusY,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.Media{}, NewError(http.StatusNotFound, "not_found", "media not found")
+		}
+		return api.Media{}, err
+	}
+	variants, err := loadMediaVariants(ctx, s.store, []uuid.UUID{row.ID})
+	if err != nil {
+		return api.Media{}, err
+	}
+	m := newAPIMedia(mediaRecord{
+		ID:         row.ID,
+		Type:       row.Type,
+		Ext:        row.Ext,
+		Width:      row.Width,
+		Height:     row.Height,
+		DurationMs: row.DurationMs,
+		AltText:    row.AltText,
+		FocusX:     row.FocusX,
+		FocusY:     row.FocusY,
+		Blurhash:   row.Blurhash,
+		CreatedAt:  row.CreatedAt,
+	}, variants[row.ID])
+	status := api.MediaStatus(row.Status)
+	m.Status = &status
+	s.signAPIMedia(&m, s.signedURLTTL)
+	return m, nil
+}
+
+// computeBlurhash returns the BlurHash of the image at path, or "" when it
+// cannot be computed; placeholders are optional, so failures are only logged.
+func (s *MediaService) computeBlurhash(ctx context.Context, path string, width, height int) string {
+	out, err := s.images.SampleRGB(ctx, path, blurhashSamplePx)
+	if err != nil {
+		slog.Warn("failed to sample image for blurhash", "error", err)
+		return ""
+	}
+	xComp, yComp := 4, 3
+	if height > width {
+		xComp, yComp = 3, 4
+	}
+	hash, err := blurhash.Encode(xComp, yComp, blurhashSamplePx, blurhashSamplePx, out)
+	if err != nil {
+		slog.Warn("failed to compute blurhash", "error", err)
+		return ""
+	}
+	return hash
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"backend/internal/db/sqlc"
+	"backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// mediaGCBatchSize is the number of rows or stored media handled per query
+// by the garbage collector.
+const mediaGCBatchSize = 100
+
+// MediaGCResult summarizes a CollectGarbage run.
+type MediaGCResult struct {
+	Media   int // Unattached media deleted
+	Blobs   int // Unreferenced blobs deleted
+	Objects int // Stored objects without a database row deleted
+}
+
+// RunGC collects garbage every interval until ctx is cancelled.
+func (s *MediaService) RunGC(ctx context.Context, interval time.Duration) {
+	if s == nil || s.store == nil || s.objects == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		res, err := s.CollectGarbage(ctx)
+		if err != nil {
+			slog.Warn("failed to collect media garbage", "error", err)
+		}
+		if res.Media > 0 || res.Blobs > 0 || res.Objects > 0 {
+			slog.Info("collected media garbage", "media", res.Media, "blobs", res.Blobs, "objects", res.Objects)
+		}
+	}
+}
+
+// CollectGarbage deletes media older than the orphan age that is not
+// attached to a post, not a current avatar and not the server icon; deletes
+// blobs no media references; and, when reconciling is enabled and due and
+// the store can list its objects, deletes blob objects older than the
+// orphan age that have no database row. It is safe to run on several
+// instances at once.
+func (s *MediaService) CollectGarbage(ctx context.Context) (MediaGCResult, error) {
+	var res MediaGCResult
+	if s.store == nil || s.objects == nil {
+		return res, errors.New("media: database and storage must be configured")
+	}
+	cutoff := time.Now().Add(-s.orphanMaxAge)
+
+	var err error
+	if res.Media, err = s.collectOrphanMedia(ctx, cutoff); err != nil {
+		return res, err
+	}
+	if res.Blobs, err = s.collectBlobs(ctx); err != nil {
+		return res, err
+	}
+	if s.reconcileDue() {
+		res.Objects, err = s.reconcileObjects(ctx, cutoff)
+	}
+	return res, err
+}
+
+// reconcileDue reports whether CollectGarbage should reconcile stored
+// objects, which it does at most every reconcile interval.
+func (s *MediaService) reconcileDue() bool {
+	if s.reconcileEvery <= 0 {
+		return false
+	}
+	s.reconcileMu.Lock()
+	defer s.reconcileMu.Unlock()
+	now := time.Now()
+	if !s.lastReconcile.IsZero() && now.Sub(s.lastReconcile) < s.reconcileEvery {
+		return false
+	}
+	s.lastReconcile = now
+	return true
+}
+
+// collectOrphanMedia deletes unattached media created before cutoff.
+func (s *MediaService) collectOrphanMedia(ctx context.Context, cutoff time.Time) (int, error) {
+	icon := serverIconMediaID()
+	var n int
+	after := uuid.Nil
+	for {
+		ids, err := s.store.Q.ListOrphanMedia(ctx, sqlc.ListOrphanMediaParams{
+			ID:                after,
+			Limit:             mediaGCBatchSize,
+			CreatedBefore:     cutoff,
+			ServerIconMediaID: icon,
+		})
+		if err != nil {
+			return n, err
+		}
+		if len(ids) == 0 {
+			return n, nil
+		}
+		for _, id := range ids {
+			// Locking the row first makes a concurrent attach or avatar
+			// change either visible to the re-check or fail on its foreign
+			// key once the delete commits.
+			var row sqlc.DeleteOrphanMediaRow
+			err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+				if _, err := q.LockMediaByID(ctx, id); err != nil {
+					return err
+				}
+				var err error
+				row, err = q.DeleteOrphanMedia(ctx, sqlc.DeleteOrphanMediaParams{
+					ID:                id,
+					CreatedBefore:     cutoff,
+					ServerIconMediaID: icon,
+				})
+				return err
+			})
+			if errors.Is(err, sql.ErrNoRows) {
+				continue // attached or deleted meanwhile
+			}
+			if err != nil {
+				return n, err
+			}
+			s.deleteMediaObjects(ctx, row.ID, row.Ext, row.BlobHash.String)
+			n++
+		}
+		after = ids[len(ids)-1]
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+	}
+}
+
+// collectBlobs deletes blobs whose pin expired without a media row
+// referencing them, e.g. after failed uploads or cascading deletes.
+func (s *MediaService) collectBlobs(ctx context.Context) (int, error) {
+	var n int
+	after := ""
+	for {
+		hashes, err := s.store.Q.ListUnreferencedMediaBlobs(ctx, sqlc.ListUnreferencedMediaBlobsParams{
+			Hash:  after,
+			Limit: mediaGCBatchSize,
+		})
+		if err != nil {
+			return n, err
+		}
+		if len(hashes) == 0 {
+			return n, nil
+		}
+		for _, hash := range hashes {
+			released, err := s.releaseBlob(ctx, hash)
+			if err != nil {
+				slog.Warn("failed to release media blob", "error", err, "hash", hash)
+				continue
+			}
+			if released {
+				n++
+			}
+		}
+		after = hashes[len(hashes)-1]
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+	}
+}
+
+// reconcileObjects deletes stored blob objects modified before cutoff
+// whose blob row does not exist, which may be left behind when an instance
+// stops between storing a blob and recording it. It lists every object
+// below mediaBlobDir, which on S3 is a paid scan, so CollectGarbage only
+// runs it every reconcile interval. Stores that cannot list are skipped.
+func (s *MediaService) reconcileObjects(ctx context.Context, cutoff time.Time) (int, error) {
+	lister, ok := s.objects.(storage.Lister)
+	if !ok {
+		return 0, nil
+	}
+	var n int
+	byBlob := make(map[string][]string)
+	flush := func() error {
+		deleted, err := s.deleteUnownedBlobObjects(ctx, byBlob)
+		n += deleted
+		clear(byBlob)
+		return err
+	}
+	err := lister.List(ctx, mediaBlobDir+"/", func(key string, info storage.ObjectInfo) error {
+		if !info.ModTime.Before(cutoff) {
+			return nil
+		}
+		hash, _, _ := strings.Cut(strings.TrimPrefix(key, mediaBlobDir+"/"), "/")
+		byBlob[hash] = append(byBlob[hash], key)
+		if len(byBlob) >= mediaGCBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// deleteUnownedBlobObjects deletes the listed objects of blob hashes that
+// have no database row.
+func (s *MediaService) deleteUnownedBlobObjects(ctx context.Context, byBlob map[string][]string) (int, error) {
+	if len(byBlob) == 0 {
+		return 0, nil
+	}
+	hashes := make([]string, 0, len(byBlob))
+	for hash := range byBlob {
+		hashes = append(hashes, hash)
+	}
+	existing, err := s.store.Q.ListExistingMediaBlobHashes(ctx, hashes)
+	if err != nil {
+		return 0, err
+	}
+	for _, hash := range existing {
+		delete(byBlob, hash)
+	}
+
+	var n int
+	for _, keys := range byBlob {
+		for _, key := range keys {
+			if err := s.objects.Delete(ctx, key); err != nil {
+				slog.Warn("failed to delete media object", "error", err, "key", key)
+				continue
+			}
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Image processors for MediaServiceOptions.ImageProcessor.
+const (
+	// MediaImageProcessorAuto uses ffmpeg when ffmpeg and ffprobe are in
+	// PATH and the pure-Go processor otherwise.
+	MediaImageProcessorAuto = "auto"
+	// MediaImageProcessorFFmpeg always uses ffmpeg; image uploads are
+	// unavailable without it.
+	MediaImageProcessorFFmpeg = "ffmpeg"
+	// MediaImageProcessorGo decodes and encodes in-process. Video uploads
+	// still need ffmpeg; animated GIFs keep their first frame.
+	MediaImageProcessorGo = "go"
+)
+
+// ImageProcessor decodes, resizes and encodes still images for the upload
+// pipeline. Only the first frame of an input is read.
+//
+// SECURITY: Implementations must write output that carries nothing but
+// pixels: no EXIF/XMP/GPS metadata, ICC profiles or comments. Callers check
+// Dimensions against maxImageWidth, maxImageHeight and maxImagePixels before
+// converting.
+type ImageProcessor interface {
+	// Dimensions returns the displayed size of the image at path, reading
+	// as little as possible.
+	Dimensions(ctx context.Context, path string) (width, height int, err error)
+
+	// ConvertWebP writes inPath to outPath as WebP, downscaled to fit within
+	// maxEdge x maxEdge. Smaller images keep their size.
+	ConvertWebP(ctx context.Context, inPath, outPath string, maxEdge int) error
+
+	// ConvertWebPSquare writes inPath to outPath as a size x size WebP,
+	// scaled to cover the square and center-cropped.
+	ConvertWebPSquare(ctx context.Context, inPath, outPath string, size int) error
+
+	// ConvertPNG writes inPath to outPath as PNG at its original size.
+	ConvertPNG(ctx context.Context, inPath, outPath string) error
+
+	// SampleRGB returns the image at path scaled to size x size as packed
+	// 8-bit RGB, for computing placeholders.
+	SampleRGB(ctx context.Context, path string, size int) ([]byte, error)
+}
+
+// newImageProcessor returns the processor selected by mode, or nil when it
+// is unavailable.
+func newImageProcessor(mode, ffmpegPath, ffprobePath string) ImageProcessor {
+	hasFFmpeg := ffmpegPath != "" && ffprobePath != ""
+	switch mode {
+	case MediaImageProcessorGo:
+		return GoImageProcessor{}
+	case MediaImageProcessorFFmpeg:
+		if !hasFFmpeg {
+			return nil
+		}
+	default:
+		if !hasFFmpeg {
+			return GoImageProcessor{}
+		}
+	}
+	return ffmpegImageProcessor{ffmpegPath: ffmpegPath, ffprobePath: ffprobePath}
+}
+
+// ffmpegImageProcessor runs ffmpeg and ffprobe.
+type ffmpegImageProcessor struct {
+	ffmpegPath  string
+	ffprobePath string
+}
+
+func (p ffmpegImageProcessor) Dimensions(ctx context.Context, path string) (int, int, error) {
+	return ffprobeDimensions(ctx, p.ffprobePath, path)
+}
+
+// ffprobeDimensions returns the size of the first video stream of path,
+// which for images is the image itself.
+func ffprobeDimensions(ctx context.Context, ffprobePath, path string) (int, int, error) {
+	cmd := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height",
+		"-of", "csv=s=x:p=0",
+		path,
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	line := strings.TrimSpace(string(out))
+	parts := strings.Split(line, "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected ffprobe output: %q", line)
+	}
+	w, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, err
+	}
+	return w, h, nil
+}
+
+func (p ffmpegImageProcessor) ConvertWebP(ctx context.Context, inPath, outPath string, maxEdge int) error {
+	// SECURITY: Automatically resize images to maxEdge (maxOutputEdgePx, 1920px, for originals) to:
+	// - Limit output resolution and prevent storage exhaustion
+	// - Strip metadata (EXIF/XMP/GPS) that may contain sensitive location/device info
+	// - Preserve aspect ratio while fitting within maximum edge constraint
+	// - Convert all formats to WebP for consistent, optimized output
+	//
+	// NOTE: Avoid quoting expressions here; Go exec passes quotes literally and ffmpeg filter parsing becomes brittle.
+	// Also escape commas inside min() for ffmpeg expression parser.
+	vf := fmt.Sprintf("scale=w=min(%d\\,iw):h=min(%d\\,ih):force_original_aspect_ratio=decrease", maxEdge, maxEdge)
+	return p.convertWebP(ctx, inPath, outPath, vf)
+}
+
+func (p ffmpegImageProcessor) ConvertWebPSquare(ctx context.Context, inPath, outPath string, size int) error {
+	// Scale to cover and center-crop to a square.
+	vf := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", size, size, size, size)
+	return p.convertWebP(ctx, inPath, outPath, vf)
+}
+
+func (p ffmpegImageProcessor) convertWebP(ctx context.Context, inPath, outPath, vf string) error {
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-y",
+		"-i", inPath,
+		"-frames:v", "1",
+		"-map_metadata", "-1",
+		"-map_chapters", "-1",
+		"-vf", vf,
+		"-f", "webp",
+		"-c:v", "libwebp",
+		"-q:v", strconv.Itoa(defaultWebPQuality),
+		"-an",
+		outPath,
+	}
+	return runFFmpeg(ctx, p.ffmpegPath, inPath, outPath, args)
+}
+
+func (p ffmpegImageProcessor) ConvertPNG(ctx context.Context, inPath, outPath string) error {
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-y",
+		"-i", inPath,
+		"-frames:v", "1",
+		"-map_metadata", "-1",
+		"-c:v", "png",
+		"-f", "image2",
+		outPath,
+	}
+	return runFFmpeg(ctx, p.ffmpegPath, inPath, outPath, args)
+}
+
+func (p ffmpegImageProcessor) SampleRGB(ctx context.Context, path string, size int) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, p.ffmpegPath,
+		"-hide_banner",
+		"-loglevel", "error",
+		"-i", path,
+		"-frames:v", "1",
+		"-vf", "scale="+strconv.Itoa(size)+":"+strconv.Itoa(size)+":flags=area",
+		"-f", "rawvideo",
+		"-pix_fmt", "rgb24",
+		"pipe:1",
+	)
+	return cmd.Output()
+}
+
+// runFFmpeg runs ffmpeg with args, logging its stderr on failure.
+func runFFmpeg(ctx context.Context, ffmpegPath, inPath, outPath string, args []string) error {
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		// Best-effort sanitize: avoid leaking local temp paths.
+		msg = strings.ReplaceAll(msg, inPath, "<input>")
+		msg = strings.ReplaceAll(msg, outPath, "<output>")
+
+		// SECURITY: Log detailed error server-side, return generic error to client
+		slog.Error("ffmpeg conversion failed", "error", err, "stderr", msg)
+		return fmt.Errorf("media conversion failed")
+	}
+	return nil
+}
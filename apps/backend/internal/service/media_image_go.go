@@ -0,0 +1,285 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// GoImageProcessor is a pure-Go ImageProcessor; the zero value is ready to
+// use. It decodes JPEG, PNG, GIF and (still) WebP, honours the EXIF
+// orientation of JPEGs and writes lossless WebP, so its files are larger than
+// ffmpeg's. Output is encoded from pixels alone, so no metadata of the input
+// survives.
+type GoImageProcessor struct{}
+
+func (GoImageProcessor) Dimensions(_ context.Context, path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	if format == "jpeg" && swapsAxes(jpegOrientation(path)) {
+		return cfg.Height, cfg.Width, nil
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+func (p GoImageProcessor) ConvertWebP(ctx context.Context, inPath, outPath string, maxEdge int) error {
+	img, orientation, err := p.decode(ctx, inPath)
+	if err != nil {
+		return err
+	}
+	// The bounding box is square, so scaling before orienting is equivalent
+	// and touches fewer pixels.
+	b := img.Bounds()
+	if edge := max(b.Dx(), b.Dy()); edge > maxEdge {
+		w := max(1, b.Dx()*maxEdge/edge)
+		h := max(1, b.Dy()*maxEdge/edge)
+		img = scaleImage(img, b, w, h)
+	}
+	return writeWebP(outPath, orient(img, orientation))
+}
+
+func (p GoImageProcessor) ConvertWebPSquare(ctx context.Context, inPath, outPath string, size int) error {
+	img, orientation, err := p.decode(ctx, inPath)
+	if err != nil {
+		return err
+	}
+	return writeWebP(outPath, orient(scaleImage(img, centerSquare(img.Bounds()), size, size), orientation))
+}
+
+func (p GoImageProcessor) ConvertPNG(ctx context.Context, inPath, outPath string) error {
+	img, orientation, err := p.decode(ctx, inPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, orient(img, orientation))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (p GoImageProcessor) SampleRGB(ctx context.Context, path string, size int) ([]byte, error) {
+	img, orientation, err := p.decode(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	sample := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(sample, sample.Bounds(), img, img.Bounds(), draw.Src, nil)
+	if oriented, ok := orient(sample, orientation).(*image.NRGBA); ok {
+		sample = oriented
+	}
+	out := make([]byte, 0, size*size*3)
+	for i := 0; i < len(sample.Pix); i += 4 {
+		out = append(out, sample.Pix[i], sample.Pix[i+1], sample.Pix[i+2])
+	}
+	return out, nil
+}
+
+// decode reads the first frame of the image at path and its EXIF
+// orientation. The header is checked against the same limits as uploads
+// before any pixels are decoded.
+func (GoImageProcessor) decode(ctx context.Context, path string) (image.Image, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || cfg.Width > maxImageWidth || cfg.Height > maxImageHeight || cfg.Width*cfg.Height > maxImagePixels {
+		return nil, 0, errors.New("image dimensions out of range")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	img, _, err := image.Decode(bufio.NewReader(f))
+	if err != nil {
+		return nil, 0, err
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(path)
+	}
+	return img, orientation, ctx.Err()
+}
+
+// scaleImage resamples the src rectangle of img to w x h.
+func scaleImage(img image.Image, src image.Rectangle, w, h int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+	return dst
+}
+
+// centerSquare returns the largest square centered in r.
+func centerSquare(r image.Rectangle) image.Rectangle {
+	edge := min(r.Dx(), r.Dy())
+	x := r.Min.X + (r.Dx()-edge)/2
+	y := r.Min.Y + (r.Dy()-edge)/2
+	return image.Rect(x, y, x+edge, y+edge)
+}
+
+func writeWebP(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = nativewebp.Encode(w, img, nil)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// swapsAxes reports whether an EXIF orientation rotates by 90 degrees.
+func swapsAxes(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
+
+// orient applies an EXIF orientation (1-8) so the image displays upright.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if swapsAxes(orientation) {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90 clockwise to display
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90 counter-clockwise to display
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation of the JPEG at path, or 1
+// when it has none or the metadata cannot be read.
+func jpegOrientation(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 1
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return 1
+	}
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil || marker[0] != 0xFF {
+			return 1
+		}
+		// Metadata segments precede the image data.
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return 1
+		}
+		n := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if n < 0 {
+			return 1
+		}
+		if marker[1] != 0xE1 {
+			if _, err := r.Discard(n); err != nil {
+				return 1
+			}
+			continue
+		}
+		seg := make([]byte, n)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return 1
+		}
+		if o, ok := exifOrientation(seg); ok {
+			return o
+		}
+	}
+}
+
+// exifOrientation reads the Orientation tag from IFD0 of an APP1 segment.
+func exifOrientation(seg []byte) (int, bool) {
+	tiff, ok := bytes.CutPrefix(seg, []byte("Exif\x00\x00"))
+	if !ok || len(tiff) < 8 {
+		return 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, false
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := range count {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		// SHORT values are stored left-aligned in the value field.
+		o := int(order.Uint16(tiff[entry+8:]))
+		if o < 1 || o > 8 {
+			return 0, false
+		}
+		return o, true
+	}
+	return 0, false
+}
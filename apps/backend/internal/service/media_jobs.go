@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/db/sqlc"
+	"backend/internal/realtime"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// mediaJobLease bounds a single conversion. A job whose worker dies is
+	// picked up again by any instance once its lease expires.
+	mediaJobLease = 10 * time.Minute
+
+	// mediaJobMaxAttempts is how often a job is tried before the media is
+	// marked failed. Validation errors fail immediately.
+	mediaJobMaxAttempts = 3
+
+	// mediaJobRetryDelay is multiplied by the square of the attempt number.
+	mediaJobRetryDelay = 30 * time.Second
+
+	// mediaJobPollInterval is how often idle workers look for jobs queued by
+	// other instances.
+	mediaJobPollInterval = 2 * time.Second
+
+	// DefaultMediaWorkers is the number of conversions run concurrently per
+	// instance when not configured.
+	DefaultMediaWorkers = 2
+)
+
+// mediaSourceKey is the storage key of an upload waiting for conversion.
+func mediaSourceKey(id uuid.UUID) string {
+	return id.String() + "/source"
+}
+
+// enqueueUpload validates the upload, stores it as a source object and queues
+// a conversion job. Checks that need decoding run in the worker.
+func (s *MediaService) enqueueUpload(ctx context.Context, user auth.User, src multipart.File, header *multipart.FileHeader, form url.Values) (api.Media, error) {
+	// Validate file metadata and description
+	_, declaredCT, ext, err := s.validateUploadMetadata(header)
+	if err != nil {
+		return api.Media{}, err
+	}
+	desc, err := parseUploadDescription(form)
+	if err != nil {
+		return api.Media{}, err
+	}
+	if err := checkBannedWords(ctx, s.store.Q, bannedWordScopePosts, desc.AltText.String); err != nil {
+		return api.Media{}, err
+	}
+
+	// Write upload to temporary file with content validation
+	inPath, totalSize, err := s.writeUploadToTemp(src, ext, declaredCT)
+	if err != nil {
+		return api.Media{}, err
+	}
+	defer os.Remove(inPath)
+
+	// Reject what can be rejected without decoding, so that most errors are
+	// still reported by the upload request itself.
+	_, isMotionExt := motionExt[ext]
+	if isMotionExt && !s.videoSupported() {
+		return api.Media{}, errVideoUnsupported
+	}
+	if err := s.validateImageDimensions(ctx, inPath, ext); err != nil {
+		return api.Media{}, err
+	}
+	mediaType, storedExt := "image", storedImageExt
+	if isMotionExt {
+		mediaType, storedExt = mediaTypeVideo, storedVideoExt
+	} else if ext != ".gif" && ext != ".webp" && totalSize > maxUploadBytes {
+		// Only GIF and WebP can be animated and get the video limit.
+		return api.Media{}, NewError(http.StatusRequestEntityTooLarge, "payload_too_large", "file too large")
+	}
+
+	id := uuid.New()
+	sourceBytes, err := s.putFile(ctx, mediaSourceKey(id), inPath, expectedMimeByExt[ext])
+	if err != nil {
+		return api.Media{}, err
+	}
+	var row sqlc.CreatePendingMediaRow
+	err = s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		var err error
+		row, err = q.CreatePendingMedia(ctx, sqlc.CreatePendingMediaParams{
+			ID:        id,
+			UserID:    user.ID,
+			Type:      mediaType,
+			Ext:       storedExt,
+			AltText:   desc.AltText,
+			FocusX:    desc.FocusX,
+			FocusY:    desc.FocusY,
+			SizeBytes: sourceBytes, // until converted
+		})
+		if err != nil {
+			return err
+		}
+		return q.EnqueueMediaJob(ctx, sqlc.EnqueueMediaJobParams{MediaID: id, SourceExt: ext})
+	})
+	if err != nil {
+		s.deleteSource(ctx, id)
+		return api.Media{}, err
+	}
+	s.notifyWorkers()
+
+	m := newAPIMedia(mediaRecord{
+		ID:        row.ID,
+		Type:      row.Type,
+		Ext:       row.Ext,
+		AltText:   row.AltText,
+		FocusX:    row.FocusX,
+		FocusY:    row.FocusY,
+		CreatedAt: row.CreatedAt,
+	}, nil)
+	status := api.Processing
+	m.Status = &status
+	return m, nil
+}
+
+// notifyWorkers wakes an idle worker of this instance without blocking.
+func (s *MediaService) notifyWorkers() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *MediaService) deleteSource(ctx context.Context, id uuid.UUID) {
+	if err := s.objects.Delete(context.WithoutCancel(ctx), mediaSourceKey(id)); err != nil {
+		slog.Warn("failed to delete media object", "error", err, "key", mediaSourceKey(id))
+	}
+}
+
+// GetMedia returns a media item owned by userID with its processing status.
+func (s *MediaService) GetMedia(ctx context.Context, userID, mediaID uuid.UUID) (api.Media, error) {
+	if s.store == nil {
+		return api.Media{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	row, err := s.store.Q.GetMediaStatusByID(ctx, mediaID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.Media{}, NewError(http.StatusNotFound, "not_found", "media not found")
+		}
+		return api.Media{}, err
+	}
+	// Other users' media is reported as missing rather than forbidden so
+	// that IDs cannot be probed.
+	if row.UserID != userID {
+		return api.Media{}, NewError(http.StatusNotFound, "not_found", "media not found")
+	}
+	variants, err := loadMediaVariants(ctx, s.store, []uuid.UUID{row.ID})
+	if err != nil {
+		return api.Media{}, err
+	}
+	m := newAPIMedia(mediaRecord{
+		ID:         row.ID,
+		Type:       row.Type,
+		Ext:        row.Ext,
+		Width:      row.Width,
+		Height:     row.Height,
+		DurationMs: row.DurationMs,
+		AltText:    row.AltText,
+		FocusX:     row.FocusX,
+		FocusY:     row.FocusY,
+		Blurhash:   row.Blurhash,
+		CreatedAt:  row.CreatedAt,
+	}, variants[row.ID])
+	status := api.MediaStatus(row.Status)
+	m.Status = &status
+	s.signAPIMedia(&m, s.signedURLTTL)
+	return m, nil
+}
+
+// RunWorkers converts queued uploads with n concurrent workers until ctx is
+// cancelled. Jobs live in Postgres, so workers on every instance share the
+// queue.
+func (s *MediaService) RunWorkers(ctx context.Context, n int) {
+	if s.store == nil || s.objects == nil || s.initErr != nil {
+		slog.Warn("media workers disabled: storage or database not available")
+		return
+	}
+	if s.images == nil {
+		slog.Warn("media workers disabled: image processing not available")
+		return
+	}
+	if n <= 0 {
+		n = DefaultMediaWorkers
+	}
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runWorker(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *MediaService) runWorker(ctx context.Context) {
+	ticker := time.NewTicker(mediaJobPollInterval)
+	defer ticker.Stop()
+	for {
+		// Drain the queue before waiting again.
+		for {
+			ok, err := s.processNextJob(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("failed to claim media job", "error", err)
+				}
+				break
+			}
+			if !ok {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// processNextJob claims and runs one job. It reports whether a job was found.
+func (s *MediaService) processNextJob(ctx context.Context) (bool, error) {
+	job, err := s.store.Q.ClaimMediaJob(ctx, int32(mediaJobLease/time.Second))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, mediaJobLease)
+	defer cancel()
+	res, err := s.runMediaJob(jobCtx, job)
+	if err == nil {
+		err = s.completeMediaJob(ctx, job, res)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// Shutting down; the lease expires and another worker retries.
+			return true, nil
+		}
+		s.handleMediaJobError(ctx, job, err)
+	}
+	return true, nil
+}
+
+// runMediaJob downloads the source object and converts it.
+func (s *MediaService) runMediaJob(ctx context.Context, job sqlc.ClaimMediaJobRow) (processedMedia, error) {
+	workDir, err := os.MkdirTemp("", "ciel-media-*")
+	if err != nil {
+		return processedMedia{}, err
+	}
+	defer os.RemoveAll(workDir)
+
+	inPath := filepath.Join(workDir, "source"+job.SourceExt)
+	size, err := s.downloadObject(ctx, mediaSourceKey(job.MediaID), inPath)
+	if err != nil {
+		return processedMedia{}, fmt.Errorf("read source: %w", err)
+	}
+
+	return s.processUpload(ctx, job.MediaID, inPath, job.SourceExt, size, "image", s.convertToWebP, 0, true)
+}
+
+// completeMediaJob marks the media ready and notifies the uploader.
+func (s *MediaService) completeMediaJob(ctx context.Context, job sqlc.ClaimMediaJobRow, res processedMedia) error {
+	row, err := s.store.Q.CompleteMediaProcessing(ctx, sqlc.CompleteMediaProcessingParams{
+		ID:         job.MediaID,
+		Type:       res.Type,
+		Ext:        res.Ext,
+		Width:      int32(res.Width),
+		Height:     int32(res.Height),
+		DurationMs: res.Duration,
+		Blurhash:   nullString(res.Blurhash),
+		SizeBytes:  res.Bytes,
+		BlobHash:   nullString(res.Blob),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted while processing; the job row went with it.
+		s.deleteMediaObjects(ctx, job.MediaID, res.Ext, res.Blob)
+		return nil
+	}
+	if err != nil {
+		s.deleteMediaObjects(ctx, job.MediaID, res.Ext, res.Blob)
+		return err
+	}
+	variants := s.saveVariants(ctx, job.MediaID, res.Blob, res.Variants)
+	if err := s.store.Q.DeleteMediaJob(ctx, job.MediaID); err != nil {
+		slog.Warn("failed to delete media job", "error", err, "media_id", job.MediaID)
+	}
+	s.deleteSource(ctx, job.MediaID)
+
+	m := newAPIMedia(mediaRecord{
+		ID:         row.ID,
+		Type:       row.Type,
+		Ext:        row.Ext,
+		Width:      row.Width,
+		Height:     row.Height,
+		DurationMs: row.DurationMs,
+		AltText:    row.AltText,
+		FocusX:     row.FocusX,
+		FocusY:     row.FocusY,
+		Blurhash:   row.Blurhash,
+		CreatedAt:  row.CreatedAt,
+	}, variants)
+	s.publishMedia(ctx, realtime.Event{Type: realtime.EventMediaReady, Media: &m, UserId: &job.UserID})
+	return nil
+}
+
+// handleMediaJobError schedules a retry, or marks the media failed when the
+// upload was rejected or the job ran out of attempts.
+func (s *MediaService) handleMediaJobError(ctx context.Context, job sqlc.ClaimMediaJobRow, err error) {
+	var svcErr *Error
+	rejected := errors.As(err, &svcErr)
+	if !rejected && job.Attempts < mediaJobMaxAttempts {
+		delay := mediaJobRetryDelay * time.Duration(job.Attempts*job.Attempts)
+		slog.Warn("media job failed; retrying", "error", err, "media_id", job.MediaID, "attempt", job.Attempts, "delay", delay)
+		if err := s.store.Q.RetryMediaJob(ctx, sqlc.RetryMediaJobParams{
+			MediaID:      job.MediaID,
+			LastError:    sql.NullString{String: err.Error(), Valid: true},
+			DelaySeconds: int32(delay / time.Second),
+		}); err != nil {
+			slog.Warn("failed to reschedule media job", "error", err, "media_id", job.MediaID)
+		}
+		return
+	}
+
+	reason := "media processing failed"
+	if rejected {
+		reason = svcErr.Message
+	} else {
+		slog.Error("media job failed", "error", err, "media_id", job.MediaID, "attempts", job.Attempts)
+	}
+	if err := s.store.Q.FailMediaProcessing(ctx, job.MediaID); err != nil {
+		slog.Warn("failed to mark media failed", "error", err, "media_id", job.MediaID)
+	}
+	if err := s.store.Q.DeleteMediaJob(ctx, job.MediaID); err != nil {
+		slog.Warn("failed to delete media job", "error", err, "media_id", job.MediaID)
+	}
+	s.deleteSource(ctx, job.MediaID)
+
+	mediaID := job.MediaID
+	s.publishMedia(ctx, realtime.Event{Type: realtime.EventMediaFailed, MediaId: &mediaID, Reason: &reason, UserId: &job.UserID})
+}
+
+func (s *MediaService) publishMedia(ctx context.Context, event realtime.Event) {
+	if s.publisher == nil {
+		return
+	}
+	if err := s.publisher.Publish(ctx, event); err != nil {
+		slog.Warn("failed to publish media event", "error", err, "type", event.Type)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"backend/internal/storage"
+)
+
+// pngCacheKey names the PNG transcode of an object version. It includes the
+// source ETag, so a replaced source never serves a stale PNG.
+func pngCacheKey(key string, info storage.ObjectInfo) string {
+	sum := sha256.Sum256([]byte(key + "\x00" + info.ETag + "\x00" + strconv.FormatInt(info.Size, 10)))
+	name := hex.EncodeToString(sum[:16])
+	return name[:2] + "/" + name + ".png"
+}
+
+// servePNG serves the object at key transcoded to PNG, converting and
+// caching it on first request. Concurrent requests for the same object share
+// one conversion.
+func (s *MediaService) servePNG(w http.ResponseWriter, r *http.Request, key, cacheControl string) {
+	if s.images == nil || s.pngCache == nil {
+		http.Error(w, "png conversion unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	info, err := s.objects.Stat(r.Context(), key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotExist) {
+			slog.Warn("failed to stat media object", "error", err, "key", key)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	cacheKey := pngCacheKey(key, info)
+	cached, err := s.pngCache.Stat(r.Context(), cacheKey)
+	if err == nil {
+		s.touchPNG(cacheKey, cached)
+	} else if errors.Is(err, storage.ErrNotExist) {
+		// The conversion outlives a cancelled request so other waiters and
+		// later requests still get the cached file.
+		ctx := context.WithoutCancel(r.Context())
+		_, err, _ = s.pngGroup.Do(cacheKey, func() (any, error) {
+			return nil, s.transcodePNG(ctx, key, cacheKey)
+		})
+		if err != nil {
+			slog.Warn("failed to transcode media to png", "error", err, "key", key)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	s.serveObject(w, r, s.pngCache, cacheKey, "image/png", cacheControl)
+}
+
+// transcodePNG converts the object at key to PNG and stores it in the cache.
+func (s *MediaService) transcodePNG(ctx context.Context, key, cacheKey string) error {
+	if _, err := s.pngCache.Stat(ctx, cacheKey); err == nil {
+		return nil // converted by a previous flight
+	}
+	workDir, err := os.MkdirTemp("", "ciel-media-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	inPath := filepath.Join(workDir, "source.webp")
+	if _, err := s.downloadObject(ctx, key, inPath); err != nil {
+		return err
+	}
+	outPath := filepath.Join(workDir, "image.png")
+	if err := s.images.ConvertPNG(ctx, inPath, outPath); err != nil {
+		return err
+	}
+	f, err := os.Open(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return s.pngCache.Put(ctx, cacheKey, f, st.Size(), "image/png")
+}
+
+// pngTouchInterval limits how often serving a cached transcode refreshes its
+// modification time, which eviction uses as the time it was last served.
+const pngTouchInterval = time.Hour
+
+func (s *MediaService) touchPNG(cacheKey string, info storage.ObjectInfo) {
+	now := time.Now()
+	if now.Sub(info.ModTime) < pngTouchInterval {
+		return
+	}
+	p := filepath.Join(s.pngCache.Root(), filepath.FromSlash(cacheKey))
+	if err := os.Chtimes(p, now, now); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Debug("failed to touch png transcode", "error", err, "key", cacheKey)
+	}
+}
+
+// RunPNGCacheEviction evicts PNG transcodes every interval until ctx is
+// cancelled. The cache is local, so every instance runs it.
+func (s *MediaService) RunPNGCacheEviction(ctx context.Context, interval time.Duration) {
+	if s == nil || s.pngCache == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := s.EvictPNGCache(ctx)
+		if err != nil {
+			slog.Warn("failed to evict png transcodes", "error", err)
+		}
+		if n > 0 {
+			slog.Info("evicted png transcodes", "files", n)
+		}
+	}
+}
+
+// EvictPNGCache deletes transcodes not served within the maximum age, then
+// the least recently served ones until the cache fits its size limit. It
+// returns the number of deleted files.
+func (s *MediaService) EvictPNGCache(ctx context.Context) (int, error) {
+	type entry struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var (
+		entries []entry
+		total   int64
+		n       int
+	)
+	cutoff := time.Now().Add(-s.pngCacheMaxAge)
+	remove := func(key string) {
+		if err := s.pngCache.Delete(ctx, key); err != nil {
+			slog.Warn("failed to delete png transcode", "error", err, "key", key)
+			return
+		}
+		n++
+	}
+	err := s.pngCache.List(ctx, "", func(key string, info storage.ObjectInfo) error {
+		if info.ModTime.Before(cutoff) {
+			remove(key)
+			return nil
+		}
+		entries = append(entries, entry{key: key, size: info.Size, modTime: info.ModTime})
+		total += info.Size
+		return nil
+	})
+	if err != nil || total <= s.pngCacheBytes {
+		return n, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, e := range entries {
+		if total <= s.pngCacheBytes {
+			break
+		}
+		remove(e.key)
+		total -= e.size
+	}
+	return n, nil
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"backend/internal/api"
+	"backend/internal/db/sqlc"
+	"backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// userMediaQuota returns the stored-bytes quota of userID, or nil when it is
+// unlimited. A user gets the most generous quota of their roles, so any role
+// without a quota (and having no role at all) means unlimited.
+func userMediaQuota(ctx context.Context, q *sqlc.Queries, userID uuid.UUID) (*int64, error) {
+	quotas, err := q.ListUserRoleMediaQuotas(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var quota *int64
+	for _, v := range quotas {
+		if !v.Valid {
+			return nil, nil
+		}
+		if quota == nil || v.Int64 > *quota {
+			quota = &v.Int64
+		}
+	}
+	return quota, nil
+}
+
+// checkMediaQuota rejects an upload of size bytes that would take userID
+// over their quota. Concurrent uploads are checked against the same usage,
+// so a user can briefly exceed the quota by the size of those uploads.
+func (s *MediaService) checkMediaQuota(ctx context.Context, userID uuid.UUID, size int64) error {
+	quota, err := userMediaQuota(ctx, s.store.Q, userID)
+	if err != nil || quota == nil {
+		return err
+	}
+	usage, err := s.store.Q.GetUserMediaUsage(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if usage.UsedBytes+size > *quota {
+		return NewError(http.StatusRequestEntityTooLarge, "quota_exceeded", "media storage quota exceeded")
+	}
+	return nil
+}
+
+// GetStorageUsage reports the stored media bytes and quota of userID.
+func (s *MediaService) GetStorageUsage(ctx context.Context, userID uuid.UUID) (api.MediaStorageUsage, error) {
+	if s.store == nil {
+		return api.MediaStorageUsage{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	usage, err := s.store.Q.GetUserMediaUsage(ctx, userID)
+	if err != nil {
+		return api.MediaStorageUsage{}, err
+	}
+	quota, err := userMediaQuota(ctx, s.store.Q, userID)
+	if err != nil {
+		return api.MediaStorageUsage{}, err
+	}
+	return api.MediaStorageUsage{
+		UsedBytes:  usage.UsedBytes,
+		MediaCount: int(usage.MediaCount),
+		QuotaBytes: quota,
+	}, nil
+}
+
+// MediaSizeBackfillResult summarizes a BackfillSizes run.
+type MediaSizeBackfillResult struct {
+	Scanned int
+	Updated int
+	Failed  int
+}
+
+// BackfillSizes records the stored size of media created before sizes were
+// tracked, reading object sizes from storage. Media whose objects are all
+// missing keeps a size of 0 and is counted as failed.
+func (s *MediaService) BackfillSizes(ctx context.Context, batchSize int) (MediaSizeBackfillResult, error) {
+	var res MediaSizeBackfillResult
+	if s.store == nil || s.objects == nil {
+		return res, errors.New("media: database and storage must be configured")
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	after := uuid.Nil
+	for {
+		rows, err := s.store.Q.ListMediaForSizeBackfill(ctx, sqlc.ListMediaForSizeBackfillParams{
+			ID:    after,
+			Limit: int32(batchSize),
+		})
+		if err != nil {
+			return res, err
+		}
+		if len(rows) == 0 {
+			return res, nil
+		}
+		for _, row := range rows {
+			res.Scanned++
+			var total int64
+			for _, key := range MediaObjectKeys(MediaKeyPrefix(row.ID, row.BlobHash.String), row.Ext) {
+				info, err := s.objects.Stat(ctx, key)
+				if err != nil {
+					if !errors.Is(err, storage.ErrNotExist) {
+						slog.Warn("failed to stat media object", "error", err, "key", key)
+					}
+					continue
+				}
+				total += info.Size
+			}
+			if total == 0 {
+				res.Failed++
+				continue
+			}
+			if err := s.store.Q.SetMediaSizeBytes(ctx, sqlc.SetMediaSizeBytesParams{ID: row.ID, SizeBytes: total}); err != nil {
+				return res, err
+			}
+			res.Updated++
+		}
+		after = rows[len(rows)-1].ID
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+	}
+}
@@ -1,8 +1,16 @@
 package service
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"backend/internal/api"
 
 	"github.com/google/uuid"
 )
@@ -20,15 +28,92 @@ func publicBaseURL() string {
 // This is primarily used by tests living outside this package.
 func PublicBaseURL() string { return publicBaseURL() }
 
-func mediaImageURL(id uuid.UUID, ext string) string {
+// mediaFileName is the last path element of a media item's URL and storage
+// key: "video.mp4" for videos and "image.<ext>" otherwise.
+func mediaFileName(ext string) string {
 	ext = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
 	if ext == "" {
 		ext = "webp"
 	}
-	return publicBaseURL() + "/media/" + id.String() + "/image." + ext
+	if ext == storedVideoExt {
+		return "video." + ext
+	}
+	return "image." + ext
+}
+
+// MediaFileName exposes mediaFileName for handlers that build URLs from the
+// request host.
+func MediaFileName(ext string) string { return mediaFileName(ext) }
+
+func mediaImageURL(id uuid.UUID, ext string) string {
+	return publicBaseURL() + "/media/" + id.String() + "/" + mediaFileName(ext)
+}
+
+// mediaPosterURL is the URL of the poster frame of a video or gifv item.
+func mediaPosterURL(id uuid.UUID) string {
+	return publicBaseURL() + "/media/" + id.String() + "/" + mediaPosterFileName
+}
+
+// mediaVariantURL is the URL of the rendition with the given edge; ServeImage
+// resolves the size parameter to the stored rendition.
+func mediaVariantURL(id uuid.UUID, ext string, size int) string {
+	return mediaImageURL(id, ext) + "?size=" + strconv.Itoa(size)
 }
 
 // MediaImageURL builds the public URL for serving a media image.
 //
 // This is primarily used by tests living outside this package.
 func MediaImageURL(id uuid.UUID, ext string) string { return mediaImageURL(id, ext) }
+
+// mediaURLSignature signs access to every file of a media item until exp.
+func (s *MediaService) mediaURLSignature(id uuid.UUID, exp int64) string {
+	m := hmac.New(sha256.New, s.signingKey)
+	m.Write([]byte("media:" + id.String() + ":" + strconv.FormatInt(exp, 10)))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// signMediaURL appends exp and sig query parameters to a URL of media id.
+func (s *MediaService) signMediaURL(u string, id uuid.UUID, exp time.Time) string {
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	unix := exp.Unix()
+	return u + sep + "exp=" + strconv.FormatInt(unix, 10) + "&sig=" + s.mediaURLSignature(id, unix)
+}
+
+// signAPIMedia replaces the URLs of m with URLs signed for ttl when signing
+// is enabled.
+func (s *MediaService) signAPIMedia(m *api.Media, ttl time.Duration) {
+	if len(s.signingKey) == 0 {
+		return
+	}
+	exp := time.Now().Add(ttl)
+	m.Url = s.signMediaURL(m.Url, m.Id, exp)
+	if m.PosterUrl != nil {
+		poster := s.signMediaURL(*m.PosterUrl, m.Id, exp)
+		m.PosterUrl = &poster
+	}
+	if m.Variants != nil {
+		variants := make([]api.MediaVariant, len(*m.Variants))
+		for i, v := range *m.Variants {
+			v.Url = s.signMediaURL(v.Url, m.Id, exp)
+			variants[i] = v
+		}
+		m.Variants = &variants
+	}
+}
+
+// verifyMediaSignature reports whether r carries an unexpired signature for
+// media id.
+func (s *MediaService) verifyMediaSignature(r *http.Request, id uuid.UUID) bool {
+	if len(s.signingKey) == 0 {
+		return false
+	}
+	q := r.URL.Query()
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(q.Get("sig")), []byte(s.mediaURLSignature(id, exp)))
+}
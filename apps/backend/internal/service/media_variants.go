@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"backend/internal/api"
+	"backend/internal/db/sqlc"
+	"backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// mediaRenditionSizes are the bounding-box edges of the renditions stored
+// next to each image, smallest first. The original (capped at
+// maxOutputEdgePx) serves every larger request. Renditions are only generated
+// when smaller than the original.
+var mediaRenditionSizes = []int{320, 640, 1280}
+
+// mediaVariant is a stored rendition of an image.
+type mediaVariant struct {
+	Size   int
+	Width  int
+	Height int
+	Bytes  int64  // Stored size; only known for newly generated variants
+	Path   string // Local file; only set while processing
+}
+
+// mediaVariantFileName is the object name of the rendition with the given
+// edge.
+func mediaVariantFileName(size int) string {
+	return "image_" + strconv.Itoa(size) + "." + storedImageExt
+}
+
+// mediaVariantKey is the storage key of the rendition with the given edge
+// under prefix.
+func mediaVariantKey(prefix string, size int) string {
+	return prefix + "/" + mediaVariantFileName(size)
+}
+
+// renditionSizesFor returns the rendition edges to generate for an image of
+// the given dimensions.
+func renditionSizesFor(width, height int) []int {
+	edge := max(width, height)
+	var sizes []int
+	for _, size := range mediaRenditionSizes {
+		if size < edge {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+// pickVariant returns the smallest variant whose edge is at least size, or
+// false when only the original is large enough. Picking upwards avoids
+// serving an upscaled (blurry) image.
+func pickVariant(variants []mediaVariant, size int) (mediaVariant, bool) {
+	for _, v := range variants {
+		if v.Size >= size {
+			return v, true
+		}
+	}
+	return mediaVariant{}, false
+}
+
+// apiMediaVariants converts stored variants to their API form.
+func apiMediaVariants(id uuid.UUID, ext string, variants []mediaVariant) *[]api.MediaVariant {
+	out := make([]api.MediaVariant, 0, len(variants))
+	for _, v := range variants {
+		out = append(out, api.MediaVariant{
+			Url:    mediaVariantURL(id, ext, v.Size),
+			Width:  v.Width,
+			Height: v.Height,
+		})
+	}
+	return &out
+}
+
+// loadMediaVariants returns the variants of the given media, keyed by media ID.
+func loadMediaVariants(ctx context.Context, store *repository.Store, ids []uuid.UUID) (map[uuid.UUID][]mediaVariant, error) {
+	if store == nil {
+		return make(map[uuid.UUID][]mediaVariant), nil
+	}
+	return listMediaVariants(ctx, store.Q, ids)
+}
+
+// listMediaVariants is loadMediaVariants for a transaction.
+func listMediaVariants(ctx context.Context, q *sqlc.Queries, ids []uuid.UUID) (map[uuid.UUID][]mediaVariant, error) {
+	out := make(map[uuid.UUID][]mediaVariant, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	rows, err := q.ListMediaVariantsByMediaIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		out[row.MediaID] = append(out[row.MediaID], mediaVariant{
+			Size:   int(row.Size),
+			Width:  int(row.Width),
+			Height: int(row.Height),
+		})
+	}
+	return out, nil
+}
+
+// renderRenditions downscales srcPath to each of sizes in workDir; the
+// caller stores the results. Failures are logged and skipped so that one bad
+// rendition does not fail an upload; the backfill job retries missing sizes.
+func (s *MediaService) renderRenditions(ctx context.Context, id uuid.UUID, srcPath, workDir string, sizes []int) []mediaVariant {
+	variants := make([]mediaVariant, 0, len(sizes))
+	for _, size := range sizes {
+		outPath := filepath.Join(workDir, mediaVariantFileName(size))
+		if err := s.images.ConvertWebP(ctx, srcPath, outPath, size); err != nil {
+			slog.Warn("failed to generate media rendition", "error", err, "media_id", id, "size", size)
+			continue
+		}
+		w, h, err := s.images.Dimensions(ctx, outPath)
+		if err != nil {
+			slog.Warn("failed to probe media rendition", "error", err, "media_id", id, "size", size)
+			continue
+		}
+		st, err := os.Stat(outPath)
+		if err != nil {
+			slog.Warn("failed to stat media rendition", "error", err, "media_id", id, "size", size)
+			continue
+		}
+		variants = append(variants, mediaVariant{Size: size, Width: w, Height: h, Bytes: st.Size(), Path: outPath})
+	}
+	return variants
+}
+
+// saveVariants records generated renditions and adds their bytes to the
+// media's stored size. Rows that fail to insert have their objects removed so
+// storage and database stay in step, unless they live in a shared blob.
+func (s *MediaService) saveVariants(ctx context.Context, id uuid.UUID, blobHash string, variants []mediaVariant) []mediaVariant {
+	saved := variants[:0]
+	var bytes int64
+	for _, v := range variants {
+		err := s.store.Q.UpsertMediaVariant(ctx, sqlc.UpsertMediaVariantParams{
+			MediaID: id,
+			Size:    int32(v.Size),
+			Width:   int32(v.Width),
+			Height:  int32(v.Height),
+		})
+		if err != nil {
+			slog.Warn("failed to record media rendition", "error", err, "media_id", id, "size", v.Size)
+			if blobHash == "" {
+				key := mediaVariantKey(id.String(), v.Size)
+				if err := s.objects.Delete(context.WithoutCancel(ctx), key); err != nil {
+					slog.Warn("failed to delete media object", "error", err, "key", key)
+				}
+			}
+			continue
+		}
+		saved = append(saved, v)
+		bytes += v.Bytes
+	}
+	if bytes > 0 {
+		if err := s.store.Q.AddMediaSizeBytes(ctx, sqlc.AddMediaSizeBytesParams{ID: id, SizeBytes: bytes}); err != nil {
+			slog.Warn("failed to record media size", "error", err, "media_id", id)
+		}
+	}
+	return saved
+}
+
+// MediaVariantBackfillResult summarizes a BackfillVariants run.
+type MediaVariantBackfillResult struct {
+	Scanned   int
+	Generated int
+	Failed    int
+}
+
+// BackfillVariants generates missing renditions for existing images, walking
+// the media table in batches of batchSize. It is safe to run repeatedly and
+// concurrently with uploads.
+func (s *MediaService) BackfillVariants(ctx context.Context, batchSize int) (MediaVariantBackfillResult, error) {
+	var res MediaVariantBackfillResult
+	if s.store == nil || s.objects == nil {
+		return res, errors.New("media: database and storage must be configured")
+	}
+	if s.images == nil {
+		return res, errors.New("media: image processing not available")
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	after := uuid.Nil
+	for {
+		rows, err := s.store.Q.ListMediaForVariantBackfill(ctx, sqlc.ListMediaForVariantBackfillParams{
+			ID:    after,
+			Limit: int32(batchSize),
+		})
+		if err != nil {
+			return res, err
+		}
+		if len(rows) == 0 {
+			return res, nil
+		}
+		ids := make([]uuid.UUID, len(rows))
+		for i, row := range rows {
+			ids[i] = row.ID
+		}
+		existing, err := loadMediaVariants(ctx, s.store, ids)
+		if err != nil {
+			return res, err
+		}
+		for _, row := range rows {
+			res.Scanned++
+			missing := missingRenditionSizes(int(row.Width), int(row.Height), existing[row.ID])
+			if len(missing) == 0 {
+				continue
+			}
+			n, err := s.backfillOne(ctx, row.ID, row.Ext, row.BlobHash.String, missing)
+			res.Generated += n
+			if err != nil || n < len(missing) {
+				res.Failed++
+				if err != nil {
+					slog.Warn("failed to backfill media renditions", "error", err, "media_id", row.ID)
+				}
+			}
+		}
+		after = rows[len(rows)-1].ID
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+	}
+}
+
+func missingRenditionSizes(width, height int, have []mediaVariant) []int {
+	done := make(map[int]bool, len(have))
+	for _, v := range have {
+		done[v.Size] = true
+	}
+	var missing []int
+	for _, size := range renditionSizesFor(width, height) {
+		if !done[size] {
+			missing = append(missing, size)
+		}
+	}
+	return missing
+}
+
+// backfillOne fetches the stored original and generates the given renditions
+// from it, storing them next to the original. It returns the number of
+// renditions recorded.
+func (s *MediaService) backfillOne(ctx context.Context, id uuid.UUID, ext, blobHash string, sizes []int) (int, error) {
+	workDir, err := os.MkdirTemp("", "ciel-media-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(workDir)
+
+	srcPath := filepath.Join(workDir, "image."+normalizeStoredExt(ext))
+	prefix := MediaKeyPrefix(id, blobHash)
+	if _, err := s.downloadObject(ctx, mediaObjectKey(prefix, ext), srcPath); err != nil {
+		return 0, fmt.Errorf("read original: %w", err)
+	}
+
+	rendered := s.renderRenditions(ctx, id, srcPath, workDir, sizes)
+	variants := rendered[:0]
+	for _, v := range rendered {
+		if _, err := s.putFile(ctx, mediaVariantKey(prefix, v.Size), v.Path, "image/webp"); err != nil {
+			slog.Warn("failed to store media rendition", "error", err, "media_id", id, "size", v.Size)
+			continue
+		}
+		variants = append(variants, v)
+	}
+	return len(s.saveVariants(ctx, id, blobHash, variants)), nil
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/api"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Upload size limit for animated images and videos.
+	maxVideoUploadBytes = int64(64 << 20) // 64 MiB
+
+	// Output limits for the transcoded MP4. Longer inputs are truncated.
+	maxVideoDuration = 60 * time.Second
+	maxVideoEdgePx   = 1280
+	videoMaxBitrate  = "2500k"
+	videoBufSize     = "5000k"
+	videoCRF         = 23
+	videoAudioRate   = "128k"
+
+	storedVideoExt      = "mp4"
+	mediaPosterFileName = "poster.webp"
+)
+
+// Stored media types besides "image" and "avatar".
+const (
+	mediaTypeVideo = "video"
+	// mediaTypeGIFV is an animated image transcoded to a silent looping MP4.
+	mediaTypeGIFV = "gifv"
+)
+
+// motionExt lists extensions that are always uploaded as video.
+var motionExt = map[string]struct{}{
+	".mp4":  {},
+	".webm": {},
+}
+
+// mediaPosterKey is the storage key of a video's poster frame under prefix.
+func mediaPosterKey(prefix string) string {
+	return prefix + "/" + mediaPosterFileName
+}
+
+func isVideoExt(ext string) bool {
+	return normalizeStoredExt(ext) == storedVideoExt
+}
+
+// mediaContentType is the Content-Type of a stored media object.
+func mediaContentType(ext string) string {
+	if isVideoExt(ext) {
+		return "video/mp4"
+	}
+	return "image/webp"
+}
+
+// apiMediaType maps a stored media type to its API form. Avatars are images.
+func apiMediaType(t string) api.MediaType {
+	switch t {
+	case mediaTypeVideo:
+		return api.MediaTypeVideo
+	case mediaTypeGIFV:
+		return api.MediaTypeGifv
+	default:
+		return api.MediaTypeImage
+	}
+}
+
+// mediaRecord is the subset of a media row needed to build its API form. The
+// sqlc row types differ per query, so callers copy the fields they selected.
+type mediaRecord struct {
+	ID         uuid.UUID
+	Type       string
+	Ext        string
+	Width      int32
+	Height     int32
+	DurationMs sql.NullInt32
+	AltText    sql.NullString
+	FocusX     sql.NullFloat64
+	FocusY     sql.NullFloat64
+	Blurhash   sql.NullString
+	CreatedAt  time.Time
+}
+
+// newAPIMedia builds the API form of a stored media row. The status is
+// ready; callers that know otherwise overwrite it.
+func newAPIMedia(rec mediaRecord, variants []mediaVariant) api.Media {
+	m := api.Media{
+		Id:        rec.ID,
+		Type:      apiMediaType(rec.Type),
+		Url:       mediaImageURL(rec.ID, rec.Ext),
+		Width:     int(rec.Width),
+		Height:    int(rec.Height),
+		CreatedAt: rec.CreatedAt,
+	}
+	status := api.Ready
+	m.Status = &status
+	if isVideoExt(rec.Ext) {
+		poster := mediaPosterURL(rec.ID)
+		m.PosterUrl = &poster
+		if rec.DurationMs.Valid {
+			d := int(rec.DurationMs.Int32)
+			m.DurationMs = &d
+		}
+	} else {
+		m.Variants = apiMediaVariants(rec.ID, rec.Ext, variants)
+	}
+	if rec.AltText.Valid {
+		m.AltText = &rec.AltText.String
+	}
+	if rec.FocusX.Valid && rec.FocusY.Valid {
+		m.Focus = &api.MediaFocus{X: float32(rec.FocusX.Float64), Y: float32(rec.FocusY.Float64)}
+	}
+	if rec.Blurhash.Valid {
+		m.Blurhash = &rec.Blurhash.String
+	}
+	return m
+}
+
+// isAnimated reports whether a still-image upload (GIF or WebP) has more than
+// one frame and should be stored as gifv.
+func (s *MediaService) isAnimated(ctx context.Context, path, ext string) (bool, error) {
+	switch ext {
+	case ".webp":
+		return isAnimatedWebP(path)
+	case ".gif":
+		frames, err := s.probeFrameCount(ctx, path)
+		if err != nil {
+			return false, err
+		}
+		return frames > 1, nil
+	default:
+		return false, nil
+	}
+}
+
+// isAnimatedWebP checks the animation flag of an extended (VP8X) WebP header.
+func isAnimatedWebP(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	hdr := make([]byte, 21)
+	if _, err := f.Read(hdr); err != nil {
+		return false, nil
+	}
+	if string(hdr[0:4]) != "RIFF" || string(hdr[8:12]) != "WEBP" || string(hdr[12:16]) != "VP8X" {
+		return false, nil
+	}
+	return hdr[20]&0x02 != 0, nil
+}
+
+func (s *MediaService) probeFrameCount(ctx context.Context, path string) (int, error) {
+	cmd := exec.CommandContext(ctx, s.ffprobePath,
+		"-v", "error",
+		"-count_frames",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=nb_read_frames",
+		"-of", "csv=p=0",
+		path,
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+func (s *MediaService) probeDuration(ctx context.Context, path string) (time.Duration, error) {
+	cmd := exec.CommandContext(ctx, s.ffprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "csv=p=0",
+		path,
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+	sec, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected ffprobe output: %q", strings.TrimSpace(string(out)))
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
+
+// convertVideo transcodes an animated image or video to MP4, extracts a
+// poster frame and stores both in a blob.
+func (s *MediaService) convertVideo(ctx context.Context, id uuid.UUID, inPath, mediaType string) (processedMedia, error) {
+	workDir, err := os.MkdirTemp("", "ciel-media-*")
+	if err != nil {
+		return processedMedia{}, err
+	}
+	defer os.RemoveAll(workDir)
+	outPath := filepath.Join(workDir, "video."+storedVideoExt)
+	posterPath := filepath.Join(workDir, mediaPosterFileName)
+
+	if err := s.transcodeVideo(ctx, inPath, outPath, mediaType == mediaTypeVideo); err != nil {
+		return processedMedia{}, NewError(http.StatusBadRequest, "invalid_request", "failed to convert video")
+	}
+	wOut, hOut, err := s.probeDimensions(ctx, outPath)
+	if err != nil {
+		return processedMedia{}, NewError(http.StatusBadRequest, "invalid_request", "failed to read converted video")
+	}
+	duration, err := s.probeDuration(ctx, outPath)
+	if err != nil {
+		return processedMedia{}, NewError(http.StatusBadRequest, "invalid_request", "failed to read converted video")
+	}
+	if err := s.extractPoster(ctx, outPath, posterPath); err != nil {
+		return processedMedia{}, NewError(http.StatusBadRequest, "invalid_request", "failed to extract poster frame")
+	}
+
+	var total int64
+	for _, p := range []string{outPath, posterPath} {
+		st, err := os.Stat(p)
+		if err != nil {
+			return processedMedia{}, err
+		}
+		total += st.Size()
+	}
+	hash, err := s.storeBlob(ctx, storedVideoExt, []blobFile{
+		{Name: mediaFileName(storedVideoExt), Path: outPath, ContentType: "video/mp4"},
+		{Name: mediaPosterFileName, Path: posterPath, ContentType: "image/webp"},
+	})
+	if err != nil {
+		return processedMedia{}, err
+	}
+
+	return processedMedia{
+		Type:     mediaType,
+		Ext:      storedVideoExt,
+		Width:    wOut,
+		Height:   hOut,
+		Duration: sql.NullInt32{Int32: int32(duration / time.Millisecond), Valid: true},
+		Blurhash: s.computeBlurhash(ctx, posterPath, wOut, hOut),
+		Bytes:    total,
+		Blob:     hash,
+	}, nil
+}
+
+// transcodeVideo converts inPath to H.264 MP4 within the output limits.
+func (s *MediaService) transcodeVideo(ctx context.Context, inPath, outPath string, withAudio bool) error {
+	// SECURITY: Re-encode everything rather than remuxing so that only streams
+	// produced by our encoder reach clients, and strip metadata/chapters.
+	// Dimensions are kept even (force_divisible_by) as yuv420p requires.
+	vf := fmt.Sprintf("scale=w=min(%d\\,iw):h=min(%d\\,ih):force_original_aspect_ratio=decrease:force_divisible_by=2,format=yuv420p", maxVideoEdgePx, maxVideoEdgePx)
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-y",
+		"-i", inPath,
+		"-t", strconv.Itoa(int(maxVideoDuration / time.Second)),
+		"-map", "0:v:0",
+		"-map_metadata", "-1",
+		"-map_chapters", "-1",
+		"-vf", vf,
+		"-c:v", "libx264",
+		"-profile:v", "high",
+		"-preset", "veryfast",
+		"-crf", strconv.Itoa(videoCRF),
+		"-maxrate", videoMaxBitrate,
+		"-bufsize", videoBufSize,
+		"-movflags", "+faststart",
+	}
+	if withAudio {
+		// The trailing "?" makes the audio stream optional.
+		args = append(args, "-map", "0:a:0?", "-c:a", "aac", "-b:a", videoAudioRate, "-ac", "2")
+	} else {
+		args = append(args, "-an")
+	}
+	args = append(args, "-f", "mp4", outPath)
+	return s.runFFmpeg(ctx, inPath, outPath, args)
+}
+
+// extractPoster writes the first frame of videoPath as WebP.
+func (s *MediaService) extractPoster(ctx context.Context, videoPath, outPath string) error {
+	args := []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-y",
+		"-i", videoPath,
+		"-frames:v", "1",
+		"-map_metadata", "-1",
+		"-f", "webp",
+		"-c:v", "libwebp",
+		"-q:v", strconv.Itoa(defaultWebPQuality),
+		"-an",
+		outPath,
+	}
+	return s.runFFmpeg(ctx, videoPath, outPath, args)
+}
+
+func (s *MediaService) runFFmpeg(ctx context.Context, inPath, outPath string, args []string) error {
+	return runFFmpeg(ctx, s.ffmpegPath, inPath, outPath, args)
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net/http"
 
+	"backend/internal/api"
 	"backend/internal/db/sqlc"
+	"backend/internal/realtime"
 	"backend/internal/repository"
+	"backend/internal/service"
 
 	"github.com/google/uuid"
 )
@@ -15,6 +19,7 @@ import (
 type MediaService struct {
 	store       *repository.Store
 	logsService *LogsService
+	outbox      *service.RealtimeOutbox
 }
 
 // NewMediaService creates a new MediaService
@@ -25,6 +30,15 @@ func NewMediaService(store *repository.Store, logsService *LogsService) *MediaSe
 	}
 }
 
+// NewMediaServiceWithPublisher creates a new MediaService with realtime publishing.
+func NewMediaServiceWithPublisher(store *repository.Store, logsService *LogsService, publisher realtime.Publisher) *MediaService {
+	return &MediaService{
+		store:       store,
+		logsService: logsService,
+		outbox:      service.NewRealtimeOutbox(store, publisher),
+	}
+}
+
 // ListMediaParams contains parameters for listing media
 type ListMediaParams struct {
 	UserID  *uuid.UUID
@@ -86,14 +100,33 @@ func (s *MediaService) DeleteMedia(ctx context.Context, mediaID, deletedBy uuid.
 		deletionReason = sql.NullString{String: reason, Valid: true}
 	}
 
-	err := s.store.Q.AdminDeleteMedia(ctx, sqlc.AdminDeleteMediaParams{
-		ID:             mediaID,
-		DeletedBy:      uuid.NullUUID{UUID: deletedBy, Valid: true},
-		DeletionReason: deletionReason,
+	mid := api.MediaId(mediaID)
+	var event service.OutboxEvent
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		row, err := q.AdminDeleteMedia(ctx, sqlc.AdminDeleteMediaParams{
+			ID:             mediaID,
+			DeletedBy:      uuid.NullUUID{UUID: deletedBy, Valid: true},
+			DeletionReason: deletionReason,
+		})
+		if err != nil {
+			return err
+		}
+		// Only media on a visible post can be on anyone's timeline; other
+		// media is only shown to its owner.
+		deleted := realtime.Event{Type: realtime.EventMediaDeleted, MediaId: &mid}
+		if !row.OnVisiblePost {
+			deleted.UserId = &row.UserID
+		}
+		event, err = s.outbox.Record(ctx, q, deleted)
+		return err
 	})
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return service.NewError(http.StatusNotFound, "not_found", "media not found")
+		}
 		return fmt.Errorf("failed to delete media: %w", err)
 	}
+	s.outbox.Publish(ctx, event)
 
 	// Log the action
 	_, err = s.logsService.CreateLog(ctx, CreateLogParams{
@@ -9,6 +9,7 @@ import (
 	"backend/internal/db/sqlc"
 	"backend/internal/realtime"
 	"backend/internal/repository"
+	"backend/internal/service"
 
 	"github.com/google/uuid"
 )
@@ -17,7 +18,7 @@ import (
 type PostsService struct {
 	store       *repository.Store
 	logsService *LogsService
-	publisher   realtime.Publisher
+	outbox      *service.RealtimeOutbox
 }
 
 // NewPostsService creates a new PostsService
@@ -25,7 +26,7 @@ func NewPostsService(store *repository.Store, logsService *LogsService) *PostsSe
 	return &PostsService{
 		store:       store,
 		logsService: logsService,
-		publisher:   nil,
+		outbox:      nil,
 	}
 }
 
@@ -34,7 +35,7 @@ func NewPostsServiceWithPublisher(store *repository.Store, logsService *LogsServ
 	return &PostsService{
 		store:       store,
 		logsService: logsService,
-		publisher:   publisher,
+		outbox:      service.NewRealtimeOutbox(store, publisher),
 	}
 }
 
@@ -99,18 +100,24 @@ func (s *PostsService) DeletePost(ctx context.Context, postID, deletedBy uuid.UU
 		deletionReason = sql.NullString{String: reason, Valid: true}
 	}
 
-	err := s.store.Q.AdminDeletePost(ctx, sqlc.AdminDeletePostParams{
-		ID:             postID,
-		DeletedBy:      uuid.NullUUID{UUID: deletedBy, Valid: true},
-		DeletionReason: deletionReason,
+	pid := apiPostId(postID)
+	var event service.OutboxEvent
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		if err := q.AdminDeletePost(ctx, sqlc.AdminDeletePostParams{
+			ID:             postID,
+			DeletedBy:      uuid.NullUUID{UUID: deletedBy, Valid: true},
+			DeletionReason: deletionReason,
+		}); err != nil {
+			return err
+		}
+		var err error
+		event, err = s.outbox.Record(ctx, q, realtime.Event{Type: realtime.EventPostDeleted, PostId: &pid})
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
-	if s.publisher != nil {
-		pid := apiPostId(postID)
-		_ = s.publisher.Publish(ctx, realtime.Event{Type: realtime.EventPostDeleted, PostId: &pid})
-	}
+	s.outbox.Publish(ctx, event)
 
 	// Log the action
 	_, err = s.logsService.CreateLog(ctx, CreateLogParams{
@@ -134,10 +141,20 @@ func apiPostId(id uuid.UUID) api.PostId {
 
 // HidePost sets a post's visibility to hidden
 func (s *PostsService) HidePost(ctx context.Context, postID, adminUserID uuid.UUID) error {
-	err := s.store.Q.HidePost(ctx, postID)
+	pid := apiPostId(postID)
+	var event service.OutboxEvent
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		if err := q.HidePost(ctx, postID); err != nil {
+			return err
+		}
+		var err error
+		event, err = s.outbox.Record(ctx, q, realtime.Event{Type: realtime.EventPostHidden, PostId: &pid})
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to hide post: %w", err)
 	}
+	s.outbox.Publish(ctx, event)
 
 	// Log the action
 	_, err = s.logsService.CreateLog(ctx, CreateLogParams{
@@ -157,10 +174,26 @@ func (s *PostsService) HidePost(ctx context.Context, postID, adminUserID uuid.UU
 
 // UnhidePost restores a post's visibility to public
 func (s *PostsService) UnhidePost(ctx context.Context, postID, adminUserID uuid.UUID) error {
-	err := s.store.Q.UnhidePost(ctx, postID)
+	var event service.OutboxEvent
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		if err := q.UnhidePost(ctx, postID); err != nil {
+			return err
+		}
+		if s.outbox == nil {
+			return nil
+		}
+		// Clients need the whole post to show it again.
+		post, err := service.LoadPost(ctx, q, postID)
+		if err != nil || post.DeletedAt != nil {
+			return err
+		}
+		event, err = s.outbox.Record(ctx, q, realtime.Event{Type: realtime.EventPostUnhidden, Post: &post})
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to unhide post: %w", err)
 	}
+	s.outbox.Publish(ctx, event)
 
 	// Log the action
 	_, err = s.logsService.CreateLog(ctx, CreateLogParams{
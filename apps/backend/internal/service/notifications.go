@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"backend/internal/api"
+	"backend/internal/db/sqlc"
+	"backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// Notification types.
+const (
+	NotificationLoginLockout = "login_lockout"
+)
+
+type NotificationsService struct {
+	store *repository.Store
+}
+
+func NewNotificationsService(store *repository.Store) *NotificationsService {
+	return &NotificationsService{store: store}
+}
+
+// Notify adds a notification to the user's inbox. data must be JSON-serialisable.
+func (s *NotificationsService) Notify(ctx context.Context, userID uuid.UUID, notificationType string, data any) error {
+	if s.store == nil {
+		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.Q.CreateNotification(ctx, sqlc.CreateNotificationParams{
+		UserID: userID,
+		Type:   notificationType,
+		Data:   raw,
+	})
+	return err
+}
+
+func (s *NotificationsService) List(ctx context.Context, userID uuid.UUID, limit int) (api.NotificationList, error) {
+	if s.store == nil {
+		return api.NotificationList{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	rows, err := s.store.Q.ListNotificationsByUser(ctx, sqlc.ListNotificationsByUserParams{UserID: userID, Limit: int32(limit)})
+	if err != nil {
+		return api.NotificationList{}, err
+	}
+	unread, err := s.store.Q.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return api.NotificationList{}, err
+	}
+
+	items := make([]api.Notification, 0, len(rows))
+	for _, row := range rows {
+		n := api.Notification{
+			Id:        row.ID,
+			Type:      row.Type,
+			Data:      map[string]interface{}{},
+			CreatedAt: row.CreatedAt,
+		}
+		if len(row.Data) > 0 {
+			_ = json.Unmarshal(row.Data, &n.Data)
+		}
+		if row.ReadAt.Valid {
+			t := row.ReadAt.Time
+			n.ReadAt = &t
+		}
+		items = append(items, n)
+	}
+	return api.NotificationList{Items: items, UnreadCount: int(unread)}, nil
+}
+
+func (s *NotificationsService) MarkRead(ctx context.Context, userID, notificationID uuid.UUID) error {
+	if s.store == nil {
+		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	n, err := s.store.Q.MarkNotificationRead(ctx, sqlc.MarkNotificationReadParams{ID: notificationID, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NewError(http.StatusNotFound, "not_found", "notification not found")
+	}
+	return nil
+}
@@ -0,0 +1,887 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/db/sqlc"
+	"backend/internal/logging"
+	"backend/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// OAuth scopes that are not permission IDs. Delegated tokens may additionally
+// carry the user-action permission IDs listed in oauthScopeDescriptions; a
+// token only ever carries permissions its user actually holds.
+const (
+	OAuthScopeOpenID  = "openid"
+	OAuthScopeProfile = "profile"
+	OAuthScopeRead    = "read"
+)
+
+var oauthScopeDescriptions = map[string]string{
+	OAuthScopeOpenID:   "Sign you in with your account",
+	OAuthScopeProfile:  "See your username and display name",
+	OAuthScopeRead:     "Read timelines, posts and profiles",
+	"posts_create":     "Create posts on your behalf",
+	"posts_delete":     "Delete your posts",
+	"media_upload":     "Upload media on your behalf",
+	"reactions_add":    "Add reactions on your behalf",
+	"reactions_remove": "Remove your reactions",
+}
+
+// isPermissionScope reports whether scope maps to a permission ID that must be
+// re-checked against the user's current permissions.
+func isPermissionScope(scope string) bool {
+	switch scope {
+	case OAuthScopeOpenID, OAuthScopeProfile, OAuthScopeRead:
+		return false
+	default:
+		return true
+	}
+}
+
+const (
+	oauthClientIDPrefix  = "ciel_"
+	maxOAuthRedirectURIs = 10
+)
+
+type OAuthServiceOptions struct {
+	AccessTokenTTL time.Duration
+	CodeTTL        time.Duration
+	Now            func() time.Time
+}
+
+// OAuthService implements an OAuth2 authorization server (authorization code
+// flow with PKCE) and the OpenID Connect pieces on top of it.
+type OAuthService struct {
+	store     *repository.Store
+	tokens    *auth.TokenManager
+	authz     *AuthzService
+	accessTTL time.Duration
+	codeTTL   time.Duration
+	now       func() time.Time
+
+	securityEvents *SecurityEventsService
+}
+
+func NewOAuthService(store *repository.Store, tokens *auth.TokenManager, authz *AuthzService, opts OAuthServiceOptions) *OAuthService {
+	if opts.AccessTokenTTL <= 0 {
+		opts.AccessTokenTTL = time.Hour
+	}
+	if opts.CodeTTL <= 0 {
+		opts.CodeTTL = 10 * time.Minute
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &OAuthService{
+		store:     store,
+		tokens:    tokens,
+		authz:     authz,
+		accessTTL: opts.AccessTokenTTL,
+		codeTTL:   opts.CodeTTL,
+		now:       opts.Now,
+	}
+}
+
+// SetSecurityEventsService sets the log that records token grants and revocations.
+func (s *OAuthService) SetSecurityEventsService(events *SecurityEventsService) {
+	s.securityEvents = events
+}
+
+// Issuer is the OpenID Connect issuer identifier.
+func (s *OAuthService) Issuer() string {
+	return publicBaseURL()
+}
+
+func (s *OAuthService) ready() error {
+	if s.store == nil || s.tokens == nil {
+		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Client registration (admin)
+// ---------------------------------------------------------------------------
+
+type CreateOAuthClientParams struct {
+	Name         string
+	RedirectURIs []string
+	Scopes       []string
+	// Public clients (SPAs, native apps) have no secret and rely on PKCE alone.
+	Public bool
+}
+
+// CreateOAuthClient registers a client. The secret is only returned here.
+func (s *OAuthService) CreateOAuthClient(ctx context.Context, admin auth.User, p CreateOAuthClientParams) (api.OAuthClient, string, error) {
+	if err := s.ready(); err != nil {
+		return api.OAuthClient{}, "", err
+	}
+	name := strings.TrimSpace(p.Name)
+	if name == "" || len(name) > 100 {
+		return api.OAuthClient{}, "", NewError(http.StatusBadRequest, "invalid_request", "name must be 1-100 characters")
+	}
+	if len(p.RedirectURIs) == 0 || len(p.RedirectURIs) > maxOAuthRedirectURIs {
+		return api.OAuthClient{}, "", NewError(http.StatusBadRequest, "invalid_request", "between 1 and 10 redirect URIs required")
+	}
+	for _, u := range p.RedirectURIs {
+		if err := validateRedirectURI(u); err != nil {
+			return api.OAuthClient{}, "", err
+		}
+	}
+	scopes, err := parseScopes(strings.Join(p.Scopes, " "), nil)
+	if err != nil {
+		return api.OAuthClient{}, "", err
+	}
+	if len(scopes) == 0 {
+		return api.OAuthClient{}, "", NewError(http.StatusBadRequest, "invalid_scope", "at least one scope required")
+	}
+
+	idPart, err := auth.RandomToken(12)
+	if err != nil {
+		return api.OAuthClient{}, "", err
+	}
+	var secret string
+	var secretHash []byte
+	if !p.Public {
+		if secret, err = auth.RandomToken(32); err != nil {
+			return api.OAuthClient{}, "", err
+		}
+		secretHash = hashAuthToken(secret)
+	}
+
+	row, err := s.store.Q.CreateOAuthClient(ctx, sqlc.CreateOAuthClientParams{
+		ID:            oauthClientIDPrefix + idPart,
+		Name:          name,
+		SecretHash:    secretHash,
+		RedirectUris:  p.RedirectURIs,
+		AllowedScopes: strings.Join(scopes, " "),
+		CreatedBy:     uuid.NullUUID{UUID: admin.ID, Valid: true},
+	})
+	if err != nil {
+		return api.OAuthClient{}, "", err
+	}
+	auditOAuth(ctx, "oauth.client.create", admin.ID, row.ID)
+	return mapOAuthClient(row), secret, nil
+}
+
+func (s *OAuthService) ListOAuthClients(ctx context.Context) ([]api.OAuthClient, error) {
+	if err := s.ready(); err != nil {
+		return nil, err
+	}
+	rows, err := s.store.Q.ListOAuthClients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]api.OAuthClient, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, mapOAuthClient(row))
+	}
+	return out, nil
+}
+
+// DisableOAuthClient stops a client from authorizing users and revokes its
+// outstanding access tokens.
+func (s *OAuthService) DisableOAuthClient(ctx context.Context, admin auth.User, clientID string) error {
+	if err := s.ready(); err != nil {
+		return err
+	}
+	n, err := s.store.Q.DisableOAuthClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NewError(http.StatusNotFound, "not_found", "client not found")
+	}
+	revoked, err := s.store.Q.RevokeOAuthAccessTokensForClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	for _, t := range revoked {
+		s.propagateRevocation(ctx, t.Jti, t.ExpiresAt)
+	}
+	auditOAuth(ctx, "oauth.client.disable", admin.ID, clientID)
+	return nil
+}
+
+func mapOAuthClient(row sqlc.OauthClient) api.OAuthClient {
+	out := api.OAuthClient{
+		ClientId:     row.ID,
+		Name:         row.Name,
+		RedirectUris: row.RedirectUris,
+		Scopes:       strings.Fields(row.AllowedScopes),
+		Public:       len(row.SecretHash) == 0,
+		CreatedAt:    row.CreatedAt,
+		Disabled:     row.DisabledAt.Valid,
+	}
+	if out.RedirectUris == nil {
+		out.RedirectUris = []string{}
+	}
+	return out
+}
+
+// validateRedirectURI accepts absolute https URLs, or http on loopback for
+// local development. Fragments are not allowed (RFC 6749 §3.1.2).
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" || u.User != nil {
+		return NewError(http.StatusBadRequest, "invalid_request", "redirect URI must be an absolute URL without fragment")
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			return nil
+		}
+	}
+	return NewError(http.StatusBadRequest, "invalid_request", "redirect URI must use https (http is allowed for loopback only)")
+}
+
+// parseScopes splits a space-delimited scope string, rejecting unknown scopes
+// and, when allowed is non-nil, scopes outside allowed. Order is normalised.
+func parseScopes(raw string, allowed []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, sc := range strings.Fields(raw) {
+		if seen[sc] {
+			continue
+		}
+		if _, ok := oauthScopeDescriptions[sc]; !ok {
+			return nil, NewError(http.StatusBadRequest, "invalid_scope", "unknown scope: "+sc)
+		}
+		if allowed != nil && !auth.HasScope(allowed, sc) {
+			return nil, NewError(http.StatusBadRequest, "invalid_scope", "scope not allowed for this client: "+sc)
+		}
+		seen[sc] = true
+		out = append(out, sc)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// ---------------------------------------------------------------------------
+// Authorization endpoint (consent screen)
+// ---------------------------------------------------------------------------
+
+// AuthorizeRequest carries the parameters of an authorization request as the
+// client sent them to the consent page.
+type AuthorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// validateAuthorize checks an authorization request. Errors here must be shown
+// to the user rather than redirected, because the redirect URI is untrusted
+// until it is matched against the client registration.
+func (s *OAuthService) validateAuthorize(ctx context.Context, req AuthorizeRequest) (sqlc.OauthClient, []string, error) {
+	client, err := s.store.Q.GetOAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sqlc.OauthClient{}, nil, NewError(http.StatusBadRequest, "invalid_client", "unknown client")
+		}
+		return sqlc.OauthClient{}, nil, err
+	}
+	if client.DisabledAt.Valid {
+		return sqlc.OauthClient{}, nil, NewError(http.StatusBadRequest, "invalid_client", "client is disabled")
+	}
+	registered := false
+	for _, u := range client.RedirectUris {
+		if u == req.RedirectURI {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return sqlc.OauthClient{}, nil, NewError(http.StatusBadRequest, "invalid_redirect_uri", "redirect URI is not registered for this client")
+	}
+	if req.ResponseType != "code" {
+		return sqlc.OauthClient{}, nil, NewError(http.StatusBadRequest, "unsupported_response_type", "only response_type=code is supported")
+	}
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) < 43 || len(req.CodeChallenge) > 128 {
+		return sqlc.OauthClient{}, nil, NewError(http.StatusBadRequest, "invalid_request", "PKCE with code_challenge_method=S256 is required")
+	}
+	scopes, err := parseScopes(req.Scope, strings.Fields(client.AllowedScopes))
+	if err != nil {
+		return sqlc.OauthClient{}, nil, err
+	}
+	if len(scopes) == 0 {
+		return sqlc.OauthClient{}, nil, NewError(http.StatusBadRequest, "invalid_scope", "scope required")
+	}
+	return client, scopes, nil
+}
+
+// grantableScopes drops permission scopes the user does not currently hold.
+func (s *OAuthService) grantableScopes(ctx context.Context, userID uuid.UUID, scopes []string) ([]string, error) {
+	out := make([]string, 0, len(scopes))
+	for _, sc := range scopes {
+		if isPermissionScope(sc) && s.authz != nil {
+			ok, err := s.authz.HasPermission(ctx, userID, sc, DefaultPermissionScope)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		out = append(out, sc)
+	}
+	return out, nil
+}
+
+// AuthorizeInfo returns what the consent screen should display.
+func (s *OAuthService) AuthorizeInfo(ctx context.Context, user auth.User, req AuthorizeRequest) (api.OAuthAuthorizeInfo, error) {
+	if err := s.ready(); err != nil {
+		return api.OAuthAuthorizeInfo{}, err
+	}
+	client, scopes, err := s.validateAuthorize(ctx, req)
+	if err != nil {
+		return api.OAuthAuthorizeInfo{}, err
+	}
+	granted, err := s.grantableScopes(ctx, user.ID, scopes)
+	if err != nil {
+		return api.OAuthAuthorizeInfo{}, err
+	}
+
+	consentRequired := true
+	consent, err := s.store.Q.GetOAuthConsent(ctx, sqlc.GetOAuthConsentParams{UserID: user.ID, ClientID: client.ID})
+	switch {
+	case err == nil:
+		consentRequired = !coversScopes(strings.Fields(consent.Scope), granted)
+	case !errors.Is(err, sql.ErrNoRows):
+		return api.OAuthAuthorizeInfo{}, err
+	}
+
+	info := api.OAuthAuthorizeInfo{
+		Client:          api.OAuthClientSummary{ClientId: client.ID, Name: client.Name},
+		RedirectUri:     req.RedirectURI,
+		Scopes:          make([]api.OAuthScope, 0, len(granted)),
+		ConsentRequired: consentRequired,
+	}
+	for _, sc := range granted {
+		info.Scopes = append(info.Scopes, api.OAuthScope{Id: sc, Description: oauthScopeDescriptions[sc]})
+	}
+	return info, nil
+}
+
+func coversScopes(have, want []string) bool {
+	for _, sc := range want {
+		if !auth.HasScope(have, sc) {
+			return false
+		}
+	}
+	return true
+}
+
+// Authorize records the user's decision and returns the URL to redirect the
+// browser to: either with an authorization code or with error=access_denied.
+func (s *OAuthService) Authorize(ctx context.Context, user auth.User, req AuthorizeRequest, approve bool) (string, error) {
+	if err := s.ready(); err != nil {
+		return "", err
+	}
+	client, scopes, err := s.validateAuthorize(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	params.Set("iss", s.Issuer())
+	if !approve {
+		params.Set("error", "access_denied")
+		auditOAuth(ctx, "oauth.authorize.deny", user.ID, client.ID)
+		return appendQuery(req.RedirectURI, params), nil
+	}
+
+	granted, err := s.grantableScopes(ctx, user.ID, scopes)
+	if err != nil {
+		return "", err
+	}
+	if len(granted) == 0 {
+		params.Set("error", "invalid_scope")
+		return appendQuery(req.RedirectURI, params), nil
+	}
+
+	code, err := auth.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	consented := granted
+	if consent, err := s.store.Q.GetOAuthConsent(ctx, sqlc.GetOAuthConsentParams{UserID: user.ID, ClientID: client.ID}); err == nil {
+		consented, _ = parseScopes(consent.Scope+" "+strings.Join(granted, " "), nil)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	err = s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		if err := q.UpsertOAuthConsent(ctx, sqlc.UpsertOAuthConsentParams{
+			UserID:   user.ID,
+			ClientID: client.ID,
+			Scope:    strings.Join(consented, " "),
+		}); err != nil {
+			return err
+		}
+		return q.CreateOAuthAuthorizationCode(ctx, sqlc.CreateOAuthAuthorizationCodeParams{
+			CodeHash:      hashAuthToken(code),
+			ClientID:      client.ID,
+			UserID:        user.ID,
+			RedirectUri:   req.RedirectURI,
+			Scope:         strings.Join(granted, " "),
+			CodeChallenge: req.CodeChallenge,
+			Nonce:         sql.NullString{String: req.Nonce, Valid: req.Nonce != ""},
+			ExpiresAt:     s.now().Add(s.codeTTL),
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	auditOAuth(ctx, "oauth.authorize", user.ID, client.ID, slog.String("scope", strings.Join(granted, " ")))
+	params.Set("code", code)
+	return appendQuery(req.RedirectURI, params), nil
+}
+
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// ---------------------------------------------------------------------------
+// Token, introspection and revocation endpoints
+// ---------------------------------------------------------------------------
+
+// OAuthTokenRequest is the form body of the token endpoint. ClientSecret may
+// come from HTTP Basic authentication instead.
+type OAuthTokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+}
+
+// authenticateClient verifies client credentials. Confidential clients must
+// present their secret; public clients must not have one.
+func (s *OAuthService) authenticateClient(ctx context.Context, clientID, secret string) (sqlc.OauthClient, error) {
+	errInvalid := NewError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	if clientID == "" {
+		return sqlc.OauthClient{}, errInvalid
+	}
+	client, err := s.store.Q.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return sqlc.OauthClient{}, errInvalid
+		}
+		return sqlc.OauthClient{}, err
+	}
+	if client.DisabledAt.Valid {
+		return sqlc.OauthClient{}, errInvalid
+	}
+	if len(client.SecretHash) == 0 {
+		if secret != "" {
+			return sqlc.OauthClient{}, errInvalid
+		}
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare(hashAuthToken(secret), client.SecretHash) != 1 {
+		return sqlc.OauthClient{}, errInvalid
+	}
+	return client, nil
+}
+
+// Exchange redeems an authorization code for an access token (and an ID token
+// when the openid scope was granted).
+func (s *OAuthService) Exchange(ctx context.Context, req OAuthTokenRequest) (api.OAuthTokenResponse, error) {
+	if err := s.ready(); err != nil {
+		return api.OAuthTokenResponse{}, err
+	}
+	if req.GrantType != "authorization_code" {
+		return api.OAuthTokenResponse{}, NewError(http.StatusBadRequest, "unsupported_grant_type", "only authorization_code is supported")
+	}
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return api.OAuthTokenResponse{}, err
+	}
+	if req.Code == "" || req.CodeVerifier == "" {
+		return api.OAuthTokenResponse{}, NewError(http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+	}
+
+	errGrant := NewError(http.StatusBadRequest, "invalid_grant", "authorization code is invalid or expired")
+	code, err := s.store.Q.ConsumeOAuthAuthorizationCode(ctx, hashAuthToken(req.Code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.OAuthTokenResponse{}, errGrant
+		}
+		return api.OAuthTokenResponse{}, err
+	}
+	if code.ClientID != client.ID || code.RedirectUri != req.RedirectURI {
+		return api.OAuthTokenResponse{}, errGrant
+	}
+	if !verifyPKCE(req.CodeVerifier, code.CodeChallenge) {
+		return api.OAuthTokenResponse{}, errGrant
+	}
+
+	row, err := s.store.Q.GetUserByID(ctx, code.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.OAuthTokenResponse{}, errGrant
+		}
+		return api.OAuthTokenResponse{}, err
+	}
+	user := auth.User{ID: row.ID, Username: row.Username}
+	// Permissions may have changed since consent.
+	scopes, err := s.grantableScopes(ctx, user.ID, strings.Fields(code.Scope))
+	if err != nil {
+		return api.OAuthTokenResponse{}, err
+	}
+
+	token, info, err := s.tokens.IssueOAuth(user, client.ID, scopes, s.accessTTL)
+	if err != nil {
+		return api.OAuthTokenResponse{}, err
+	}
+	if err := s.store.Q.CreateOAuthAccessToken(ctx, sqlc.CreateOAuthAccessTokenParams{
+		Jti:       info.ID,
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		Scope:     strings.Join(scopes, " "),
+		ExpiresAt: info.ExpiresAt,
+	}); err != nil {
+		return api.OAuthTokenResponse{}, err
+	}
+
+	resp := api.OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.accessTTL.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}
+	if auth.HasScope(scopes, OAuthScopeOpenID) {
+		idToken, err := s.issueIDToken(user, row.DisplayName, client.ID, code.Nonce.String, scopes, info.IssuedAt)
+		if err != nil {
+			return api.OAuthTokenResponse{}, err
+		}
+		resp.IdToken = &idToken
+	}
+	auditOAuth(ctx, "oauth.token", user.ID, client.ID, slog.String("scope", resp.Scope))
+	s.securityEvents.Record(ctx, SecurityEvent{
+		UserID:  user.ID,
+		Type:    SecurityEventSessionCreate,
+		Outcome: SecurityOutcomeSuccess,
+		Details: map[string]any{"client_id": client.ID, "scope": resp.Scope},
+	})
+	return resp, nil
+}
+
+// verifyPKCE checks an S256 code verifier (RFC 7636 §4.6).
+func verifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+type idTokenClaims struct {
+	Nonce             string `json:"nonce,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (s *OAuthService) issueIDToken(user auth.User, displayName sql.NullString, clientID, nonce string, scopes []string, issuedAt time.Time) (string, error) {
+	claims := idTokenClaims{
+		Nonce: nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.Issuer(),
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(s.accessTTL)),
+		},
+	}
+	if auth.HasScope(scopes, OAuthScopeProfile) {
+		claims.PreferredUsername = user.Username
+		claims.Name = user.Username
+		if displayName.Valid && strings.TrimSpace(displayName.String) != "" {
+			claims.Name = displayName.String
+		}
+	}
+	return s.tokens.SignClaims(claims)
+}
+
+// Introspect reports whether token is active (RFC 7662). Clients may only
+// introspect tokens issued to themselves.
+func (s *OAuthService) Introspect(ctx context.Context, clientID, clientSecret, token string) (api.OAuthIntrospection, error) {
+	if err := s.ready(); err != nil {
+		return api.OAuthIntrospection{}, err
+	}
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return api.OAuthIntrospection{}, err
+	}
+	inactive := api.OAuthIntrospection{Active: false}
+
+	user, grant, err := s.tokens.ParseOAuth(token)
+	if err != nil || grant.ClientID != client.ID {
+		return inactive, nil
+	}
+	row, err := s.store.Q.GetOAuthAccessToken(ctx, grant.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return inactive, nil
+		}
+		return api.OAuthIntrospection{}, err
+	}
+	if row.RevokedAt.Valid {
+		return inactive, nil
+	}
+
+	scope := strings.Join(grant.Scopes, " ")
+	sub := user.ID.String()
+	username := user.Username
+	tokenType := "Bearer"
+	exp := int(grant.ExpiresAt.Unix())
+	iat := int(grant.IssuedAt.Unix())
+	return api.OAuthIntrospection{
+		Active:    true,
+		Scope:     &scope,
+		ClientId:  &grant.ClientID,
+		Username:  &username,
+		Sub:       &sub,
+		TokenType: &tokenType,
+		Exp:       &exp,
+		Iat:       &iat,
+	}, nil
+}
+
+// Revoke revokes an access token (RFC 7009). Unknown, invalid or foreign
+// tokens are ignored so the response does not reveal anything.
+func (s *OAuthService) Revoke(ctx context.Context, clientID, clientSecret, token string) error {
+	if err := s.ready(); err != nil {
+		return err
+	}
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	owner, grant, err := s.tokens.ParseOAuth(token)
+	if err != nil || grant.ClientID != client.ID {
+		return nil
+	}
+	if _, err := s.store.Q.RevokeOAuthAccessToken(ctx, sqlc.RevokeOAuthAccessTokenParams{Jti: grant.ID, ClientID: client.ID}); err != nil {
+		return err
+	}
+	s.propagateRevocation(ctx, grant.ID, grant.ExpiresAt)
+	s.securityEvents.Record(ctx, SecurityEvent{
+		UserID:  owner.ID,
+		Type:    SecurityEventTokenRevocation,
+		Outcome: SecurityOutcomeSuccess,
+		Details: map[string]any{"client_id": client.ID, "revoked_by": "client"},
+	})
+	return nil
+}
+
+func (s *OAuthService) propagateRevocation(ctx context.Context, jti string, expiresAt time.Time) {
+	if err := s.tokens.RevokeOAuthToken(ctx, jti, expiresAt); err != nil {
+		slog.Warn("failed to propagate oauth token revocation", "error", err)
+	}
+}
+
+// UserInfo returns the OpenID Connect claims for the token's user.
+func (s *OAuthService) UserInfo(ctx context.Context, user auth.User, scopes []string) (api.OAuthUserInfo, error) {
+	if err := s.ready(); err != nil {
+		return api.OAuthUserInfo{}, err
+	}
+	out := api.OAuthUserInfo{Sub: user.ID.String()}
+	if !auth.HasScope(scopes, OAuthScopeProfile) {
+		return out, nil
+	}
+	row, err := s.store.Q.GetUserByID(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return api.OAuthUserInfo{}, NewError(http.StatusNotFound, "not_found", "user not found")
+		}
+		return api.OAuthUserInfo{}, err
+	}
+	username := row.Username
+	name := row.Username
+	if row.DisplayName.Valid && strings.TrimSpace(row.DisplayName.String) != "" {
+		name = row.DisplayName.String
+	}
+	out.PreferredUsername = &username
+	out.Name = &name
+	return out, nil
+}
+
+// OpenIDConfiguration is the discovery document served at
+// /.well-known/openid-configuration.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// Discovery returns the OpenID Connect discovery document.
+func (s *OAuthService) Discovery() OpenIDConfiguration {
+	base := s.Issuer()
+	scopes := make([]string, 0, len(oauthScopeDescriptions))
+	for sc := range oauthScopeDescriptions {
+		scopes = append(scopes, sc)
+	}
+	sort.Strings(scopes)
+	alg := auth.AlgHS256
+	if s.tokens != nil {
+		alg = s.tokens.SigningAlg()
+	}
+	return OpenIDConfiguration{
+		Issuer:                            base,
+		AuthorizationEndpoint:             base + "/oauth/authorize",
+		TokenEndpoint:                     base + "/api/v1/oauth/token",
+		UserinfoEndpoint:                  base + "/api/v1/oauth/userinfo",
+		IntrospectionEndpoint:             base + "/api/v1/oauth/introspect",
+		RevocationEndpoint:                base + "/api/v1/oauth/revoke",
+		JwksURI:                           base + "/.well-known/jwks.json",
+		ScopesSupported:                   scopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{alg},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "nonce", "preferred_username", "name"},
+	}
+}
+
+// ---------------------------------------------------------------------------
+// User-facing grant management
+// ---------------------------------------------------------------------------
+
+// ListAuthorizations lists the apps the user has granted access to.
+func (s *OAuthService) ListAuthorizations(ctx context.Context, userID uuid.UUID) ([]api.OAuthAuthorization, error) {
+	if err := s.ready(); err != nil {
+		return nil, err
+	}
+	rows, err := s.store.Q.ListOAuthConsentsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]api.OAuthAuthorization, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, api.OAuthAuthorization{
+			Client:    api.OAuthClientSummary{ClientId: row.ClientID, Name: row.ClientName},
+			Scopes:    strings.Fields(row.Scope),
+			GrantedAt: row.GrantedAt,
+		})
+	}
+	return out, nil
+}
+
+// RevokeAuthorization removes the user's consent for a client and revokes the
+// access tokens it holds for the user.
+func (s *OAuthService) RevokeAuthorization(ctx context.Context, userID uuid.UUID, clientID string) error {
+	if err := s.ready(); err != nil {
+		return err
+	}
+	n, err := s.store.Q.DeleteOAuthConsent(ctx, sqlc.DeleteOAuthConsentParams{UserID: userID, ClientID: clientID})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NewError(http.StatusNotFound, "not_found", "authorization not found")
+	}
+	revoked, err := s.store.Q.RevokeOAuthAccessTokensForGrant(ctx, sqlc.RevokeOAuthAccessTokensForGrantParams{UserID: userID, ClientID: clientID})
+	if err != nil {
+		return err
+	}
+	for _, t := range revoked {
+		s.propagateRevocation(ctx, t.Jti, t.ExpiresAt)
+	}
+	auditOAuth(ctx, "oauth.authorization.revoke", userID, clientID)
+	s.securityEvents.Record(ctx, SecurityEvent{
+		UserID:  userID,
+		Type:    SecurityEventTokenRevocation,
+		Outcome: SecurityOutcomeSuccess,
+		Details: map[string]any{"client_id": clientID, "revoked_by": "user", "tokens": len(revoked)},
+	})
+	return nil
+}
+
+// RunCleanup periodically deletes expired authorization codes and access
+// token records until ctx is cancelled.
+func (s *OAuthService) RunCleanup(ctx context.Context, interval time.Duration) {
+	if s.store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.store.Q.DeleteExpiredOAuthAuthorizationCodes(ctx); err != nil {
+			slog.Warn("failed to delete expired oauth codes", "error", err)
+		}
+		if _, err := s.store.Q.DeleteExpiredOAuthAccessTokens(ctx); err != nil {
+			slog.Warn("failed to delete expired oauth tokens", "error", err)
+		}
+	}
+}
+
+func auditOAuth(ctx context.Context, event string, actor uuid.UUID, clientID string, extra ...slog.Attr) {
+	attrs := append([]slog.Attr{
+		slog.String("actor_user_id", actor.String()),
+		slog.String("client_id", clientID),
+	}, extra...)
+	attrs = append(attrs, logging.RequestAttrs(ctx)...)
+	logging.Audit(ctx, event, "success", attrs...)
+}
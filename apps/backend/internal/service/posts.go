@@ -24,13 +24,13 @@ const (
 )
 
 type PostsService struct {
-	store     *repository.Store
-	cache     cache.Cache
-	publisher realtime.Publisher
+	store  *repository.Store
+	cache  cache.Cache
+	outbox *RealtimeOutbox
 }
 
 func NewPostsService(store *repository.Store, cache cache.Cache, publisher realtime.Publisher) *PostsService {
-	return &PostsService{store: store, cache: cache, publisher: publisher}
+	return &PostsService{store: store, cache: cache, outbox: NewRealtimeOutbox(store, publisher)}
 }
 
 func (s *PostsService) Create(ctx context.Context, user auth.User, req api.CreatePostRequest) (api.Post, error) {
@@ -59,53 +59,69 @@ func (s *PostsService) Create(ctx context.Context, user auth.User, req api.Creat
 		return api.Post{}, NewError(http.StatusBadRequest, "invalid_request", fmt.Sprintf("content exceeds maximum length of %d characters", maxPostContentRunes))
 	}
 
-	var created sqlc.CreatePostRow
+	var post api.Post
+	var event OutboxEvent
 	if err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
-		c, err := q.CreatePost(ctx, sqlc.CreatePostParams{UserID: user.ID, Content: content})
+		created, err := q.CreatePost(ctx, sqlc.CreatePostParams{UserID: user.ID, Content: content})
 		if err != nil {
 			return err
 		}
-		created = c
-
-		if len(mediaIDs) == 0 {
-			return nil
+		if err := attachMediaIDs(ctx, q, user.ID, created.ID, mediaIDs); err != nil {
+			return err
 		}
-		count, err := q.CountOwnedMediaByIDs(ctx, sqlc.CountOwnedMediaByIDsParams{UserID: user.ID, Column2: mediaIDs})
+
+		// The event is built inside the transaction so that it is recorded
+		// with the post.
+		post, err = LoadPost(ctx, q, created.ID)
 		if err != nil {
 			return err
 		}
-		if int(count) != len(mediaIDs) {
-			return NewError(http.StatusBadRequest, "invalid_request", "invalid mediaIds")
-		}
-		for i, mid := range mediaIDs {
-			if err := q.AttachMediaToPost(ctx, sqlc.AttachMediaToPostParams{PostID: created.ID, MediaID: mid, SortOrder: int32(i)}); err != nil {
-				return err
-			}
-		}
-		return nil
+		event, err = s.outbox.Record(ctx, q, realtime.Event{Type: realtime.EventPostCreated, Post: &post})
+		return err
 	}); err != nil {
 		return api.Post{}, err
 	}
 
-	row, err := s.store.Q.GetPostWithAuthorByID(ctx, created.ID)
-	if err != nil {
-		return api.Post{}, err
-	}
-	post := mapPostRow(row)
-	if err := s.attachMediaToPost(ctx, &post); err != nil {
-		return api.Post{}, err
-	}
-
 	if s.cache != nil {
 		key := timelineKeyGlobal()
 		score := float64(post.CreatedAt.UnixMilli())
 		_ = s.cache.ZAdd(ctx, key, cache.Z{Score: score, Member: post.Id.String()})
 	}
 
-	s.publish(ctx, realtime.Event{Type: realtime.EventPostCreated, Post: &post})
+	s.outbox.Publish(ctx, event)
 	return post, nil
 }
 
+// attachMediaIDs attaches the user's ready media to a new post in order.
+func attachMediaIDs(ctx context.Context, q *sqlc.Queries, userID, postID uuid.UUID, mediaIDs []uuid.UUID) error {
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+	count, err := q.CountOwnedMediaByIDs(ctx, sqlc.CountOwnedMediaByIDsParams{UserID: userID, Column2: mediaIDs})
+	if err != nil {
+		return err
+	}
+	if int(count) != len(mediaIDs) {
+		return NewError(http.StatusBadRequest, "invalid_request", "invalid mediaIds")
+	}
+	unready, err := q.CountUnreadyMediaByIDs(ctx, mediaIDs)
+	if err != nil {
+		return err
+	}
+	if unready.Failed > 0 {
+		return NewError(http.StatusBadRequest, "invalid_request", "media processing failed")
+	}
+	if unready.Processing > 0 {
+		return NewError(http.StatusConflict, "media_not_ready", "media is still processing")
+	}
+	for i, mid := range mediaIDs {
+		if err := q.AttachMediaToPost(ctx, sqlc.AttachMediaToPostParams{PostID: postID, MediaID: mid, SortOrder: int32(i)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *PostsService) Get(ctx context.Context, postID api.PostId) (api.Post, error) {
 	if s.store == nil {
 		return api.Post{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
@@ -121,7 +137,7 @@ func (s *PostsService) Get(ctx context.Context, postID api.PostId) (api.Post, er
 		return api.Post{}, NewError(http.StatusNotFound, "not_found", "post not found")
 	}
 	post := mapPostRow(row)
-	if err := s.attachMediaToPost(ctx, &post); err != nil {
+	if err := attachMediaToPost(ctx, s.store.Q, &post); err != nil {
 		return api.Post{}, err
 	}
 	return post, nil
@@ -196,24 +212,48 @@ func (s *PostsService) ListByUsername(ctx context.Context, username api.Username
 	return api.UserPostsPage{Items: items, NextCursor: nextCursor}, nil
 }
 
-func (s *PostsService) attachMediaToPost(ctx context.Context, post *api.Post) error {
-	if s.store == nil {
-		return nil
+// LoadPost loads a post with its author and media using q, such as to
+// build a realtime event inside a transaction.
+func LoadPost(ctx context.Context, q *sqlc.Queries, postID uuid.UUID) (api.Post, error) {
+	row, err := q.GetPostWithAuthorByID(ctx, postID)
+	if err != nil {
+		return api.Post{}, err
+	}
+	post := mapPostRow(row)
+	if err := attachMediaToPost(ctx, q, &post); err != nil {
+		return api.Post{}, err
+	}
+	return post, nil
+}
+
+func attachMediaToPost(ctx context.Context, q *sqlc.Queries, post *api.Post) error {
+	rows, err := q.ListMediaForPost(ctx, post.Id)
+	if err != nil {
+		return err
+	}
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.MediaID)
 	}
-	rows, err := s.store.Q.ListMediaForPost(ctx, post.Id)
+	variants, err := listMediaVariants(ctx, q, ids)
 	if err != nil {
 		return err
 	}
 	post.Media = make([]api.Media, 0, len(rows))
 	for _, row := range rows {
-		post.Media = append(post.Media, api.Media{
-			Id:        row.MediaID,
-			Type:      api.MediaType("image"),
-			Url:       mediaImageURL(row.MediaID, row.Ext),
-			Width:     int(row.Width),
-			Height:    int(row.Height),
-			CreatedAt: row.CreatedAt,
-		})
+		post.Media = append(post.Media, newAPIMedia(mediaRecord{
+			ID:         row.MediaID,
+			Type:       row.Type,
+			Ext:        row.Ext,
+			Width:      row.Width,
+			Height:     row.Height,
+			DurationMs: row.DurationMs,
+			AltText:    row.AltText,
+			FocusX:     row.FocusX,
+			FocusY:     row.FocusY,
+			Blurhash:   row.Blurhash,
+			CreatedAt:  row.CreatedAt,
+		}, variants[row.MediaID]))
 	}
 	return nil
 }
@@ -233,6 +273,14 @@ func (s *PostsService) attachMediaToPosts(ctx context.Context, posts []api.Post)
 	if err != nil {
 		return err
 	}
+	mediaIDs := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		mediaIDs = append(mediaIDs, row.MediaID)
+	}
+	variants, err := loadMediaVariants(ctx, s.store, mediaIDs)
+	if err != nil {
+		return err
+	}
 	counts := make(map[uuid.UUID]int, len(posts))
 	for _, row := range rows {
 		pi, ok := index[row.PostID]
@@ -242,14 +290,19 @@ func (s *PostsService) attachMediaToPosts(ctx context.Context, posts []api.Post)
 		if counts[row.PostID] >= 4 {
 			continue
 		}
-		posts[pi].Media = append(posts[pi].Media, api.Media{
-			Id:        row.MediaID,
-			Type:      api.MediaType("image"),
-			Url:       mediaImageURL(row.MediaID, row.Ext),
-			Width:     int(row.Width),
-			Height:    int(row.Height),
-			CreatedAt: row.CreatedAt,
-		})
+		posts[pi].Media = append(posts[pi].Media, newAPIMedia(mediaRecord{
+			ID:         row.MediaID,
+			Type:       row.Type,
+			Ext:        row.Ext,
+			Width:      row.Width,
+			Height:     row.Height,
+			DurationMs: row.DurationMs,
+			AltText:    row.AltText,
+			FocusX:     row.FocusX,
+			FocusY:     row.FocusY,
+			Blurhash:   row.Blurhash,
+			CreatedAt:  row.CreatedAt,
+		}, variants[row.MediaID]))
 		counts[row.PostID]++
 	}
 	return nil
@@ -294,7 +347,16 @@ func (s *PostsService) Delete(ctx context.Context, user auth.User, postID api.Po
 		return NewError(http.StatusForbidden, "forbidden", "not the owner")
 	}
 
-	_, err = s.store.Q.MarkPostDeleted(ctx, sqlc.MarkPostDeletedParams{ID: postID, UserID: user.ID})
+	pid := postID
+	var event OutboxEvent
+	err = s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		if _, err := q.MarkPostDeleted(ctx, sqlc.MarkPostDeletedParams{ID: postID, UserID: user.ID}); err != nil {
+			return err
+		}
+		var err error
+		event, err = s.outbox.Record(ctx, q, realtime.Event{Type: realtime.EventPostDeleted, PostId: &pid})
+		return err
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return NewError(http.StatusNotFound, "not_found", "post not found")
@@ -307,8 +369,7 @@ func (s *PostsService) Delete(ctx context.Context, user auth.User, postID api.Po
 		_ = s.cache.ZRem(ctx, key, postID.String())
 		_ = s.cache.Delete(ctx, reactionCacheKey(postID))
 	}
-	pid := postID
-	s.publish(ctx, realtime.Event{Type: realtime.EventPostDeleted, PostId: &pid})
+	s.outbox.Publish(ctx, event)
 	return nil
 }
 
@@ -317,10 +378,3 @@ func timelineKeyGlobal() string { return "timeline:global" }
 // TimelineKeyGlobal returns the Redis key used for the global timeline.
 // Primarily used by tests living outside this package.
 func TimelineKeyGlobal() string { return timelineKeyGlobal() }
-
-func (s *PostsService) publish(ctx context.Context, event realtime.Event) {
-	if s.publisher == nil {
-		return
-	}
-	_ = s.publisher.Publish(ctx, event)
-}
@@ -21,13 +21,13 @@ import (
 )
 
 type ReactionsService struct {
-	store     *repository.Store
-	cache     cache.Cache
-	publisher realtime.Publisher
+	store  *repository.Store
+	cache  cache.Cache
+	outbox *RealtimeOutbox
 }
 
 func NewReactionsService(store *repository.Store, cache cache.Cache, publisher realtime.Publisher) *ReactionsService {
-	return &ReactionsService{store: store, cache: cache, publisher: publisher}
+	return &ReactionsService{store: store, cache: cache, outbox: NewRealtimeOutbox(store, publisher)}
 }
 
 func (s *ReactionsService) List(ctx context.Context, postID api.PostId, userID *api.UserId) (api.ReactionCounts, error) {
@@ -38,10 +38,10 @@ func (s *ReactionsService) List(ctx context.Context, postID api.PostId, userID *
 		// Only use cache for anonymous requests (no user-specific data)
 		return counts, nil
 	}
-	if err := s.ensurePostVisible(ctx, postID); err != nil {
+	if err := ensurePostVisible(ctx, s.store.Q, postID); err != nil {
 		return api.ReactionCounts{}, err
 	}
-	counts, err := s.buildCounts(ctx, postID, userID)
+	counts, err := buildReactionCounts(ctx, s.store.Q, postID, userID)
 	if err != nil {
 		return api.ReactionCounts{}, err
 	}
@@ -68,7 +68,7 @@ func (s *ReactionsService) ListUsers(ctx context.Context, postID api.PostId, emo
 	if em == "" {
 		return api.ReactionUsersPage{}, NewError(http.StatusBadRequest, "invalid_request", "emoji required")
 	}
-	if err := s.ensurePostVisible(ctx, postID); err != nil {
+	if err := ensurePostVisible(ctx, s.store.Q, postID); err != nil {
 		return api.ReactionUsersPage{}, err
 	}
 
@@ -130,12 +130,9 @@ func (s *ReactionsService) ListUsers(ctx context.Context, postID api.PostId, emo
 	}, nil
 }
 
-func (s *ReactionsService) ensurePostVisible(ctx context.Context, postID api.PostId) error {
-	if s.store == nil {
-		return NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
-	}
+func ensurePostVisible(ctx context.Context, q *sqlc.Queries, postID api.PostId) error {
 	// Ensure post exists and not deleted.
-	row, err := s.store.Q.GetPostWithAuthorByID(ctx, postID)
+	row, err := q.GetPostWithAuthorByID(ctx, postID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return NewError(http.StatusNotFound, "not_found", "post not found")
@@ -148,9 +145,9 @@ func (s *ReactionsService) ensurePostVisible(ctx context.Context, postID api.Pos
 	return nil
 }
 
-func (s *ReactionsService) buildCounts(ctx context.Context, postID api.PostId, userID *api.UserId) (api.ReactionCounts, error) {
+func buildReactionCounts(ctx context.Context, q *sqlc.Queries, postID api.PostId, userID *api.UserId) (api.ReactionCounts, error) {
 	if userID != nil {
-		rows, err := s.store.Q.ListReactionCountsWithUserStatus(ctx, sqlc.ListReactionCountsWithUserStatusParams{
+		rows, err := q.ListReactionCountsWithUserStatus(ctx, sqlc.ListReactionCountsWithUserStatusParams{
 			PostID: postID,
 			UserID: *userID,
 		})
@@ -168,7 +165,7 @@ func (s *ReactionsService) buildCounts(ctx context.Context, postID api.PostId, u
 		return api.ReactionCounts{PostId: postID, Reactions: counts}, nil
 	}
 
-	rows, err := s.store.Q.ListReactionCounts(ctx, postID)
+	rows, err := q.ListReactionCounts(ctx, postID)
 	if err != nil {
 		return api.ReactionCounts{}, err
 	}
@@ -202,6 +199,8 @@ func (s *ReactionsService) Add(ctx context.Context, user auth.User, postID api.P
 		return api.ReactionCounts{}, NewError(http.StatusNotFound, "not_found", "post not found")
 	}
 
+	var counts api.ReactionCounts
+	var event OutboxEvent
 	if err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
 		if _, err := q.AddReactionEvent(ctx, sqlc.AddReactionEventParams{UserID: user.ID, PostID: postID, Emoji: emoji}); err != nil {
 			if err == sql.ErrNoRows {
@@ -213,19 +212,14 @@ func (s *ReactionsService) Add(ctx context.Context, user auth.User, postID api.P
 		if _, err := q.IncrementReactionCount(ctx, sqlc.IncrementReactionCountParams{PostID: postID, Emoji: emoji}); err != nil {
 			return err
 		}
-		return nil
+		var err error
+		counts, event, err = s.recordCounts(ctx, q, postID, user.ID)
+		return err
 	}); err != nil {
 		return api.ReactionCounts{}, err
 	}
-	if err := s.ensurePostVisible(ctx, postID); err != nil {
-		return api.ReactionCounts{}, err
-	}
-	counts, err := s.buildCounts(ctx, postID, &user.ID)
-	if err != nil {
-		return api.ReactionCounts{}, err
-	}
 	s.setReactionCache(ctx, counts)
-	s.publish(ctx, counts)
+	s.outbox.Publish(ctx, event)
 	return counts, nil
 }
 
@@ -238,6 +232,8 @@ func (s *ReactionsService) Remove(ctx context.Context, user auth.User, postID ap
 		return api.ReactionCounts{}, NewError(http.StatusBadRequest, "invalid_request", "emoji required")
 	}
 
+	var counts api.ReactionCounts
+	var event OutboxEvent
 	if err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
 		if _, err := q.RemoveReactionEvent(ctx, sqlc.RemoveReactionEventParams{UserID: user.ID, PostID: postID, Emoji: em}); err != nil {
 			if err == sql.ErrNoRows {
@@ -258,28 +254,28 @@ func (s *ReactionsService) Remove(ctx context.Context, user auth.User, postID ap
 				return err
 			}
 		}
-		return nil
+		counts, event, err = s.recordCounts(ctx, q, postID, user.ID)
+		return err
 	}); err != nil {
 		return api.ReactionCounts{}, err
 	}
-
-	if err := s.ensurePostVisible(ctx, postID); err != nil {
-		return api.ReactionCounts{}, err
-	}
-	counts, err := s.buildCounts(ctx, postID, &user.ID)
-	if err != nil {
-		return api.ReactionCounts{}, err
-	}
 	s.setReactionCache(ctx, counts)
-	s.publish(ctx, counts)
+	s.outbox.Publish(ctx, event)
 	return counts, nil
 }
 
-func (s *ReactionsService) publish(ctx context.Context, counts api.ReactionCounts) {
-	if s.publisher == nil {
-		return
+// recordCounts reads the post's counts after a change by userID and records
+// the reaction_updated event in the same transaction.
+func (s *ReactionsService) recordCounts(ctx context.Context, q *sqlc.Queries, postID api.PostId, userID uuid.UUID) (api.ReactionCounts, OutboxEvent, error) {
+	if err := ensurePostVisible(ctx, q, postID); err != nil {
+		return api.ReactionCounts{}, OutboxEvent{}, err
+	}
+	counts, err := buildReactionCounts(ctx, q, postID, &userID)
+	if err != nil {
+		return api.ReactionCounts{}, OutboxEvent{}, err
 	}
-	_ = s.publisher.Publish(ctx, realtime.Event{Type: realtime.EventReactionUpdated, ReactionCounts: &counts})
+	event, err := s.outbox.Record(ctx, q, realtime.Event{Type: realtime.EventReactionUpdated, ReactionCounts: &counts})
+	return counts, event, err
 }
 
 func encodeReactionUsersCursor(c ReactionUsersCursor) string {
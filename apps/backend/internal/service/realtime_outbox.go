@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"backend/internal/db/sqlc"
+	"backend/internal/realtime"
+	"backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// outboxGrace leaves fresh rows to the request that wrote them, which
+	// publishes right after commit; the relay only picks up leftovers.
+	outboxGrace = 5 * time.Second
+
+	// outboxLease bounds one publish attempt. Rows of a relay that dies are
+	// claimed again once their lease expires, which also paces retries.
+	outboxLease = 30 * time.Second
+
+	// outboxMaxAttempts is how often the relay tries an event before
+	// dropping it; by then it is too stale to be worth delivering. Only
+	// publish attempts count, not claims of rows that were never tried.
+	outboxMaxAttempts = 20
+
+	outboxBatchSize    = 100
+	outboxPollInterval = time.Second
+)
+
+// OutboxEvent is a realtime event recorded in realtime_outbox.
+type OutboxEvent struct {
+	ID    uuid.UUID
+	Event realtime.Event
+}
+
+// RealtimeOutbox makes realtime publishing reliable: events are recorded in
+// the transaction of the change they report, published after commit and
+// retried by Run until published. Retries are deduplicated by row ID when
+// the publisher supports it, so delivery is at least once and usually
+// exactly once.
+type RealtimeOutbox struct {
+	store     *repository.Store
+	publisher realtime.Publisher
+	dropped   atomic.Uint64
+}
+
+// OutboxStats describes events waiting in the outbox.
+type OutboxStats struct {
+	Pending          int
+	OldestAgeSeconds int64
+	// Dropped counts events this instance's relay gave up on.
+	Dropped uint64
+}
+
+// NewRealtimeOutbox returns an outbox publishing to publisher. Without a
+// store or publisher nothing is recorded.
+func NewRealtimeOutbox(store *repository.Store, publisher realtime.Publisher) *RealtimeOutbox {
+	return &RealtimeOutbox{store: store, publisher: publisher}
+}
+
+func (o *RealtimeOutbox) enabled() bool {
+	return o != nil && o.store != nil && o.publisher != nil
+}
+
+// Record writes event to the outbox using q, which should belong to the
+// transaction of the change. Pass the result to Publish after commit.
+func (o *RealtimeOutbox) Record(ctx context.Context, q *sqlc.Queries, event realtime.Event) (OutboxEvent, error) {
+	if !o.enabled() {
+		return OutboxEvent{}, nil
+	}
+	// An invalid event would never leave the outbox.
+	if err := event.Validate(); err != nil {
+		return OutboxEvent{}, err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+	id, err := q.EnqueueRealtimeEvent(ctx, payload)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+	return OutboxEvent{ID: id, Event: event}, nil
+}
+
+// Publish publishes recorded events whose transaction committed. Events
+// that fail stay in the outbox for the relay.
+func (o *RealtimeOutbox) Publish(ctx context.Context, events ...OutboxEvent) {
+	if !o.enabled() {
+		return
+	}
+	for _, ev := range events {
+		if ev.ID == uuid.Nil {
+			continue
+		}
+		if err := o.publish(ctx, ev); err != nil {
+			slog.Warn("failed to publish realtime event; relay will retry", "error", err, "type", ev.Event.Type, "outbox_id", ev.ID)
+			continue
+		}
+		if err := o.store.Q.DeleteRealtimeOutboxEvent(ctx, ev.ID); err != nil {
+			slog.Warn("failed to delete published realtime event", "error", err, "outbox_id", ev.ID)
+		}
+	}
+}
+
+func (o *RealtimeOutbox) publish(ctx context.Context, ev OutboxEvent) error {
+	if p, ok := o.publisher.(realtime.OncePublisher); ok {
+		return p.PublishOnce(ctx, ev.ID.String(), ev.Event)
+	}
+	return o.publisher.Publish(ctx, ev.Event)
+}
+
+// Run relays events left in the outbox until ctx is cancelled. Rows are
+// claimed with SKIP LOCKED, so every instance can run a relay.
+func (o *RealtimeOutbox) Run(ctx context.Context) {
+	if !o.enabled() {
+		return
+	}
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := o.relayBatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("failed to relay realtime outbox", "error", err)
+				}
+				break
+			}
+			if n < outboxBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch publishes one batch of claimed rows in order and returns how
+// many were claimed. It stops at the first failure, since later events
+// would likely fail too. Only the failed row counts an attempt and waits for
+// its lease; the untried rows are released for the next poll.
+func (o *RealtimeOutbox) relayBatch(ctx context.Context) (int, error) {
+	rows, err := o.store.Q.ClaimRealtimeOutbox(ctx, sqlc.ClaimRealtimeOutboxParams{
+		LeaseSeconds: int32(outboxLease / time.Second),
+		GraceSeconds: int32(outboxGrace / time.Second),
+		BatchSize:    outboxBatchSize,
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].CreatedAt.Equal(rows[j].CreatedAt) {
+			return rows[i].CreatedAt.Before(rows[j].CreatedAt)
+		}
+		return rows[i].ID.String() < rows[j].ID.String()
+	})
+	for i, row := range rows {
+		var event realtime.Event
+		if err := json.Unmarshal(row.Payload, &event); err != nil {
+			o.drop(ctx, row.ID, "undecodable payload", err)
+			continue
+		}
+		if err := o.publish(ctx, OutboxEvent{ID: row.ID, Event: event}); err != nil {
+			if row.Attempts+1 >= outboxMaxAttempts {
+				o.drop(ctx, row.ID, "too many attempts", err)
+				continue
+			}
+			if ferr := o.store.Q.FailRealtimeOutboxEvent(ctx, sqlc.FailRealtimeOutboxEventParams{
+				ID:        row.ID,
+				LastError: sql.NullString{String: err.Error(), Valid: true},
+			}); ferr != nil {
+				slog.Warn("failed to record realtime outbox error", "error", ferr, "outbox_id", row.ID)
+			}
+			o.release(ctx, rows[i+1:])
+			return len(rows), err
+		}
+		if err := o.store.Q.DeleteRealtimeOutboxEvent(ctx, row.ID); err != nil {
+			o.release(ctx, rows[i+1:])
+			return len(rows), err
+		}
+	}
+	return len(rows), nil
+}
+
+// release returns claimed rows that were not tried to the outbox.
+func (o *RealtimeOutbox) release(ctx context.Context, rows []sqlc.ClaimRealtimeOutboxRow) {
+	if len(rows) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	if err := o.store.Q.ReleaseRealtimeOutboxEvents(ctx, ids); err != nil {
+		slog.Warn("failed to release realtime outbox events", "error", err, "count", len(ids))
+	}
+}
+
+func (o *RealtimeOutbox) drop(ctx context.Context, id uuid.UUID, reason string, cause error) {
+	o.dropped.Add(1)
+	slog.Error("dropping realtime outbox event", "reason", reason, "error", cause, "outbox_id", id)
+	if err := o.store.Q.DeleteRealtimeOutboxEvent(ctx, id); err != nil {
+		slog.Warn("failed to delete realtime outbox event", "error", err, "outbox_id", id)
+	}
+}
+
+// Stats reports the events waiting in the outbox.
+func (o *RealtimeOutbox) Stats(ctx context.Context) (OutboxStats, error) {
+	if o == nil || o.store == nil {
+		return OutboxStats{}, nil
+	}
+	row, err := o.store.Q.GetRealtimeOutboxStats(ctx)
+	if err != nil {
+		return OutboxStats{}, err
+	}
+	return OutboxStats{
+		Pending:          int(row.Pending),
+		OldestAgeSeconds: row.OldestAgeSeconds,
+		Dropped:          o.dropped.Load(),
+	}, nil
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/db/sqlc"
+	"backend/internal/geoip"
+	"backend/internal/logging"
+	"backend/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/sqlc-dev/pqtype"
+)
+
+// Security event types.
+const (
+	SecurityEventLogin            = "login"
+	SecurityEventStepup           = "stepup"
+	SecurityEventPasswordChange   = "password_change"
+	SecurityEventPasswordReset    = "password_reset"
+	SecurityEventTokenRevocation  = "token_revocation"
+	SecurityEventSessionCreate    = "session_create"
+	SecurityEventRoleChange       = "role_change"
+	SecurityEventPermissionChange = "permission_change"
+)
+
+// Security event outcomes.
+const (
+	SecurityOutcomeSuccess = "success"
+	SecurityOutcomeFailure = "failure"
+)
+
+// maxSecurityEventUserAgent caps stored User-Agent headers.
+const maxSecurityEventUserAgent = 512
+
+// SecurityEvent is one entry to record in a user's security history.
+type SecurityEvent struct {
+	UserID uuid.UUID
+	// ActorID is set when someone other than the owner caused the event,
+	// e.g. an admin changing the user's roles.
+	ActorID uuid.UUID
+	Type    string
+	Outcome string
+	Details map[string]any
+}
+
+type SecurityEventsServiceOptions struct {
+	// GeoIP resolves client IPs to a country and city. If nil, no location is stored.
+	GeoIP geoip.Locator
+
+	// Retention is how long events are kept. If zero, defaults to 90 days.
+	Retention time.Duration
+
+	// Now is used for retention cutoffs. If nil, defaults to time.Now.
+	Now func() time.Time
+}
+
+// SecurityEventsService persists and lists per-user security events.
+// A nil *SecurityEventsService records nothing, so callers need not check.
+type SecurityEventsService struct {
+	store     *repository.Store
+	geo       geoip.Locator
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewSecurityEventsService(store *repository.Store, opts SecurityEventsServiceOptions) *SecurityEventsService {
+	if opts.Retention <= 0 {
+		opts.Retention = 90 * 24 * time.Hour
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &SecurityEventsService{
+		store:     store,
+		geo:       opts.GeoIP,
+		retention: opts.Retention,
+		now:       opts.Now,
+	}
+}
+
+// Record stores ev with the client IP, user agent and location taken from
+// ctx. Failures are logged and never returned: the security log must not
+// break the action it describes.
+func (s *SecurityEventsService) Record(ctx context.Context, ev SecurityEvent) {
+	if s == nil || s.store == nil || ev.UserID == uuid.Nil {
+		return
+	}
+	details := ev.Details
+	if details == nil {
+		details = map[string]any{}
+	}
+	raw, err := json.Marshal(details)
+	if err != nil {
+		slog.Warn("failed to encode security event details", "error", err, "event_type", ev.Type)
+		return
+	}
+
+	params := sqlc.CreateSecurityEventParams{
+		UserID:    ev.UserID,
+		EventType: ev.Type,
+		Outcome:   ev.Outcome,
+		Details:   raw,
+	}
+	if ev.ActorID != uuid.Nil {
+		params.ActorUserID = uuid.NullUUID{UUID: ev.ActorID, Valid: true}
+	}
+	if ua := logging.UserAgent(ctx); ua != "" {
+		if len(ua) > maxSecurityEventUserAgent {
+			ua = ua[:maxSecurityEventUserAgent]
+		}
+		params.UserAgent = sql.NullString{String: ua, Valid: true}
+	}
+	if ip := net.ParseIP(logging.ClientIP(ctx)); ip != nil {
+		params.IpAddress = inetFromIP(ip)
+		if s.geo != nil {
+			if loc, ok := s.geo.Lookup(ip); ok {
+				params.Country = sql.NullString{String: loc.Country, Valid: true}
+				params.City = sql.NullString{String: loc.City, Valid: loc.City != ""}
+			}
+		}
+	}
+
+	if err := s.store.Q.CreateSecurityEvent(ctx, params); err != nil {
+		slog.Warn("failed to record security event", "error", err, "event_type", ev.Type, "user_id", ev.UserID.String())
+	}
+}
+
+func inetFromIP(ip net.IP) pqtype.Inet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return pqtype.Inet{IPNet: net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, Valid: true}
+	}
+	return pqtype.Inet{IPNet: net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, Valid: true}
+}
+
+// List returns userID's events, newest first, paginated by cursor.
+func (s *SecurityEventsService) List(ctx context.Context, userID uuid.UUID, limit int, cursor *string) (api.SecurityEventPage, error) {
+	if s == nil || s.store == nil {
+		return api.SecurityEventPage{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		return api.SecurityEventPage{}, NewError(http.StatusBadRequest, "invalid_request", "invalid cursor")
+	}
+	params := sqlc.ListSecurityEventsByUserParams{UserID: userID, Limit: int32(limit)}
+	if c != nil {
+		params.CursorTime = sql.NullTime{Time: time.UnixMicro(c.Score).UTC(), Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: uuid.MustParse(c.ID), Valid: true}
+	}
+	rows, err := s.store.Q.ListSecurityEventsByUser(ctx, params)
+	if err != nil {
+		return api.SecurityEventPage{}, err
+	}
+
+	items := make([]api.SecurityEvent, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, mapSecurityEvent(row))
+	}
+	var next *string
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		n := encodeCursor(timelineCursor{Score: last.CreatedAt.UnixMicro(), ID: last.ID.String()})
+		next = &n
+	}
+	return api.SecurityEventPage{Items: items, NextCursor: next}, nil
+}
+
+func mapSecurityEvent(row sqlc.SecurityEvent) api.SecurityEvent {
+	ev := api.SecurityEvent{
+		Id:        row.ID,
+		Type:      row.EventType,
+		Outcome:   row.Outcome,
+		Details:   map[string]interface{}{},
+		CreatedAt: row.CreatedAt,
+	}
+	if len(row.Details) > 0 {
+		_ = json.Unmarshal(row.Details, &ev.Details)
+	}
+	if row.ActorUserID.Valid {
+		id := row.ActorUserID.UUID
+		ev.ActorUserId = &id
+	}
+	if row.IpAddress.Valid {
+		ip := row.IpAddress.IPNet.IP.String()
+		ev.Ip = &ip
+	}
+	if row.UserAgent.Valid {
+		ua := row.UserAgent.String
+		ev.UserAgent = &ua
+	}
+	if row.Country.Valid {
+		country := row.Country.String
+		ev.Country = &country
+	}
+	if row.City.Valid {
+		city := row.City.String
+		ev.City = &city
+	}
+	return ev
+}
+
+// Purge deletes events older than the retention period.
+func (s *SecurityEventsService) Purge(ctx context.Context) (int64, error) {
+	if s == nil || s.store == nil {
+		return 0, nil
+	}
+	return s.store.Q.DeleteSecurityEventsBefore(ctx, s.now().Add(-s.retention))
+}
+
+// RunRetention purges expired events every interval until ctx is cancelled.
+func (s *SecurityEventsService) RunRetention(ctx context.Context, interval time.Duration) {
+	if s == nil || s.store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := s.Purge(ctx)
+		if err != nil {
+			slog.Warn("failed to purge security events", "error", err)
+			continue
+		}
+		if n > 0 {
+			slog.Info("purged expired security events", "count", n)
+		}
+	}
+}
@@ -227,6 +227,14 @@ func (s *TimelineService) attachMediaToPosts(ctx context.Context, posts []api.Po
 	if err != nil {
 		return err
 	}
+	mediaIDs := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		mediaIDs = append(mediaIDs, row.MediaID)
+	}
+	variants, err := loadMediaVariants(ctx, s.store, mediaIDs)
+	if err != nil {
+		return err
+	}
 	counts := make(map[uuid.UUID]int, len(posts))
 	for _, row := range rows {
 		pi, ok := index[row.PostID]
@@ -236,14 +244,19 @@ func (s *TimelineService) attachMediaToPosts(ctx context.Context, posts []api.Po
 		if counts[row.PostID] >= 4 {
 			continue
 		}
-		posts[pi].Media = append(posts[pi].Media, api.Media{
-			Id:        row.MediaID,
-			Type:      api.MediaType("image"),
-			Url:       mediaImageURL(row.MediaID, row.Ext),
-			Width:     int(row.Width),
-			Height:    int(row.Height),
-			CreatedAt: row.CreatedAt,
-		})
+		posts[pi].Media = append(posts[pi].Media, newAPIMedia(mediaRecord{
+			ID:         row.MediaID,
+			Type:       row.Type,
+			Ext:        row.Ext,
+			Width:      row.Width,
+			Height:     row.Height,
+			DurationMs: row.DurationMs,
+			AltText:    row.AltText,
+			FocusX:     row.FocusX,
+			FocusY:     row.FocusY,
+			Blurhash:   row.Blurhash,
+			CreatedAt:  row.CreatedAt,
+		}, variants[row.MediaID]))
 		counts[row.PostID]++
 	}
 	return nil
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"net/http"
 	"regexp"
@@ -10,6 +11,7 @@ import (
 	"unicode/utf8"
 
 	"backend/internal/api"
+	"backend/internal/db/sqlc"
 
 	"github.com/google/uuid"
 )
@@ -60,6 +62,16 @@ func mapUserWithProfile(id uuid.UUID, username string, createdAt time.Time, disp
 	return user
 }
 
+// PublicProfile loads userID as other users see it, without agreement
+// state, using q.
+func PublicProfile(ctx context.Context, q *sqlc.Queries, userID uuid.UUID) (api.User, error) {
+	row, err := q.GetUserByID(ctx, userID)
+	if err != nil {
+		return api.User{}, err
+	}
+	return mapUserWithProfile(row.ID, row.Username, row.CreatedAt, row.DisplayName, row.Bio, row.AvatarMediaID, row.AvatarExt, 0, 0, sql.NullTime{}, sql.NullTime{}), nil
+}
+
 func sanitizeDisplayName(input string) string {
 	cleaned := sanitizeProfileText(input, false)
 	fields := strings.Fields(cleaned)
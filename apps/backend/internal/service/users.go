@@ -8,19 +8,27 @@ import (
 
 	"backend/internal/api"
 	"backend/internal/db/sqlc"
+	"backend/internal/realtime"
 	"backend/internal/repository"
 
 	"github.com/google/uuid"
 )
 
 type UsersService struct {
-	store *repository.Store
+	store  *repository.Store
+	outbox *RealtimeOutbox
 }
 
 func NewUsersService(store *repository.Store) *UsersService {
 	return &UsersService{store: store}
 }
 
+// NewUsersServiceWithPublisher creates a UsersService that announces
+// profile changes as user_updated events.
+func NewUsersServiceWithPublisher(store *repository.Store, publisher realtime.Publisher) *UsersService {
+	return &UsersService{store: store, outbox: NewRealtimeOutbox(store, publisher)}
+}
+
 func (s *UsersService) GetByUsername(ctx context.Context, username api.Username) (api.User, error) {
 	if s.store == nil {
 		return api.User{}, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
@@ -77,13 +85,23 @@ func (s *UsersService) UpdateProfile(ctx context.Context, userID uuid.UUID, disp
 		params.Bio = sql.NullString{String: cleaned, Valid: true}
 	}
 
-	row, err := s.store.Q.UpdateUserProfile(ctx, params)
+	var row sqlc.UpdateUserProfileRow
+	var event OutboxEvent
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		var err error
+		if row, err = q.UpdateUserProfile(ctx, params); err != nil {
+			return err
+		}
+		event, err = RecordUserUpdated(ctx, s.outbox, q, userID)
+		return err
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return api.User{}, NewError(http.StatusNotFound, "not_found", "user not found")
 		}
 		return api.User{}, err
 	}
+	s.outbox.Publish(ctx, event)
 	return mapUserWithProfile(row.ID, row.Username, row.CreatedAt, row.DisplayName, row.Bio, row.AvatarMediaID, sql.NullString{}, row.TermsVersion, row.PrivacyVersion, row.TermsAcceptedAt, row.PrivacyAcceptedAt), nil
 }
 
@@ -91,9 +109,19 @@ func (s *UsersService) UpdateAvatar(ctx context.Context, userID uuid.UUID, avata
 	if s.store == nil {
 		return api.User{}, nil, NewError(http.StatusServiceUnavailable, "service_unavailable", "database not configured")
 	}
-	row, err := s.store.Q.UpdateUserAvatar(ctx, sqlc.UpdateUserAvatarParams{
-		ID:            userID,
-		AvatarMediaID: uuid.NullUUID{UUID: avatarMediaID, Valid: true},
+	var row sqlc.UpdateUserAvatarRow
+	var event OutboxEvent
+	err := s.store.WithTx(ctx, func(q *sqlc.Queries) error {
+		var err error
+		row, err = q.UpdateUserAvatar(ctx, sqlc.UpdateUserAvatarParams{
+			ID:            userID,
+			AvatarMediaID: uuid.NullUUID{UUID: avatarMediaID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		event, err = RecordUserUpdated(ctx, s.outbox, q, userID)
+		return err
 	})
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -101,6 +129,7 @@ func (s *UsersService) UpdateAvatar(ctx context.Context, userID uuid.UUID, avata
 		}
 		return api.User{}, nil, err
 	}
+	s.outbox.Publish(ctx, event)
 
 	var previous *uuid.UUID
 	if row.PreviousAvatarMediaID.Valid {
@@ -110,3 +139,17 @@ func (s *UsersService) UpdateAvatar(ctx context.Context, userID uuid.UUID, avata
 	user := mapUserWithProfile(row.ID, row.Username, row.CreatedAt, row.DisplayName, row.Bio, row.AvatarMediaID, row.AvatarExt, row.TermsVersion, row.PrivacyVersion, row.TermsAcceptedAt, row.PrivacyAcceptedAt)
 	return user, previous, nil
 }
+
+// RecordUserUpdated records a user_updated event with the public profile of
+// userID as read through q. Call it in the transaction that changed the
+// profile and pass the result to outbox.Publish after commit.
+func RecordUserUpdated(ctx context.Context, outbox *RealtimeOutbox, q *sqlc.Queries, userID uuid.UUID) (OutboxEvent, error) {
+	if !outbox.enabled() {
+		return OutboxEvent{}, nil
+	}
+	user, err := PublicProfile(ctx, q, userID)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+	return outbox.Record(ctx, q, realtime.Event{Type: realtime.EventUserUpdated, User: &user})
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Backend names accepted by MEDIA_STORAGE.
+const (
+	DriverFS = "fs"
+	DriverS3 = "s3"
+)
+
+// DriverFromEnv returns the backend selected by MEDIA_STORAGE (default "fs").
+func DriverFromEnv() (string, error) {
+	driver := strings.ToLower(strings.TrimSpace(os.Getenv("MEDIA_STORAGE")))
+	switch driver {
+	case "", DriverFS:
+		return DriverFS, nil
+	case DriverS3:
+		return DriverS3, nil
+	default:
+		return "", fmt.Errorf("storage: unknown MEDIA_STORAGE %q", driver)
+	}
+}
+
+// S3ConfigFromEnv reads S3_ENDPOINT, S3_PUBLIC_ENDPOINT, S3_REGION,
+// S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY, S3_PREFIX and
+// S3_FORCE_PATH_STYLE. Path-style addressing defaults to on when a custom
+// endpoint is configured.
+func S3ConfigFromEnv() (S3Config, error) {
+	cfg := S3Config{
+		Endpoint:        strings.TrimSpace(os.Getenv("S3_ENDPOINT")),
+		PublicEndpoint:  strings.TrimSpace(os.Getenv("S3_PUBLIC_ENDPOINT")),
+		Region:          strings.TrimSpace(os.Getenv("S3_REGION")),
+		Bucket:          strings.TrimSpace(os.Getenv("S3_BUCKET")),
+		AccessKeyID:     strings.TrimSpace(os.Getenv("S3_ACCESS_KEY_ID")),
+		SecretAccessKey: strings.TrimSpace(os.Getenv("S3_SECRET_ACCESS_KEY")),
+		Prefix:          strings.TrimLeft(strings.TrimSpace(os.Getenv("S3_PREFIX")), "/"),
+		PathStyle:       strings.TrimSpace(os.Getenv("S3_ENDPOINT")) != "",
+	}
+	if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+		cfg.Prefix += "/"
+	}
+	if v := strings.TrimSpace(os.Getenv("S3_FORCE_PATH_STYLE")); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return S3Config{}, fmt.Errorf("storage: invalid S3_FORCE_PATH_STYLE %q", v)
+		}
+		cfg.PathStyle = b
+	}
+	if cfg.Bucket == "" {
+		return S3Config{}, fmt.Errorf("storage: S3_BUCKET is required when MEDIA_STORAGE=s3")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return S3Config{}, fmt.Errorf("storage: S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required when MEDIA_STORAGE=s3")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps objects as files below a root directory.
+//
+// ETags are SHA-256 digests of the file contents, computed on first access
+// and remembered while the file's size and modification time are unchanged.
+type FileStore struct {
+	root  string
+	etags etagCache
+}
+
+// NewFileStore returns a store rooted at dir. The directory is created on
+// first write if it does not exist.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{root: dir}
+}
+
+// Root returns the store's root directory.
+func (s *FileStore) Root() string { return s.root }
+
+func (s *FileStore) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the object to a temporary file and renames it into place so
+// readers never observe a partial object.
+func (s *FileStore) Put(_ context.Context, key string, r io.Reader, size int64, _ string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	n, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("storage: wrote %d bytes, expected %d", n, size)
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, p)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Get(_ context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, ObjectInfo{}, mapFSError(err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if st.IsDir() {
+		_ = f.Close()
+		return nil, ObjectInfo{}, ErrNotExist
+	}
+	info := fileInfo(key, st)
+	if info.ETag, err = s.etag(p, st, f); err != nil {
+		_ = f.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, ObjectInfo{}, err
+	}
+	return f, info, nil
+}
+
+func (s *FileStore) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return ObjectInfo{}, mapFSError(err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if st.IsDir() {
+		return ObjectInfo{}, ErrNotExist
+	}
+	info := fileInfo(key, st)
+	if info.ETag, err = s.etag(p, st, f); err != nil {
+		return ObjectInfo{}, err
+	}
+	return info, nil
+}
+
+// etag returns the quoted content digest of the open file at p, reading it
+// only when the cached digest is missing or stale.
+func (s *FileStore) etag(p string, st fs.FileInfo, f io.Reader) (string, error) {
+	if tag, ok := s.etags.get(p, st); ok {
+		return tag, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	tag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.put(p, st, tag)
+	return tag, nil
+}
+
+// etagCacheSize bounds the number of remembered digests. The cache is
+// cleared when full; recomputing costs one read of the file.
+const etagCacheSize = 10000
+
+type etagEntry struct {
+	size    int64
+	modTime time.Time
+	tag     string
+}
+
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+func (c *etagCache) get(p string, st fs.FileInfo) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[p]
+	if !ok || e.size != st.Size() || !e.modTime.Equal(st.ModTime()) {
+		return "", false
+	}
+	return e.tag, true
+}
+
+func (c *etagCache) put(p string, st fs.FileInfo, tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= etagCacheSize {
+		c.entries = make(map[string]etagEntry)
+	}
+	c.entries[p] = etagEntry{size: st.Size(), modTime: st.ModTime(), tag: tag}
+}
+
+// Delete removes the object and, if it is now empty, its parent directory
+// (objects of one media item share a directory).
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if dir := filepath.Dir(p); dir != filepath.Clean(s.root) {
+		_ = os.Remove(dir) // fails harmlessly if other objects remain
+	}
+	return nil
+}
+
+// List walks the directory of prefix below the root. Temporary files of
+// in-progress writes are skipped.
+func (s *FileStore) List(ctx context.Context, prefix string, fn func(key string, info ObjectInfo) error) error {
+	start := s.root
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		start = filepath.Join(s.root, filepath.FromSlash(prefix[:i]))
+	}
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		st, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // deleted during the walk
+		}
+		if err != nil {
+			return err
+		}
+		return fn(key, fileInfo(key, st))
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // nothing stored yet
+	}
+	return err
+}
+
+func (s *FileStore) PresignGet(context.Context, string, time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+func fileInfo(key string, st fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Size:        st.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     st.ModTime(),
+	}
+}
+
+func mapFSError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
@@ -0,0 +1,473 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3EmptySHA256     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3MaxPresignTTL   = 7 * 24 * time.Hour
+)
+
+// S3Config configures an S3-compatible store.
+type S3Config struct {
+	// Endpoint is the service URL, e.g. "https://s3.ap-northeast-1.amazonaws.com"
+	// or "http://minio:9000".
+	Endpoint string
+
+	// PublicEndpoint, if set, is used in presigned URLs instead of Endpoint.
+	// Use it when the backend reaches the service on an internal address.
+	PublicEndpoint string
+
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PathStyle addresses objects as Endpoint/Bucket/Key instead of
+	// Bucket.Endpoint/Key. MinIO and most self-hosted services need this.
+	PathStyle bool
+
+	// Prefix is prepended to every object key, e.g. "media/".
+	Prefix string
+
+	// HTTPClient is used for requests. If nil, a client with a 2 minute
+	// timeout is used.
+	HTTPClient *http.Client
+
+	// Now is used for request signing. If nil, defaults to time.Now.
+	Now func() time.Time
+}
+
+// S3Store stores objects in an S3-compatible bucket using Signature V4.
+type S3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	public   *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Store validates cfg and returns a store. No request is made.
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("storage: s3 bucket required")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("storage: s3 credentials required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	endpoint, err := parseEndpoint(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	public := endpoint
+	if cfg.PublicEndpoint != "" {
+		if public, err = parseEndpoint(cfg.PublicEndpoint); err != nil {
+			return nil, err
+		}
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Minute}
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &S3Store{cfg: cfg, endpoint: endpoint, public: public, client: client, now: now}, nil
+}
+
+func parseEndpoint(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(strings.TrimSpace(raw), "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint %q", raw)
+	}
+	return u, nil
+}
+
+// objectURL returns the URL of key on base. Path and RawPath are both set so
+// the request is sent with exactly the escaping used for signing.
+func (s *S3Store) objectURL(base *url.URL, key string) *url.URL {
+	full := s.cfg.Prefix + key
+	u := &url.URL{Scheme: base.Scheme, Host: base.Host}
+	if s.cfg.PathStyle {
+		u.Path = base.Path + "/" + s.cfg.Bucket + "/" + full
+		u.RawPath = s3EscapePath(base.Path + "/" + s.cfg.Bucket + "/" + full)
+	} else {
+		u.Host = s.cfg.Bucket + "." + base.Host
+		u.Path = base.Path + "/" + full
+		u.RawPath = s3EscapePath(base.Path + "/" + full)
+	}
+	return u
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, "", io.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.URL = s.objectURL(s.endpoint, key)
+	req.Host = req.URL.Host
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req, s3UnsignedPayload)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Get returns the object body. The body also implements io.Seeker (see
+// s3Object), so callers can serve byte ranges.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	resp, err := s.simple(ctx, http.MethodGet, key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	info := s3ObjectInfo(resp)
+	return &s3Object{s: s, ctx: ctx, key: key, size: info.Size, body: resp.Body}, info, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := s.simple(ctx, http.MethodHead, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	_ = resp.Body.Close()
+	return s3ObjectInfo(resp), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.simple(ctx, http.MethodDelete, key)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// List pages through ListObjectsV2 results for prefix.
+func (s *S3Store) List(ctx context.Context, prefix string, fn func(key string, info ObjectInfo) error) error {
+	var token string
+	for {
+		q := map[string]string{"list-type": "2", "prefix": s.cfg.Prefix + prefix}
+		if token != "" {
+			q["continuation-token"] = token
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+		if err != nil {
+			return err
+		}
+		req.URL = s.bucketURL(s.endpoint)
+		req.URL.RawQuery = s3CanonicalQuery(q)
+		req.Host = req.URL.Host
+		resp, err := s.do(req, s3EmptySHA256)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				ETag         string    `xml:"ETag"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		_ = resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("storage: s3 list: %w", err)
+		}
+		for _, c := range page.Contents {
+			info := ObjectInfo{Size: c.Size, ETag: c.ETag, ModTime: c.LastModified}
+			if err := fn(strings.TrimPrefix(c.Key, s.cfg.Prefix), info); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// bucketURL returns the URL of the bucket itself, used for listing.
+func (s *S3Store) bucketURL(base *url.URL) *url.URL {
+	u := &url.URL{Scheme: base.Scheme, Host: base.Host}
+	if s.cfg.PathStyle {
+		u.Path = base.Path + "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + base.Host
+		u.Path = base.Path + "/"
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	return u
+}
+
+// PresignGet returns a query-signed GET URL on the public endpoint.
+// ttl is clamped to the S3 maximum of seven days.
+func (s *S3Store) PresignGet(_ context.Context, key string, ttl time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	if ttl > s3MaxPresignTTL {
+		ttl = s3MaxPresignTTL
+	}
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.scope(now)
+	u := s.objectURL(s.public, key)
+
+	q := map[string]string{
+		"X-Amz-Algorithm":     s3Algorithm,
+		"X-Amz-Credential":    s.cfg.AccessKeyID + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       strconv.Itoa(int(ttl / time.Second)),
+		"X-Amz-SignedHeaders": "host",
+	}
+	query := s3CanonicalQuery(q)
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.RawPath,
+		query,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	sig := s.signature(now, amzDate, scope, canonical)
+	u.RawQuery = query + "&X-Amz-Signature=" + sig
+	return u.String(), nil
+}
+
+func (s *S3Store) simple(ctx context.Context, method, key string) (*http.Response, error) {
+	return s.simpleFrom(ctx, method, key, 0)
+}
+
+// simpleFrom is simple with a "Range: bytes=from-" header when from > 0.
+func (s *S3Store) simpleFrom(ctx context.Context, method, key string, from int64) (*http.Response, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = s.objectURL(s.endpoint, key)
+	req.Host = req.URL.Host
+	if from > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(from, 10)+"-")
+	}
+	return s.do(req, s3EmptySHA256)
+}
+
+// s3Object is the body of a GET. Seeking is lazy: the next Read after a seek
+// reissues the request with a Range header, so http.ServeContent can serve
+// byte ranges without buffering the object.
+type s3Object struct {
+	s    *S3Store
+	ctx  context.Context
+	key  string
+	size int64
+	body io.ReadCloser
+	pos  int64 // offset body is positioned at
+	off  int64 // offset of the next Read
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.size >= 0 && o.off >= o.size {
+		return 0, io.EOF
+	}
+	if o.body == nil || o.pos != o.off {
+		if o.body != nil {
+			_ = o.body.Close()
+			o.body = nil
+		}
+		resp, err := o.s.simpleFrom(o.ctx, http.MethodGet, o.key, o.off)
+		if err != nil {
+			return 0, err
+		}
+		o.body, o.pos = resp.Body, o.off
+	}
+	n, err := o.body.Read(p)
+	o.pos += int64(n)
+	o.off += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.off + offset
+	case io.SeekEnd:
+		if o.size < 0 {
+			return 0, errors.New("storage: object size unknown")
+		}
+		abs = o.size + offset
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+	o.off = abs
+	return abs, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+// do signs req with header-based Signature V4 and sends it. Non-2xx
+// responses are converted to errors; 404 becomes ErrNotExist.
+func (s *S3Store) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.scope(now)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.RawPath,
+		req.URL.RawQuery, // callers build it with s3CanonicalQuery
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signed,
+		payloadHash,
+	}, "\n")
+	sig := s.signature(now, amzDate, scope, canonical)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.cfg.AccessKeyID, scope, signed, sig))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotExist
+	}
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+	return nil, fmt.Errorf("storage: s3 %s %s: %s %s %s", req.Method, req.URL.Path, resp.Status, e.Code, e.Message)
+}
+
+func (s *S3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s *S3Store) signature(now time.Time, amzDate, scope, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := s3Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func s3ObjectInfo(resp *http.Response) ObjectInfo {
+	info := ObjectInfo{
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = t
+	}
+	return info
+}
+
+// s3Escape percent-encodes everything except RFC 3986 unreserved characters,
+// as Signature V4 requires.
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(p string) string { return s3Escape(p, true) }
+
+func s3CanonicalQuery(q map[string]string) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, s3Escape(k, false)+"="+s3Escape(q[k], false))
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,86 @@
+// Package storage abstracts where uploaded media objects live.
+//
+// Objects are addressed by slash-separated keys such as
+// "3f0c.../image.webp". Two backends are provided: FileStore keeps objects
+// under a local directory (the historical MEDIA_DIR layout) and S3Store talks
+// to any S3-compatible service (AWS S3, MinIO, R2, ...).
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotExist is returned when an object does not exist.
+	ErrNotExist = errors.New("storage: object does not exist")
+
+	// ErrPresignUnsupported is returned by backends that cannot hand out
+	// direct download URLs; callers should proxy the object instead.
+	ErrPresignUnsupported = errors.New("storage: presigned URLs not supported")
+
+	// ErrInvalidKey is returned for empty keys or keys escaping the store root.
+	ErrInvalidKey = errors.New("storage: invalid object key")
+)
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// MediaStore stores media objects.
+type MediaStore interface {
+	// Put stores size bytes from r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get opens the object for reading. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+
+	// Stat returns object metadata without reading the body.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// PresignGet returns a URL that allows anyone to download the object
+	// until ttl elapses, or ErrPresignUnsupported.
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// Lister is implemented by stores that can enumerate their objects. It is
+// used by maintenance jobs; request handling never lists.
+type Lister interface {
+	// List calls fn for every object whose key starts with prefix. Listing
+	// stops at the first error returned by fn.
+	List(ctx context.Context, prefix string, fn func(key string, info ObjectInfo) error) error
+}
+
+// validKey rejects keys that are empty, absolute or contain "." or ".."
+// segments, so a key can never address anything outside the store.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy copies key from src to dst.
+func Copy(ctx context.Context, dst, src MediaStore, key string) error {
+	rc, info, err := src.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return dst.Put(ctx, key, rc, info.Size, info.ContentType)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -17,14 +19,17 @@ import (
 	"backend/internal/cache"
 	"backend/internal/config"
 	"backend/internal/db"
+	"backend/internal/geoip"
 	"backend/internal/handlers"
 	"backend/internal/logging"
+	"backend/internal/mail"
 	"backend/internal/middleware"
 	"backend/internal/realtime"
 	"backend/internal/repository"
 	"backend/internal/service"
 	"backend/internal/service/admin"
 	"backend/internal/service/moderation"
+	"backend/internal/storage"
 
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
@@ -103,6 +108,17 @@ func main() {
 		}
 	}
 
+	// JWT_SECRET is only required when no keyring file is configured
+	jwtKeysFile := strings.TrimSpace(os.Getenv("JWT_KEYS_FILE"))
+	if jwtKeysFile != "" {
+		delete(requiredSecrets, "JWT_SECRET")
+	}
+	// Likewise REALTIME_SIGNING_SECRET
+	realtimeKeysFile := strings.TrimSpace(os.Getenv("REALTIME_SIGNING_KEYS_FILE"))
+	if realtimeKeysFile != "" {
+		delete(requiredSecrets, "REALTIME_SIGNING_SECRET")
+	}
+
 	// Check all required secrets
 	var errors []string
 	for varName, config := range requiredSecrets {
@@ -188,9 +204,30 @@ func main() {
 	r := chi.NewRouter()
 	r.Use(chimw.RequestID)
 
-	// JWT_SECRET is now validated above - no fallback to ephemeral secret
-	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
-	tokenManager := auth.NewTokenManager(jwtSecret, 1*time.Hour)
+	// JWT_SECRET is now validated above - no fallback to ephemeral secret.
+	// JWT_KEYS_FILE takes precedence and enables key rotation without restart.
+	var tokenManager *auth.TokenManager
+	if jwtKeysFile != "" {
+		keyring, err := auth.LoadKeyringFile(jwtKeysFile)
+		if err != nil {
+			slog.Error("failed to load JWT_KEYS_FILE", "path", jwtKeysFile, "error", err)
+			os.Exit(1)
+		}
+		reloadEvery := 30 * time.Second
+		if v := os.Getenv("JWT_KEYS_RELOAD_SECONDS"); v != "" {
+			if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+				reloadEvery = time.Duration(secs) * time.Second
+			} else {
+				slog.Warn("invalid JWT_KEYS_RELOAD_SECONDS", "value", v)
+			}
+		}
+		go auth.WatchKeyringFile(context.Background(), jwtKeysFile, keyring, reloadEvery)
+		tokenManager = auth.NewTokenManagerWithKeyring(keyring, 1*time.Hour)
+		slog.Info("jwt keyring loaded", "path", jwtKeysFile, "active_kid", keyring.Active().ID, "alg", keyring.Active().Alg)
+	} else {
+		jwtSecret := []byte(os.Getenv("JWT_SECRET"))
+		tokenManager = auth.NewTokenManager(jwtSecret, 1*time.Hour)
+	}
 	if v := os.Getenv("STEPUP_TOKEN_TTL_SECONDS"); v != "" {
 		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
 			tokenManager.SetStepupTTL(time.Duration(secs) * time.Second)
@@ -237,7 +274,35 @@ func main() {
 		}
 	}
 
-	realtimeHub := realtime.NewHub(redisClient)
+	var hubOpts realtime.HubOptions
+	if v := os.Getenv("REALTIME_HUB_SHARDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			hubOpts.Shards = n
+		} else {
+			slog.Warn("invalid REALTIME_HUB_SHARDS", "value", v)
+		}
+	}
+	// REALTIME_SIGNING_KEYS_FILE takes precedence over REALTIME_SIGNING_SECRET
+	// and enables key rotation without restart.
+	if realtimeKeysFile != "" {
+		keyring, err := auth.LoadKeyringFile(realtimeKeysFile)
+		if err != nil {
+			slog.Error("failed to load REALTIME_SIGNING_KEYS_FILE", "path", realtimeKeysFile, "error", err)
+			os.Exit(1)
+		}
+		reloadEvery := 30 * time.Second
+		if v := os.Getenv("REALTIME_SIGNING_KEYS_RELOAD_SECONDS"); v != "" {
+			if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+				reloadEvery = time.Duration(secs) * time.Second
+			} else {
+				slog.Warn("invalid REALTIME_SIGNING_KEYS_RELOAD_SECONDS", "value", v)
+			}
+		}
+		go auth.WatchKeyringFile(context.Background(), realtimeKeysFile, keyring, reloadEvery)
+		hubOpts.Signer = realtime.NewSigner(keyring)
+		slog.Info("realtime signing keyring loaded", "path", realtimeKeysFile, "active_kid", keyring.Active().ID, "alg", keyring.Active().Alg)
+	}
+	realtimeHub := realtime.NewHubWithOptions(redisClient, hubOpts)
 	go realtimeHub.Run(context.Background())
 
 	// Set Redis on TokenManager for token revocation
@@ -269,27 +334,69 @@ func main() {
 	// Initialize session stores (Redis if available, fallback to memory)
 	var loginSessionStore auth.LoginSessionStore
 	var stepupSessionStore auth.StepupSessionStore
+	var loginAttemptStore auth.LoginAttemptStore
+	var realtimeTicketStore auth.RealtimeTicketStore
 	if redisClient != nil {
 		loginSessionStore = auth.NewRedisLoginSessionStore(redisClient, 60*time.Second)
 		stepupSessionStore = auth.NewRedisStepupSessionStore(redisClient, 5*time.Minute)
+		loginAttemptStore = auth.NewRedisLoginAttemptStore(redisClient)
+		realtimeTicketStore = auth.NewRedisRealtimeTicketStore(redisClient)
 		slog.Info("using Redis-backed session stores")
 	} else {
 		loginSessionStore = auth.NewMemoryLoginSessionStore()
 		stepupSessionStore = auth.NewMemoryStepupSessionStore()
+		loginAttemptStore = auth.NewMemoryLoginAttemptStore()
+		realtimeTicketStore = auth.NewMemoryRealtimeTicketStore()
 		slog.Warn("Redis not available; using in-memory session stores (not suitable for multi-instance deployment)")
 	}
 
 	authSvc := service.NewAuthServiceWithOptions(store, tokenManager, service.AuthServiceOptions{
 		LoginSessionStore:  loginSessionStore,
 		StepupSessionStore: stepupSessionStore,
+		LoginAttemptStore:  loginAttemptStore,
 	})
 	authSvc.SetConfigManager(configMgr)
 
+	notificationsSvc := service.NewNotificationsService(store)
+	authSvc.SetNotificationsService(notificationsSvc)
+
+	securityEventsOpts := service.SecurityEventsServiceOptions{}
+	if path := os.Getenv("GEOIP_DB_PATH"); path != "" {
+		if geo, err := geoip.Open(path); err != nil {
+			slog.Warn("failed to load GeoIP database; security events will have no location", "path", path, "error", err)
+		} else {
+			securityEventsOpts.GeoIP = geo
+			slog.Info("GeoIP database loaded", "path", path)
+		}
+	}
+	if v := os.Getenv("SECURITY_EVENT_RETENTION_DAYS"); v != "" {
+		if days, err := strconv.Atoi(v); err == nil && days > 0 {
+			securityEventsOpts.Retention = time.Duration(days) * 24 * time.Hour
+		} else {
+			slog.Warn("invalid SECURITY_EVENT_RETENTION_DAYS", "value", v)
+		}
+	}
+	securityEventsSvc := service.NewSecurityEventsService(store, securityEventsOpts)
+	authSvc.SetSecurityEventsService(securityEventsSvc)
+	go securityEventsSvc.RunRetention(context.Background(), time.Hour)
+
+	mailer, err := mail.NewFromEnv()
+	if err != nil {
+		slog.Error("invalid mail configuration", "error", err)
+		os.Exit(1)
+	}
+	if !mail.Enabled(mailer) {
+		slog.Warn("MAIL_DRIVER not set; email verification and password reset are disabled")
+	}
+	emailSvc := service.NewEmailService(store, tokenManager, mailer, service.EmailServiceOptions{})
+	emailSvc.SetSecurityEventsService(securityEventsSvc)
+	go emailSvc.RunCleanup(context.Background(), time.Hour)
+
 	// Initialize admin services
 	modLogsSvc := moderation.NewLogsService(store)
 	adminInvitesSvc := admin.NewInvitesService(store)
 	adminUsersSvc := admin.NewUsersService(store)
-	adminProfileSvc := admin.NewProfileService(store, modLogsSvc)
+	adminProfileSvc := admin.NewProfileServiceWithPublisher(store, modLogsSvc, realtimeHub)
 	adminAgreementsSvc := admin.NewAgreementsService(store)
 
 	// Initialize moderation services
@@ -298,7 +405,7 @@ func main() {
 	modBannedContentSvc := moderation.NewBannedContentService(store, modLogsSvc)
 	modIPBansSvc := moderation.NewIPBansService(store, modLogsSvc)
 	modPostsSvc := moderation.NewPostsServiceWithPublisher(store, modLogsSvc, realtimeHub)
-	modMediaSvc := moderation.NewMediaService(store, modLogsSvc)
+	modMediaSvc := moderation.NewMediaServiceWithPublisher(store, modLogsSvc, realtimeHub)
 
 	// Update auth service to use admin invites service
 	authSvc.SetInviteService(adminInvitesSvc)
@@ -322,51 +429,85 @@ func main() {
 	r.Use(middleware.RequireAdminAccess(tokenManager, authzSvc))
 
 	adminSvc := service.NewAdminService(store, cacheImpl, configMgr)
-	usersSvc := service.NewUsersService(store)
+	usersSvc := service.NewUsersServiceWithPublisher(store, realtimeHub)
 	postsSvc := service.NewPostsService(store, cacheImpl, realtimeHub)
 	timelineSvc := service.NewTimelineService(store, cacheImpl)
 	reactionsSvc := service.NewReactionsService(store, cacheImpl, realtimeHub)
-
-	mediaDir := os.Getenv("MEDIA_DIR")
-	if mediaDir == "" {
-		mediaDir = filepath.FromSlash("./data/media")
+	// Relays realtime events that were not published right after their
+	// transaction committed.
+	realtimeOutbox := service.NewRealtimeOutbox(store, realtimeHub)
+	go realtimeOutbox.Run(context.Background())
+
+	mediaOpts := mediaServiceOptionsFromEnv()
+	mediaOpts.Publisher = realtimeHub
+	mediaSvc := service.NewMediaServiceWithOptions(store, mediaOpts)
+	mediaWorkers := service.DefaultMediaWorkers
+	if v := os.Getenv("MEDIA_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			mediaWorkers = n
+		} else {
+			slog.Warn("invalid MEDIA_WORKERS", "value", v)
+		}
 	}
-
-	// Resolve to absolute path for clarity in logs
-	absMediaDir, err := filepath.Abs(mediaDir)
-	if err != nil {
-		slog.Warn("failed to resolve MEDIA_DIR to absolute path; using as-is", "mediaDir", mediaDir, "error", err)
-		absMediaDir = mediaDir
+	// MEDIA_WORKERS=0 leaves conversion to other instances.
+	if mediaWorkers > 0 {
+		go mediaSvc.RunWorkers(context.Background(), mediaWorkers)
 	}
-
-	// Try to initialize media directory
-	mediaInitErr := initMediaDir(absMediaDir)
-	if mediaInitErr != nil {
-		slog.Error("media directory initialization failed", "path", absMediaDir, "error", mediaInitErr)
-		slog.Warn("media upload will return 503 until directory is created with proper permissions")
-	} else {
-		slog.Info("media directory initialized", "path", absMediaDir)
+	mediaGCInterval := time.Hour
+	if v := os.Getenv("MEDIA_GC_INTERVAL_MINUTES"); v != "" {
+		if mins, err := strconv.Atoi(v); err == nil && mins >= 0 {
+			mediaGCInterval = time.Duration(mins) * time.Minute
+		} else {
+			slog.Warn("invalid MEDIA_GC_INTERVAL_MINUTES", "value", v)
+		}
+	}
+	// MEDIA_GC_INTERVAL_MINUTES=0 disables garbage collection here.
+	if mediaGCInterval > 0 {
+		go mediaSvc.RunGC(context.Background(), mediaGCInterval)
 	}
 
-	mediaSvc := service.NewMediaService(store, absMediaDir, mediaInitErr)
+	go mediaSvc.RunPNGCacheEviction(context.Background(), time.Hour)
 
-	// Public media routes (authentication bypassed in OptionalAuth middleware)
-	r.Get("/media/{mediaId}/image.png", mediaSvc.ServeImage)
-	r.Get("/media/{mediaId}/image.webp", mediaSvc.ServeImage)
+	// Media routes. OptionalAuth resolves the viewer from the auth cookie or a
+	// first-party bearer token without rejecting bad credentials, so owners
+	// can view unattached uploads; signed URLs grant access without either.
+	// GET also answers HEAD, which must be registered separately with chi.
+	mediaRoutes := map[string]http.HandlerFunc{
+		"/media/{mediaId}/image.png":   mediaSvc.ServePNG,
+		"/media/{mediaId}/image.webp":  mediaSvc.ServeImage,
+		"/media/{mediaId}/video.mp4":   mediaSvc.ServeImage,
+		"/media/{mediaId}/poster.webp": mediaSvc.ServePoster,
+	}
+	for pattern, h := range mediaRoutes {
+		r.Get(pattern, h)
+		r.Head(pattern, h)
+	}
+
+	oauthSvc := service.NewOAuthService(store, tokenManager, authzSvc, service.OAuthServiceOptions{})
+	oauthSvc.SetSecurityEventsService(securityEventsSvc)
+	go oauthSvc.RunCleanup(context.Background(), time.Hour)
 
 	apiServer := handlers.API{
-		Auth:       authSvc,
-		Admin:      adminSvc,
-		Authz:      authzSvc,
-		Users:      usersSvc,
-		Posts:      postsSvc,
-		Timeline:   timelineSvc,
-		Reactions:  reactionsSvc,
-		Media:      mediaSvc,
-		Setup:      setupSvc,
-		Agreements: agreementsSvc,
-		Tokens:     tokenManager,
-		Redis:      redisClient,
+		Auth:           authSvc,
+		Admin:          adminSvc,
+		Authz:          authzSvc,
+		Users:          usersSvc,
+		Posts:          postsSvc,
+		Timeline:       timelineSvc,
+		Reactions:      reactionsSvc,
+		Media:          mediaSvc,
+		Setup:          setupSvc,
+		Agreements:     agreementsSvc,
+		Email:          emailSvc,
+		Notifications:  notificationsSvc,
+		OAuth:          oauthSvc,
+		SecurityEvents: securityEventsSvc,
+		Tokens:         tokenManager,
+		Redis:          redisClient,
+		Realtime:       realtimeHub,
+		RealtimeOutbox: realtimeOutbox,
+
+		RealtimeTickets: realtimeTicketStore,
 
 		// Admin services
 		AdminInvites:    adminInvitesSvc,
@@ -383,7 +524,19 @@ func main() {
 		ModPosts:         modPostsSvc,
 		ModMedia:         modMediaSvc,
 	}
-	r.Get("/ws/timeline", handlers.NewTimelineWebSocketHandler(realtimeHub, tokenManager, handlers.WebSocketOptions{TrustProxy: trustProxy}))
+	r.Get("/.well-known/jwks.json", handlers.NewJWKSHandler(tokenManager))
+	r.Get("/.well-known/realtime-keys.json", handlers.NewRealtimeJWKSHandler(realtimeHub))
+	r.Get("/.well-known/openid-configuration", handlers.NewOpenIDConfigurationHandler(oauthSvc))
+	// The websocket and SSE endpoints share one set of connection limits.
+	realtimeOpts := handlers.WebSocketOptions{TrustProxy: trustProxy, Tickets: realtimeTicketStore}
+	switch os.Getenv("REALTIME_WS_COMPRESSION") {
+	case "1", "true", "TRUE", "True":
+		realtimeOpts.Compression = true
+	}
+	realtimeOpts.Limiter = handlers.NewRealtimeLimiter(realtimeOpts)
+	r.Get("/ws/timeline", handlers.NewTimelineWebSocketHandler(realtimeHub, tokenManager, realtimeOpts))
+	r.Get("/sse/timeline", handlers.NewTimelineSSEHandler(realtimeHub, tokenManager, realtimeOpts))
+	r.Get("/sse/me", handlers.NewUserSSEHandler(realtimeHub, tokenManager, realtimeOpts))
 	api.HandlerWithOptions(&apiServer, api.ChiServerOptions{
 		BaseURL:    "/api/v1",
 		BaseRouter: r,
@@ -410,7 +563,8 @@ func main() {
 		// Set to 30s to allow large file uploads (12MB over slower connections)
 		ReadTimeout: 30 * time.Second,
 		// WriteTimeout covers the time from end of request read to end of response write
-		// Set to 60s to allow image processing time (large images may take several seconds)
+		// Set to 60s to allow avatar processing time; post media is converted
+		// in the background by the media workers
 		WriteTimeout: 60 * time.Second,
 		// IdleTimeout limits keep-alive connections
 		IdleTimeout: 120 * time.Second,
@@ -428,6 +582,139 @@ func main() {
 	}
 }
 
+// mediaServiceOptionsFromEnv selects the media storage backend (MEDIA_STORAGE)
+// and serving mode (MEDIA_SERVE_MODE). Invalid S3 settings are fatal; an
+// unwritable MEDIA_DIR only disables uploads.
+func mediaServiceOptionsFromEnv() service.MediaServiceOptions {
+	var opts service.MediaServiceOptions
+
+	driver, err := storage.DriverFromEnv()
+	if err != nil {
+		slog.Error("invalid media storage configuration", "error", err)
+		os.Exit(1)
+	}
+	switch driver {
+	case storage.DriverS3:
+		cfg, err := storage.S3ConfigFromEnv()
+		if err != nil {
+			slog.Error("invalid media storage configuration", "error", err)
+			os.Exit(1)
+		}
+		s3Store, err := storage.NewS3Store(cfg)
+		if err != nil {
+			slog.Error("invalid media storage configuration", "error", err)
+			os.Exit(1)
+		}
+		opts.Objects = s3Store
+		slog.Info("media storage: s3", "endpoint", cfg.Endpoint, "bucket", cfg.Bucket, "prefix", cfg.Prefix)
+	default:
+		mediaDir := os.Getenv("MEDIA_DIR")
+		if mediaDir == "" {
+			mediaDir = filepath.FromSlash("./data/media")
+		}
+
+		// Resolve to absolute path for clarity in logs
+		absMediaDir, err := filepath.Abs(mediaDir)
+		if err != nil {
+			slog.Warn("failed to resolve MEDIA_DIR to absolute path; using as-is", "mediaDir", mediaDir, "error", err)
+			absMediaDir = mediaDir
+		}
+
+		// Try to initialize media directory
+		mediaInitErr := initMediaDir(absMediaDir)
+		if mediaInitErr != nil {
+			slog.Error("media directory initialization failed", "path", absMediaDir, "error", mediaInitErr)
+			slog.Warn("media upload will return 503 until directory is created with proper permissions")
+		} else {
+			slog.Info("media directory initialized", "path", absMediaDir)
+		}
+
+		opts.Objects = storage.NewFileStore(absMediaDir)
+		opts.InitErr = mediaInitErr
+	}
+
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("MEDIA_SERVE_MODE"))); mode {
+	case "", service.MediaServeProxy:
+		opts.ServeMode = service.MediaServeProxy
+	case service.MediaServeRedirect:
+		opts.ServeMode = service.MediaServeRedirect
+	default:
+		slog.Warn("invalid MEDIA_SERVE_MODE; proxying media", "value", mode)
+		opts.ServeMode = service.MediaServeProxy
+	}
+	if v := os.Getenv("MEDIA_PRESIGN_TTL_SECONDS"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			opts.PresignTTL = time.Duration(secs) * time.Second
+		} else {
+			slog.Warn("invalid MEDIA_PRESIGN_TTL_SECONDS", "value", v)
+		}
+	}
+
+	switch proc := strings.ToLower(strings.TrimSpace(os.Getenv("MEDIA_IMAGE_PROCESSOR"))); proc {
+	case "", service.MediaImageProcessorAuto:
+		opts.ImageProcessor = service.MediaImageProcessorAuto
+	case service.MediaImageProcessorFFmpeg, service.MediaImageProcessorGo:
+		opts.ImageProcessor = proc
+	default:
+		slog.Warn("invalid MEDIA_IMAGE_PROCESSOR; using auto", "value", proc)
+		opts.ImageProcessor = service.MediaImageProcessorAuto
+	}
+
+	opts.PNGCacheDir = os.Getenv("MEDIA_PNG_CACHE_DIR")
+	if v := os.Getenv("MEDIA_PNG_CACHE_MAX_MB"); v != "" {
+		if mb, err := strconv.ParseInt(v, 10, 64); err == nil && mb > 0 {
+			opts.PNGCacheMaxBytes = mb << 20
+		} else {
+			slog.Warn("invalid MEDIA_PNG_CACHE_MAX_MB", "value", v)
+		}
+	}
+	if v := os.Getenv("MEDIA_PNG_CACHE_MAX_AGE_HOURS"); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil && hours > 0 {
+			opts.PNGCacheMaxAge = time.Duration(hours) * time.Hour
+		} else {
+			slog.Warn("invalid MEDIA_PNG_CACHE_MAX_AGE_HOURS", "value", v)
+		}
+	}
+	if key := os.Getenv("MEDIA_URL_SIGNING_KEY"); key != "" {
+		opts.URLSigningKey = []byte(key)
+	} else if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		// Derive a key so upload previews work out of the box; the derived
+		// key cannot be used to forge session tokens.
+		m := hmac.New(sha256.New, []byte(secret))
+		m.Write([]byte("ciel media url signing"))
+		opts.URLSigningKey = m.Sum(nil)
+	}
+	if v := os.Getenv("MEDIA_SIGNED_URL_TTL_SECONDS"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			opts.SignedURLTTL = time.Duration(secs) * time.Second
+		} else {
+			slog.Warn("invalid MEDIA_SIGNED_URL_TTL_SECONDS", "value", v)
+		}
+	}
+	if v := os.Getenv("MEDIA_PREVIEW_URL_TTL_SECONDS"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			opts.PreviewURLTTL = time.Duration(secs) * time.Second
+		} else {
+			slog.Warn("invalid MEDIA_PREVIEW_URL_TTL_SECONDS", "value", v)
+		}
+	}
+	if v := os.Getenv("MEDIA_ORPHAN_MAX_AGE_HOURS"); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil && hours > 0 {
+			opts.OrphanMaxAge = time.Duration(hours) * time.Hour
+		} else {
+			slog.Warn("invalid MEDIA_ORPHAN_MAX_AGE_HOURS", "value", v)
+		}
+	}
+	if v := os.Getenv("MEDIA_GC_RECONCILE_HOURS"); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil && hours >= 0 {
+			opts.ReconcileObjectsInterval = time.Duration(hours) * time.Hour
+		} else {
+			slog.Warn("invalid MEDIA_GC_RECONCILE_HOURS", "value", v)
+		}
+	}
+	return opts
+}
+
 // initMediaDir attempts to initialize the media directory with proper permissions.
 // Returns an error if the directory cannot be created or is not writable.
 func initMediaDir(path string) error {
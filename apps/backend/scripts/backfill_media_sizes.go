@@ -0,0 +1,78 @@
+// backfill_media_sizes records the stored size (media.size_bytes) of media
+// uploaded before storage accounting existed, so that it counts towards
+// quotas and the dashboard totals:
+//
+//	go run scripts/backfill_media_sizes.go
+//
+// Storage is configured from the usual environment (MEDIA_STORAGE,
+// MEDIA_DIR, S3_*). Only media with a size of 0 is visited, so the command
+// can be re-run after an interruption.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"backend/internal/db"
+	"backend/internal/repository"
+	"backend/internal/service"
+	"backend/internal/storage"
+
+	"github.com/joho/godotenv"
+)
+
+func openStore() (storage.MediaStore, error) {
+	driver, err := storage.DriverFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if driver == storage.DriverS3 {
+		cfg, err := storage.S3ConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewS3Store(cfg)
+	}
+	dir := os.Getenv("MEDIA_DIR")
+	if dir == "" {
+		dir = "./data/media"
+	}
+	return storage.NewFileStore(dir), nil
+}
+
+func main() {
+	batch := flag.Int("batch", 100, "media rows fetched per query")
+	flag.Parse()
+
+	if err := godotenv.Load(".env.local"); err != nil {
+		log.Printf("Warning: .env.local not found: %v", err)
+	}
+
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL not set")
+	}
+	sqlDB, err := db.Open(databaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer sqlDB.Close()
+
+	objects, err := openStore()
+	if err != nil {
+		log.Fatalf("Media storage: %v", err)
+	}
+	svc := service.NewMediaServiceWithOptions(repository.NewStore(sqlDB), service.MediaServiceOptions{Objects: objects})
+
+	res, err := svc.BackfillSizes(context.Background(), *batch)
+	fmt.Printf("scanned=%d updated=%d failed=%d\n", res.Scanned, res.Updated, res.Failed)
+	if err != nil {
+		log.Fatalf("Backfill stopped: %v", err)
+	}
+	if res.Failed > 0 {
+		os.Exit(1)
+	}
+}
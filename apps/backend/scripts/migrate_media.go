@@ -0,0 +1,135 @@
+// migrate_media copies media objects between storage backends, e.g. when
+// moving from a shared MEDIA_DIR to S3:
+//
+//	go run scripts/migrate_media.go -from fs -to s3
+//
+// Both backends are configured from the usual environment (MEDIA_DIR for fs,
+// S3_* for s3). Objects already present in the destination with the same
+// size are skipped, so the command can be re-run after an interruption.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"backend/internal/db"
+	"backend/internal/service"
+	"backend/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func openStore(driver string) (storage.MediaStore, error) {
+	switch driver {
+	case storage.DriverFS:
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "./data/media"
+		}
+		return storage.NewFileStore(dir), nil
+	case storage.DriverS3:
+		cfg, err := storage.S3ConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewS3Store(cfg)
+	default:
+		return nil, fmt.Errorf("unknown backend %q (want fs or s3)", driver)
+	}
+}
+
+func main() {
+	from := flag.String("from", storage.DriverFS, "source backend (fs or s3)")
+	to := flag.String("to", storage.DriverS3, "destination backend (fs or s3)")
+	dryRun := flag.Bool("dry-run", false, "only report what would be copied")
+	flag.Parse()
+
+	if err := godotenv.Load(".env.local"); err != nil {
+		log.Printf("Warning: .env.local not found: %v", err)
+	}
+	if *from == *to {
+		log.Fatal("-from and -to must differ")
+	}
+
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL not set")
+	}
+	sqlDB, err := db.Open(databaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer sqlDB.Close()
+
+	src, err := openStore(*from)
+	if err != nil {
+		log.Fatalf("Source backend: %v", err)
+	}
+	dst, err := openStore(*to)
+	if err != nil {
+		log.Fatalf("Destination backend: %v", err)
+	}
+
+	ctx := context.Background()
+	rows, err := sqlDB.QueryContext(ctx, `SELECT id, ext, COALESCE(blob_hash, '') FROM media ORDER BY created_at, id`)
+	if err != nil {
+		log.Fatalf("Failed to list media: %v", err)
+	}
+	defer rows.Close()
+
+	var copied, skipped, missing, failed int
+	for rows.Next() {
+		var id uuid.UUID
+		var ext, blobHash string
+		if err := rows.Scan(&id, &ext, &blobHash); err != nil {
+			log.Fatalf("Failed to scan media row: %v", err)
+		}
+		// Media sharing a blob lists the same keys; the size check below
+		// skips them after the first copy.
+		for i, key := range service.MediaObjectKeys(service.MediaKeyPrefix(id, blobHash), ext) {
+			srcInfo, err := src.Stat(ctx, key)
+			if errors.Is(err, storage.ErrNotExist) {
+				// Only the original is guaranteed to exist; renditions are
+				// skipped for small images.
+				if i == 0 {
+					log.Printf("missing in source: %s", key)
+					missing++
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("stat %s: %v", key, err)
+				failed++
+				continue
+			}
+			if dstInfo, err := dst.Stat(ctx, key); err == nil && dstInfo.Size == srcInfo.Size {
+				skipped++
+				continue
+			}
+			if *dryRun {
+				fmt.Printf("would copy %s (%d bytes)\n", key, srcInfo.Size)
+				copied++
+				continue
+			}
+			if err := storage.Copy(ctx, dst, src, key); err != nil {
+				log.Printf("copy %s: %v", key, err)
+				failed++
+				continue
+			}
+			copied++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Fatalf("Failed to list media: %v", err)
+	}
+
+	fmt.Printf("copied=%d skipped=%d missing=%d failed=%d\n", copied, skipped, missing, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -44,6 +44,7 @@ type testApp struct {
 	TokenManager *auth.TokenManager
 	SQLDB        *sql.DB
 	RDB          *redis.Client
+	stopWorkers  context.CancelFunc
 }
 
 func newTestApp(t *testing.T) *testApp {
@@ -109,8 +110,10 @@ func newTestAppWithAuthOptions(t *testing.T, authOpts service.AuthServiceOptions
 	}
 
 	mediaSvc := service.NewMediaService(store, mediaDir, nil)
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	go mediaSvc.RunWorkers(workerCtx, 1)
 
-	r.Get("/media/{mediaId}/image.png", mediaSvc.ServeImage)
+	r.Get("/media/{mediaId}/image.png", mediaSvc.ServePNG)
 	r.Get("/media/{mediaId}/image.webp", mediaSvc.ServeImage)
 
 	apiServer := handlers.API{
@@ -133,6 +136,7 @@ func newTestAppWithAuthOptions(t *testing.T, authOpts service.AuthServiceOptions
 		TokenManager: tokenManager,
 		SQLDB:        sqlDB,
 		RDB:          rdb,
+		stopWorkers:  stopWorkers,
 	}
 }
 
@@ -140,6 +144,9 @@ func (a *testApp) Close() {
 	if a == nil {
 		return
 	}
+	if a.stopWorkers != nil {
+		a.stopWorkers()
+	}
 	if a.Server != nil {
 		a.Server.Close()
 	}
@@ -371,7 +378,30 @@ func uploadMediaPNG(t *testing.T, client *http.Client, baseURL string, authz map
 		errBody := decodeJSON[map[string]any](t, resp)
 		t.Fatalf("upload media: expected 201, got %d (%v)", resp.StatusCode, errBody)
 	}
-	return decodeJSON[api.Media](t, resp)
+	return waitForMediaReady(t, client, baseURL, authz, decodeJSON[api.Media](t, resp))
+}
+
+// waitForMediaReady polls an uploaded media item until its conversion job
+// has finished and fails the test unless it became ready.
+func waitForMediaReady(t *testing.T, client *http.Client, baseURL string, authz map[string]string, media api.Media) api.Media {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for media.Status != nil && *media.Status == api.Processing {
+		if time.Now().After(deadline) {
+			t.Fatalf("media %s still processing", media.Id)
+		}
+		time.Sleep(100 * time.Millisecond)
+		resp := get(t, client, baseURL+"/api/v1/media/"+media.Id.String(), authz)
+		if resp.StatusCode != http.StatusOK {
+			errBody := decodeJSON[map[string]any](t, resp)
+			t.Fatalf("get media: expected 200, got %d (%v)", resp.StatusCode, errBody)
+		}
+		media = decodeJSON[api.Media](t, resp)
+	}
+	if media.Status == nil || *media.Status != api.Ready {
+		t.Fatalf("media %s not ready: %v", media.Id, media.Status)
+	}
+	return media
 }
 
 func uploadAvatarPNG(t *testing.T, client *http.Client, baseURL string, authz map[string]string) api.User {
@@ -1401,7 +1431,7 @@ func TestIntegration_Media_Upload_LargeImage_AutoResize(t *testing.T) {
 		errBody := decodeJSON[map[string]any](t, resp)
 		t.Fatalf("upload large image: expected 201, got %d (%v)", resp.StatusCode, errBody)
 	}
-	media := decodeJSON[api.Media](t, resp)
+	media := waitForMediaReady(t, client, base, a, decodeJSON[api.Media](t, resp))
 
 	// Verify the image was resized to maxOutputEdgePx (1920px)
 	// Original: 6000x4000 (aspect ratio 1.5)
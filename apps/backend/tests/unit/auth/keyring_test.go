@@ -0,0 +1,190 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"backend/internal/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newEdKey(t *testing.T, kid string) auth.SigningKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return auth.SigningKey{ID: kid, Alg: auth.AlgEdDSA, PrivateKey: priv}
+}
+
+func TestKeyring_EdDSAIssueAndParse(t *testing.T) {
+	kr, err := auth.NewKeyring(newEdKey(t, "k1"))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	m := auth.NewTokenManagerWithKeyring(kr, time.Minute)
+	uid := uuid.New()
+	tok, _, err := m.Issue(auth.User{ID: uid, Username: "alice"})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(tok, &auth.Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if parsed.Header["kid"] != "k1" || parsed.Header["alg"] != "EdDSA" {
+		t.Fatalf("unexpected header: %v", parsed.Header)
+	}
+
+	user, err := m.Parse(tok)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if user.ID != uid {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+}
+
+func TestKeyring_RotationKeepsOldTokensUntilRetired(t *testing.T) {
+	oldKey := auth.SigningKey{ID: "old", Alg: auth.AlgHS256, Secret: []byte("old-secret")}
+	kr, err := auth.NewKeyring(oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	m := auth.NewTokenManagerWithKeyring(kr, time.Minute)
+	oldTok, _, err := m.Issue(auth.User{ID: uuid.New(), Username: "alice"})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// Rotate: new active key, old key verify-only.
+	rotated, err := auth.NewKeyring(newEdKey(t, "new"), oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	kr.Replace(rotated)
+	if _, err := m.Parse(oldTok); err != nil {
+		t.Fatalf("old token should still verify: %v", err)
+	}
+	newTok, _, err := m.Issue(auth.User{ID: uuid.New(), Username: "bob"})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// Retire the old key.
+	oldKey.RetireAt = time.Now().Add(-time.Second)
+	retired, err := auth.NewKeyring(kr.Active(), oldKey)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	kr.Replace(retired)
+	if _, err := m.Parse(oldTok); err == nil {
+		t.Fatalf("expected token signed with retired key to be rejected")
+	}
+	if _, err := m.Parse(newTok); err != nil {
+		t.Fatalf("new token should verify: %v", err)
+	}
+}
+
+func TestKeyring_LegacyTokenWithoutKid(t *testing.T) {
+	m := auth.NewTokenManager([]byte("secret"), time.Minute)
+	claims := auth.Claims{
+		UserID:           uuid.New().String(),
+		Username:         "alice",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatalf("signed: %v", err)
+	}
+	if _, err := m.Parse(signed); err != nil {
+		t.Fatalf("expected legacy token to verify: %v", err)
+	}
+}
+
+func TestKeyring_RejectsAlgMismatchForKid(t *testing.T) {
+	ed := newEdKey(t, "ed")
+	kr, err := auth.NewKeyring(ed)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	m := auth.NewTokenManagerWithKeyring(kr, time.Minute)
+
+	// HS256 token claiming the EdDSA kid, keyed with the public key bytes.
+	claims := auth.Claims{UserID: uuid.New().String(), Username: "alice"}
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tok.Header["kid"] = "ed"
+	signed, err := tok.SignedString([]byte(ed.PrivateKey.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatalf("signed: %v", err)
+	}
+	if _, err := m.Parse(signed); err == nil {
+		t.Fatalf("expected alg mismatch to be rejected")
+	}
+
+	tok = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tok.Header["kid"] = "unknown"
+	signed, _ = tok.SignedString([]byte("x"))
+	if _, err := m.Parse(signed); err == nil {
+		t.Fatalf("expected unknown kid to be rejected")
+	}
+}
+
+func TestKeyring_JWKSPublishesOnlyEdDSA(t *testing.T) {
+	ed := newEdKey(t, "ed")
+	kr, err := auth.NewKeyring(ed, auth.SigningKey{ID: "hs", Alg: auth.AlgHS256, Secret: []byte("s")})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	set := kr.JWKS(time.Now())
+	if len(set.Keys) != 1 {
+		t.Fatalf("expected 1 key, got %d", len(set.Keys))
+	}
+	k := set.Keys[0]
+	if k.Kid != "ed" || k.Kty != "OKP" || k.Crv != "Ed25519" || k.Alg != "EdDSA" {
+		t.Fatalf("unexpected jwk: %+v", k)
+	}
+	want := base64.RawURLEncoding.EncodeToString(ed.PrivateKey.Public().(ed25519.PublicKey))
+	if k.X != want {
+		t.Fatalf("unexpected x: %s", k.X)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	doc := fmt.Sprintf(`{"active":"a","keys":[
+		{"kid":"a","alg":"EdDSA","private_key":%q},
+		{"kid":"b","alg":"HS256","secret":"0123456789abcdef0123456789abcdef","retire_at":"2030-01-01T00:00:00Z"}]}`,
+		base64.StdEncoding.EncodeToString(seed))
+	kr, err := auth.ParseKeyring([]byte(doc))
+	if err != nil {
+		t.Fatalf("ParseKeyring: %v", err)
+	}
+	if kr.Active().ID != "a" || kr.Active().Alg != auth.AlgEdDSA {
+		t.Fatalf("unexpected active key: %+v", kr.Active())
+	}
+	if _, ok := kr.Lookup("b", time.Now()); !ok {
+		t.Fatalf("expected verify-only key b")
+	}
+
+	bad := []string{
+		`{"active":"missing","keys":[{"kid":"a","alg":"HS256","secret":"0123456789abcdef0123456789abcdef"}]}`,
+		`{"active":"a","keys":[{"kid":"a","alg":"HS256","secret":"short"}]}`,
+		`{"active":"a","keys":[{"kid":"a","alg":"RS256"}]}`,
+		`{"active":"a","keys":[{"kid":"a","alg":"EdDSA","public_key":"` + base64.StdEncoding.EncodeToString(seed) + `"}]}`,
+	}
+	for _, b := range bad {
+		if _, err := auth.ParseKeyring([]byte(b)); err == nil {
+			t.Fatalf("expected error for %s", b)
+		}
+	}
+}
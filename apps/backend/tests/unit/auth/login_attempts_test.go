@@ -0,0 +1,87 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"backend/internal/auth"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSubnetOf(t *testing.T) {
+	cases := map[string]string{
+		"203.0.113.77":        "203.0.113.0/24",
+		"2001:db8:abcd:12::1": "2001:db8:abcd::/48",
+		"not-an-ip":           "",
+		"":                    "",
+	}
+	for in, want := range cases {
+		if got := auth.SubnetOf(in); got != want {
+			t.Fatalf("SubnetOf(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func exerciseLoginAttemptStore(t *testing.T, s auth.LoginAttemptStore) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for i := 1; i <= 3; i++ {
+		a, err := s.RecordFailure(ctx, "alice", "203.0.113.7", now, time.Hour)
+		if err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+		if a.Failures != i {
+			t.Fatalf("expected %d failures, got %d", i, a.Failures)
+		}
+	}
+
+	until := now.Add(10 * time.Minute)
+	if err := s.Lock(ctx, "alice", until); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	a, ok, err := s.Get(ctx, "alice")
+	if err != nil || !ok {
+		t.Fatalf("Get: ok=%v err=%v", ok, err)
+	}
+	if a.LockedUntil.Unix() != until.Unix() || a.LastIP != "203.0.113.7" {
+		t.Fatalf("unexpected attempt: %+v", a)
+	}
+
+	list, err := s.List(ctx)
+	if err != nil || len(list) != 1 || list[0].Username != "alice" {
+		t.Fatalf("List: %+v err=%v", list, err)
+	}
+
+	if err := s.Reset(ctx, "alice"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if _, ok, _ := s.Get(ctx, "alice"); ok {
+		t.Fatalf("expected record to be cleared")
+	}
+
+	for _, u := range []string{"a", "b", "b", "c"} {
+		if _, err := s.RecordSubnetFailure(ctx, "203.0.113.0/24", u, now, time.Minute); err != nil {
+			t.Fatalf("RecordSubnetFailure: %v", err)
+		}
+	}
+	subnets, err := s.ListSubnets(ctx)
+	if err != nil || len(subnets) != 1 || subnets[0].Usernames != 3 {
+		t.Fatalf("ListSubnets: %+v err=%v", subnets, err)
+	}
+}
+
+func TestMemoryLoginAttemptStore(t *testing.T) {
+	exerciseLoginAttemptStore(t, auth.NewMemoryLoginAttemptStore())
+}
+
+func TestRedisLoginAttemptStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+	exerciseLoginAttemptStore(t, auth.NewRedisLoginAttemptStore(rdb))
+}
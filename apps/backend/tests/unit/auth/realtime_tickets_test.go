@@ -0,0 +1,44 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"backend/internal/auth"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRealtimeTicketStore_SingleUseAndExpiry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+
+	stores := map[string]auth.RealtimeTicketStore{
+		"memory": auth.NewMemoryRealtimeTicketStore(),
+		"redis":  auth.NewRedisRealtimeTicketStore(rdb),
+	}
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			userID := uuid.New()
+			if err := s.Put(context.Background(), auth.RealtimeTicket{Ticket: "tkt", UserID: userID, IP: "192.0.2.1", ExpiresAtUTC: time.Now().UTC().Add(auth.RealtimeTicketTTL)}); err != nil {
+				t.Fatalf("put: %v", err)
+			}
+			got, ok := s.Take(context.Background(), "tkt")
+			if !ok || got.UserID != userID || got.IP != "192.0.2.1" {
+				t.Fatalf("take = %+v, %v", got, ok)
+			}
+			if _, ok := s.Take(context.Background(), "tkt"); ok {
+				t.Fatalf("expected ticket to be redeemable once")
+			}
+
+			_ = s.Put(context.Background(), auth.RealtimeTicket{Ticket: "expired", UserID: userID, ExpiresAtUTC: time.Now().UTC().Add(-time.Second)})
+			if _, ok := s.Take(context.Background(), "expired"); ok {
+				t.Fatalf("expected expired ticket to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package blurhash_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"backend/internal/blurhash"
+)
+
+func solid(width, height int, r, g, b byte) []byte {
+	return bytes.Repeat([]byte{r, g, b}, width*height)
+}
+
+func TestEncode_Black(t *testing.T) {
+	// Black has no energy at all: DC 0 and every AC term quantised to zero ("fQ").
+	got, err := blurhash.Encode(4, 3, 8, 6, solid(8, 6, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if want := "L00000" + strings.Repeat("fQ", 11); got != want {
+		t.Fatalf("Encode = %q, want %q", got, want)
+	}
+}
+
+func TestEncode_DCIsAverageColor(t *testing.T) {
+	got, err := blurhash.Encode(4, 3, 8, 6, solid(8, 6, 255, 255, 255))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	// Characters 2-5 hold the DC term, 0xFFFFFF in base83.
+	if dc := got[2:6]; dc != "TSUA" {
+		t.Fatalf("DC = %q in %q, want TSUA", dc, got)
+	}
+}
+
+func TestEncode_LengthFollowsComponents(t *testing.T) {
+	// Left half red, right half blue, so AC terms are non-zero.
+	const w, h = 16, 8
+	rgb := make([]byte, 0, w*h*3)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				rgb = append(rgb, 255, 0, 0)
+			} else {
+				rgb = append(rgb, 0, 0, 255)
+			}
+		}
+	}
+	got, err := blurhash.Encode(3, 4, w, h, rgb)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if want := 4 + 2*3*4; len(got) != want {
+		t.Fatalf("len(%q) = %d, want %d", got, len(got), want)
+	}
+	if got[0] != 'T' { // (3-1) + (4-1)*9 = 29
+		t.Fatalf("size flag = %q, want 'T'", got[0])
+	}
+	if strings.Count(got, "fQ") == 11 {
+		t.Fatalf("expected non-zero AC components, got %q", got)
+	}
+}
+
+func TestEncode_Validation(t *testing.T) {
+	if _, err := blurhash.Encode(0, 3, 1, 1, solid(1, 1, 0, 0, 0)); !errors.Is(err, blurhash.ErrInvalidComponents) {
+		t.Fatalf("components 0: err = %v", err)
+	}
+	if _, err := blurhash.Encode(4, 10, 1, 1, solid(1, 1, 0, 0, 0)); !errors.Is(err, blurhash.ErrInvalidComponents) {
+		t.Fatalf("components 10: err = %v", err)
+	}
+	if _, err := blurhash.Encode(4, 3, 2, 2, solid(1, 1, 0, 0, 0)); !errors.Is(err, blurhash.ErrInvalidPixels) {
+		t.Fatalf("short buffer: err = %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package geoip_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"backend/internal/geoip"
+)
+
+// The helpers below encode the small subset of the MaxMind DB data format
+// needed to build a test database by hand.
+
+func mmdbString(s string) []byte {
+	return append([]byte{byte(2<<5 | len(s))}, s...)
+}
+
+func mmdbUint16(v uint16) []byte {
+	return []byte{5<<5 | 2, byte(v >> 8), byte(v)}
+}
+
+func mmdbUint32(v uint32) []byte {
+	return []byte{6<<5 | 4, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func mmdbMap(pairs ...[]byte) []byte {
+	out := []byte{byte(7<<5 | len(pairs)/2)}
+	for _, p := range pairs {
+		out = append(out, p...)
+	}
+	return out
+}
+
+// buildDB returns a database with a single node whose left branch (first
+// address bit 0) points at a Tokyo record and whose right branch is empty.
+func buildDB(ipVersion uint16, recordSize uint16) []byte {
+	const nodeCount = 1
+	record := mmdbMap(
+		mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbString("JP")),
+		mmdbString("city"), mmdbMap(mmdbString("names"), mmdbMap(mmdbString("en"), mmdbString("Tokyo"))),
+	)
+	left := uint32(nodeCount + 16) // data offset 0
+	right := uint32(nodeCount)     // no data
+
+	var tree []byte
+	switch recordSize {
+	case 24:
+		tree = []byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)}
+	case 28:
+		tree = []byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>20)&0xF0 | byte(right>>24)&0x0F, byte(right >> 16), byte(right >> 8), byte(right)}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(tree)
+	buf.Write(make([]byte, 16))
+	buf.Write(record)
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	buf.Write(mmdbMap(
+		mmdbString("node_count"), mmdbUint32(nodeCount),
+		mmdbString("record_size"), mmdbUint16(recordSize),
+		mmdbString("ip_version"), mmdbUint16(ipVersion),
+	))
+	return buf.Bytes()
+}
+
+func TestReader_LookupIPv4Database(t *testing.T) {
+	r, err := geoip.New(buildDB(4, 24))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	loc, ok := r.Lookup(net.ParseIP("10.1.2.3"))
+	if !ok || loc.Country != "JP" || loc.City != "Tokyo" {
+		t.Fatalf("Lookup(10.1.2.3) = %+v, %v", loc, ok)
+	}
+	if _, ok := r.Lookup(net.ParseIP("192.0.2.1")); ok {
+		t.Fatalf("expected no match for 192.0.2.1")
+	}
+	if _, ok := r.Lookup(net.ParseIP("2001:db8::1")); ok {
+		t.Fatalf("expected IPv6 lookups to miss in an IPv4 database")
+	}
+}
+
+func TestReader_LookupIPv6Database(t *testing.T) {
+	r, err := geoip.New(buildDB(6, 28))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	// IPv4 addresses map into ::/96, whose first bit is 0.
+	if loc, ok := r.Lookup(net.ParseIP("203.0.113.9")); !ok || loc.Country != "JP" {
+		t.Fatalf("Lookup(203.0.113.9) = %+v, %v", loc, ok)
+	}
+	if _, ok := r.Lookup(net.ParseIP("8000::1")); ok {
+		t.Fatalf("expected no match for 8000::1")
+	}
+}
+
+func TestReader_NilAndInvalid(t *testing.T) {
+	var r *geoip.Reader
+	if _, ok := r.Lookup(net.ParseIP("10.0.0.1")); ok {
+		t.Fatalf("nil reader should not match")
+	}
+	if _, err := geoip.New([]byte("not a database")); err == nil {
+		t.Fatalf("expected error for missing metadata")
+	}
+}
@@ -0,0 +1,49 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/handlers"
+	"backend/internal/realtime"
+
+	"github.com/google/uuid"
+)
+
+func TestPutMePresence_HidesAndRequiresFlag(t *testing.T) {
+	hub := realtime.NewHub(nil)
+	apiHandler := handlers.API{Realtime: hub}
+	user := auth.User{ID: uuid.New(), Username: "alice"}
+	ctx := auth.WithUser(context.Background(), user)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/me/presence", strings.NewReader(body)).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		apiHandler.PutMePresence(rr, req)
+		return rr
+	}
+
+	if rr := put(`{}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("missing flag: status = %d, want 400", rr.Code)
+	}
+	if rr := put(`{"hidden":true}`); rr.Code != http.StatusOK {
+		t.Fatalf("hide: status = %d, body %s", rr.Code, rr.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/me/presence", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	apiHandler.GetMePresence(rr, req)
+	var settings api.PresenceSettings
+	if err := json.Unmarshal(rr.Body.Bytes(), &settings); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if rr.Code != http.StatusOK || !settings.Hidden {
+		t.Fatalf("GetMePresence = %d %+v, want hidden", rr.Code, settings)
+	}
+}
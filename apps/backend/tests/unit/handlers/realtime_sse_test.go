@@ -0,0 +1,216 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/handlers"
+	"backend/internal/realtime"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// sseMessage is one parsed Server-Sent Events message.
+type sseMessage struct {
+	id, event, data string
+}
+
+// readSSE returns the next message of the stream, skipping comments and
+// field-less blocks such as the retry hint.
+func readSSE(t *testing.T, r *bufio.Reader) sseMessage {
+	t.Helper()
+	done := make(chan sseMessage, 1)
+	go func() {
+		var msg sseMessage
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(done)
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case line == "":
+				if msg.data != "" {
+					done <- msg
+					return
+				}
+			case strings.HasPrefix(line, "id: "):
+				msg.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				msg.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	select {
+	case msg, ok := <-done:
+		if !ok {
+			t.Fatalf("stream closed")
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for SSE message")
+	}
+	return sseMessage{}
+}
+
+func startSSEServer(t *testing.T, opts handlers.WebSocketOptions) (*realtime.Hub, *httptest.Server) {
+	t.Helper()
+	hub := realtime.NewHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/sse/timeline", handlers.NewTimelineSSEHandler(hub, nil, opts))
+	mux.Handle("/sse/me", handlers.NewUserSSEHandler(hub, nil, opts))
+	mux.Handle("/ws/timeline", handlers.NewTimelineWebSocketHandler(hub, nil, opts))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return hub, srv
+}
+
+func openSSE(t *testing.T, url string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+// publishUntilReceived publishes a deletion and reads it from the stream.
+// Headers are only sent once the stream's client is registered, so nothing
+// is missed.
+func publishUntilReceived(t *testing.T, hub *realtime.Hub, r *bufio.Reader) sseMessage {
+	t.Helper()
+	postID := api.PostId(uuid.New())
+	if err := hub.Publish(context.Background(), realtime.Event{Type: realtime.EventPostDeleted, PostId: &postID}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	return readSSE(t, r)
+}
+
+func TestTimelineSSE_DeliversEventsWithIDs(t *testing.T) {
+	hub, srv := startSSEServer(t, handlers.WebSocketOptions{})
+	resp := openSSE(t, srv.URL+"/sse/timeline", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	msg := publishUntilReceived(t, hub, bufio.NewReader(resp.Body))
+	var event realtime.Event
+	if err := json.Unmarshal([]byte(msg.data), &event); err != nil {
+		t.Fatalf("unmarshal %q: %v", msg.data, err)
+	}
+	if event.Type != realtime.EventPostDeleted || event.Id == "" || msg.id != event.Id {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+}
+
+func TestTimelineSSE_ResumesFromLastEventID(t *testing.T) {
+	hub, srv := startSSEServer(t, handlers.WebSocketOptions{})
+	first := openSSE(t, srv.URL+"/sse/timeline", nil)
+	seen := publishUntilReceived(t, hub, bufio.NewReader(first.Body))
+	_ = first.Body.Close()
+
+	missed := api.PostId(uuid.New())
+	if err := hub.Publish(context.Background(), realtime.Event{Type: realtime.EventPostDeleted, PostId: &missed}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	resp := openSSE(t, srv.URL+"/sse/timeline", http.Header{"Last-Event-Id": {seen.id}})
+	r := bufio.NewReader(resp.Body)
+	msg := readSSE(t, r)
+	var event realtime.Event
+	if err := json.Unmarshal([]byte(msg.data), &event); err != nil {
+		t.Fatalf("unmarshal %q: %v", msg.data, err)
+	}
+	if event.PostId == nil || *event.PostId != missed {
+		t.Fatalf("replayed %+v, want deletion of %s", event, missed)
+	}
+	if ack := readSSE(t, r); ack.event != realtime.ReplyAck {
+		t.Fatalf("got %+v, want ack", ack)
+	}
+
+	// An unknown ID asks the client to resync.
+	resp = openSSE(t, srv.URL+"/sse/timeline?lastEventId=1-0", nil)
+	if msg := readSSE(t, bufio.NewReader(resp.Body)); msg.event != realtime.ReplyResync {
+		t.Fatalf("got %+v, want resync_required", msg)
+	}
+}
+
+func TestUserSSE_RequiresAuthentication(t *testing.T) {
+	_, srv := startSSEServer(t, handlers.WebSocketOptions{})
+	resp := openSSE(t, srv.URL+"/sse/me", nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestRealtimeSignedEvents_RequireEdDSAKey(t *testing.T) {
+	t.Setenv("REALTIME_SIGNING_SECRET", "secret-secret-secret-secret-secret")
+	_, srv := startSSEServer(t, handlers.WebSocketOptions{})
+	for _, path := range []string{"/sse/timeline?signed=1", "/ws/timeline?signed=1"} {
+		resp := openSSE(t, srv.URL+path, nil)
+		var body api.Error
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		if resp.StatusCode != http.StatusBadRequest || body.Code != "signed_events_unavailable" {
+			t.Fatalf("%s: status = %d, code = %q; want 400 signed_events_unavailable", path, resp.StatusCode, body.Code)
+		}
+	}
+}
+
+func TestRealtimeLimiter_SharedAcrossTransports(t *testing.T) {
+	opts := handlers.WebSocketOptions{MaxConnections: 1}
+	opts.Limiter = handlers.NewRealtimeLimiter(opts)
+	hub, srv := startSSEServer(t, opts)
+	resp := openSSE(t, srv.URL+"/sse/timeline", nil)
+	publishUntilReceived(t, hub, bufio.NewReader(resp.Body))
+
+	if second := openSSE(t, srv.URL+"/sse/timeline", nil); second.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second SSE status = %d, want 429", second.StatusCode)
+	}
+	// The websocket endpoint rejects before upgrading.
+	if ws := openSSE(t, srv.URL+"/ws/timeline", nil); ws.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("websocket status = %d, want 429", ws.StatusCode)
+	}
+}
+
+func TestTimelineWebSocket_NegotiatesCompression(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "http://example.test")
+	for _, enabled := range []bool{false, true} {
+		_, srv := startSSEServer(t, handlers.WebSocketOptions{Compression: enabled})
+		dialer := websocket.Dialer{EnableCompression: true}
+		conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/timeline", http.Header{"Origin": {"http://example.test"}})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		_ = conn.Close()
+		negotiated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+		if negotiated != enabled {
+			t.Fatalf("compression enabled=%v, negotiated=%v", enabled, negotiated)
+		}
+	}
+}
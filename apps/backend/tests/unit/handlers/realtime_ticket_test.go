@@ -0,0 +1,143 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/handlers"
+	"backend/internal/realtime"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+func issueRealtimeTicket(t *testing.T, apiHandler handlers.API, user auth.User, remoteAddr string) api.RealtimeTicket {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/realtime/ticket", nil)
+	req = req.WithContext(auth.WithUser(req.Context(), user))
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	apiHandler.PostRealtimeTicket(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	var ticket api.RealtimeTicket
+	if err := json.Unmarshal(rr.Body.Bytes(), &ticket); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if ticket.Ticket == "" || time.Until(ticket.ExpiresAt) > auth.RealtimeTicketTTL {
+		t.Fatalf("ticket = %+v", ticket)
+	}
+	return ticket
+}
+
+func TestPostRealtimeTicket_RequiresUser(t *testing.T) {
+	apiHandler := handlers.API{Realtime: realtime.NewHub(nil), RealtimeTickets: auth.NewMemoryRealtimeTicketStore()}
+	rr := httptest.NewRecorder()
+	apiHandler.PostRealtimeTicket(rr, httptest.NewRequest(http.MethodPost, "/api/v1/realtime/ticket", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rr.Code)
+	}
+}
+
+func TestTimelineWebSocket_RedeemsTicketOnce(t *testing.T) {
+	hub := realtime.NewHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	tickets := auth.NewMemoryRealtimeTicketStore()
+	apiHandler := handlers.API{Realtime: hub, RealtimeTickets: tickets}
+	srv := httptest.NewServer(handlers.NewTimelineWebSocketHandler(hub, nil, handlers.WebSocketOptions{Tickets: tickets}))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "?ticket="
+
+	user := auth.User{ID: uuid.New(), Username: "alice"}
+	ticket := issueRealtimeTicket(t, apiHandler, user, "127.0.0.1:1234")
+
+	// No Origin header, as sent by native clients.
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+ticket.Ticket, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, err := hub.Presence(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("presence: %v", err)
+		}
+		if status == api.Online {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ticket connection is not authenticated as %s", user.Username)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+ticket.Ticket, nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("reused ticket: err = %v, want 401", err)
+	}
+
+	elsewhere := issueRealtimeTicket(t, apiHandler, user, "203.0.113.9:1234")
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+elsewhere.Ticket, nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("ticket from another IP: err = %v, want 401", err)
+	}
+}
+
+func TestTimelineWebSocket_RateLimitedRequestKeepsTicket(t *testing.T) {
+	hub := realtime.NewHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	tickets := auth.NewMemoryRealtimeTicketStore()
+	apiHandler := handlers.API{Realtime: hub, RealtimeTickets: tickets}
+	opts := handlers.WebSocketOptions{Tickets: tickets, MaxConnections: 1}
+	opts.Limiter = handlers.NewRealtimeLimiter(opts)
+	srv := httptest.NewServer(handlers.NewTimelineWebSocketHandler(hub, nil, opts))
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "?ticket="
+
+	user := auth.User{ID: uuid.New(), Username: "alice"}
+	first := issueRealtimeTicket(t, apiHandler, user, "127.0.0.1:1234")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+first.Ticket, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	second := issueRealtimeTicket(t, apiHandler, user, "127.0.0.1:1234")
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+second.Ticket, nil); err == nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("over the limit: err = %v, want 429", err)
+	}
+
+	// Once the slot is free, a request that cannot be upgraded is turned
+	// away without using up the ticket.
+	_ = conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := http.Get(srv.URL + "?ticket=" + second.Ticket)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusBadRequest {
+			break
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || time.Now().After(deadline) {
+			t.Fatalf("plain GET status = %d, want 400", resp.StatusCode)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	conn, _, err = websocket.DefaultDialer.Dial(wsURL+second.Ticket, nil)
+	if err != nil {
+		t.Fatalf("ticket was used up by rejected requests: %v", err)
+	}
+	_ = conn.Close()
+}
@@ -96,8 +96,8 @@ func TestAPI_GetServerInfo_WithIcon(t *testing.T) {
 
 	// Mock the GetMediaByID query
 	createdAt := time.Date(2026, 1, 22, 0, 0, 0, 0, time.UTC)
-	rows := sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at"}).
-		AddRow(iconMediaID, uuid.New(), "image", "webp", int32(400), int32(400), createdAt)
+	rows := sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at", "blob_hash"}).
+		AddRow(iconMediaID, uuid.New(), "image", "webp", int32(400), int32(400), createdAt, nil)
 	mock.ExpectQuery(`-- name: GetMediaByID`).
 		WithArgs(iconMediaID).
 		WillReturnRows(rows)
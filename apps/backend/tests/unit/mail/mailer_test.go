@@ -0,0 +1,164 @@
+package mail_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/mail"
+)
+
+// fakeSMTP is a minimal SMTP stand-in that accepts a single message.
+func fakeSMTP(t *testing.T) (addr string, received <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	out := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		write := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+
+		write("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					out <- data.String()
+					write("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				write("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				inData = true
+				write("354 go ahead")
+			case strings.HasPrefix(cmd, "QUIT"):
+				write("221 bye")
+				return
+			default:
+				write("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func TestSMTPMailer_DeliversToServer(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	m := mail.NewSMTPMailer(mail.SMTPOptions{Host: host, Port: port, From: "no-reply@example.com"})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, mail.Message{To: "alice@example.com", Subject: "Hello", Body: "line one\nline two"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if !strings.Contains(msg, "To: alice@example.com") || !strings.Contains(msg, "Subject: Hello") || !strings.Contains(msg, "line two") {
+			t.Fatalf("unexpected message: %q", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for message")
+	}
+}
+
+func TestFileMailer_AppendsMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := mail.NewFileMailer(path, "no-reply@example.com")
+
+	for _, subject := range []string{"first", "second"} {
+		if err := m.Send(context.Background(), mail.Message{To: "bob@example.com", Subject: subject, Body: "body"}); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.Contains(string(b), "Subject: first") || !strings.Contains(string(b), "Subject: second") {
+		t.Fatalf("expected both messages, got %q", string(b))
+	}
+}
+
+func TestMailer_RejectsHeaderInjection(t *testing.T) {
+	m := mail.NewFileMailer("", "no-reply@example.com")
+	err := m.Send(context.Background(), mail.Message{To: "a@example.com\r\nBcc: x@example.com", Subject: "hi"})
+	if !errors.Is(err, mail.ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage, got %v", err)
+	}
+}
+
+func TestNewFromEnv_UnknownDriver(t *testing.T) {
+	t.Setenv("MAIL_DRIVER", "pigeon")
+	if _, err := mail.NewFromEnv(); err == nil {
+		t.Fatalf("expected error for unknown driver")
+	}
+}
+
+func TestNewFromEnv_NoDriverDisablesMail(t *testing.T) {
+	t.Setenv("MAIL_DRIVER", "")
+	m, err := mail.NewFromEnv()
+	if err != nil {
+		t.Fatalf("NewFromEnv: %v", err)
+	}
+	if mail.Enabled(m) {
+		t.Fatalf("mailer without MAIL_DRIVER is enabled: %T", m)
+	}
+	if err := m.Send(context.Background(), mail.Message{To: "bob@example.com", Subject: "hi"}); !errors.Is(err, mail.ErrDisabled) {
+		t.Fatalf("Send() error = %v, want ErrDisabled", err)
+	}
+}
+
+func TestLogMailer_OmitsBody(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	t.Setenv("MAIL_DRIVER", "log")
+	m, err := mail.NewFromEnv()
+	if err != nil {
+		t.Fatalf("NewFromEnv: %v", err)
+	}
+	body := "https://example.com/reset-password?token=secret-token"
+	if err := m.Send(context.Background(), mail.Message{To: "bob@example.com", Subject: "Reset your password", Body: body}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Reset your password") {
+		t.Fatalf("log does not mention the message: %s", buf.String())
+	}
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Fatalf("log contains the message body: %s", buf.String())
+	}
+}
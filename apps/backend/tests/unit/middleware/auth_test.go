@@ -112,3 +112,50 @@ func TestOptionalAuth_ValidToken_SetsUser(t *testing.T) {
 		t.Fatalf("expected handler to be called")
 	}
 }
+
+func TestOptionalAuth_MediaCookie_SetsUserWithoutRefresh(t *testing.T) {
+	tm := auth.NewTokenManager([]byte("secret"), time.Minute)
+	uid := uuid.New()
+	token, _, err := tm.Issue(auth.User{ID: uid, Username: "alice"})
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+
+	h := middleware.OptionalAuth(tm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.UserFromContext(r.Context())
+		if !ok || user.ID != uid {
+			t.Fatalf("expected user %s in context, got %+v", uid, user)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/media/"+uuid.NewString()+"/image.webp", nil)
+	req.AddCookie(&http.Cookie{Name: "ciel_auth", Value: token})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if got := rr.Header().Values("Set-Cookie"); len(got) != 0 {
+		t.Fatalf("expected no cookie refresh, got %v", got)
+	}
+}
+
+func TestOptionalAuth_MediaInvalidToken_PassesThrough(t *testing.T) {
+	h := middleware.OptionalAuth(auth.NewTokenManager([]byte("secret"), time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := auth.UserFromContext(r.Context()); ok {
+			t.Fatalf("expected no user in context")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/media/"+uuid.NewString()+"/image.webp", nil)
+	req.Header.Set("Authorization", "Bearer invalid-token")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/middleware"
+
+	"github.com/google/uuid"
+)
+
+func TestOptionalAuth_OAuthToken_ScopeEnforced(t *testing.T) {
+	tm := auth.NewTokenManager([]byte("secret"), time.Minute)
+	mw := middleware.OptionalAuth(tm)
+	tok, _, err := tm.IssueOAuth(auth.User{ID: uuid.New(), Username: "alice"}, "ciel_app", []string{"openid", "read"}, time.Minute)
+	if err != nil {
+		t.Fatalf("IssueOAuth: %v", err)
+	}
+
+	var gotScopes []string
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotScopes, _ = auth.TokenScopesFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/v1/timeline", http.StatusOK},
+		{http.MethodGet, "/api/v1/posts/123", http.StatusOK},
+		{http.MethodGet, "/api/v1/oauth/userinfo", http.StatusOK},
+		{http.MethodPost, "/api/v1/posts", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/me", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/me/email", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/auth/password/change", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/admin/users", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/oauth/authorize", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Fatalf("%s %s: expected %d, got %d", tc.method, tc.path, tc.want, rr.Code)
+		}
+		if tc.want == http.StatusForbidden && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("%s %s: expected WWW-Authenticate challenge", tc.method, tc.path)
+		}
+	}
+	if len(gotScopes) != 2 {
+		t.Fatalf("expected scopes in context, got %v", gotScopes)
+	}
+}
+
+func TestOptionalAuth_OAuthToken_PermissionScopeAllowsWrite(t *testing.T) {
+	tm := auth.NewTokenManager([]byte("secret"), time.Minute)
+	mw := middleware.OptionalAuth(tm)
+	tok, _, err := tm.IssueOAuth(auth.User{ID: uuid.New(), Username: "alice"}, "ciel_app", []string{"posts_create", "reactions_add"}, time.Minute)
+	if err != nil {
+		t.Fatalf("IssueOAuth: %v", err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPost, "/api/v1/posts", http.StatusOK},
+		{http.MethodPost, "/api/v1/posts/abc/reactions", http.StatusOK},
+		{http.MethodDelete, "/api/v1/posts/abc/reactions", http.StatusForbidden},
+		{http.MethodDelete, "/api/v1/posts/abc", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Fatalf("%s %s: expected %d, got %d", tc.method, tc.path, tc.want, rr.Code)
+		}
+	}
+}
+
+func TestOptionalAuth_OAuthToken_NotAcceptedAsSession(t *testing.T) {
+	tm := auth.NewTokenManager([]byte("secret"), time.Minute)
+	tok, _, err := tm.IssueOAuth(auth.User{ID: uuid.New(), Username: "alice"}, "ciel_app", []string{"read"}, time.Minute)
+	if err != nil {
+		t.Fatalf("IssueOAuth: %v", err)
+	}
+	if _, err := tm.Parse(tok); err == nil {
+		t.Fatalf("expected Parse to reject delegated token")
+	}
+
+	// Delegated tokens in the session cookie are rejected too.
+	mw := middleware.OptionalAuth(tm)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/timeline", nil)
+	req.AddCookie(&http.Cookie{Name: "ciel_auth", Value: tok})
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+}
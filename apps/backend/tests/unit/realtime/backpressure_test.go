@@ -0,0 +1,245 @@
+package realtime_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/realtime"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+func startMemoryHub(t testing.TB, shards int) *realtime.Hub {
+	t.Helper()
+	hub := realtime.NewHubWithOptions(nil, realtime.HubOptions{Shards: shards})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+	return hub
+}
+
+func publishReaction(t testing.TB, hub *realtime.Hub, postID api.PostId, count int) {
+	t.Helper()
+	event := realtime.Event{
+		Type:           realtime.EventReactionUpdated,
+		ReactionCounts: &api.ReactionCounts{PostId: postID, Reactions: []api.ReactionCount{{Emoji: "👍", Count: count}}},
+	}
+	if err := hub.Publish(context.Background(), event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+}
+
+// waitStats polls the hub's counters until cond holds.
+func waitStats(t *testing.T, hub *realtime.Hub, cond func(realtime.Stats) bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond(hub.Stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats never matched: %+v", hub.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHub_CoalescesReactionUpdatesForLaggingClient(t *testing.T) {
+	hub := startMemoryHub(t, 1)
+	client := realtime.NewStreamClient(hub, uuid.Nil, []string{realtime.TopicTimeline})
+	hub.Register(client)
+
+	postID := api.PostId(uuid.New())
+	publishReaction(t, hub, postID, 1)
+	publishReaction(t, hub, postID, 2)
+	deleted := publishDeleted(t, hub, 1)[0]
+	publishReaction(t, hub, postID, 3)
+	waitStats(t, hub, func(s realtime.Stats) bool { return s.CoalescedEvents == 2 })
+
+	// Only the latest counts are left, behind the deletion.
+	if got := receiveEvent(t, client); got.PostId == nil || *got.PostId != deleted {
+		t.Fatalf("first event = %+v, want deletion", got)
+	}
+	got := receiveEvent(t, client)
+	if got.ReactionCounts == nil || got.ReactionCounts.Reactions[0].Count != 3 {
+		t.Fatalf("second event = %+v, want latest counts", got)
+	}
+	select {
+	case payload := <-client.SendChan():
+		t.Fatalf("unexpected payload %s", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHub_DropsSlowConsumerOnly(t *testing.T) {
+	hub := startMemoryHub(t, 2)
+	slow := realtime.NewStreamClient(hub, uuid.Nil, []string{realtime.TopicTimeline})
+	fast := realtime.NewStreamClient(hub, uuid.Nil, []string{realtime.TopicTimeline})
+	hub.Register(slow)
+	hub.Register(fast)
+
+	// The fast client reads each batch before the next one is published,
+	// so only the slow client's queue overflows.
+	received := make(chan struct{}, 100)
+	go func() {
+		for range fast.SendChan() {
+			received <- struct{}{}
+		}
+	}()
+	for batch := 0; batch < 5; batch++ {
+		publishDeleted(t, hub, 100)
+		for i := 0; i < 100; i++ {
+			select {
+			case <-received:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("fast client stopped receiving")
+			}
+		}
+	}
+	waitStats(t, hub, func(s realtime.Stats) bool { return s.DroppedClients == 1 })
+	if code := slow.CloseCode(); code != realtime.CloseSlowConsumer {
+		t.Fatalf("close code = %d, want %d", code, realtime.CloseSlowConsumer)
+	}
+	if _, ok := <-slow.SendChan(); ok {
+		t.Fatalf("slow client still receives events")
+	}
+	if code := fast.CloseCode(); code != 0 {
+		t.Fatalf("fast client closed with %d", code)
+	}
+}
+
+func TestHub_SlowWebsocketReceivesCloseCode(t *testing.T) {
+	hub := startMemoryHub(t, 1)
+	conn := dialHub(t, hub)
+	waitStats(t, hub, func(s realtime.Stats) bool { return s.Connections == 1 })
+
+	// Large events fill the socket buffers, then the client's queue.
+	content := strings.Repeat("x", 64<<10)
+	for i := 0; hub.Stats().DroppedClients == 0; i++ {
+		if i == 2000 {
+			t.Fatalf("client was never dropped")
+		}
+		event := realtime.Event{Type: realtime.EventPostCreated, Post: &api.Post{Id: api.PostId(uuid.New()), Content: content}}
+		if err := hub.Publish(context.Background(), event); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, realtime.CloseSlowConsumer) {
+				t.Fatalf("read error = %v, want close %d", err, realtime.CloseSlowConsumer)
+			}
+			return
+		}
+	}
+}
+
+func TestHub_ShardsDeliverToEveryClient(t *testing.T) {
+	hub := startMemoryHub(t, 4)
+	userID := uuid.New()
+	var clients []*realtime.Client
+	for i := 0; i < 8; i++ {
+		client := realtime.NewStreamClient(hub, userID, []string{realtime.TopicTimeline})
+		hub.Register(client)
+		clients = append(clients, client)
+	}
+
+	deleted := publishDeleted(t, hub, 1)[0]
+	mediaID := api.MediaId(uuid.New())
+	reason := "invalid image"
+	if err := hub.PublishToUser(context.Background(), userID, realtime.Event{Type: realtime.EventMediaFailed, MediaId: &mediaID, Reason: &reason}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	for i, client := range clients {
+		if got := receiveEvent(t, client); got.PostId == nil || *got.PostId != deleted {
+			t.Fatalf("client %d got %+v, want deletion", i, got)
+		}
+		if got := receiveEvent(t, client); got.MediaId == nil || *got.MediaId != mediaID {
+			t.Fatalf("client %d got %+v, want media event", i, got)
+		}
+	}
+}
+
+// BenchmarkHubFanOut publishes events to thousands of fake clients that
+// read as fast as they can, with a few that never read. Each op is one
+// event delivered to every reading client; more shards help once
+// GOMAXPROCS is above one.
+func BenchmarkHubFanOut(b *testing.B) {
+	const clients = 5000
+	const stalled = 50
+	for _, shards := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			hub := startMemoryHub(b, shards)
+			var wg sync.WaitGroup
+			for i := 0; i < clients; i++ {
+				client := realtime.NewStreamClient(hub, uuid.Nil, []string{realtime.TopicTimeline})
+				hub.Register(client)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					n := 0
+					for range client.SendChan() {
+						if n++; n == b.N {
+							return
+						}
+					}
+				}()
+			}
+			for i := 0; i < stalled; i++ {
+				hub.Register(realtime.NewStreamClient(hub, uuid.Nil, []string{realtime.TopicTimeline}))
+			}
+
+			b.ResetTimer()
+			publishDeleted(b, hub, b.N)
+			wg.Wait()
+			b.StopTimer()
+			b.ReportMetric(float64(b.N*clients)/b.Elapsed().Seconds(), "deliveries/s")
+		})
+	}
+}
+
+// BenchmarkHubReactionStorm publishes reaction updates for a few posts to
+// clients that read slowly. Coalescing keeps them connected and caps what
+// they have to read.
+func BenchmarkHubReactionStorm(b *testing.B) {
+	const clients = 2000
+	hub := startMemoryHub(b, runtime.GOMAXPROCS(0))
+	done := make(chan struct{}, clients)
+	for i := 0; i < clients; i++ {
+		client := realtime.NewStreamClient(hub, uuid.Nil, []string{realtime.TopicTimeline})
+		hub.Register(client)
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for payload := range client.SendChan() {
+				if strings.Contains(string(payload), string(realtime.EventPostDeleted)) {
+					return
+				}
+				time.Sleep(100 * time.Microsecond)
+			}
+		}()
+	}
+	posts := make([]api.PostId, 10)
+	for i := range posts {
+		posts[i] = api.PostId(uuid.New())
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		publishReaction(b, hub, posts[i%len(posts)], i)
+	}
+	// A deletion marks the end of the storm for every client.
+	publishDeleted(b, hub, 1)
+	for i := 0; i < clients; i++ {
+		<-done
+	}
+	b.StopTimer()
+	stats := hub.Stats()
+	b.ReportMetric(float64(stats.DroppedClients), "dropped_clients")
+	b.ReportMetric(float64(stats.CoalescedEvents)/float64(b.N*clients), "coalesced_ratio")
+}
@@ -73,3 +73,84 @@ func assertHasKey(t *testing.T, raw map[string]json.RawMessage, key string) {
 		t.Fatalf("expected key %q", key)
 	}
 }
+
+func TestEventValidate_MediaEventsRequireUser(t *testing.T) {
+	mediaID := api.MediaId(uuid.New())
+	userID := uuid.New()
+	media := api.Media{Id: mediaID, Type: api.MediaTypeImage}
+
+	cases := []struct {
+		name    string
+		event   realtime.Event
+		wantErr bool
+	}{
+		{"ready", realtime.Event{Type: realtime.EventMediaReady, Media: &media, UserId: &userID}, false},
+		{"ready without user", realtime.Event{Type: realtime.EventMediaReady, Media: &media}, true},
+		{"ready without media", realtime.Event{Type: realtime.EventMediaReady, UserId: &userID}, true},
+		{"failed", realtime.Event{Type: realtime.EventMediaFailed, MediaId: &mediaID, UserId: &userID}, false},
+		{"failed without user", realtime.Event{Type: realtime.EventMediaFailed, MediaId: &mediaID}, true},
+	}
+	for _, tc := range cases {
+		if err := tc.event.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestEventValidate_ModerationAndProfileEvents(t *testing.T) {
+	postID := api.PostId(uuid.New())
+	mediaID := api.MediaId(uuid.New())
+	post := api.Post{Id: postID}
+	user := api.User{Id: uuid.New(), Username: "alice"}
+	termsVersion := 1
+	private := user
+	private.TermsVersion = &termsVersion
+
+	cases := []struct {
+		name    string
+		event   realtime.Event
+		wantErr bool
+	}{
+		{"hidden", realtime.Event{Type: realtime.EventPostHidden, PostId: &postID}, false},
+		{"hidden without post id", realtime.Event{Type: realtime.EventPostHidden}, true},
+		{"unhidden", realtime.Event{Type: realtime.EventPostUnhidden, Post: &post}, false},
+		{"unhidden without post", realtime.Event{Type: realtime.EventPostUnhidden, PostId: &postID}, true},
+		{"media deleted", realtime.Event{Type: realtime.EventMediaDeleted, MediaId: &mediaID}, false},
+		{"media deleted without media id", realtime.Event{Type: realtime.EventMediaDeleted}, true},
+		{"user updated", realtime.Event{Type: realtime.EventUserUpdated, User: &user}, false},
+		{"user updated without user", realtime.Event{Type: realtime.EventUserUpdated}, true},
+		{"user updated with agreement state", realtime.Event{Type: realtime.EventUserUpdated, User: &private}, true},
+	}
+	for _, tc := range cases {
+		if err := tc.event.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestEventValidate_EphemeralEvents(t *testing.T) {
+	typist, recipient := uuid.New(), uuid.New()
+	postTopic := realtime.PostTopic(uuid.New())
+	dmTopic := realtime.UserTopic(recipient)
+	other := uuid.New()
+
+	cases := []struct {
+		name    string
+		event   realtime.Event
+		wantErr bool
+	}{
+		{"presence", realtime.Event{Type: realtime.EventPresenceUpdated, Presence: &api.Presence{UserId: typist, Status: api.Away}}, false},
+		{"presence without presence", realtime.Event{Type: realtime.EventPresenceUpdated}, true},
+		{"reply typing", realtime.Event{Type: realtime.EventTyping, Typing: &realtime.Typing{UserId: typist, Topic: postTopic}}, false},
+		{"direct typing", realtime.Event{Type: realtime.EventTyping, Typing: &realtime.Typing{UserId: typist, Topic: dmTopic}, UserId: &recipient}, false},
+		{"direct typing broadcast", realtime.Event{Type: realtime.EventTyping, Typing: &realtime.Typing{UserId: typist, Topic: dmTopic}}, true},
+		{"direct typing to someone else", realtime.Event{Type: realtime.EventTyping, Typing: &realtime.Typing{UserId: typist, Topic: dmTopic}, UserId: &other}, true},
+		{"timeline typing", realtime.Event{Type: realtime.EventTyping, Typing: &realtime.Typing{UserId: typist, Topic: realtime.TopicTimeline}}, true},
+		{"typing without typing", realtime.Event{Type: realtime.EventTyping}, true},
+	}
+	for _, tc := range cases {
+		if err := tc.event.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: Validate() = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
@@ -52,3 +52,243 @@ func TestHubPublish_RedisPubSubDelivers(t *testing.T) {
 		t.Fatalf("timed out waiting for payload")
 	}
 }
+
+func TestHubPublish_UserEventReachesOnlyThatUser(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+
+	hub := realtime.NewHub(rdb)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	readyCtx, readyCancel := context.WithTimeout(context.Background(), time.Second)
+	defer readyCancel()
+	if !hub.WaitReady(readyCtx) {
+		t.Fatalf("hub subscription not ready")
+	}
+
+	owner := uuid.New()
+	ownerClient := realtime.NewUserClient(hub, nil, owner, nil)
+	otherClient := realtime.NewUserClient(hub, nil, uuid.New(), nil)
+	anonClient := realtime.NewClient(hub, nil, nil)
+	hub.Register(ownerClient)
+	hub.Register(otherClient)
+	hub.Register(anonClient)
+	waitUserSubscribed(t, mr, owner)
+
+	mediaID := api.MediaId(uuid.New())
+	reason := "invalid image"
+	event := realtime.Event{Type: realtime.EventMediaFailed, MediaId: &mediaID, Reason: &reason, UserId: &owner}
+	if err := hub.Publish(ctx, event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case payload := <-ownerClient.SendChan():
+		var got realtime.Event
+		if err := json.Unmarshal(payload, &got); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if got.Type != realtime.EventMediaFailed || got.MediaId == nil || *got.MediaId != mediaID {
+			t.Fatalf("unexpected event: %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for payload")
+	}
+
+	// The owner's delivery happens in the same fan-out pass, so anything
+	// sent to the others would already be queued.
+	select {
+	case payload := <-otherClient.SendChan():
+		t.Fatalf("other user received %s", payload)
+	case payload := <-anonClient.SendChan():
+		t.Fatalf("anonymous client received %s", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// waitUserSubscribed waits until some hub subscribed to the user's channel.
+func waitUserSubscribed(t *testing.T, mr *miniredis.Miniredis, userID uuid.UUID) {
+	t.Helper()
+	channel := "realtime:user:" + userID.String()
+	deadline := time.Now().Add(time.Second)
+	for mr.PubSubNumSub(channel)[channel] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no subscription to %s", channel)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func startHub(t *testing.T, ctx context.Context, rdb *redis.Client) *realtime.Hub {
+	t.Helper()
+	hub := realtime.NewHub(rdb)
+	go hub.Run(ctx)
+	readyCtx, readyCancel := context.WithTimeout(ctx, time.Second)
+	defer readyCancel()
+	if !hub.WaitReady(readyCtx) {
+		t.Fatalf("hub subscription not ready")
+	}
+	return hub
+}
+
+func TestHubPublishToUser_CrossInstance(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The user is connected to the second instance only.
+	sender := startHub(t, ctx, rdb)
+	receiver := startHub(t, ctx, rdb)
+	userID := uuid.New()
+	client := realtime.NewUserClient(receiver, nil, userID, nil)
+	receiver.Register(client)
+	waitUserSubscribed(t, mr, userID)
+
+	mediaID := api.MediaId(uuid.New())
+	reason := "invalid image"
+	event := realtime.Event{Type: realtime.EventMediaFailed, MediaId: &mediaID, Reason: &reason}
+	if err := sender.PublishToUser(ctx, userID, event); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case payload := <-client.SendChan():
+		var got realtime.Event
+		if err := json.Unmarshal(payload, &got); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if got.UserId == nil || *got.UserId != userID || got.MediaId == nil || *got.MediaId != mediaID {
+			t.Fatalf("unexpected event: %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for payload")
+	}
+}
+
+func TestHub_DropsEventAddressedToAnotherUsersChannel(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := startHub(t, ctx, rdb)
+	owner := uuid.New()
+	victim := uuid.New()
+	ownerClient := realtime.NewUserClient(hub, nil, owner, nil)
+	victimClient := realtime.NewUserClient(hub, nil, victim, nil)
+	hub.Register(ownerClient)
+	hub.Register(victimClient)
+	waitUserSubscribed(t, mr, owner)
+	waitUserSubscribed(t, mr, victim)
+
+	mediaID := api.MediaId(uuid.New())
+	reason := "invalid image"
+	payload, err := json.Marshal(realtime.Event{Type: realtime.EventMediaFailed, MediaId: &mediaID, Reason: &reason, UserId: &victim})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.Publish("realtime:user:"+owner.String(), string(payload))
+
+	select {
+	case payload := <-ownerClient.SendChan():
+		t.Fatalf("owner received %s", payload)
+	case payload := <-victimClient.SendChan():
+		t.Fatalf("victim received %s", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHub_ResumeFromRedisStream(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Events published by another instance are replayed too.
+	sender := startHub(t, ctx, rdb)
+	hub := startHub(t, ctx, rdb)
+	observer := realtime.NewClient(hub, nil, nil)
+	hub.Register(observer)
+
+	publishDeleted(t, sender, 1)
+	seen := receiveEvent(t, observer)
+	if seen.Id == "" {
+		t.Fatalf("event has no id: %+v", seen)
+	}
+	missed := publishDeleted(t, sender, 3)
+	for range missed {
+		receiveEvent(t, observer)
+	}
+	assertResumes(t, hub, seen.Id, missed)
+}
+
+func TestHubPublishOnce_DeliversEachKeyOnce(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	memory := realtime.NewHub(nil)
+	go memory.Run(ctx)
+	for name, hub := range map[string]*realtime.Hub{
+		"redis":  startHub(t, ctx, rdb),
+		"memory": memory,
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := realtime.NewClient(hub, nil, nil)
+			hub.Register(client)
+
+			key := uuid.NewString()
+			postID := api.PostId(uuid.New())
+			event := realtime.Event{Type: realtime.EventPostDeleted, PostId: &postID}
+			for i := 0; i < 3; i++ {
+				if err := hub.PublishOnce(ctx, key, event); err != nil {
+					t.Fatalf("publish once: %v", err)
+				}
+			}
+			if got := receiveEvent(t, client); got.PostId == nil || *got.PostId != postID {
+				t.Fatalf("unexpected event: %+v", got)
+			}
+			select {
+			case payload := <-client.SendChan():
+				t.Fatalf("duplicate delivered: %s", payload)
+			case <-time.After(50 * time.Millisecond):
+			}
+			if err := hub.PublishOnce(ctx, "", event); err == nil {
+				t.Fatalf("expected error for empty key")
+			}
+		})
+	}
+}
+
+func TestHubStats_CountsConnections(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := realtime.NewHub(nil)
+	go hub.Run(ctx)
+
+	client := realtime.NewClient(hub, nil, nil)
+	hub.Register(client)
+	waitConnections(t, hub, 1)
+	hub.Unregister(client)
+	waitConnections(t, hub, 0)
+}
+
+func waitConnections(t *testing.T, hub *realtime.Hub, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for hub.Stats().Connections != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("connections = %d, want %d", hub.Stats().Connections, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,246 @@
+package realtime_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/realtime"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// dialUserHub serves hub over a websocket as userID and returns a
+// connected client.
+func dialUserHub(t *testing.T, hub *realtime.Hub, userID uuid.UUID) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		realtime.NewUserClient(hub, conn, userID, nil).Run()
+	}))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// watchTopic registers a hub-side client subscribed to topic only.
+func watchTopic(t *testing.T, hub *realtime.Hub, topic string) *realtime.Client {
+	t.Helper()
+	client := realtime.NewStreamClient(hub, uuid.Nil, []string{topic})
+	hub.Register(client)
+	return client
+}
+
+func waitPresence(t *testing.T, hub *realtime.Hub, userID uuid.UUID, want api.PresenceStatus) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, err := hub.Presence(context.Background(), userID)
+		if err != nil {
+			t.Fatalf("presence: %v", err)
+		}
+		if status == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("presence = %s, want %s", status, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func expectPresenceEvent(t *testing.T, client *realtime.Client, userID uuid.UUID, want api.PresenceStatus) {
+	t.Helper()
+	event := receiveEvent(t, client)
+	if event.Type != realtime.EventPresenceUpdated || event.Presence == nil ||
+		event.Presence.UserId != userID || event.Presence.Status != want {
+		t.Fatalf("event = %+v, want presence %s", event, want)
+	}
+	if event.Id != "" {
+		t.Fatalf("presence event has ID %q; it must not be retained", event.Id)
+	}
+}
+
+func TestPresence_FollowsConnectionsAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := startHub(t, ctx, rdb)
+	b := startHub(t, ctx, rdb)
+	userID := uuid.New()
+	watcher := watchTopic(t, b, realtime.UserTopic(userID))
+	waitConnections(t, b, 1)
+
+	first := realtime.NewStreamClient(a, userID, nil)
+	a.Register(first)
+	expectPresenceEvent(t, watcher, userID, api.Online)
+	waitPresence(t, b, userID, api.Online)
+
+	// A second connection on another instance keeps the user online when
+	// the first one leaves.
+	second := realtime.NewStreamClient(b, userID, nil)
+	b.Register(second)
+	waitConnections(t, b, 2)
+	a.Unregister(first)
+	waitConnections(t, a, 0)
+	b.Unregister(second)
+	expectPresenceEvent(t, watcher, userID, api.Offline)
+	waitPresence(t, a, userID, api.Offline)
+}
+
+func TestPresence_AwayAndHidden(t *testing.T) {
+	hub := startMemoryHub(t, 2)
+	userID := uuid.New()
+	watcher := watchTopic(t, hub, realtime.UserTopic(userID))
+
+	conn := dialUserHub(t, hub, userID)
+	expectPresenceEvent(t, watcher, userID, api.Online)
+
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpPresence, Status: string(api.Away), ID: "1"}); r.Type != realtime.ReplyAck {
+		t.Fatalf("presence reply = %+v", r)
+	}
+	expectPresenceEvent(t, watcher, userID, api.Away)
+
+	ctx := context.Background()
+	if err := hub.SetPresenceHidden(ctx, userID, true); err != nil {
+		t.Fatalf("hide: %v", err)
+	}
+	expectPresenceEvent(t, watcher, userID, api.Offline)
+	if hidden, err := hub.PresenceHidden(ctx, userID); err != nil || !hidden {
+		t.Fatalf("PresenceHidden() = %v, %v", hidden, err)
+	}
+
+	// Status changes of hidden users are not announced.
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpPresence, Status: string(api.Online)}); r.Type != realtime.ReplyAck {
+		t.Fatalf("presence reply = %+v", r)
+	}
+	waitPresence(t, hub, userID, api.Offline)
+
+	if err := hub.SetPresenceHidden(ctx, userID, false); err != nil {
+		t.Fatalf("show: %v", err)
+	}
+	expectPresenceEvent(t, watcher, userID, api.Online)
+}
+
+func TestPresence_StoppedInstanceMarksUsersOffline(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	a := startHub(t, stopCtx, rdb)
+	b := startHub(t, ctx, rdb)
+	userID := uuid.New()
+	watcher := watchTopic(t, b, realtime.UserTopic(userID))
+	waitConnections(t, b, 1)
+
+	a.Register(realtime.NewStreamClient(a, userID, nil))
+	expectPresenceEvent(t, watcher, userID, api.Online)
+
+	// The user goes offline as the instance stops, not once its entry
+	// expires.
+	stop()
+	expectPresenceEvent(t, watcher, userID, api.Offline)
+	waitPresence(t, b, userID, api.Offline)
+}
+
+func TestTyping_ReachesPostSubscribersAndRecipient(t *testing.T) {
+	hub := startMemoryHub(t, 2)
+	typist, recipient := uuid.New(), uuid.New()
+	postID := uuid.New()
+	thread := watchTopic(t, hub, realtime.PostTopic(postID))
+	inbox := realtime.NewStreamClient(hub, recipient, nil)
+	hub.Register(inbox)
+	waitConnections(t, hub, 2)
+
+	conn := dialUserHub(t, hub, typist)
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpTyping, Topic: realtime.PostTopic(postID)}); r.Type != realtime.ReplyAck {
+		t.Fatalf("typing reply = %+v", r)
+	}
+	event := receiveEvent(t, thread)
+	if event.Type != realtime.EventTyping || event.Typing == nil ||
+		event.Typing.UserId != typist || event.Typing.Topic != realtime.PostTopic(postID) {
+		t.Fatalf("reply typing event = %+v", event)
+	}
+
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpTyping, Topic: realtime.UserTopic(recipient)}); r.Type != realtime.ReplyAck {
+		t.Fatalf("typing reply = %+v", r)
+	}
+	// The recipient's own presence event may come first.
+	for {
+		event = receiveEvent(t, inbox)
+		if event.Type != realtime.EventPresenceUpdated {
+			break
+		}
+	}
+	if event.Type != realtime.EventTyping || event.Typing == nil || event.Typing.UserId != typist ||
+		event.UserId == nil || *event.UserId != recipient {
+		t.Fatalf("direct message typing event = %+v", event)
+	}
+}
+
+func TestTyping_RateLimited(t *testing.T) {
+	hub := startMemoryHub(t, 1)
+	conn := dialUserHub(t, hub, uuid.New())
+	topic := realtime.PostTopic(uuid.New())
+
+	limited := false
+	for range 10 {
+		r := sendCommand(t, conn, realtime.Command{Op: realtime.OpTyping, Topic: topic})
+		if r.Type == realtime.ReplyError {
+			if r.Code != "rate_limited" {
+				t.Fatalf("reply = %+v", r)
+			}
+			limited = true
+			break
+		}
+	}
+	if !limited {
+		t.Fatalf("typing burst was not rate-limited")
+	}
+	// Other commands are not limited.
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpPing, ID: "p"}); r.Type != realtime.ReplyPong {
+		t.Fatalf("ping reply = %+v", r)
+	}
+}
+
+func TestTyping_NotPublishedForHiddenUsers(t *testing.T) {
+	hub := startMemoryHub(t, 2)
+	typist := uuid.New()
+	postID := uuid.New()
+	thread := watchTopic(t, hub, realtime.PostTopic(postID))
+	if err := hub.SetPresenceHidden(context.Background(), typist, true); err != nil {
+		t.Fatalf("hide: %v", err)
+	}
+
+	conn := dialUserHub(t, hub, typist)
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpTyping, Topic: realtime.PostTopic(postID)}); r.Type != realtime.ReplyAck {
+		t.Fatalf("typing reply = %+v", r)
+	}
+	select {
+	case payload := <-thread.SendChan():
+		t.Fatalf("typing of a hidden user was published: %s", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,240 @@
+package realtime_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/realtime"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// dialHub serves hub over a websocket and returns a connected client.
+func dialHub(t *testing.T, hub *realtime.Hub) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		realtime.NewClient(hub, conn, nil).Run()
+	}))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func sendCommand(t *testing.T, conn *websocket.Conn, cmd realtime.Command) realtime.Reply {
+	t.Helper()
+	if err := conn.WriteJSON(cmd); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var reply realtime.Reply
+	readJSON(t, conn, &reply)
+	return reply
+}
+
+func readJSON(t *testing.T, conn *websocket.Conn, v any) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if err := json.Unmarshal(msg, v); err != nil {
+		t.Fatalf("unmarshal %s: %v", msg, err)
+	}
+}
+
+func TestClientProtocol_SubscriptionsRouteEvents(t *testing.T) {
+	hub := realtime.NewHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	conn := dialHub(t, hub)
+
+	watched := api.PostId(uuid.New())
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpSubscribe, Topic: "post:" + watched.String(), ID: "1"}); r.Type != realtime.ReplyAck || r.ID != "1" {
+		t.Fatalf("subscribe reply = %+v", r)
+	}
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpUnsubscribe, Topic: realtime.TopicTimeline, ID: "2"}); r.Type != realtime.ReplyAck || r.ID != "2" {
+		t.Fatalf("unsubscribe reply = %+v", r)
+	}
+
+	// Only the event for the watched post is delivered.
+	other := api.PostId(uuid.New())
+	for _, id := range []api.PostId{other, watched} {
+		if err := hub.Publish(ctx, realtime.Event{Type: realtime.EventPostDeleted, PostId: &id}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	var got realtime.Event
+	readJSON(t, conn, &got)
+	if got.Type != realtime.EventPostDeleted || got.PostId == nil || *got.PostId != watched {
+		t.Fatalf("unexpected event: %+v", got)
+	}
+
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpPing, ID: "3"}); r.Type != realtime.ReplyPong || r.ID != "3" {
+		t.Fatalf("ping reply = %+v", r)
+	}
+}
+
+func TestClientProtocol_RejectsInvalidCommands(t *testing.T) {
+	hub := realtime.NewHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	conn := dialHub(t, hub)
+
+	cases := []struct {
+		cmd  realtime.Command
+		code string
+	}{
+		{realtime.Command{Op: realtime.OpSubscribe, Topic: "everything", ID: "a"}, "invalid_topic"},
+		{realtime.Command{Op: "publish", ID: "b"}, "invalid_command"},
+		{realtime.Command{Op: realtime.OpPing, ID: strings.Repeat("x", 65)}, "invalid_command"},
+		{realtime.Command{Op: realtime.OpTyping, Topic: "hashtag:go", ID: "c"}, "invalid_topic"},
+		{realtime.Command{Op: realtime.OpPresence, Status: "busy", ID: "d"}, "invalid_command"},
+		{realtime.Command{Op: realtime.OpTyping, Topic: realtime.PostTopic(uuid.New()), ID: "e"}, "unauthorized"},
+	}
+	for _, tc := range cases {
+		r := sendCommand(t, conn, tc.cmd)
+		if r.Type != realtime.ReplyError || r.Code != tc.code {
+			t.Errorf("%+v: reply = %+v, want %s", tc.cmd, r, tc.code)
+		}
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var r realtime.Reply
+	readJSON(t, conn, &r)
+	if r.Type != realtime.ReplyError || r.Code != "invalid_command" {
+		t.Fatalf("malformed reply = %+v", r)
+	}
+}
+
+func TestClientProtocol_SubscriptionLimit(t *testing.T) {
+	hub := realtime.NewHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	conn := dialHub(t, hub)
+
+	// The timeline subscription counts towards the limit.
+	for i := 1; i < realtime.MaxSubscriptions; i++ {
+		r := sendCommand(t, conn, realtime.Command{Op: realtime.OpSubscribe, Topic: "hashtag:t" + strconv.Itoa(i)})
+		if r.Type != realtime.ReplyAck {
+			t.Fatalf("subscription %d: reply = %+v", i, r)
+		}
+	}
+	r := sendCommand(t, conn, realtime.Command{Op: realtime.OpSubscribe, Topic: "hashtag:more"})
+	if r.Type != realtime.ReplyError || r.Code != "too_many_subscriptions" {
+		t.Fatalf("reply = %+v, want too_many_subscriptions", r)
+	}
+	// Re-subscribing to a held topic is not a new subscription.
+	if r := sendCommand(t, conn, realtime.Command{Op: realtime.OpSubscribe, Topic: "hashtag:t1"}); r.Type != realtime.ReplyAck {
+		t.Fatalf("resubscribe reply = %+v", r)
+	}
+}
+
+// publishDeleted publishes post deletions and returns their post IDs.
+func publishDeleted(t testing.TB, hub *realtime.Hub, n int) []api.PostId {
+	t.Helper()
+	ids := make([]api.PostId, n)
+	for i := range ids {
+		ids[i] = api.PostId(uuid.New())
+		if err := hub.Publish(context.Background(), realtime.Event{Type: realtime.EventPostDeleted, PostId: &ids[i]}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	return ids
+}
+
+// receiveEvent reads the next event delivered to a hub-side client.
+func receiveEvent(t *testing.T, client *realtime.Client) realtime.Event {
+	t.Helper()
+	select {
+	case payload := <-client.SendChan():
+		var event realtime.Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for event")
+	}
+	return realtime.Event{}
+}
+
+// assertResumes resumes after lastEventID on a new connection and expects
+// the deletions of want, then the ack.
+func assertResumes(t *testing.T, hub *realtime.Hub, lastEventID string, want []api.PostId) {
+	t.Helper()
+	conn := dialHub(t, hub)
+	if err := conn.WriteJSON(realtime.Command{Op: realtime.OpResume, LastEventID: lastEventID, ID: "r"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	prev := lastEventID
+	for _, postID := range want {
+		var got realtime.Event
+		readJSON(t, conn, &got)
+		if got.PostId == nil || *got.PostId != postID {
+			t.Fatalf("replayed %+v, want deletion of %s", got, postID)
+		}
+		if got.Id == "" || got.Id <= prev {
+			t.Fatalf("event id %q does not follow %q", got.Id, prev)
+		}
+		prev = got.Id
+	}
+	var r realtime.Reply
+	readJSON(t, conn, &r)
+	if r.Type != realtime.ReplyAck || r.ID != "r" {
+		t.Fatalf("resume reply = %+v", r)
+	}
+}
+
+func TestClientProtocol_ResumeReplaysMissedEvents(t *testing.T) {
+	hub := realtime.NewHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	observer := realtime.NewClient(hub, nil, nil)
+	hub.Register(observer)
+
+	publishDeleted(t, hub, 1)
+	seen := receiveEvent(t, observer)
+	missed := publishDeleted(t, hub, 3)
+	assertResumes(t, hub, seen.Id, missed)
+}
+
+func TestClientProtocol_ResumeRequiresResyncForUnknownGap(t *testing.T) {
+	hub := realtime.NewHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+	publishDeleted(t, hub, 2)
+	conn := dialHub(t, hub)
+
+	r := sendCommand(t, conn, realtime.Command{Op: realtime.OpResume, LastEventID: "1-0", ID: "r"})
+	if r.Type != realtime.ReplyResync || r.ID != "r" {
+		t.Fatalf("reply = %+v, want resync_required", r)
+	}
+	r = sendCommand(t, conn, realtime.Command{Op: realtime.OpResume, LastEventID: "latest"})
+	if r.Type != realtime.ReplyError || r.Code != "invalid_command" {
+		t.Fatalf("reply = %+v, want invalid_command", r)
+	}
+}
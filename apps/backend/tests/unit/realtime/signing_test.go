@@ -0,0 +1,204 @@
+package realtime_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/realtime"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func hmacKey(id, secret string) auth.SigningKey {
+	return auth.SigningKey{ID: id, Alg: auth.AlgHS256, Secret: []byte(secret)}
+}
+
+func mustKeyring(t *testing.T, active auth.SigningKey, verifyOnly ...auth.SigningKey) *auth.Keyring {
+	t.Helper()
+	keys, err := auth.NewKeyring(active, verifyOnly...)
+	if err != nil {
+		t.Fatalf("keyring: %v", err)
+	}
+	return keys
+}
+
+func TestSigner_VerifiesKeysDuringRotation(t *testing.T) {
+	payload := []byte(`{"type":"post_deleted"}`)
+	oldKey := hmacKey("2026-09", "old-secret-old-secret-old-secret")
+	newKey := hmacKey("2026-10", "new-secret-new-secret-new-secret")
+
+	before := realtime.NewSigner(mustKeyring(t, oldKey))
+	kid, sig := before.Sign(payload)
+	if kid != oldKey.ID {
+		t.Fatalf("kid = %q, want %q", kid, oldKey.ID)
+	}
+
+	// The new key is active; the old one still verifies messages from
+	// instances that have not rolled over yet.
+	during := realtime.NewSigner(mustKeyring(t, newKey, oldKey))
+	if !during.Verify(payload, kid, sig) {
+		t.Fatalf("message signed with the previous key was rejected")
+	}
+	newKid, newSig := during.Sign(payload)
+	if newKid != newKey.ID || !during.Verify(payload, newKid, newSig) {
+		t.Fatalf("message signed with the active key was rejected")
+	}
+	if during.Verify([]byte(`{"type":"post_created"}`), newKid, newSig) {
+		t.Fatalf("tampered payload was accepted")
+	}
+	if during.Verify(payload, oldKey.ID, newSig) {
+		t.Fatalf("signature was accepted under another key ID")
+	}
+
+	retired := oldKey
+	retired.RetireAt = time.Now().Add(-time.Minute)
+	after := realtime.NewSigner(mustKeyring(t, newKey, retired))
+	if after.Verify(payload, kid, sig) {
+		t.Fatalf("message signed with a retired key was accepted")
+	}
+}
+
+func TestSigner_VerifiesLegacyMessagesWithoutKeyID(t *testing.T) {
+	payload := []byte(`{"type":"post_deleted"}`)
+	secret := "legacy-secret-legacy-secret-legacy"
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(payload)
+	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	signer := realtime.NewSigner(auth.NewHMACKeyring(auth.DefaultKeyID, []byte(secret)))
+	if !signer.Verify(payload, "", sig) {
+		t.Fatalf("legacy message was rejected")
+	}
+	other := realtime.NewSigner(auth.NewHMACKeyring(auth.DefaultKeyID, []byte("another-secret-another-secret-xx")))
+	if other.Verify(payload, "", sig) {
+		t.Fatalf("legacy message signed with another secret was accepted")
+	}
+}
+
+func TestSigner_CanSignEventsRequiresEdDSA(t *testing.T) {
+	if realtime.NewSigner(mustKeyring(t, hmacKey("k1", "secret-secret-secret-secret-secr"))).CanSignEvents() {
+		t.Fatalf("HS256 signer claims to sign events for clients")
+	}
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signer := realtime.NewSigner(mustKeyring(t, auth.SigningKey{ID: "ed", Alg: auth.AlgEdDSA, PrivateKey: priv}))
+	if !signer.CanSignEvents() {
+		t.Fatalf("EdDSA signer cannot sign events for clients")
+	}
+	if jwks := signer.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "ed" {
+		t.Fatalf("jwks = %+v, want the ed key", jwks)
+	}
+}
+
+func startSignedHub(t *testing.T, ctx context.Context, rdb *redis.Client, keys *auth.Keyring) *realtime.Hub {
+	t.Helper()
+	hub := realtime.NewHubWithOptions(rdb, realtime.HubOptions{Signer: realtime.NewSigner(keys)})
+	go hub.Run(ctx)
+	readyCtx, readyCancel := context.WithTimeout(ctx, time.Second)
+	defer readyCancel()
+	if !hub.WaitReady(readyCtx) {
+		t.Fatalf("hub subscription not ready")
+	}
+	return hub
+}
+
+func TestHub_DeliversAcrossInstancesDuringKeyRotation(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	oldKey := hmacKey("2026-09", "old-secret-old-secret-old-secret")
+	newKey := hmacKey("2026-10", "new-secret-new-secret-new-secret")
+	rolled := startSignedHub(t, ctx, rdb, mustKeyring(t, newKey, oldKey))
+	pending := startSignedHub(t, ctx, rdb, mustKeyring(t, oldKey, newKey))
+	stale := startSignedHub(t, ctx, rdb, mustKeyring(t, oldKey))
+
+	rolledClient := watchTopic(t, rolled, realtime.TopicTimeline)
+	pendingClient := watchTopic(t, pending, realtime.TopicTimeline)
+	staleClient := watchTopic(t, stale, realtime.TopicTimeline)
+
+	postID := api.PostId(uuid.New())
+	if err := rolled.Publish(ctx, realtime.Event{Type: realtime.EventPostDeleted, PostId: &postID}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	for _, client := range []*realtime.Client{rolledClient, pendingClient} {
+		if event := receiveEvent(t, client); event.PostId == nil || *event.PostId != postID {
+			t.Fatalf("event = %+v, want deletion of %s", event, postID)
+		}
+	}
+	select {
+	case payload := <-staleClient.SendChan():
+		t.Fatalf("instance without the signing key delivered %s", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Messages from the instance that has not rolled over yet still verify.
+	other := api.PostId(uuid.New())
+	if err := pending.Publish(ctx, realtime.Event{Type: realtime.EventPostDeleted, PostId: &other}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if event := receiveEvent(t, rolledClient); event.PostId == nil || *event.PostId != other {
+		t.Fatalf("event = %+v, want deletion of %s", event, other)
+	}
+}
+
+func TestHub_SignsEventsForClientsThatAsk(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	hub := realtime.NewHubWithOptions(nil, realtime.HubOptions{
+		Signer: realtime.NewSigner(mustKeyring(t, auth.SigningKey{ID: "ed", Alg: auth.AlgEdDSA, PrivateKey: priv})),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hub.Run(ctx)
+
+	signed := realtime.NewStreamClient(hub, uuid.Nil, []string{realtime.TopicTimeline})
+	signed.SignEvents()
+	hub.Register(signed)
+	plain := watchTopic(t, hub, realtime.TopicTimeline)
+
+	postID := api.PostId(uuid.New())
+	if err := hub.Publish(ctx, realtime.Event{Type: realtime.EventPostDeleted, PostId: &postID}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if event := receiveEvent(t, plain); event.PostId == nil || *event.PostId != postID {
+		t.Fatalf("plain client got %+v", event)
+	}
+
+	var msg realtime.SignedEvent
+	select {
+	case payload := <-signed.SendChan():
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for signed event")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(msg.Sig)
+	if err != nil || msg.Kid != "ed" || !ed25519.Verify(pub, []byte(msg.Payload), sig) {
+		t.Fatalf("signed event %+v does not verify", msg)
+	}
+	var event realtime.Event
+	if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if event.Type != realtime.EventPostDeleted || event.PostId == nil || *event.PostId != postID || event.Id == "" {
+		t.Fatalf("signed payload = %+v", event)
+	}
+}
@@ -0,0 +1,103 @@
+package realtime_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"backend/internal/api"
+	"backend/internal/realtime"
+
+	"github.com/google/uuid"
+)
+
+func TestParseTopic(t *testing.T) {
+	id := uuid.New()
+	valid := map[string]string{
+		"timeline":                             "timeline",
+		"user:" + id.String():                  realtime.UserTopic(id),
+		"post:" + strings.ToUpper(id.String()): realtime.PostTopic(id),
+		"hashtag:Golang":                       "hashtag:golang",
+		"hashtag:#日本語":                         "hashtag:日本語",
+	}
+	for raw, want := range valid {
+		got, err := realtime.ParseTopic(raw)
+		if err != nil || got != want {
+			t.Errorf("ParseTopic(%q) = %q, %v; want %q", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"", "timeline:all", "user:alice", "post:", "hashtag:", "hashtag:a b", "hashtag:" + strings.Repeat("a", 65)} {
+		if _, err := realtime.ParseTopic(raw); err == nil {
+			t.Errorf("ParseTopic(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestHashtags(t *testing.T) {
+	got := realtime.Hashtags("#Go is fun #go\n#日本、 #a_b x#no #")
+	if want := []string{"go", "日本", "a_b"}; !slices.Equal(got, want) {
+		t.Fatalf("Hashtags = %q, want %q", got, want)
+	}
+	if got := realtime.Hashtags("no tags here"); len(got) != 0 {
+		t.Fatalf("Hashtags = %q, want none", got)
+	}
+}
+
+func TestEventTopics(t *testing.T) {
+	authorID := uuid.New()
+	postID := api.PostId(uuid.New())
+	post := api.Post{Id: postID, Content: "hello #World", Author: api.User{Id: authorID}}
+	mediaID := api.MediaId(uuid.New())
+
+	cases := []struct {
+		event realtime.Event
+		want  []string
+	}{
+		{
+			realtime.Event{Type: realtime.EventPostCreated, Post: &post},
+			[]string{realtime.TopicTimeline, realtime.UserTopic(authorID), "hashtag:world"},
+		},
+		{
+			realtime.Event{Type: realtime.EventPostDeleted, PostId: &postID},
+			[]string{realtime.TopicTimeline, realtime.PostTopic(postID)},
+		},
+		{
+			realtime.Event{Type: realtime.EventReactionUpdated, ReactionCounts: &api.ReactionCounts{PostId: postID}},
+			[]string{realtime.TopicTimeline, realtime.PostTopic(postID)},
+		},
+		{
+			realtime.Event{Type: realtime.EventPostHidden, PostId: &postID},
+			[]string{realtime.TopicTimeline, realtime.PostTopic(postID)},
+		},
+		{
+			realtime.Event{Type: realtime.EventPostUnhidden, Post: &post},
+			[]string{realtime.TopicTimeline, realtime.UserTopic(authorID), "hashtag:world", realtime.PostTopic(postID)},
+		},
+		{
+			realtime.Event{Type: realtime.EventMediaDeleted, MediaId: &mediaID},
+			[]string{realtime.TopicTimeline},
+		},
+		{
+			realtime.Event{Type: realtime.EventUserUpdated, User: &post.Author},
+			[]string{realtime.TopicTimeline, realtime.UserTopic(authorID)},
+		},
+		{
+			realtime.Event{Type: realtime.EventPresenceUpdated, Presence: &api.Presence{UserId: authorID, Status: api.Online}},
+			[]string{realtime.UserTopic(authorID)},
+		},
+		{
+			realtime.Event{Type: realtime.EventTyping, Typing: &realtime.Typing{UserId: authorID, Topic: realtime.PostTopic(postID)}},
+			[]string{realtime.PostTopic(postID)},
+		},
+		// Addressed events bypass topics.
+		{
+			realtime.Event{Type: realtime.EventMediaFailed, MediaId: &mediaID, UserId: &authorID},
+			nil,
+		},
+	}
+	for _, tc := range cases {
+		if got := tc.event.Topics(); !slices.Equal(got, tc.want) {
+			t.Errorf("%s topics = %q, want %q", tc.event.Type, got, tc.want)
+		}
+	}
+}
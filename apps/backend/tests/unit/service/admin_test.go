@@ -593,8 +593,8 @@ func TestGetDashboardStats(t *testing.T) {
 	// Mock GetDashboardStats query
 	mock.ExpectQuery(`-- name: GetDashboardStats`).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"total_users", "total_posts", "total_media"}).
-				AddRow(int64(100), int64(500), int64(250)),
+			sqlmock.NewRows([]string{"total_users", "total_posts", "total_media", "total_media_bytes"}).
+				AddRow(int64(100), int64(500), int64(250), int64(1<<30)),
 		)
 
 	stats, err := svc.GetDashboardStats(context.Background())
@@ -605,6 +605,7 @@ func TestGetDashboardStats(t *testing.T) {
 	assert.Equal(t, 100, stats.TotalUsers)
 	assert.Equal(t, 500, stats.TotalPosts)
 	assert.Equal(t, 250, stats.TotalMedia)
+	assert.Equal(t, int64(1<<30), stats.TotalMediaBytes)
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("unmet expectations: %v", err)
@@ -0,0 +1,153 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/mail"
+	"backend/internal/repository"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(_ context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newEmailServiceWithMock(t *testing.T, tm *auth.TokenManager, mailer mail.Mailer) (*service.EmailService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	svc := service.NewEmailService(repository.NewStore(db), tm, mailer, service.EmailServiceOptions{SyncDelivery: true})
+	return svc, mock
+}
+
+func TestEmailService_RequestPasswordReset_UnknownEmailIsSilent(t *testing.T) {
+	mailer := &recordingMailer{}
+	svc, mock := newEmailServiceWithMock(t, nil, mailer)
+
+	mock.ExpectQuery(`-- name: GetUserByVerifiedEmail`).
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+
+	if err := svc.RequestPasswordReset(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatalf("expected nil error for unknown email, got %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Fatalf("expected no mail, got %d", len(mailer.sent))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEmailService_RequestPasswordReset_SendsLink(t *testing.T) {
+	t.Setenv("PUBLIC_BASE_URL", "https://example.com")
+	mailer := &recordingMailer{}
+	svc, mock := newEmailServiceWithMock(t, nil, mailer)
+	userID := uuid.New()
+
+	mock.ExpectQuery(`-- name: GetUserByVerifiedEmail`).
+		WithArgs("alice@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "email"}).AddRow(userID, "alice", "alice@example.com"))
+	mock.ExpectExec(`-- name: CreateAuthToken`).
+		WithArgs(userID, "password_reset", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := svc.RequestPasswordReset(context.Background(), " alice@example.com "); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("expected one mail, got %d", len(mailer.sent))
+	}
+	if mailer.sent[0].To != "alice@example.com" || !strings.Contains(mailer.sent[0].Body, "https://example.com/reset-password?token=") {
+		t.Fatalf("unexpected mail: %+v", mailer.sent[0])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEmailService_RequestPasswordReset_InvalidEmail(t *testing.T) {
+	svc, _ := newEmailServiceWithMock(t, nil, &recordingMailer{})
+	err := svc.RequestPasswordReset(context.Background(), "Alice <alice@example.com>")
+	assertServiceError(t, err, 400, "invalid_request")
+}
+
+func TestEmailService_RequestPasswordReset_DisabledWithoutMailer(t *testing.T) {
+	svc, mock := newEmailServiceWithMock(t, nil, nil)
+	err := svc.RequestPasswordReset(context.Background(), "alice@example.com")
+	assertServiceError(t, err, 503, "mail_unavailable")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEmailService_ResetPassword_RotatesCredentialsAndRevokesSessions(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() { _ = rdb.Close() }()
+	tm := auth.NewTokenManager([]byte("secret"), time.Minute)
+	tm.SetRedis(rdb)
+
+	svc, mock := newEmailServiceWithMock(t, tm, &recordingMailer{})
+	userID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`-- name: ConsumeAuthToken`).
+		WithArgs(sqlmock.AnyArg(), "password_reset").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "email"}).AddRow(userID, "alice@example.com"))
+	mock.ExpectExec(`-- name: UpdateAuthCredential`).
+		WithArgs(userID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`-- name: InvalidateAuthTokens`).
+		WithArgs(userID, "password_reset").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	if err := svc.ResetPassword(context.Background(), "token", "NewPassword123"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if !mr.Exists("token:revoke:" + userID.String()) {
+		t.Fatalf("expected sessions to be revoked")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestEmailService_ResetPassword_InvalidToken(t *testing.T) {
+	svc, mock := newEmailServiceWithMock(t, nil, &recordingMailer{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`-- name: ConsumeAuthToken`).
+		WithArgs(sqlmock.AnyArg(), "password_reset").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	err := svc.ResetPassword(context.Background(), "used-or-expired", "NewPassword123")
+	assertServiceError(t, err, 400, "invalid_token")
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
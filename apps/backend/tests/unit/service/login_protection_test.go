@@ -0,0 +1,115 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/repository"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newProtectedAuthService(t *testing.T, attempts auth.LoginAttemptStore) (*service.AuthService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	svc := service.NewAuthServiceWithOptions(repository.NewStore(db), auth.NewTokenManager([]byte("secret"), time.Minute), service.AuthServiceOptions{
+		LoginAttemptStore: attempts,
+		LoginProtection: service.LoginProtectionPolicy{
+			BackoffAfter: 3,
+			LockoutAfter: 3,
+		},
+	})
+	return svc, mock
+}
+
+func TestLoginFinish_LocksOutAfterRepeatedFailures(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	sessions := auth.NewMemoryLoginSessionStore()
+	now := time.Now()
+	svc := service.NewAuthServiceWithOptions(repository.NewStore(db), auth.NewTokenManager([]byte("secret"), time.Minute), service.AuthServiceOptions{
+		Now:               func() time.Time { return now },
+		LoginSessionStore: sessions,
+		LoginProtection:   service.LoginProtectionPolicy{BackoffAfter: 3, LockoutAfter: 3, LockoutDuration: time.Minute},
+	})
+
+	// Unknown usernames never get a session, so they are counted at the
+	// start step and locked out after as many failures as existing ones.
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery(`-- name: GetAuthByUsername`).WithArgs("ghost").WillReturnError(sql.ErrNoRows)
+		_, err := svc.LoginStart(context.Background(), api.LoginStartRequest{Username: "ghost", ClientNonce: "nonce"})
+		assertServiceError(t, err, 404, "not_found")
+	}
+	_, err = svc.LoginStart(context.Background(), api.LoginStartRequest{Username: "ghost", ClientNonce: "nonce"})
+	assertServiceError(t, err, 429, "too_many_attempts")
+
+	finish := func() error {
+		_ = sessions.Put(auth.LoginSession{SessionID: "sid", Username: "alice", ClientNonce: "c", ServerNonce: "s", ExpiresAtUTC: time.Now().UTC().Add(time.Minute)})
+		_, err := svc.LoginFinish(context.Background(), api.LoginFinishRequest{LoginSessionId: "sid", ClientFinalNonce: "wrong", ClientProof: "proof"})
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		assertServiceError(t, finish(), 401, "unauthorized")
+	}
+	// Locked: rejected before any lookup.
+	_, err = svc.LoginStart(context.Background(), api.LoginStartRequest{Username: "alice", ClientNonce: "nonce"})
+	assertServiceError(t, err, 429, "too_many_attempts")
+
+	// The lockout follows the service clock.
+	now = now.Add(2 * time.Minute)
+	mock.ExpectQuery(`-- name: GetAuthByUsername`).WithArgs("alice").WillReturnError(sql.ErrNoRows)
+	_, err = svc.LoginStart(context.Background(), api.LoginStartRequest{Username: "alice", ClientNonce: "nonce"})
+	assertServiceError(t, err, 404, "not_found")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestLoginStart_LockoutResponseIndependentOfExistence(t *testing.T) {
+	attempts := auth.NewMemoryLoginAttemptStore()
+	svc, mock := newProtectedAuthService(t, attempts)
+	until := time.Now().Add(time.Minute)
+	_ = attempts.Lock(context.Background(), "alice", until)
+	_ = attempts.Lock(context.Background(), "nobody", until)
+
+	_, errExisting := svc.LoginStart(context.Background(), api.LoginStartRequest{Username: "Alice", ClientNonce: "n"})
+	_, errMissing := svc.LoginStart(context.Background(), api.LoginStartRequest{Username: "nobody", ClientNonce: "n"})
+	assertServiceError(t, errExisting, 429, "too_many_attempts")
+	assertServiceError(t, errMissing, 429, "too_many_attempts")
+	if errExisting.Error() != errMissing.Error() {
+		t.Fatalf("lockout responses differ: %q vs %q", errExisting, errMissing)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unexpected queries: %v", err)
+	}
+}
+
+func TestUnlockLogin_ClearsLockout(t *testing.T) {
+	attempts := auth.NewMemoryLoginAttemptStore()
+	svc, _ := newProtectedAuthService(t, attempts)
+	_ = attempts.Lock(context.Background(), "alice", time.Now().Add(time.Hour))
+
+	if err := svc.UnlockLogin(context.Background(), auth.User{}, "ALICE"); err != nil {
+		t.Fatalf("UnlockLogin: %v", err)
+	}
+	overview, err := svc.LoginSecurityOverview(context.Background())
+	if err != nil {
+		t.Fatalf("LoginSecurityOverview: %v", err)
+	}
+	if len(overview.Accounts) != 0 {
+		t.Fatalf("expected no tracked accounts, got %+v", overview.Accounts)
+	}
+}
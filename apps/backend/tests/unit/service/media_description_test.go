@@ -0,0 +1,106 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+var bannedWordColumns = []string{"id", "pattern", "applies_to", "severity", "created_by", "created_at"}
+
+func expectMediaRow(mock sqlmock.Sqlmock, mediaID, ownerID uuid.UUID) {
+	mock.ExpectQuery(`-- name: GetMediaStatusByID`).WithArgs(mediaID).
+		WillReturnRows(sqlmock.NewRows(mediaStatusColumns).
+			AddRow(mediaID, ownerID, "image", "webp", 640, 480, sql.NullInt32{}, "old", 0.5, 0.5, "LEHV6nWB2yk8", "ready", time.Now()))
+}
+
+func TestMediaService_UpdateMedia(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+
+	svc := service.NewMediaService(store, t.TempDir(), nil)
+	ownerID := uuid.New()
+	mediaID := uuid.New()
+
+	expectMediaRow(mock, mediaID, ownerID)
+	mock.ExpectQuery(`-- name: ListBannedWords`).WithArgs("posts").
+		WillReturnRows(sqlmock.NewRows(bannedWordColumns).
+			AddRow(uuid.New(), "spam+", "posts", "flag", uuid.New(), time.Now()))
+	// Focus is unchanged because the request omits it.
+	mock.ExpectQuery(`-- name: UpdateMediaDescription`).
+		WithArgs(mediaID, ownerID, "A cat on a sofa", 0.5, 0.5).
+		WillReturnRows(sqlmock.NewRows(mediaStatusColumns).
+			AddRow(mediaID, ownerID, "image", "webp", 640, 480, sql.NullInt32{}, "A cat on a sofa", 0.5, 0.5, "LEHV6nWB2yk8", "ready", time.Now()))
+	mock.ExpectQuery(`-- name: ListMediaVariantsByMediaIDs`).
+		WillReturnRows(sqlmock.NewRows([]string{"media_id", "size", "width", "height"}))
+
+	alt := "  A cat on a sofa "
+	media, err := svc.UpdateMedia(context.Background(), ownerID, mediaID, api.UpdateMediaRequest{AltText: &alt})
+	if err != nil {
+		t.Fatalf("UpdateMedia: %v", err)
+	}
+	if media.AltText == nil || *media.AltText != "A cat on a sofa" {
+		t.Fatalf("altText = %v", media.AltText)
+	}
+	if media.Focus == nil || media.Focus.X != 0.5 || media.Focus.Y != 0.5 {
+		t.Fatalf("focus = %+v", media.Focus)
+	}
+	if media.Blurhash == nil || *media.Blurhash != "LEHV6nWB2yk8" {
+		t.Fatalf("blurhash = %v", media.Blurhash)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestMediaService_UpdateMedia_Rejected(t *testing.T) {
+	ownerID := uuid.New()
+	long := strings.Repeat("é", 1501)
+	banned := "Buy SPAMMM now"
+	literal := "contains a(b literally"
+
+	cases := []struct {
+		name    string
+		req     api.UpdateMediaRequest
+		pattern string // banned word returned for the alt text check
+	}{
+		{"alt text too long", api.UpdateMediaRequest{AltText: &long}, ""},
+		{"banned word regex", api.UpdateMediaRequest{AltText: &banned}, "spam+"},
+		{"banned word literal", api.UpdateMediaRequest{AltText: &literal}, "a(b"},
+		{"focus out of range", api.UpdateMediaRequest{Focus: &api.MediaFocus{X: 1.5, Y: 0}}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, mock, cleanup := newMockStore(t)
+			defer cleanup()
+			svc := service.NewMediaService(store, t.TempDir(), nil)
+			mediaID := uuid.New()
+
+			expectMediaRow(mock, mediaID, ownerID)
+			if tc.pattern != "" {
+				mock.ExpectQuery(`-- name: ListBannedWords`).
+					WillReturnRows(sqlmock.NewRows(bannedWordColumns).
+						AddRow(uuid.New(), tc.pattern, "all", "auto_delete", uuid.New(), time.Now()))
+			}
+
+			_, err := svc.UpdateMedia(context.Background(), ownerID, mediaID, tc.req)
+			var svcErr *service.Error
+			if !errors.As(err, &svcErr) || svcErr.Status != http.StatusBadRequest {
+				t.Fatalf("UpdateMedia = %v, want 400", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
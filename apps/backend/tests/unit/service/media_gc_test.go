@@ -0,0 +1,190 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backend/internal/service"
+	"backend/internal/storage"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeMediaObject stores a file under the media directory with the given
+// modification time.
+func writeMediaObject(t *testing.T, dir, key string, modTime time.Time) string {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(key), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestMediaKeyPrefix(t *testing.T) {
+	id := uuid.New()
+	assert.Equal(t, id.String(), service.MediaKeyPrefix(id, ""))
+	assert.Equal(t, "blobs/abc", service.MediaKeyPrefix(id, "abc"))
+	assert.Equal(t, []string{"blobs/abc/video.mp4", "blobs/abc/poster.webp"}, service.MediaObjectKeys("blobs/abc", "mp4"))
+}
+
+func TestMediaService_CollectGarbage(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+	dir := t.TempDir()
+	svc := service.NewMediaServiceWithOptions(store, service.MediaServiceOptions{
+		Objects:                  storage.NewFileStore(dir),
+		ReconcileObjectsInterval: time.Hour,
+	})
+	old := time.Now().Add(-48 * time.Hour)
+
+	orphanID := uuid.New()
+	blob := writeMediaObject(t, dir, "blobs/aaa/image.webp", old)
+	strayID := uuid.New()
+	stray := writeMediaObject(t, dir, strayID.String()+"/image.webp", old)
+	strayBlob := writeMediaObject(t, dir, "blobs/bbb/image.webp", old)
+	keptID := uuid.New()
+	kept := writeMediaObject(t, dir, keptID.String()+"/image.webp", old)
+	recent := writeMediaObject(t, dir, uuid.New().String()+"/image.webp", time.Now())
+	foreign := writeMediaObject(t, dir, "other/file.txt", old)
+
+	// Orphaned media: deleted under a row lock, then its blob is released.
+	mock.ExpectQuery(`-- name: ListOrphanMedia`).
+		WithArgs(uuid.Nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(orphanID))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`-- name: LockMediaByID`).WithArgs(orphanID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(orphanID))
+	mock.ExpectQuery(`-- name: DeleteOrphanMedia`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ext", "blob_hash"}).AddRow(orphanID, "webp", "aaa"))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`-- name: DeleteUnreferencedMediaBlob`).WithArgs("aaa").
+		WillReturnRows(sqlmock.NewRows([]string{"hash", "ext"}).AddRow("aaa", "webp"))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`-- name: ListOrphanMedia`).
+		WithArgs(orphanID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	mock.ExpectQuery(`-- name: ListUnreferencedMediaBlobs`).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+
+	// Reconciliation only lists blobs; no blob rows remain.
+	mock.ExpectQuery(`-- name: ListExistingMediaBlobHashes`).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+
+	res, err := svc.CollectGarbage(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, service.MediaGCResult{Media: 1, Blobs: 0, Objects: 1}, res)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	for _, p := range []string{blob, strayBlob} {
+		_, err := os.Stat(p)
+		assert.True(t, os.IsNotExist(err), "expected %s to be deleted", p)
+	}
+	for _, p := range []string{stray, kept, recent, foreign} {
+		_, err := os.Stat(p)
+		assert.NoError(t, err, "expected %s to be kept", p)
+	}
+}
+
+func TestMediaService_CollectGarbage_SkipsMediaAttachedMeanwhile(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+	dir := t.TempDir()
+	svc := service.NewMediaService(store, dir, nil)
+	id := uuid.New()
+	obj := writeMediaObject(t, dir, id.String()+"/image.webp", time.Now())
+
+	mock.ExpectQuery(`-- name: ListOrphanMedia`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`-- name: LockMediaByID`).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	mock.ExpectQuery(`-- name: DeleteOrphanMedia`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	mock.ExpectQuery(`-- name: ListOrphanMedia`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`-- name: ListUnreferencedMediaBlobs`).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+
+	res, err := svc.CollectGarbage(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, service.MediaGCResult{}, res)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	_, err = os.Stat(obj)
+	assert.NoError(t, err)
+}
+
+func TestMediaService_DeleteMedia_KeepsSharedBlob(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+	dir := t.TempDir()
+	svc := service.NewMediaService(store, dir, nil)
+	userID := uuid.New()
+	mediaID := uuid.New()
+	blob := writeMediaObject(t, dir, "blobs/aaa/image.webp", time.Now())
+
+	mock.ExpectQuery(`-- name: GetMediaByID`).WithArgs(mediaID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at", "blob_hash"}).
+			AddRow(mediaID, userID, "image", "webp", 64, 64, time.Now(), "aaa"))
+	mock.ExpectExec(`-- name: DeleteMediaByID`).WithArgs(mediaID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Another media row still references the blob.
+	mock.ExpectBegin()
+	mock.ExpectQuery(`-- name: DeleteUnreferencedMediaBlob`).WithArgs("aaa").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	assert.NoError(t, svc.DeleteMedia(context.Background(), userID, mediaID))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	_, err := os.Stat(blob)
+	assert.NoError(t, err)
+}
+
+func TestMediaService_CollectGarbage_ReconcilesOnlyWhenDue(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+	dir := t.TempDir()
+	stray := writeMediaObject(t, dir, "blobs/bbb/image.webp", time.Now().Add(-48*time.Hour))
+	expectNoGarbage := func() {
+		mock.ExpectQuery(`-- name: ListOrphanMedia`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(`-- name: ListUnreferencedMediaBlobs`).WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+	}
+
+	// Disabled by default.
+	disabled := service.NewMediaService(store, dir, nil)
+	expectNoGarbage()
+	_, err := disabled.CollectGarbage(context.Background())
+	assert.NoError(t, err)
+
+	svc := service.NewMediaServiceWithOptions(store, service.MediaServiceOptions{
+		Objects:                  storage.NewFileStore(dir),
+		ReconcileObjectsInterval: time.Hour,
+	})
+	expectNoGarbage()
+	mock.ExpectQuery(`-- name: ListExistingMediaBlobHashes`).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow("bbb"))
+	_, err = svc.CollectGarbage(context.Background())
+	assert.NoError(t, err)
+	// Not due again within the interval.
+	expectNoGarbage()
+	_, err = svc.CollectGarbage(context.Background())
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	_, err = os.Stat(stray)
+	assert.NoError(t, err)
+}
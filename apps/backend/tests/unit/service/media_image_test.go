@@ -0,0 +1,170 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"backend/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/webp"
+)
+
+var (
+	testRed  = color.NRGBA{R: 255, A: 255}
+	testBlue = color.NRGBA{B: 255, A: 255}
+)
+
+// testImage returns a w x h image whose left half is red and right half blue.
+func testImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			if x < w/2 {
+				img.Set(x, y, testRed)
+			} else {
+				img.Set(x, y, testBlue)
+			}
+		}
+	}
+	return img
+}
+
+// exifSegment returns a JPEG APP1 segment holding an EXIF orientation tag.
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1) // entries
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // padding, next IFD
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+// writeTestImage encodes img into dir/name as PNG or, for .jpg names, as
+// JPEG with app1 inserted after the SOI marker.
+func writeTestImage(t *testing.T, dir, name string, img image.Image, app1 []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	if filepath.Ext(name) == ".jpg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if app1 != nil {
+		data = append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+	}
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func decodeTestWebP(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := webp.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// assertNear checks a decoded pixel against a color, allowing for JPEG
+// compression and resampling.
+func assertNear(t *testing.T, want color.NRGBA, got color.Color) {
+	t.Helper()
+	c := color.NRGBAModel.Convert(got).(color.NRGBA)
+	near := func(a, b uint8) bool { return max(a, b)-min(a, b) < 40 }
+	assert.True(t, near(c.R, want.R) && near(c.G, want.G) && near(c.B, want.B), "got %v, want %v", c, want)
+}
+
+func TestGoImageProcessor_ConvertWebP_AppliesOrientationAndStripsMetadata(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var p service.GoImageProcessor
+	// Orientation 6 displays the stored image rotated 90 degrees clockwise,
+	// so its red left half ends up on top.
+	in := writeTestImage(t, dir, "in.jpg", testImage(64, 32), exifSegment(6))
+
+	w, h, err := p.Dimensions(ctx, in)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{32, 64}, []int{w, h})
+
+	out := filepath.Join(dir, "out.webp")
+	assert.NoError(t, p.ConvertWebP(ctx, in, out, 1920))
+	img := decodeTestWebP(t, out)
+	assert.Equal(t, image.Rect(0, 0, 32, 64), img.Bounds())
+	assertNear(t, testRed, img.At(16, 8))
+	assertNear(t, testBlue, img.At(16, 56))
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "Exif")
+	assert.NotContains(t, string(data), "EXIF")
+}
+
+func TestGoImageProcessor_ConvertWebP_Downscales(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var p service.GoImageProcessor
+	in := writeTestImage(t, dir, "in.png", testImage(400, 100), nil)
+
+	out := filepath.Join(dir, "out.webp")
+	assert.NoError(t, p.ConvertWebP(ctx, in, out, 200))
+	w, h, err := p.Dimensions(ctx, out)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{200, 50}, []int{w, h})
+
+	square := filepath.Join(dir, "square.webp")
+	assert.NoError(t, p.ConvertWebPSquare(ctx, in, square, 16))
+	w, h, err = p.Dimensions(ctx, square)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{16, 16}, []int{w, h})
+}
+
+func TestGoImageProcessor_RejectsOversizedImages(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var p service.GoImageProcessor
+	in := writeTestImage(t, dir, "wide.png", image.NewGray(image.Rect(0, 0, 16385, 1)), nil)
+
+	assert.Error(t, p.ConvertWebP(ctx, in, filepath.Join(dir, "out.webp"), 1920))
+	assert.Error(t, p.ConvertPNG(ctx, in, filepath.Join(dir, "out.png")))
+	_, err := p.SampleRGB(ctx, in, 32)
+	assert.Error(t, err)
+}
+
+func TestGoImageProcessor_SampleRGB(t *testing.T) {
+	dir := t.TempDir()
+	in := writeTestImage(t, dir, "in.png", testImage(64, 64), nil)
+
+	rgb, err := service.GoImageProcessor{}.SampleRGB(context.Background(), in, 4)
+	assert.NoError(t, err)
+	if assert.Len(t, rgb, 4*4*3) {
+		assertNear(t, testRed, color.NRGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255})
+		assertNear(t, testBlue, color.NRGBA{R: rgb[9], G: rgb[10], B: rgb[11], A: 255})
+	}
+}
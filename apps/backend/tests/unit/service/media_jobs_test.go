@@ -0,0 +1,110 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+// mediaStatusColumns are the columns of GetMediaStatusByID and
+// UpdateMediaDescription.
+var mediaStatusColumns = []string{"id", "user_id", "type", "ext", "width", "height", "duration_ms", "alt_text", "focus_x", "focus_y", "blurhash", "status", "created_at"}
+
+func TestPostsService_Create_RejectsUnreadyMedia(t *testing.T) {
+	cases := []struct {
+		name       string
+		processing int32
+		failed     int32
+		wantStatus int
+		wantCode   string
+	}{
+		{"processing", 1, 0, http.StatusConflict, "media_not_ready"},
+		{"failed", 0, 1, http.StatusBadRequest, "invalid_request"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, mock, cleanup := newMockStore(t)
+			defer cleanup()
+
+			publisher := &stubPublisher{}
+			svc := service.NewPostsService(store, nil, publisher)
+
+			userID := uuid.New()
+			postID := uuid.New()
+			mediaID := uuid.New()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`INSERT INTO posts`).
+				WithArgs(userID, "").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "deleted_at"}).
+					AddRow(postID, userID, "", time.Now(), sql.NullTime{}))
+			mock.ExpectQuery(`-- name: CountOwnedMediaByIDs`).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			mock.ExpectQuery(`-- name: CountUnreadyMediaByIDs`).
+				WillReturnRows(sqlmock.NewRows([]string{"processing", "failed"}).AddRow(tc.processing, tc.failed))
+			mock.ExpectRollback()
+
+			ids := []api.MediaId{mediaID}
+			_, err := svc.Create(context.Background(), auth.User{ID: userID}, api.CreatePostRequest{MediaIds: &ids})
+			var svcErr *service.Error
+			if !errors.As(err, &svcErr) || svcErr.Status != tc.wantStatus || svcErr.Code != tc.wantCode {
+				t.Fatalf("Create error = %v, want %d %s", err, tc.wantStatus, tc.wantCode)
+			}
+			if len(publisher.events) != 0 {
+				t.Fatalf("expected no events, got %+v", publisher.events)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestMediaService_GetMedia(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+
+	svc := service.NewMediaService(store, t.TempDir(), nil)
+	ownerID := uuid.New()
+	mediaID := uuid.New()
+
+	mock.ExpectQuery(`-- name: GetMediaStatusByID`).WithArgs(mediaID).
+		WillReturnRows(sqlmock.NewRows(mediaStatusColumns).
+			AddRow(mediaID, ownerID, "video", "mp4", 0, 0, sql.NullInt32{}, sql.NullString{}, sql.NullFloat64{}, sql.NullFloat64{}, sql.NullString{}, "processing", time.Now()))
+	mock.ExpectQuery(`-- name: ListMediaVariantsByMediaIDs`).
+		WillReturnRows(sqlmock.NewRows([]string{"media_id", "size", "width", "height"}))
+
+	media, err := svc.GetMedia(context.Background(), ownerID, mediaID)
+	if err != nil {
+		t.Fatalf("GetMedia: %v", err)
+	}
+	if media.Status == nil || *media.Status != api.Processing {
+		t.Fatalf("status = %v, want processing", media.Status)
+	}
+	if media.Type != api.MediaTypeVideo {
+		t.Fatalf("type = %q, want video", media.Type)
+	}
+
+	// Someone else's media is reported as missing.
+	mock.ExpectQuery(`-- name: GetMediaStatusByID`).WithArgs(mediaID).
+		WillReturnRows(sqlmock.NewRows(mediaStatusColumns).
+			AddRow(mediaID, ownerID, "image", "webp", 640, 480, sql.NullInt32{}, sql.NullString{}, sql.NullFloat64{}, sql.NullFloat64{}, sql.NullString{}, "ready", time.Now()))
+	_, err = svc.GetMedia(context.Background(), uuid.New(), mediaID)
+	var svcErr *service.Error
+	if !errors.As(err, &svcErr) || svcErr.Status != http.StatusNotFound {
+		t.Fatalf("GetMedia by other user = %v, want 404", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
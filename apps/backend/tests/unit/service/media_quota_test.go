@@ -0,0 +1,111 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+
+	"backend/internal/api"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestMediaService_GetStorageUsage(t *testing.T) {
+	cases := []struct {
+		name      string
+		quotas    []sql.NullInt64
+		wantQuota *int64
+	}{
+		{"no roles", nil, nil},
+		{"most generous role", []sql.NullInt64{{Int64: 100, Valid: true}, {Int64: 500, Valid: true}}, int64Ptr(500)},
+		{"unlimited role wins", []sql.NullInt64{{Int64: 100, Valid: true}, {}}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, mock, cleanup := newMockStore(t)
+			defer cleanup()
+			svc := service.NewMediaService(store, t.TempDir(), nil)
+			userID := uuid.New()
+
+			mock.ExpectQuery(`-- name: GetUserMediaUsage`).WithArgs(userID).
+				WillReturnRows(sqlmock.NewRows([]string{"media_count", "used_bytes"}).AddRow(3, 4096))
+			rows := sqlmock.NewRows([]string{"media_quota_bytes"})
+			for _, q := range tc.quotas {
+				rows.AddRow(q)
+			}
+			mock.ExpectQuery(`-- name: ListUserRoleMediaQuotas`).WithArgs(userID).WillReturnRows(rows)
+
+			usage, err := svc.GetStorageUsage(context.Background(), userID)
+			if err != nil {
+				t.Fatalf("GetStorageUsage: %v", err)
+			}
+			if usage.UsedBytes != 4096 || usage.MediaCount != 3 {
+				t.Fatalf("usage = %+v, want 4096 bytes in 3 items", usage)
+			}
+			if (usage.QuotaBytes == nil) != (tc.wantQuota == nil) ||
+				(tc.wantQuota != nil && *usage.QuotaBytes != *tc.wantQuota) {
+				t.Fatalf("quota = %v, want %v", usage.QuotaBytes, tc.wantQuota)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAdminService_UpdateRole_MediaQuota(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+	svc := service.NewAdminService(store, nil, nil)
+	roleColumns := []string{"id", "name", "description", "media_quota_bytes"}
+
+	// Setting a quota keeps the other fields.
+	mock.ExpectQuery(`-- name: GetRoleByID`).WithArgs("user").
+		WillReturnRows(sqlmock.NewRows(roleColumns).AddRow("user", "user", "Default user role", sql.NullInt64{}))
+	mock.ExpectExec(`-- name: UpdateRole`).
+		WithArgs("user", "user", "Default user role", sql.NullInt64{Int64: 1 << 30, Valid: true}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	role, err := svc.UpdateRole(context.Background(), "user", api.UpdateRoleRequest{MediaQuotaBytes: int64Ptr(1 << 30)})
+	if err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	if role.MediaQuotaBytes == nil || *role.MediaQuotaBytes != 1<<30 {
+		t.Fatalf("quota = %v, want 1 GiB", role.MediaQuotaBytes)
+	}
+
+	// Clearing makes the role unlimited.
+	clearQuota := true
+	mock.ExpectQuery(`-- name: GetRoleByID`).WithArgs("user").
+		WillReturnRows(sqlmock.NewRows(roleColumns).AddRow("user", "user", "", sql.NullInt64{Int64: 1 << 30, Valid: true}))
+	mock.ExpectExec(`-- name: UpdateRole`).
+		WithArgs("user", "user", "", sql.NullInt64{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	role, err = svc.UpdateRole(context.Background(), "user", api.UpdateRoleRequest{ClearMediaQuota: &clearQuota})
+	if err != nil {
+		t.Fatalf("UpdateRole: %v", err)
+	}
+	if role.MediaQuotaBytes != nil {
+		t.Fatalf("quota = %d, want unlimited", *role.MediaQuotaBytes)
+	}
+
+	// Negative quotas are rejected before writing.
+	mock.ExpectQuery(`-- name: GetRoleByID`).WithArgs("user").
+		WillReturnRows(sqlmock.NewRows(roleColumns).AddRow("user", "user", "", sql.NullInt64{}))
+	_, err = svc.UpdateRole(context.Background(), "user", api.UpdateRoleRequest{MediaQuotaBytes: int64Ptr(-1)})
+	var svcErr *service.Error
+	if !errors.As(err, &svcErr) || svcErr.Status != http.StatusBadRequest {
+		t.Fatalf("UpdateRole negative quota = %v, want 400", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backend/internal/repository"
+	"backend/internal/service"
+	"backend/internal/storage"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeImage_ConditionalAndHead(t *testing.T) {
+	rec := serveStoredMedia(t, "mp4", "video.mp4", map[string]string{"video.mp4": "0123456789"}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+	assert.NotEmpty(t, rec.Header().Get("Last-Modified"))
+	assert.Equal(t, "public, max-age=31536000, immutable", rec.Header().Get("Cache-Control"))
+
+	rec = serveStoredMedia(t, "mp4", "video.mp4", map[string]string{"video.mp4": "0123456789"},
+		http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	// A stale validator gets the full body.
+	rec = serveStoredMedia(t, "mp4", "video.mp4", map[string]string{"video.mp4": "0123456789"},
+		http.Header{"If-None-Match": {`"stale"`}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0123456789", rec.Body.String())
+}
+
+func TestServeImage_Head(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dir := t.TempDir()
+	id := uuid.New()
+	if err := os.MkdirAll(filepath.Join(dir, id.String()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, id.String(), "image.webp"), []byte("webpdata"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(`-- name: GetMediaByID`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at", "blob_hash"}).
+			AddRow(id, uuid.New(), "image", "webp", 64, 64, time.Now(), nil))
+	mock.ExpectQuery(`-- name: IsMediaPublic`).
+		WillReturnRows(sqlmock.NewRows([]string{"is_public"}).AddRow(sql.NullBool{Valid: true, Bool: true}))
+
+	svc := service.NewMediaService(repository.NewStore(db), dir, nil)
+	r := chi.NewRouter()
+	r.Head("/media/{mediaId}/image.webp", svc.ServeImage)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/media/"+id.String()+"/image.webp", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "8", rec.Header().Get("Content-Length"))
+	assert.Equal(t, "image/webp", rec.Header().Get("Content-Type"))
+	assert.NotEmpty(t, rec.Header().Get("ETag"))
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestServeImage_SignedURL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dir := t.TempDir()
+	ownerID := uuid.New()
+	id := uuid.New()
+	if err := os.MkdirAll(filepath.Join(dir, id.String()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, id.String(), "image.webp"), []byte("draft"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := service.NewMediaServiceWithOptions(repository.NewStore(db), service.MediaServiceOptions{
+		Objects:       storage.NewFileStore(dir),
+		URLSigningKey: []byte("test-signing-key"),
+	})
+
+	// The owner gets a signed URL for their unattached media.
+	mock.ExpectQuery(`-- name: GetMediaStatusByID`).WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "duration_ms", "alt_text", "focus_x", "focus_y", "blurhash", "status", "created_at"}).
+			AddRow(id, ownerID, "image", "webp", 64, 64, sql.NullInt32{}, sql.NullString{}, sql.NullFloat64{}, sql.NullFloat64{}, sql.NullString{}, "ready", time.Now()))
+	mock.ExpectQuery(`-- name: ListMediaVariantsByMediaIDs`).
+		WillReturnRows(sqlmock.NewRows([]string{"media_id", "size", "width", "height"}))
+	media, err := svc.GetMedia(context.Background(), ownerID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := url.Parse(media.Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Query().Get("sig") == "" || signed.Query().Get("exp") == "" {
+		t.Fatalf("url %q is not signed", media.Url)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/media/{mediaId}/image.webp", svc.ServeImage)
+	serve := func(query string) *httptest.ResponseRecorder {
+		mock.ExpectQuery(`-- name: GetMediaByID`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at", "blob_hash"}).
+				AddRow(id, ownerID, "image", "webp", 64, 64, time.Now(), nil))
+		mock.ExpectQuery(`-- name: IsMediaPublic`).
+			WillReturnRows(sqlmock.NewRows([]string{"is_public"}).AddRow(sql.NullBool{Valid: true, Bool: false}))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/"+id.String()+"/image.webp?"+query, nil))
+		return rec
+	}
+
+	rec := serve(signed.RawQuery)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "draft", rec.Body.String())
+	assert.Equal(t, "private, no-cache", rec.Header().Get("Cache-Control"))
+
+	q := signed.Query()
+	q.Set("sig", "AAAA")
+	assert.Equal(t, http.StatusUnauthorized, serve(q.Encode()).Code)
+
+	q = signed.Query()
+	q.Set("exp", "1")
+	assert.Equal(t, http.StatusUnauthorized, serve(q.Encode()).Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// servePNGWithoutFFmpeg requests the PNG of a stored public WebP with no
+// ffmpeg in PATH.
+func servePNGWithoutFFmpeg(t *testing.T, processor string, webp []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	t.Setenv("PATH", "")
+	rec := httptest.NewRecorder()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	id := uuid.New()
+	mock.ExpectQuery(`-- name: GetMediaByID`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at", "blob_hash"}).
+			AddRow(id, uuid.New(), "image", "webp", 64, 64, time.Now(), nil))
+	mock.ExpectQuery(`-- name: IsMediaPublic`).
+		WillReturnRows(sqlmock.NewRows([]string{"is_public"}).AddRow(sql.NullBool{Valid: true, Bool: true}))
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, id.String()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, id.String(), "image.webp"), webp, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewMediaServiceWithOptions(repository.NewStore(db), service.MediaServiceOptions{
+		Objects:        storage.NewFileStore(dir),
+		PNGCacheDir:    t.TempDir(),
+		ImageProcessor: processor,
+	})
+	r := chi.NewRouter()
+	r.Get("/media/{mediaId}/image.png", svc.ServePNG)
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/"+id.String()+"/image.png", nil))
+	return rec
+}
+
+func TestServePNG_UnavailableWithoutFFmpeg(t *testing.T) {
+	rec := servePNGWithoutFFmpeg(t, service.MediaImageProcessorFFmpeg, []byte("webp"))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestServePNG_GoProcessorFallback(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "source.png")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 8, 4))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	webp := filepath.Join(dir, "image.webp")
+	if err := (service.GoImageProcessor{}).ConvertWebP(context.Background(), src, webp, 1920); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(webp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := servePNGWithoutFFmpeg(t, service.MediaImageProcessorAuto, data)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	img, err := png.Decode(rec.Body)
+	if assert.NoError(t, err) {
+		assert.Equal(t, image.Rect(0, 0, 8, 4), img.Bounds())
+	}
+}
+
+func TestEvictPNGCache_DropsStaleThenOldest(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, size int, age time.Duration) {
+		p := filepath.Join(dir, "ab", name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("stale.png", 10, 48*time.Hour)
+	write("old.png", 60, 3*time.Hour)
+	write("recent.png", 60, time.Hour)
+
+	svc := service.NewMediaServiceWithOptions(nil, service.MediaServiceOptions{
+		PNGCacheDir:      dir,
+		PNGCacheMaxBytes: 100,
+		PNGCacheMaxAge:   24 * time.Hour,
+	})
+	n, err := svc.EvictPNGCache(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	for name, kept := range map[string]bool{"stale.png": false, "old.png": false, "recent.png": true} {
+		_, err := os.Stat(filepath.Join(dir, "ab", name))
+		assert.Equal(t, kept, err == nil, name)
+	}
+}
@@ -32,8 +32,8 @@ func TestDeleteMedia_Success(t *testing.T) {
 	mock.ExpectQuery(`-- name: GetMediaByID`).
 		WithArgs(mediaID).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at"}).
-				AddRow(mediaID, userID, "image", "webp", sql.NullInt32{Valid: true, Int32: 1920}, sql.NullInt32{Valid: true, Int32: 1080}, time.Now()),
+			sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at", "blob_hash"}).
+				AddRow(mediaID, userID, "image", "webp", sql.NullInt32{Valid: true, Int32: 1920}, sql.NullInt32{Valid: true, Int32: 1080}, time.Now(), nil),
 		)
 
 	// Mock DeleteMediaByID
@@ -100,8 +100,8 @@ func TestDeleteMedia_Forbidden(t *testing.T) {
 	mock.ExpectQuery(`-- name: GetMediaByID`).
 		WithArgs(mediaID).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at"}).
-				AddRow(mediaID, ownerID, "image", "webp", sql.NullInt32{Valid: true, Int32: 1920}, sql.NullInt32{Valid: true, Int32: 1080}, time.Now()),
+			sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at", "blob_hash"}).
+				AddRow(mediaID, ownerID, "image", "webp", sql.NullInt32{Valid: true, Int32: 1920}, sql.NullInt32{Valid: true, Int32: 1080}, time.Now(), nil),
 		)
 
 	err = svc.DeleteMedia(context.Background(), userID, mediaID)
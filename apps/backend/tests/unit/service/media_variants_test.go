@@ -0,0 +1,101 @@
+package service
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"backend/internal/repository"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaObjectKeys_IncludesRenditions(t *testing.T) {
+	id := uuid.New()
+	keys := service.MediaObjectKeys(id.String(), "webp")
+	assert.Equal(t, []string{
+		id.String() + "/image.webp",
+		id.String() + "/image_320.webp",
+		id.String() + "/image_640.webp",
+		id.String() + "/image_1280.webp",
+	}, keys)
+}
+
+func serveImageWithVariants(t *testing.T, query string, variantSizes []int) (*httptest.ResponseRecorder, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	dir := t.TempDir()
+	id := uuid.New()
+	writeObject := func(name string) {
+		p := filepath.Join(dir, id.String(), name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeObject("image.webp")
+
+	mock.ExpectQuery(`-- name: GetMediaByID`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at", "blob_hash"}).
+			AddRow(id, uuid.New(), "image", "webp", 1920, 1080, time.Now(), nil))
+	mock.ExpectQuery(`-- name: IsMediaPublic`).
+		WillReturnRows(sqlmock.NewRows([]string{"is_public"}).AddRow(sql.NullBool{Valid: true, Bool: true}))
+	if variantSizes != nil {
+		rows := sqlmock.NewRows([]string{"media_id", "size", "width", "height"})
+		for _, size := range variantSizes {
+			writeObject("image_" + strconv.Itoa(size) + ".webp")
+			rows.AddRow(id, size, size, size*9/16)
+		}
+		mock.ExpectQuery(`-- name: ListMediaVariants`).WithArgs(id).WillReturnRows(rows)
+	}
+
+	svc := service.NewMediaService(repository.NewStore(db), dir, nil)
+	r := chi.NewRouter()
+	r.Get("/media/{mediaId}/image.webp", svc.ServeImage)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/"+id.String()+"/image.webp"+query, nil))
+	return rec, mock
+}
+
+func TestServeImage_SizePicksSmallestSufficientRendition(t *testing.T) {
+	rec, mock := serveImageWithVariants(t, "?size=400", []int{320, 640, 1280})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image_640.webp", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestServeImage_SizeAboveRenditionsServesOriginal(t *testing.T) {
+	rec, mock := serveImageWithVariants(t, "?size=1500", []int{320, 640, 1280})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image.webp", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestServeImage_SizeWithoutRenditionsServesOriginal(t *testing.T) {
+	rec, mock := serveImageWithVariants(t, "?size=100", []int{})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image.webp", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestServeImage_InvalidSize(t *testing.T) {
+	rec, _ := serveImageWithVariants(t, "?size=abc", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
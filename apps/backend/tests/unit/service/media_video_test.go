@@ -0,0 +1,90 @@
+package service
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backend/internal/repository"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaObjectKeys_Video(t *testing.T) {
+	id := uuid.New()
+	assert.Equal(t, []string{id.String() + "/video.mp4", id.String() + "/poster.webp"}, service.MediaObjectKeys(id.String(), "mp4"))
+	assert.Equal(t, service.PublicBaseURL()+"/media/"+id.String()+"/video.mp4", service.MediaImageURL(id, "mp4"))
+}
+
+// serveStoredMedia serves path for a public media row with the given ext,
+// whose files are created from files (name -> content).
+func serveStoredMedia(t *testing.T, ext, path string, files map[string]string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	dir := t.TempDir()
+	id := uuid.New()
+	for name, content := range files {
+		p := filepath.Join(dir, id.String(), name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mock.ExpectQuery(`-- name: GetMediaByID`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "ext", "width", "height", "created_at", "blob_hash"}).
+			AddRow(id, uuid.New(), "video", ext, 1280, 720, time.Now(), nil))
+	mock.ExpectQuery(`-- name: IsMediaPublic`).
+		WillReturnRows(sqlmock.NewRows([]string{"is_public"}).AddRow(sql.NullBool{Valid: true, Bool: true}))
+
+	svc := service.NewMediaService(repository.NewStore(db), dir, nil)
+	r := chi.NewRouter()
+	r.Get("/media/{mediaId}/video.mp4", svc.ServeImage)
+	r.Get("/media/{mediaId}/poster.webp", svc.ServePoster)
+	req := httptest.NewRequest(http.MethodGet, "/media/"+id.String()+"/"+path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServeImage_VideoSupportsRange(t *testing.T) {
+	rec := serveStoredMedia(t, "mp4", "video.mp4",
+		map[string]string{"video.mp4": "0123456789"},
+		http.Header{"Range": {"bytes=2-5"}})
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "2345", rec.Body.String())
+	assert.Equal(t, "video/mp4", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "bytes 2-5/10", rec.Header().Get("Content-Range"))
+}
+
+func TestServePoster(t *testing.T) {
+	rec := serveStoredMedia(t, "mp4", "poster.webp",
+		map[string]string{"video.mp4": "video", "poster.webp": "poster"}, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "poster", rec.Body.String())
+	assert.Equal(t, "image/webp", rec.Header().Get("Content-Type"))
+}
+
+func TestServePoster_NotFoundForImages(t *testing.T) {
+	rec := serveStoredMedia(t, "webp", "poster.webp",
+		map[string]string{"image.webp": "image"}, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
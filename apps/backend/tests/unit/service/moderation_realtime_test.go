@@ -0,0 +1,78 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"backend/internal/realtime"
+	"backend/internal/service"
+	"backend/internal/service/admin"
+	"backend/internal/service/moderation"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestModerationDeleteMedia_AddressesUnattachedMediaToOwner(t *testing.T) {
+	for _, onVisiblePost := range []bool{false, true} {
+		store, mock, cleanup := newMockStore(t)
+
+		publisher := &chanPublisher{events: make(chan realtime.Event, 1)}
+		svc := moderation.NewMediaServiceWithPublisher(store, moderation.NewLogsService(store), publisher)
+		mediaID, ownerID := uuid.New(), uuid.New()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`-- name: AdminDeleteMedia`).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "on_visible_post"}).AddRow(ownerID, onVisiblePost))
+		mock.ExpectQuery(`-- name: EnqueueRealtimeEvent`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+		mock.ExpectCommit()
+		mock.ExpectExec(`DELETE FROM realtime_outbox`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO moderation_logs`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "admin_user_id", "action", "target_type", "target_id", "details", "created_at"}).
+				AddRow(uuid.New(), uuid.New(), "delete_media", "media", mediaID.String(), []byte(`{}`), time.Now()))
+
+		if err := svc.DeleteMedia(context.Background(), mediaID, uuid.New(), ""); err != nil {
+			t.Fatalf("DeleteMedia: %v", err)
+		}
+		event := <-publisher.events
+		if event.Type != realtime.EventMediaDeleted || event.MediaId == nil || *event.MediaId != mediaID {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("unmet expectations: %v", err)
+		}
+		if onVisiblePost {
+			if event.UserId != nil {
+				t.Fatalf("media on a visible post: event addressed to %s, want the timeline", *event.UserId)
+			}
+		} else if event.UserId == nil || *event.UserId != ownerID {
+			t.Fatalf("unattached media: event addressed to %v, want owner %s", event.UserId, ownerID)
+		}
+		cleanup()
+	}
+}
+
+func TestAdminProfileDelete_MissingUserIsNotFound(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+
+	svc := admin.NewProfileServiceWithPublisher(store, moderation.NewLogsService(store), &chanPublisher{events: make(chan realtime.Event, 1)})
+	mock.ExpectBegin()
+	mock.ExpectExec(`-- name: AdminDeleteUserBio`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`-- name: GetUserByID`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	err := svc.DeleteUserBio(context.Background(), uuid.New(), uuid.New(), "")
+	var serr *service.Error
+	if !errors.As(err, &serr) || serr.Status != http.StatusNotFound {
+		t.Fatalf("DeleteUserBio() error = %v, want 404", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"backend/internal/auth"
+	"backend/internal/repository"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const testCodeVerifier = "dBjftJeZ4CVP-mJ92K1pB8Tk7XqRt0aQzWfG5hYc3vLs"
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func newOAuthServiceWithMock(t *testing.T, tm *auth.TokenManager) (*service.OAuthService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return service.NewOAuthService(repository.NewStore(db), tm, nil, service.OAuthServiceOptions{}), mock
+}
+
+func oauthClientRows(id string, secretHash []byte, redirect string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "name", "secret_hash", "redirect_uris", "allowed_scopes", "created_by", "created_at", "disabled_at"}).
+		AddRow(id, "Wiki", secretHash, pq.StringArray{redirect}, "openid profile read", nil, time.Now(), nil)
+}
+
+func expectOAuthCode(mock sqlmock.Sqlmock, clientID string, userID uuid.UUID, redirect, scope string) {
+	mock.ExpectQuery(`-- name: ConsumeOAuthAuthorizationCode`).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "user_id", "redirect_uri", "scope", "code_challenge", "nonce"}).
+			AddRow(clientID, userID, redirect, scope, pkceChallenge(testCodeVerifier), "n-123"))
+}
+
+func TestOAuthService_Exchange_IssuesAccessAndIDToken(t *testing.T) {
+	t.Setenv("PUBLIC_BASE_URL", "https://ciel.example")
+	tm := auth.NewTokenManager([]byte("secret"), time.Minute)
+	svc, mock := newOAuthServiceWithMock(t, tm)
+	userID := uuid.New()
+	redirect := "https://wiki.example/callback"
+
+	mock.ExpectQuery(`-- name: GetOAuthClient`).WithArgs("ciel_wiki").WillReturnRows(oauthClientRows("ciel_wiki", nil, redirect))
+	expectOAuthCode(mock, "ciel_wiki", userID, redirect, "openid profile")
+	mock.ExpectQuery(`-- name: GetUserByID`).WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "display_name", "bio", "avatar_media_id", "created_at", "terms_version", "privacy_version", "terms_accepted_at", "privacy_accepted_at", "avatar_ext"}).
+			AddRow(userID, "alice", "Alice A.", nil, nil, time.Now(), 1, 1, nil, nil, nil))
+	mock.ExpectExec(`-- name: CreateOAuthAccessToken`).
+		WithArgs(sqlmock.AnyArg(), "ciel_wiki", userID, "openid profile", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	resp, err := svc.Exchange(context.Background(), service.OAuthTokenRequest{
+		GrantType:    "authorization_code",
+		Code:         "the-code",
+		RedirectURI:  redirect,
+		ClientID:     "ciel_wiki",
+		CodeVerifier: testCodeVerifier,
+	})
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if resp.TokenType != "Bearer" || resp.Scope != "openid profile" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	user, grant, err := tm.ParseOAuth(resp.AccessToken)
+	if err != nil {
+		t.Fatalf("ParseOAuth: %v", err)
+	}
+	if user.ID != userID || grant.ClientID != "ciel_wiki" || len(grant.Scopes) != 2 {
+		t.Fatalf("unexpected grant: %+v %+v", user, grant)
+	}
+
+	if resp.IdToken == nil {
+		t.Fatalf("expected id token")
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(*resp.IdToken, claims, func(*jwt.Token) (interface{}, error) { return []byte("secret"), nil }); err != nil {
+		t.Fatalf("parse id token: %v", err)
+	}
+	aud, _ := claims.GetAudience()
+	if claims["iss"] != "https://ciel.example" || claims["sub"] != userID.String() || len(aud) != 1 || aud[0] != "ciel_wiki" {
+		t.Fatalf("unexpected id token claims: %v", claims)
+	}
+	if claims["nonce"] != "n-123" || claims["preferred_username"] != "alice" || claims["name"] != "Alice A." {
+		t.Fatalf("unexpected id token profile claims: %v", claims)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestOAuthService_Exchange_WrongVerifierRejected(t *testing.T) {
+	svc, mock := newOAuthServiceWithMock(t, auth.NewTokenManager([]byte("secret"), time.Minute))
+	redirect := "https://wiki.example/callback"
+
+	mock.ExpectQuery(`-- name: GetOAuthClient`).WillReturnRows(oauthClientRows("ciel_wiki", nil, redirect))
+	expectOAuthCode(mock, "ciel_wiki", uuid.New(), redirect, "openid")
+
+	_, err := svc.Exchange(context.Background(), service.OAuthTokenRequest{
+		GrantType:    "authorization_code",
+		Code:         "the-code",
+		RedirectURI:  redirect,
+		ClientID:     "ciel_wiki",
+		CodeVerifier: "wrong-verifier-wrong-verifier-wrong-verifier-0",
+	})
+	var se *service.Error
+	if !errors.As(err, &se) || se.Code != "invalid_grant" {
+		t.Fatalf("expected invalid_grant, got %v", err)
+	}
+}
+
+func TestOAuthService_Exchange_ConfidentialClientRequiresSecret(t *testing.T) {
+	svc, mock := newOAuthServiceWithMock(t, auth.NewTokenManager([]byte("secret"), time.Minute))
+	hash := sha256.Sum256([]byte("correct-secret"))
+
+	mock.ExpectQuery(`-- name: GetOAuthClient`).WillReturnRows(oauthClientRows("ciel_bot", hash[:], "https://bot.example/cb"))
+
+	_, err := svc.Exchange(context.Background(), service.OAuthTokenRequest{
+		GrantType:    "authorization_code",
+		Code:         "the-code",
+		ClientID:     "ciel_bot",
+		ClientSecret: "wrong-secret",
+		CodeVerifier: testCodeVerifier,
+	})
+	var se *service.Error
+	if !errors.As(err, &se) || se.Code != "invalid_client" || se.Status != http.StatusUnauthorized {
+		t.Fatalf("expected invalid_client, got %v", err)
+	}
+}
+
+func TestOAuthService_Authorize_RejectsUnregisteredRedirect(t *testing.T) {
+	svc, mock := newOAuthServiceWithMock(t, auth.NewTokenManager([]byte("secret"), time.Minute))
+	mock.ExpectQuery(`-- name: GetOAuthClient`).WillReturnRows(oauthClientRows("ciel_wiki", nil, "https://wiki.example/callback"))
+
+	_, err := svc.Authorize(context.Background(), auth.User{ID: uuid.New(), Username: "alice"}, service.AuthorizeRequest{
+		ClientID:            "ciel_wiki",
+		RedirectURI:         "https://evil.example/callback",
+		ResponseType:        "code",
+		Scope:               "openid",
+		CodeChallenge:       pkceChallenge(testCodeVerifier),
+		CodeChallengeMethod: "S256",
+	}, true)
+	var se *service.Error
+	if !errors.As(err, &se) || se.Code != "invalid_redirect_uri" {
+		t.Fatalf("expected invalid_redirect_uri, got %v", err)
+	}
+}
+
+func TestOAuthService_Authorize_DenyRedirectsWithError(t *testing.T) {
+	t.Setenv("PUBLIC_BASE_URL", "https://ciel.example")
+	svc, mock := newOAuthServiceWithMock(t, auth.NewTokenManager([]byte("secret"), time.Minute))
+	mock.ExpectQuery(`-- name: GetOAuthClient`).WillReturnRows(oauthClientRows("ciel_wiki", nil, "https://wiki.example/callback"))
+
+	target, err := svc.Authorize(context.Background(), auth.User{ID: uuid.New(), Username: "alice"}, service.AuthorizeRequest{
+		ClientID:            "ciel_wiki",
+		RedirectURI:         "https://wiki.example/callback",
+		ResponseType:        "code",
+		Scope:               "openid",
+		State:               "xyz",
+		CodeChallenge:       pkceChallenge(testCodeVerifier),
+		CodeChallengeMethod: "S256",
+	}, false)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	u, _ := url.Parse(target)
+	q := u.Query()
+	if u.Host != "wiki.example" || q.Get("error") != "access_denied" || q.Get("state") != "xyz" || q.Get("code") != "" {
+		t.Fatalf("unexpected redirect: %s", target)
+	}
+}
+
+func TestOAuthService_Authorize_UnknownScopeRejected(t *testing.T) {
+	svc, mock := newOAuthServiceWithMock(t, auth.NewTokenManager([]byte("secret"), time.Minute))
+	mock.ExpectQuery(`-- name: GetOAuthClient`).WillReturnRows(oauthClientRows("ciel_wiki", nil, "https://wiki.example/callback"))
+
+	_, err := svc.AuthorizeInfo(context.Background(), auth.User{ID: uuid.New(), Username: "alice"}, service.AuthorizeRequest{
+		ClientID:            "ciel_wiki",
+		RedirectURI:         "https://wiki.example/callback",
+		ResponseType:        "code",
+		Scope:               "openid posts_create",
+		CodeChallenge:       pkceChallenge(testCodeVerifier),
+		CodeChallengeMethod: "S256",
+	})
+	var se *service.Error
+	if !errors.As(err, &se) || se.Code != "invalid_scope" {
+		t.Fatalf("expected invalid_scope (not allowed for client), got %v", err)
+	}
+}
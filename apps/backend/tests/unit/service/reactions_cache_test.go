@@ -124,9 +124,9 @@ func TestReactionsService_Add_UpdatesCache(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
 	mock.ExpectQuery(`INSERT INTO post_reaction_counts`).WithArgs(postID, "👍").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
-	mock.ExpectCommit()
 	expectGetPostWithAuthor(mock, postID, userID, created, userCreated)
 	expectListReactionCountsWithUserStatus(mock, postID, userID, "👍", 2, true)
+	mock.ExpectCommit()
 
 	user := auth.User{ID: userID, Username: "alice"}
 	if _, err := svc.Add(context.Background(), user, postID, api.ReactRequest{Emoji: api.Emoji("👍")}); err != nil {
@@ -177,9 +177,9 @@ func TestReactionsService_Remove_UpdatesCache(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
 	mock.ExpectQuery(`UPDATE post_reaction_counts`).WithArgs(postID, "👍").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
-	mock.ExpectCommit()
 	expectGetPostWithAuthor(mock, postID, userID, created, userCreated)
 	expectListReactionCountsWithUserStatus(mock, postID, userID, "👍", 1, false)
+	mock.ExpectCommit()
 
 	user := auth.User{ID: userID, Username: "alice"}
 	if _, err := svc.Remove(context.Background(), user, postID, api.Emoji("👍")); err != nil {
@@ -0,0 +1,137 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/realtime"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+// chanPublisher reports published events on a channel, or fails with err.
+type chanPublisher struct {
+	events chan realtime.Event
+	err    error
+}
+
+func (p *chanPublisher) Publish(_ context.Context, event realtime.Event) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.events <- event
+	return nil
+}
+
+func TestRealtimeOutbox_PublishKeepsFailedEventsForRelay(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+
+	outbox := service.NewRealtimeOutbox(store, &chanPublisher{err: errors.New("redis down")})
+	postID := api.PostId(uuid.New())
+	outbox.Publish(context.Background(), service.OutboxEvent{
+		ID:    uuid.New(),
+		Event: realtime.Event{Type: realtime.EventPostDeleted, PostId: &postID},
+	})
+
+	// No DELETE is expected: the row stays in the outbox.
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestRealtimeOutbox_RunRelaysClaimedEvents(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+
+	publisher := &chanPublisher{events: make(chan realtime.Event, 1)}
+	outbox := service.NewRealtimeOutbox(store, publisher)
+
+	rowID := uuid.New()
+	postID := api.PostId(uuid.New())
+	payload, err := json.Marshal(realtime.Event{Type: realtime.EventPostDeleted, PostId: &postID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(`UPDATE realtime_outbox o`).WithArgs(30, 5, 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload", "attempts", "created_at"}).
+			AddRow(rowID, payload, 1, time.Now().Add(-time.Minute)))
+	mock.ExpectExec(`DELETE FROM realtime_outbox`).WithArgs(rowID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		outbox.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case event := <-publisher.events:
+		if event.Type != realtime.EventPostDeleted || event.PostId == nil || *event.PostId != postID {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for relay")
+	}
+	// Stop before the next poll.
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestRealtimeOutbox_RunReleasesUntriedEventsOnFailure(t *testing.T) {
+	store, mock, cleanup := newMockStore(t)
+	defer cleanup()
+
+	outbox := service.NewRealtimeOutbox(store, &chanPublisher{err: errors.New("redis down")})
+
+	rows := sqlmock.NewRows([]string{"id", "payload", "attempts", "created_at"})
+	ids := make([]uuid.UUID, 3)
+	created := time.Now().Add(-time.Minute)
+	for i := range ids {
+		ids[i] = uuid.New()
+		postID := api.PostId(uuid.New())
+		payload, err := json.Marshal(realtime.Event{Type: realtime.EventPostDeleted, PostId: &postID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.AddRow(ids[i], payload, 0, created.Add(time.Duration(i)*time.Second))
+	}
+	mock.ExpectQuery(`UPDATE realtime_outbox o`).WithArgs(30, 5, 100).WillReturnRows(rows)
+	// Only the first event was tried, so only it counts an attempt; the
+	// others go back to the outbox without waiting for their lease.
+	mock.ExpectExec(`SET attempts = attempts \+ 1`).WithArgs(ids[0], "redis down").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SET locked_until = NULL`).WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		outbox.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
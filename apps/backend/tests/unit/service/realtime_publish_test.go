@@ -41,12 +41,14 @@ func TestPostsService_Create_PublishesEvent(t *testing.T) {
 		WithArgs(userID, "hello").
 		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "deleted_at"}).
 			AddRow(postID, userID, "hello", created, sql.NullTime{Valid: false}))
-	mock.ExpectCommit()
 	mock.ExpectQuery(`SELECT\s+p.id,`).WithArgs(postID).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "deleted_at", "username", "display_name", "bio", "avatar_media_id", "user_created_at", "avatar_ext"}).
 			AddRow(postID, userID, "hello", created, sql.NullTime{Valid: false}, "alice", sql.NullString{}, sql.NullString{}, uuid.NullUUID{}, userCreated, sql.NullString{}))
 	mock.ExpectQuery(`SELECT\s+pm.post_id,`).WithArgs(postID).
 		WillReturnRows(sqlmock.NewRows([]string{"post_id", "media_id", "type", "ext", "width", "height", "created_at", "sort_order"}))
+	outboxID := expectOutboxRecord(mock)
+	mock.ExpectCommit()
+	expectOutboxDelete(mock, outboxID)
 
 	user := auth.User{ID: userID, Username: "alice"}
 	content := "hello"
@@ -77,8 +79,12 @@ func TestPostsService_Delete_PublishesEvent(t *testing.T) {
 
 	mock.ExpectQuery(`SELECT user_id`).WithArgs(postID).
 		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
+	mock.ExpectBegin()
 	mock.ExpectQuery(`UPDATE posts`).WithArgs(postID, userID).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(postID, deleted))
+	outboxID := expectOutboxRecord(mock)
+	mock.ExpectCommit()
+	expectOutboxDelete(mock, outboxID)
 
 	user := auth.User{ID: userID, Username: "alice"}
 	if err := svc.Delete(context.Background(), user, postID); err != nil {
@@ -113,9 +119,11 @@ func TestReactionsService_Add_PublishesEvent(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
 	mock.ExpectQuery(`INSERT INTO post_reaction_counts`).WithArgs(postID, "👍").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
-	mock.ExpectCommit()
 	expectGetPostWithAuthor(mock, postID, userID, created, userCreated)
 	expectListReactionCountsWithUserStatus(mock, postID, userID, "👍", 1, true)
+	outboxID := expectOutboxRecord(mock)
+	mock.ExpectCommit()
+	expectOutboxDelete(mock, outboxID)
 
 	user := auth.User{ID: userID, Username: "alice"}
 	if _, err := svc.Add(context.Background(), user, postID, api.ReactRequest{Emoji: api.Emoji("👍")}); err != nil {
@@ -149,9 +157,11 @@ func TestReactionsService_Remove_PublishesEvent(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID))
 	mock.ExpectQuery(`UPDATE post_reaction_counts`).WithArgs(postID, "👍").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
-	mock.ExpectCommit()
 	expectGetPostWithAuthor(mock, postID, userID, created, userCreated)
 	expectListReactionCountsWithUserStatus(mock, postID, userID, "👍", 1, false)
+	outboxID := expectOutboxRecord(mock)
+	mock.ExpectCommit()
+	expectOutboxDelete(mock, outboxID)
 
 	user := auth.User{ID: userID, Username: "alice"}
 	if _, err := svc.Remove(context.Background(), user, postID, api.Emoji("👍")); err != nil {
@@ -168,6 +178,22 @@ func TestReactionsService_Remove_PublishesEvent(t *testing.T) {
 	}
 }
 
+// expectOutboxRecord expects a realtime event to be written to the outbox
+// and returns the row ID.
+func expectOutboxRecord(mock sqlmock.Sqlmock) uuid.UUID {
+	id := uuid.New()
+	mock.ExpectQuery(`INSERT INTO realtime_outbox`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+	return id
+}
+
+// expectOutboxDelete expects a published event to be removed from the
+// outbox.
+func expectOutboxDelete(mock sqlmock.Sqlmock, id uuid.UUID) {
+	mock.ExpectExec(`DELETE FROM realtime_outbox`).WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
 func expectGetPostWithAuthor(mock sqlmock.Sqlmock, postID api.PostId, userID uuid.UUID, created time.Time, userCreated time.Time) {
 	mock.ExpectQuery(`SELECT\s+p.id,`).WithArgs(postID).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "content", "created_at", "deleted_at", "username", "display_name", "bio", "avatar_media_id", "user_created_at", "avatar_ext"}).
@@ -0,0 +1,223 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"backend/internal/api"
+	"backend/internal/auth"
+	"backend/internal/geoip"
+	"backend/internal/logging"
+	"backend/internal/repository"
+	"backend/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+type stubLocator map[string]geoip.Location
+
+func (s stubLocator) Lookup(ip net.IP) (geoip.Location, bool) {
+	loc, ok := s[ip.String()]
+	return loc, ok
+}
+
+func newSecurityEventsWithMock(t *testing.T, opts service.SecurityEventsServiceOptions) (*service.SecurityEventsService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return service.NewSecurityEventsService(repository.NewStore(db), opts), mock
+}
+
+var securityEventColumns = []string{"id", "user_id", "actor_user_id", "event_type", "outcome", "ip_address", "user_agent", "country", "city", "details", "created_at"}
+
+func TestSecurityEvents_RecordCapturesRequestContext(t *testing.T) {
+	svc, mock := newSecurityEventsWithMock(t, service.SecurityEventsServiceOptions{
+		GeoIP: stubLocator{"203.0.113.5": {Country: "JP", City: "Tokyo"}},
+	})
+	userID := uuid.New()
+	adminID := uuid.New()
+
+	ctx := logging.WithRequestContext(context.Background(), "req-1", "203.0.113.5", "PUT /api/v1/admin/users/x/roles")
+	ctx = logging.WithUserAgent(ctx, "Mozilla/5.0")
+
+	mock.ExpectExec(`-- name: CreateSecurityEvent`).
+		WithArgs(userID, adminID, service.SecurityEventRoleChange, service.SecurityOutcomeSuccess,
+			sqlmock.AnyArg(), "Mozilla/5.0", "JP", "Tokyo", []byte(`{"roles":["admin"]}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	svc.Record(ctx, service.SecurityEvent{
+		UserID:  userID,
+		ActorID: adminID,
+		Type:    service.SecurityEventRoleChange,
+		Outcome: service.SecurityOutcomeSuccess,
+		Details: map[string]any{"roles": []string{"admin"}},
+	})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestSecurityEvents_RecordWithoutRequestContext(t *testing.T) {
+	svc, mock := newSecurityEventsWithMock(t, service.SecurityEventsServiceOptions{})
+	userID := uuid.New()
+
+	mock.ExpectExec(`-- name: CreateSecurityEvent`).
+		WithArgs(userID, nil, service.SecurityEventLogin, service.SecurityOutcomeFailure, nil, nil, nil, nil, []byte(`{}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	svc.Record(context.Background(), service.SecurityEvent{UserID: userID, Type: service.SecurityEventLogin, Outcome: service.SecurityOutcomeFailure})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestSecurityEvents_NilServiceIsNoop(t *testing.T) {
+	var svc *service.SecurityEventsService
+	svc.Record(context.Background(), service.SecurityEvent{UserID: uuid.New(), Type: service.SecurityEventLogin})
+}
+
+func TestSecurityEvents_ListPaginates(t *testing.T) {
+	svc, mock := newSecurityEventsWithMock(t, service.SecurityEventsServiceOptions{})
+	userID := uuid.New()
+	created := time.Date(2026, 10, 18, 12, 0, 0, 123456000, time.UTC)
+	first, second := uuid.New(), uuid.New()
+
+	mock.ExpectQuery(`-- name: ListSecurityEventsByUser`).
+		WithArgs(userID, nil, nil, 2).
+		WillReturnRows(sqlmock.NewRows(securityEventColumns).
+			AddRow(first, userID, nil, "login", "success", "203.0.113.5/32", "Mozilla/5.0", "JP", nil, []byte(`{}`), created).
+			AddRow(second, userID, nil, "stepup", "failure", nil, nil, nil, nil, []byte(`{"reason":"invalid_proof"}`), created))
+
+	page, err := svc.List(context.Background(), userID, 2, nil)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(page.Items) != 2 || page.NextCursor == nil {
+		t.Fatalf("expected 2 items and a cursor, got %d items, cursor %v", len(page.Items), page.NextCursor)
+	}
+	if got := page.Items[0]; got.Ip == nil || *got.Ip != "203.0.113.5" || got.Country == nil || *got.Country != "JP" || got.City != nil {
+		t.Fatalf("unexpected first item: %+v", got)
+	}
+	if got := page.Items[1]; got.Details["reason"] != "invalid_proof" || got.Ip != nil {
+		t.Fatalf("unexpected second item: %+v", got)
+	}
+
+	mock.ExpectQuery(`-- name: ListSecurityEventsByUser`).
+		WithArgs(userID, created, second, 2).
+		WillReturnRows(sqlmock.NewRows(securityEventColumns))
+
+	page, err = svc.List(context.Background(), userID, 2, page.NextCursor)
+	if err != nil {
+		t.Fatalf("List with cursor: %v", err)
+	}
+	if len(page.Items) != 0 || page.NextCursor != nil {
+		t.Fatalf("expected empty last page, got %+v", page)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestSecurityEvents_ListRejectsInvalidCursor(t *testing.T) {
+	svc, _ := newSecurityEventsWithMock(t, service.SecurityEventsServiceOptions{})
+	bad := "not-a-cursor"
+	_, err := svc.List(context.Background(), uuid.New(), 10, &bad)
+	if se, ok := err.(*service.Error); !ok || se.Status != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %v", err)
+	}
+}
+
+func TestSecurityEvents_PurgeUsesRetention(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	svc, mock := newSecurityEventsWithMock(t, service.SecurityEventsServiceOptions{
+		Retention: 30 * 24 * time.Hour,
+		Now:       func() time.Time { return now },
+	})
+
+	mock.ExpectExec(`-- name: DeleteSecurityEventsBefore`).
+		WithArgs(now.Add(-30 * 24 * time.Hour)).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+
+	n, err := svc.Purge(context.Background())
+	if err != nil || n != 7 {
+		t.Fatalf("Purge = %d, %v", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func expectSecurityEvent(mock sqlmock.Sqlmock, userID uuid.UUID, eventType, outcome string) {
+	mock.ExpectExec(`-- name: CreateSecurityEvent`).
+		WithArgs(userID, sqlmock.AnyArg(), eventType, outcome, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestLoginFinish_RecordsSessionCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	store := repository.NewStore(db)
+	sessions := auth.NewMemoryLoginSessionStore()
+	svc := service.NewAuthServiceWithOptions(store, auth.NewTokenManager([]byte("secret"), time.Minute), service.AuthServiceOptions{LoginSessionStore: sessions})
+	svc.SetSecurityEventsService(service.NewSecurityEventsService(store, service.SecurityEventsServiceOptions{}))
+
+	userID := uuid.New()
+	salt := []byte("0123456789abcdef")
+	iterations := 1000
+	storedKey, serverKey := auth.DeriveVerifier("password123", salt, iterations)
+	saltB64 := base64.StdEncoding.EncodeToString(salt)
+	_ = sessions.Put(auth.LoginSession{SessionID: "sid", Username: "alice", ClientNonce: "c", ServerNonce: "s", SaltB64: saltB64, Iterations: iterations, ExpiresAtUTC: time.Now().UTC().Add(time.Minute)})
+	authMessage := auth.BuildAuthMessage("alice", "c", "s", saltB64, iterations, "cs")
+
+	mock.ExpectQuery(`-- name: GetAuthByUsername`).WithArgs("alice").WillReturnRows(
+		sqlmock.NewRows([]string{"user_id", "username", "display_name", "bio", "avatar_media_id", "created_at", "terms_version", "privacy_version", "terms_accepted_at", "privacy_accepted_at", "avatar_ext", "salt", "iterations", "stored_key", "server_key"}).
+			AddRow(userID, "alice", sql.NullString{}, sql.NullString{}, uuid.NullUUID{}, time.Now(), sql.NullInt32{Valid: true, Int32: 1}, sql.NullInt32{Valid: true, Int32: 1}, sql.NullTime{}, sql.NullTime{}, sql.NullString{}, salt, int32(iterations), storedKey, serverKey),
+	)
+	expectSecurityEvent(mock, userID, service.SecurityEventLogin, service.SecurityOutcomeSuccess)
+	expectSecurityEvent(mock, userID, service.SecurityEventSessionCreate, service.SecurityOutcomeSuccess)
+
+	if _, err := svc.LoginFinish(context.Background(), api.LoginFinishRequest{
+		LoginSessionId:   "sid",
+		ClientFinalNonce: "cs",
+		ClientProof:      computeClientProofB64ForTest(t, "password123", salt, iterations, storedKey, authMessage),
+	}); err != nil {
+		t.Fatalf("LoginFinish: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDeleteAccount_RecordsTokenRevocation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	store := repository.NewStore(db)
+	svc := service.NewAuthService(store, auth.NewTokenManager([]byte("secret"), time.Minute))
+	svc.SetSecurityEventsService(service.NewSecurityEventsService(store, service.SecurityEventsServiceOptions{}))
+
+	user := auth.User{ID: uuid.New(), Username: "alice"}
+	expectSecurityEvent(mock, user.ID, service.SecurityEventTokenRevocation, service.SecurityOutcomeSuccess)
+	mock.ExpectExec(`-- name: DeleteUserByID`).WithArgs(user.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := svc.DeleteAccount(context.Background(), user); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
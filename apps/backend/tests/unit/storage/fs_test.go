@@ -0,0 +1,173 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/storage"
+)
+
+func TestFileStore_PutGetStatDelete(t *testing.T) {
+	root := t.TempDir()
+	s := storage.NewFileStore(root)
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "abc/image.webp", strings.NewReader("hello"), 5, "image/webp"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "abc", "image.webp")); err != nil {
+		t.Fatalf("expected file on disk in MEDIA_DIR layout: %v", err)
+	}
+
+	rc, info, err := s.Get(ctx, "abc/image.webp")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	body, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(body) != "hello" || info.Size != 5 || info.ContentType != "image/webp" {
+		t.Fatalf("Get = %q, %+v", body, info)
+	}
+
+	if err := s.Delete(ctx, "abc/image.webp"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Stat(ctx, "abc/image.webp"); !errors.Is(err, storage.ErrNotExist) {
+		t.Fatalf("Stat after delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "abc")); !os.IsNotExist(err) {
+		t.Fatalf("expected empty media directory to be removed, got %v", err)
+	}
+	if err := s.Delete(ctx, "abc/image.webp"); err != nil {
+		t.Fatalf("deleting a missing object should succeed: %v", err)
+	}
+}
+
+func TestFileStore_PutSizeMismatchLeavesNoObject(t *testing.T) {
+	s := storage.NewFileStore(t.TempDir())
+	ctx := context.Background()
+	if err := s.Put(ctx, "a/image.webp", strings.NewReader("abc"), 10, ""); err == nil {
+		t.Fatalf("expected size mismatch error")
+	}
+	if _, err := s.Stat(ctx, "a/image.webp"); !errors.Is(err, storage.ErrNotExist) {
+		t.Fatalf("expected no partial object, got %v", err)
+	}
+}
+
+func TestFileStore_ETagIsContentDigest(t *testing.T) {
+	s := storage.NewFileStore(t.TempDir())
+	ctx := context.Background()
+	put := func(key, body string) {
+		t.Helper()
+		if err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), ""); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	put("a/image.webp", "hello")
+	put("b/image.webp", "hello")
+	infoA, err := s.Stat(ctx, "a/image.webp")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	infoB, _ := s.Stat(ctx, "b/image.webp")
+	if !strings.HasPrefix(infoA.ETag, `"`) || infoA.ETag != infoB.ETag {
+		t.Fatalf("same content should share a quoted ETag: %q vs %q", infoA.ETag, infoB.ETag)
+	}
+
+	// Get must hash the file and still return it from the start.
+	rc, getInfo, err := s.Get(ctx, "a/image.webp")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	body, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(body) != "hello" || getInfo.ETag != infoA.ETag {
+		t.Fatalf("Get = %q, ETag %q", body, getInfo.ETag)
+	}
+
+	put("a/image.webp", "world")
+	changed, _ := s.Stat(ctx, "a/image.webp")
+	if changed.ETag == infoA.ETag {
+		t.Fatalf("ETag did not change after overwrite")
+	}
+}
+
+func TestFileStore_List(t *testing.T) {
+	root := t.TempDir()
+	s := storage.NewFileStore(root)
+	ctx := context.Background()
+	for _, key := range []string{"a/image.webp", "a/poster.webp", "blobs/abc/image.webp"} {
+		if err := s.Put(ctx, key, strings.NewReader("hello"), 5, "image/webp"); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+	// Leftover temp file of an interrupted write.
+	if err := os.WriteFile(filepath.Join(root, "a", ".upload-123"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(prefix string) []string {
+		var keys []string
+		err := s.List(ctx, prefix, func(key string, info storage.ObjectInfo) error {
+			if info.Size != 5 {
+				t.Errorf("List size of %s = %d", key, info.Size)
+			}
+			keys = append(keys, key)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("List(%q): %v", prefix, err)
+		}
+		return keys
+	}
+	if got := strings.Join(list(""), ","); got != "a/image.webp,a/poster.webp,blobs/abc/image.webp" {
+		t.Fatalf("List all = %s", got)
+	}
+	if got := strings.Join(list("blobs/"), ","); got != "blobs/abc/image.webp" {
+		t.Fatalf("List blobs = %s", got)
+	}
+
+	empty := storage.NewFileStore(filepath.Join(root, "missing"))
+	if err := empty.List(ctx, "", func(string, storage.ObjectInfo) error { return errors.New("unexpected") }); err != nil {
+		t.Fatalf("List on missing root: %v", err)
+	}
+}
+
+func TestFileStore_RejectsInvalidKeys(t *testing.T) {
+	s := storage.NewFileStore(t.TempDir())
+	ctx := context.Background()
+	for _, key := range []string{"", "/etc/passwd", "../escape", "a/../../b", "a//b", `a\b`} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestFileStore_PresignUnsupported(t *testing.T) {
+	s := storage.NewFileStore(t.TempDir())
+	if _, err := s.PresignGet(context.Background(), "a/image.webp", time.Minute); !errors.Is(err, storage.ErrPresignUnsupported) {
+		t.Fatalf("expected ErrPresignUnsupported, got %v", err)
+	}
+}
+
+func TestCopy_BetweenStores(t *testing.T) {
+	ctx := context.Background()
+	src := storage.NewFileStore(t.TempDir())
+	dst := storage.NewFileStore(t.TempDir())
+	if err := src.Put(ctx, "m/image.webp", strings.NewReader("data"), 4, "image/webp"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := storage.Copy(ctx, dst, src, "m/image.webp"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	if info, err := dst.Stat(ctx, "m/image.webp"); err != nil || info.Size != 4 {
+		t.Fatalf("Stat copy = %+v, %v", info, err)
+	}
+}
@@ -218,6 +218,14 @@ export function createApiClient(options: ApiClientOptions = {}) {
 		userByUsername: (username: string) =>
 			request<components['schemas']['User']>('GET', `/users/${encodeURIComponent(username)}`),
 
+		userPresence: (username: string) =>
+			request<components['schemas']['Presence']>('GET', `/users/${encodeURIComponent(username)}/presence`),
+
+		mePresence: () => request<components['schemas']['PresenceSettings']>('GET', '/me/presence'),
+
+		updateMePresence: (body: components['schemas']['PresenceSettings']) =>
+			request<components['schemas']['PresenceSettings']>('PUT', '/me/presence', { body }),
+
 		userPosts: (username: string, params?: { limit?: number; cursor?: string | null }) => {
 			const qs = new URLSearchParams();
 			if (params?.limit !== undefined) qs.set('limit', String(params.limit));
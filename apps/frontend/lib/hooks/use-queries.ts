@@ -16,6 +16,7 @@ export const queryKeys = {
 	post: (id: string) => ['post', id] as const,
 	user: (username: string) => ['user', username] as const,
 	userPosts: (username: string) => ['userPosts', username] as const,
+	presence: (userId: string) => ['presence', userId] as const,
 	reactions: (postId: string) => ['reactions', postId] as const,
 	agreementVersions: ['agreementVersions'] as const,
 	latestAgreement: (type: 'terms' | 'privacy', language: string) =>
@@ -128,6 +129,23 @@ export function useUser(username: string | undefined) {
 	});
 }
 
+// Presence of a user; the realtime provider keeps it current while the
+// connection is subscribed to the user's topic.
+export function usePresence(user: { id: string; username: string } | undefined) {
+	const api = useApi();
+
+	return useQuery({
+		queryKey: user ? queryKeys.presence(user.id) : ['presence', 'null'],
+		queryFn: async () => {
+			if (!user) throw new Error(ERROR_CODES.USERNAME_REQUIRED);
+			const result = await api.userPresence(user.username);
+			if (!result.ok) throw new Error(result.errorText);
+			return result.data;
+		},
+		enabled: !!user,
+	});
+}
+
 // User posts with infinite scroll
 export function useUserPosts(username: string | undefined, params?: { limit?: number }) {
 	const api = useApi();
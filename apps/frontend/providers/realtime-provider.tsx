@@ -11,12 +11,67 @@ import type { components } from '@/lib/api/api';
 
 type Post = components['schemas']['Post'];
 type PostId = components['schemas']['PostId'];
+type MediaId = components['schemas']['MediaId'];
+type User = components['schemas']['User'];
 type ReactionCounts = components['schemas']['ReactionCounts'];
+type Presence = components['schemas']['Presence'];
 
-type RealtimeEvent =
+type RealtimeEvent = { id?: string } & (
 	| { type: 'post_created'; post: Post }
 	| { type: 'post_deleted'; postId: PostId }
-	| { type: 'reaction_updated'; reactionCounts: ReactionCounts };
+	| { type: 'post_hidden'; postId: PostId }
+	| { type: 'post_unhidden'; post: Post }
+	| { type: 'reaction_updated'; reactionCounts: ReactionCounts }
+	| { type: 'media_deleted'; mediaId: MediaId }
+	| { type: 'user_updated'; user: User }
+	| { type: 'presence_updated'; presence: Presence }
+	| { type: 'typing'; typing: { userId: string; topic: string } }
+	| { type: 'resync_required' }
+);
+
+// Query keys whose data holds posts: infinite pages, lists or single posts.
+const postQueryRoots = new Set(['timeline', 'userPosts', 'post']);
+
+// mapCachedPosts applies update to every post in a cached payload and
+// returns the payload unchanged when no post changed.
+function mapCachedPosts(payload: unknown, update: (post: Post) => Post): unknown {
+	if (!payload || typeof payload !== 'object') {
+		return payload;
+	}
+	const mapItems = (items: Post[]) => {
+		let changed = false;
+		const next = items.map((item) => {
+			const updated = item ? update(item) : item;
+			changed ||= updated !== item;
+			return updated;
+		});
+		return changed ? next : items;
+	};
+	const typed = payload as { pages?: Array<{ items?: Post[] }>; items?: Post[]; id?: string; author?: unknown };
+	if (Array.isArray(typed.pages)) {
+		let changed = false;
+		const pages = typed.pages.map((page) => {
+			if (!page || !Array.isArray(page.items)) {
+				return page;
+			}
+			const items = mapItems(page.items);
+			if (items === page.items) {
+				return page;
+			}
+			changed = true;
+			return { ...page, items };
+		});
+		return changed ? { ...(typed as object), pages } : payload;
+	}
+	if (Array.isArray(typed.items)) {
+		const items = mapItems(typed.items);
+		return items === typed.items ? payload : { ...(typed as object), items };
+	}
+	if (typed.id && typed.author) {
+		return update(payload as Post);
+	}
+	return payload;
+}
 
 interface RealtimeProviderProps {
 	children: React.ReactNode;
@@ -25,9 +80,13 @@ interface RealtimeProviderProps {
 export function RealtimeProvider({ children }: RealtimeProviderProps) {
 	const queryClient = useQueryClient();
 	const isAuthenticated = useAtomValue(isAuthenticatedAtom);
+	const isAuthenticatedRef = useRef(isAuthenticated);
+	isAuthenticatedRef.current = isAuthenticated;
 	const wsRef = useRef<WebSocket | null>(null);
 	const reconnectTimeoutRef = useRef<NodeJS.Timeout | null>(null);
 	const reconnectAttemptsRef = useRef(0);
+	// ID of the last event received, used to resume after a reconnect
+	const lastEventIdRef = useRef<string | null>(null);
 	const inactivityDisconnectRef = useRef(false);
 	const [showInactivityAlert, setShowInactivityAlert] = useState(false);
 
@@ -103,6 +162,55 @@ export function RealtimeProvider({ children }: RealtimeProviderProps) {
 		);
 	}, [queryClient, removePostFromCache, removePostFromList]);
 
+	const updateCachedPosts = useCallback(
+		(update: (post: Post) => Post) => {
+			queryClient.setQueriesData(
+				{
+					predicate: (query) =>
+						Array.isArray(query.queryKey) && postQueryRoots.has(String(query.queryKey[0])),
+				},
+				(payload) => mapCachedPosts(payload, update)
+			);
+		},
+		[queryClient]
+	);
+
+	// Profile changes are patched into cached authors in place.
+	const handleUserUpdated = useCallback(
+		(user: User) => {
+			const patch = <T extends { id: string }>(cached: T): T =>
+				cached.id === user.id
+					? {
+							...cached,
+							username: user.username,
+							displayName: user.displayName,
+							bio: user.bio,
+							avatarUrl: user.avatarUrl,
+						}
+					: cached;
+			updateCachedPosts((post) => {
+				const author = patch(post.author);
+				return author === post.author ? post : { ...post, author };
+			});
+			queryClient.setQueriesData<User>(
+				{ predicate: (query) => Array.isArray(query.queryKey) && query.queryKey[0] === 'user' },
+				(cached) => (cached ? patch(cached) : cached)
+			);
+			queryClient.setQueryData<User>(queryKeys.me, (cached) => (cached ? patch(cached) : cached));
+		},
+		[queryClient, updateCachedPosts]
+	);
+
+	const handleMediaDeleted = useCallback(
+		(mediaId: MediaId) => {
+			updateCachedPosts((post) => {
+				const media = post.media.filter((item) => item.id !== mediaId);
+				return media.length === post.media.length ? post : { ...post, media };
+			});
+		},
+		[updateCachedPosts]
+	);
+
 	const handleReactionUpdated = useCallback((counts: ReactionCounts) => {
 		const adjustedReactionCounts: ReactionCounts = {
 			...counts,
@@ -119,24 +227,57 @@ export function RealtimeProvider({ children }: RealtimeProviderProps) {
 		(event: MessageEvent) => {
 			try {
 				const data: RealtimeEvent = JSON.parse(event.data);
+				if (data.id) {
+					lastEventIdRef.current = data.id;
+				}
 				switch (data.type) {
 					case 'post_created':
 						handlePostCreated();
 						break;
 
 					case 'post_deleted':
+					case 'post_hidden':
 						handlePostDeleted(data.postId);
 						break;
 
+					case 'post_unhidden':
+						handlePostCreated();
+						queryClient.invalidateQueries({ queryKey: queryKeys.post(data.post.id) });
+						break;
+
 					case 'reaction_updated':
 						handleReactionUpdated(data.reactionCounts);
 						break;
+
+					case 'media_deleted':
+						handleMediaDeleted(data.mediaId);
+						break;
+
+					case 'user_updated':
+						handleUserUpdated(data.user);
+						break;
+
+					case 'presence_updated':
+						queryClient.setQueryData(queryKeys.presence(data.presence.userId), data.presence);
+						break;
+
+					case 'resync_required':
+						// Missed events are no longer retained; refetch instead
+						handlePostCreated();
+						break;
 				}
 			} catch (err) {
 				console.error('Failed to parse WebSocket message:', err);
 			}
 		},
-		[handlePostCreated, handlePostDeleted, handleReactionUpdated]
+		[
+			queryClient,
+			handlePostCreated,
+			handlePostDeleted,
+			handleReactionUpdated,
+			handleMediaDeleted,
+			handleUserUpdated,
+		]
 	);
 
 	// Handle user inactivity - disconnect WebSocket and show alert
@@ -189,6 +330,13 @@ export function RealtimeProvider({ children }: RealtimeProviderProps) {
 
 			ws.onopen = () => {
 				reconnectAttemptsRef.current = 0;
+				if (lastEventIdRef.current) {
+					ws.send(JSON.stringify({ op: 'resume', lastEventId: lastEventIdRef.current }));
+				}
+				// Connections start online
+				if (isAuthenticatedRef.current && document.visibilityState === 'hidden') {
+					ws.send(JSON.stringify({ op: 'presence', status: 'away' }));
+				}
 			};
 
 			ws.onmessage = handleMessage;
@@ -219,6 +367,20 @@ export function RealtimeProvider({ children }: RealtimeProviderProps) {
 		}
 	}, [handleMessage]);
 
+	// Report the tab as away while it is hidden
+	useEffect(() => {
+		if (!isAuthenticated) return;
+		const handleVisibilityChange = () => {
+			const ws = wsRef.current;
+			if (ws && ws.readyState === WebSocket.OPEN) {
+				const status = document.visibilityState === 'hidden' ? 'away' : 'online';
+				ws.send(JSON.stringify({ op: 'presence', status }));
+			}
+		};
+		document.addEventListener('visibilitychange', handleVisibilityChange);
+		return () => document.removeEventListener('visibilitychange', handleVisibilityChange);
+	}, [isAuthenticated]);
+
 	useEffect(() => {
 		// Reset inactivity flag when reconnecting
 		inactivityDisconnectRef.current = false;